@@ -0,0 +1,227 @@
+package goja
+
+import (
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/google/pprof/profile"
+)
+
+type allocKind uint8
+
+const (
+	allocObject allocKind = iota
+	allocFunction
+	allocArray
+	allocString
+	allocArrayBuffer
+
+	allocKindCount
+)
+
+var allocKindNames = [allocKindCount]string{
+	allocObject:      "object",
+	allocFunction:    "function",
+	allocArray:       "array",
+	allocString:      "string",
+	allocArrayBuffer: "arraybuffer",
+}
+
+// Approximate sizes used to attribute the allocations.
+const (
+	allocObjectSize       = 128 // *Object, the object implementation and the properties map
+	allocValueSize        = 16  // an array element
+	allocStringHeaderSize = 16
+)
+
+const defaultAllocSampleRate = 512 * 1024
+
+// AllocProfileOptions configures an allocation profile started by Runtime.StartAllocProfile.
+type AllocProfileOptions struct {
+	// The average number of allocated bytes between the samples, similar to runtime.MemProfileRate. If zero,
+	// 512KiB is used. If 1, every allocation is recorded.
+	SampleRate int
+	// If true, the native (Go) functions, including the built-ins, are included into the stacks.
+	NativeFrames bool
+}
+
+// activeAllocProfiles is the number of the allocation profiles running in the process. The object allocations
+// (see objectAllocated) are only checked against the profiler of their Runtime if it's not zero, so that there is
+// no overhead when no profile is running.
+var activeAllocProfiles int32
+
+type allocProfiler struct {
+	buf  profBuffer
+	w    io.Writer
+	rate int64
+	// the number of bytes left until the next sample
+	next int64
+
+	// the labels with the allocation kind added, by the labels set by Runtime.SetProfileLabels
+	labels map[*profLabels]*[allocKindCount]*profLabels
+	frames [profMaxStackDepth]StackFrame
+}
+
+func (p *allocProfiler) nextSample() int64 {
+	if p.rate <= 1 {
+		return 0
+	}
+	// Exponentially distributed intervals produce a Poisson process, so that the probability of an allocation
+	// to be sampled is proportional to its size, regardless of the allocation pattern.
+	return int64(rand.ExpFloat64() * float64(p.rate))
+}
+
+func (p *allocProfiler) kindLabels(labels *profLabels, kind allocKind) *profLabels {
+	kl := p.labels[labels]
+	if kl == nil {
+		kl = new([allocKindCount]*profLabels)
+		if p.labels == nil {
+			p.labels = make(map[*profLabels]*[allocKindCount]*profLabels)
+		}
+		p.labels[labels] = kl
+	}
+	l := kl[kind]
+	if l == nil {
+		name := allocKindNames[kind]
+		l = &profLabels{
+			labels: map[string][]string{"kind": {name}},
+		}
+		if labels != nil {
+			for k, v := range labels.labels {
+				if k != "kind" {
+					l.labels[k] = v
+				}
+			}
+			l.key = labels.key
+		}
+		l.key += strconv.Quote("kind") + "=" + strconv.Quote(name) + ","
+		kl[kind] = l
+	}
+	return l
+}
+
+func (p *allocProfiler) allocated(vm *vm, kind allocKind, size int) {
+	p.next -= int64(size)
+	if p.next >= 0 {
+		return
+	}
+	p.next = p.nextSample()
+	count, bytes := int64(1), int64(size)
+	if p.rate > 1 {
+		// Scale the values to account for the allocations that were not sampled, the same way the Go runtime does.
+		scale := 1 / (1 - math.Exp(-float64(size)/float64(p.rate)))
+		count = int64(scale + 0.5)
+		bytes = int64(float64(size)*scale + 0.5)
+	}
+	frames := vm.r.CaptureCallStack(len(p.frames), p.frames[:0])
+	p.buf.addSample(frames, p.kindLabels(vm.profLabels, kind), []int64{count, bytes})
+}
+
+func (p *allocProfiler) profile() *profile.Profile {
+	pr := p.buf.build([]*profile.ValueType{
+		{Type: "alloc_objects", Unit: "count"},
+		{Type: "alloc_space", Unit: "bytes"},
+	})
+	pr.PeriodType = &profile.ValueType{Type: "space", Unit: "bytes"}
+	pr.Period = p.rate
+	pr.DefaultSampleType = "alloc_space"
+	return pr
+}
+
+// allocated records an allocation if the allocation profile is active.
+func (vm *vm) allocated(kind allocKind, size int) {
+	if p := vm.allocProf; p != nil {
+		p.allocated(vm, kind, size)
+	}
+}
+
+// objectAllocated records an allocation of the object if the allocation profile of its Runtime is active.
+// It's called for every object, so it's kept inlinable.
+func objectAllocated(o *baseObject) {
+	if atomic.LoadInt32(&activeAllocProfiles) != 0 {
+		profileObjectAllocation(o)
+	}
+}
+
+func profileObjectAllocation(o *baseObject) {
+	v := o.val
+	if v == nil || v.runtime == nil || v.runtime.vm == nil {
+		return
+	}
+	vm := v.runtime.vm
+	if vm.allocProf == nil {
+		return
+	}
+	switch o.class {
+	case classArray:
+		vm.allocated(allocArray, allocObjectSize)
+	case classFunction:
+		vm.allocated(allocFunction, allocObjectSize)
+	default:
+		vm.allocated(allocObject, allocObjectSize)
+	}
+}
+
+// stringAllocated records an allocation of a new string and returns the string.
+func (r *Runtime) stringAllocated(s String) String {
+	if p := r.vm.allocProf; p != nil {
+		size := allocStringHeaderSize + s.Length()
+		if _, ok := s.(asciiString); !ok {
+			size += s.Length()
+		}
+		p.allocated(r.vm, allocString, size)
+	}
+	return s
+}
+
+/*
+StartAllocProfile starts a sampling allocation profile of this Runtime (shared by all its realms). The allocations
+of objects, functions, arrays (including the growth of their storage), strings and ArrayBuffer contents are
+attributed to the JavaScript stack that caused them and the profile is written in the pprof format (with the
+'alloc_objects' and 'alloc_space' sample types, the same as the Go heap profiles) when StopAllocProfile is called,
+so it can be analysed using `go tool pprof`. The samples are labelled with the kind of the allocation ('kind') and
+with the labels set by SetProfileLabels.
+
+The sizes are estimates based on the sizes of the internal structures rather than the actual memory usage. Only
+the strings created by concatenation (the '+' operator and template literals), Array.prototype.join,
+String.prototype.repeat and JSON.stringify are tracked, other string operations are not recorded.
+
+Unlike StartProfile, it must be called from the goroutine running the Runtime (or while the Runtime is not running).
+It returns an error if the allocation profile is already active.
+*/
+func (r *Runtime) StartAllocProfile(w io.Writer, opts AllocProfileOptions) error {
+	if r.vm.allocProf != nil {
+		return errors.New("allocation profiler is already active")
+	}
+	rate := int64(opts.SampleRate)
+	if rate <= 0 {
+		rate = defaultAllocSampleRate
+	}
+	p := &allocProfiler{
+		w:    w,
+		rate: rate,
+	}
+	p.buf.nativeFrames = opts.NativeFrames
+	p.next = p.nextSample()
+	r.vm.allocProf = p
+	atomic.AddInt32(&activeAllocProfiles, 1)
+	return nil
+}
+
+/*
+StopAllocProfile stops the allocation profile started by StartAllocProfile, if any, and writes it. The same
+restrictions as for StartAllocProfile apply.
+*/
+func (r *Runtime) StopAllocProfile() error {
+	p := r.vm.allocProf
+	if p == nil {
+		return nil
+	}
+	r.vm.allocProf = nil
+	atomic.AddInt32(&activeAllocProfiles, -1)
+	return p.profile().Write(p.w)
+}
@@ -0,0 +1,748 @@
+package analysis
+
+import (
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/file"
+	"github.com/dop251/goja/token"
+	"github.com/dop251/goja/unistring"
+)
+
+type analyzer struct {
+	info  *Info
+	scope *Scope
+}
+
+// Analyze resolves the scopes and the bindings of the program. The AST must not be modified while the result is
+// in use.
+func Analyze(prg *ast.Program) *Info {
+	a := &analyzer{
+		info: &Info{
+			Scopes: make(map[ast.Node]*Scope),
+			Defs:   make(map[*ast.Identifier]*Binding),
+			Uses:   make(map[*ast.Identifier]*Reference),
+		},
+	}
+	a.info.Global = a.openScope(ScopeGlobal, prg)
+	a.functionBody(prg.Body)
+	a.closeScope()
+	return a.info
+}
+
+func (a *analyzer) openScope(kind ScopeKind, node ast.Node) *Scope {
+	s := &Scope{
+		Kind:   kind,
+		Node:   node,
+		Parent: a.scope,
+	}
+	if a.scope != nil {
+		a.scope.Children = append(a.scope.Children, s)
+	}
+	a.info.Scopes[node] = s
+	a.scope = s
+	return s
+}
+
+func (a *analyzer) closeScope() {
+	a.scope = a.scope.Parent
+}
+
+// declare adds the declaring identifier to the binding with its name in the current scope, creating the binding if
+// it does not exist. init is the position after which the binding is initialised (0 if it has no TDZ).
+func (a *analyzer) declare(id *ast.Identifier, kind BindingKind, init file.Idx) *Binding {
+	s := a.scope
+	b := s.names[id.Name]
+	if b == nil {
+		b = &Binding{
+			Name:  id.Name,
+			Kind:  kind,
+			Scope: s,
+			init:  init,
+		}
+		if s.names == nil {
+			s.names = make(map[unistring.String]*Binding)
+		}
+		s.names[id.Name] = b
+		s.Bindings = append(s.Bindings, b)
+	} else if kind == BindingFunction && b.Kind == BindingVar {
+		b.Kind = kind
+	}
+	b.Decls = append(b.Decls, id)
+	a.info.Defs[id] = b
+	return b
+}
+
+// declareTarget declares all the names bound by the binding target.
+func (a *analyzer) declareTarget(target ast.Expression, kind BindingKind, init file.Idx) {
+	boundNames(target, func(id *ast.Identifier) {
+		a.declare(id, kind, init)
+	})
+}
+
+// boundNames calls f for each identifier bound by the binding target.
+func boundNames(target ast.Expression, f func(id *ast.Identifier)) {
+	switch t := target.(type) {
+	case *ast.Identifier:
+		f(t)
+	case *ast.Binding:
+		boundNames(t.Target, f)
+	case *ast.AssignExpression:
+		boundNames(t.Left, f)
+	case *ast.ArrayPattern:
+		for _, e := range t.Elements {
+			if e != nil {
+				boundNames(e, f)
+			}
+		}
+		if t.Rest != nil {
+			boundNames(t.Rest, f)
+		}
+	case *ast.ObjectPattern:
+		for _, p := range t.Properties {
+			switch p := p.(type) {
+			case *ast.PropertyShort:
+				f(&p.Name)
+			case *ast.PropertyKeyed:
+				boundNames(p.Value, f)
+			}
+		}
+		if t.Rest != nil {
+			boundNames(t.Rest, f)
+		}
+	}
+}
+
+// hoistVars declares the var bindings of the statements in the current (function-like) scope, not descending into
+// the nested functions.
+func (a *analyzer) hoistVars(list []ast.Statement) {
+	for _, s := range list {
+		a.hoistVarsStmt(s)
+	}
+}
+
+func (a *analyzer) hoistVarsStmt(s ast.Statement) {
+	switch s := s.(type) {
+	case *ast.VariableStatement:
+		for _, b := range s.List {
+			a.declareTarget(b.Target, BindingVar, 0)
+		}
+	case *ast.BlockStatement:
+		a.hoistVars(s.List)
+	case *ast.IfStatement:
+		a.hoistVarsStmt(s.Consequent)
+		if s.Alternate != nil {
+			a.hoistVarsStmt(s.Alternate)
+		}
+	case *ast.DoWhileStatement:
+		a.hoistVarsStmt(s.Body)
+	case *ast.WhileStatement:
+		a.hoistVarsStmt(s.Body)
+	case *ast.ForStatement:
+		if init, ok := s.Initializer.(*ast.ForLoopInitializerVarDeclList); ok {
+			for _, b := range init.List {
+				a.declareTarget(b.Target, BindingVar, 0)
+			}
+		}
+		a.hoistVarsStmt(s.Body)
+	case *ast.ForInStatement:
+		if into, ok := s.Into.(*ast.ForIntoVar); ok {
+			a.declareTarget(into.Binding.Target, BindingVar, 0)
+		}
+		a.hoistVarsStmt(s.Body)
+	case *ast.ForOfStatement:
+		if into, ok := s.Into.(*ast.ForIntoVar); ok {
+			a.declareTarget(into.Binding.Target, BindingVar, 0)
+		}
+		a.hoistVarsStmt(s.Body)
+	case *ast.LabelledStatement:
+		a.hoistVarsStmt(s.Statement)
+	case *ast.WithStatement:
+		a.hoistVarsStmt(s.Body)
+	case *ast.SwitchStatement:
+		for _, c := range s.Body {
+			a.hoistVars(c.Consequent)
+		}
+	case *ast.TryStatement:
+		a.hoistVarsStmt(s.Body)
+		if s.Catch != nil {
+			a.hoistVarsStmt(s.Catch.Body)
+		}
+		if s.Finally != nil {
+			a.hoistVarsStmt(s.Finally)
+		}
+	}
+}
+
+// declareLexical declares the lexical bindings (let, const, class and function declarations) of the statement list
+// in the current scope.
+func (a *analyzer) declareLexical(list []ast.Statement) {
+	for _, s := range list {
+		for {
+			// function declarations may be labelled in the non-strict code
+			l, ok := s.(*ast.LabelledStatement)
+			if !ok {
+				break
+			}
+			s = l.Statement
+		}
+		switch s := s.(type) {
+		case *ast.LexicalDeclaration:
+			a.lexicalDeclaration(s)
+		case *ast.FunctionDeclaration:
+			if s.Function.Name != nil {
+				a.declare(s.Function.Name, BindingFunction, 0)
+			}
+		case *ast.ClassDeclaration:
+			if s.Class.Name != nil {
+				a.declare(s.Class.Name, BindingClass, s.Class.Idx1())
+			}
+		}
+	}
+}
+
+func (a *analyzer) lexicalDeclaration(d *ast.LexicalDeclaration) {
+	kind := BindingLet
+	if d.Token == token.CONST {
+		kind = BindingConst
+	}
+	for _, b := range d.List {
+		a.declareTarget(b.Target, kind, b.Idx1())
+	}
+}
+
+// functionBody declares the bindings of a function-like scope and visits its statements.
+func (a *analyzer) functionBody(list []ast.Statement) {
+	a.hoistVars(list)
+	a.declareLexical(list)
+	a.statements(list)
+}
+
+func (a *analyzer) statements(list []ast.Statement) {
+	for _, s := range list {
+		a.statement(s)
+	}
+}
+
+func (a *analyzer) block(b *ast.BlockStatement) {
+	a.openScope(ScopeBlock, b)
+	a.declareLexical(b.List)
+	a.statements(b.List)
+	a.closeScope()
+}
+
+func (a *analyzer) statement(s ast.Statement) {
+	switch s := s.(type) {
+	case *ast.BadStatement, *ast.EmptyStatement, *ast.DebuggerStatement, *ast.BranchStatement:
+		// nothing to do
+
+	case *ast.BlockStatement:
+		a.block(s)
+
+	case *ast.ExpressionStatement:
+		a.expr(s.Expression)
+
+	case *ast.VariableStatement:
+		a.bindings(s.List)
+
+	case *ast.LexicalDeclaration:
+		a.bindings(s.List)
+
+	case *ast.FunctionDeclaration:
+		a.function(s.Function, false)
+
+	case *ast.ClassDeclaration:
+		a.class(s.Class, false)
+
+	case *ast.ReturnStatement:
+		a.optExpr(s.Argument)
+
+	case *ast.ThrowStatement:
+		a.expr(s.Argument)
+
+	case *ast.IfStatement:
+		a.expr(s.Test)
+		a.statement(s.Consequent)
+		if s.Alternate != nil {
+			a.statement(s.Alternate)
+		}
+
+	case *ast.DoWhileStatement:
+		a.statement(s.Body)
+		a.expr(s.Test)
+
+	case *ast.WhileStatement:
+		a.expr(s.Test)
+		a.statement(s.Body)
+
+	case *ast.LabelledStatement:
+		a.statement(s.Statement)
+
+	case *ast.WithStatement:
+		a.expr(s.Object)
+		a.openScope(ScopeWith, s).Dynamic = true
+		a.statement(s.Body)
+		a.closeScope()
+
+	case *ast.ForStatement:
+		scoped := false
+		switch init := s.Initializer.(type) {
+		case *ast.ForLoopInitializerExpression:
+			a.expr(init.Expression)
+		case *ast.ForLoopInitializerVarDeclList:
+			a.bindings(init.List)
+		case *ast.ForLoopInitializerLexicalDecl:
+			a.openScope(ScopeBlock, s)
+			scoped = true
+			a.lexicalDeclaration(&init.LexicalDeclaration)
+			a.bindings(init.LexicalDeclaration.List)
+		}
+		a.optExpr(s.Test)
+		a.optExpr(s.Update)
+		a.statement(s.Body)
+		if scoped {
+			a.closeScope()
+		}
+
+	case *ast.ForInStatement:
+		a.forInto(s, s.Into, s.Source, s.Body)
+
+	case *ast.ForOfStatement:
+		a.forInto(s, s.Into, s.Source, s.Body)
+
+	case *ast.SwitchStatement:
+		a.expr(s.Discriminant)
+		a.openScope(ScopeBlock, s)
+		for _, c := range s.Body {
+			a.declareLexical(c.Consequent)
+		}
+		for _, c := range s.Body {
+			a.optExpr(c.Test)
+			a.statements(c.Consequent)
+		}
+		a.closeScope()
+
+	case *ast.TryStatement:
+		a.block(s.Body)
+		if c := s.Catch; c != nil {
+			a.openScope(ScopeCatch, c)
+			if c.Parameter != nil {
+				a.declareTarget(c.Parameter, BindingCatch, 0)
+				a.target(c.Parameter, true, false)
+			}
+			a.declareLexical(c.Body.List)
+			a.statements(c.Body.List)
+			a.closeScope()
+		}
+		if s.Finally != nil {
+			a.block(s.Finally)
+		}
+	}
+}
+
+func (a *analyzer) forInto(s ast.Statement, into ast.ForInto, source ast.Expression, body ast.Statement) {
+	switch into := into.(type) {
+	case *ast.ForIntoVar:
+		a.binding(into.Binding)
+		a.expr(source)
+		a.statement(body)
+	case *ast.ForDeclaration:
+		a.openScope(ScopeBlock, s)
+		kind := BindingLet
+		if into.IsConst {
+			kind = BindingConst
+		}
+		// the source is evaluated while the bindings are in TDZ
+		a.declareTarget(into.Target, kind, source.Idx1())
+		a.target(into.Target, true, false)
+		a.expr(source)
+		a.statement(body)
+		a.closeScope()
+	case *ast.ForIntoExpression:
+		a.target(into.Expression, false, false)
+		a.expr(source)
+		a.statement(body)
+	}
+}
+
+func (a *analyzer) bindings(list []*ast.Binding) {
+	for _, b := range list {
+		a.binding(b)
+	}
+}
+
+func (a *analyzer) binding(b *ast.Binding) {
+	a.target(b.Target, true, false)
+	a.optExpr(b.Initializer)
+}
+
+// target visits an assignment target or a binding target. The identifiers in the binding targets (decl is true)
+// have already been declared, otherwise they are written to (and also read if read is true).
+func (a *analyzer) target(t ast.Expression, decl, read bool) {
+	switch t := t.(type) {
+	case *ast.Identifier:
+		if !decl {
+			a.use(t, read, true)
+		}
+	case *ast.AssignExpression:
+		// a target with a default value
+		a.target(t.Left, decl, false)
+		a.expr(t.Right)
+	case *ast.ArrayPattern:
+		for _, e := range t.Elements {
+			if e != nil {
+				a.target(e, decl, false)
+			}
+		}
+		if t.Rest != nil {
+			a.target(t.Rest, decl, false)
+		}
+	case *ast.ObjectPattern:
+		for _, p := range t.Properties {
+			switch p := p.(type) {
+			case *ast.PropertyShort:
+				if !decl {
+					a.use(&p.Name, false, true)
+				}
+				a.optExpr(p.Initializer)
+			case *ast.PropertyKeyed:
+				if p.Computed {
+					a.expr(p.Key)
+				}
+				a.target(p.Value, decl, false)
+			}
+		}
+		if t.Rest != nil {
+			a.target(t.Rest, decl, false)
+		}
+	case *ast.BadExpression:
+	default:
+		// a member expression
+		a.expr(t)
+	}
+}
+
+func (a *analyzer) optExpr(e ast.Expression) {
+	if e != nil {
+		a.expr(e)
+	}
+}
+
+func (a *analyzer) exprs(list []ast.Expression) {
+	for _, e := range list {
+		if e != nil { // holes in array literals
+			a.expr(e)
+		}
+	}
+}
+
+func (a *analyzer) expr(e ast.Expression) {
+	switch e := e.(type) {
+	case *ast.Identifier:
+		a.use(e, true, false)
+
+	case *ast.BadExpression, *ast.BooleanLiteral, *ast.NullLiteral, *ast.NumberLiteral, *ast.StringLiteral,
+		*ast.RegExpLiteral, *ast.ThisExpression, *ast.SuperExpression, *ast.MetaProperty, *ast.PrivateIdentifier:
+		// nothing to do
+
+	case *ast.TemplateLiteral:
+		a.optExpr(e.Tag)
+		a.exprs(e.Expressions)
+
+	case *ast.ArrayLiteral:
+		a.exprs(e.Value)
+
+	case *ast.ObjectLiteral:
+		for _, p := range e.Value {
+			switch p := p.(type) {
+			case *ast.PropertyShort:
+				a.use(&p.Name, true, false)
+			case *ast.PropertyKeyed:
+				if p.Computed {
+					a.expr(p.Key)
+				}
+				a.expr(p.Value)
+			case *ast.SpreadElement:
+				a.expr(p.Expression)
+			}
+		}
+
+	case *ast.ArrayPattern, *ast.ObjectPattern:
+		a.target(e, false, false)
+
+	case *ast.AssignExpression:
+		a.target(e.Left, false, e.Operator != token.ASSIGN)
+		a.expr(e.Right)
+
+	case *ast.UnaryExpression:
+		if e.Operator == token.INCREMENT || e.Operator == token.DECREMENT {
+			a.target(e.Operand, false, true)
+		} else {
+			a.expr(e.Operand)
+		}
+
+	case *ast.BinaryExpression:
+		a.expr(e.Left)
+		a.expr(e.Right)
+
+	case *ast.ConditionalExpression:
+		a.expr(e.Test)
+		a.expr(e.Consequent)
+		a.expr(e.Alternate)
+
+	case *ast.SequenceExpression:
+		a.exprs(e.Sequence)
+
+	case *ast.CallExpression:
+		a.expr(e.Callee)
+		a.exprs(e.ArgumentList)
+		if id, ok := e.Callee.(*ast.Identifier); ok && id.Name == "eval" && a.info.Uses[id].Binding == nil {
+			// a direct eval can declare and look up any name in the enclosing scopes
+			for s := a.scope; s != nil; s = s.Parent {
+				s.Dynamic = true
+			}
+		}
+
+	case *ast.NewExpression:
+		a.expr(e.Callee)
+		a.exprs(e.ArgumentList)
+
+	case *ast.DotExpression:
+		a.expr(e.Left)
+
+	case *ast.PrivateDotExpression:
+		a.expr(e.Left)
+
+	case *ast.BracketExpression:
+		a.expr(e.Left)
+		a.expr(e.Member)
+
+	case *ast.OptionalChain:
+		a.expr(e.Expression)
+
+	case *ast.Optional:
+		a.expr(e.Expression)
+
+	case *ast.SpreadElement:
+		a.expr(e.Expression)
+
+	case *ast.YieldExpression:
+		a.optExpr(e.Argument)
+
+	case *ast.AwaitExpression:
+		a.expr(e.Argument)
+
+	case *ast.FunctionLiteral:
+		a.function(e, true)
+
+	case *ast.ArrowFunctionLiteral:
+		a.openScope(ScopeFunction, e)
+		switch body := e.Body.(type) {
+		case *ast.BlockStatement:
+			a.parametersAndBody(e.ParameterList, body, nil)
+		case *ast.ExpressionBody:
+			a.parameters(e.ParameterList)
+			a.visitParameters(e.ParameterList)
+			a.expr(body.Expression)
+		}
+		a.closeScope()
+
+	case *ast.ClassLiteral:
+		a.class(e, true)
+
+	case *ast.JSXElement:
+		if !e.IsIntrinsic() {
+			// <Component> and <ns.Component> reference the variables
+			a.expr(e.Name)
+		}
+		for _, attr := range e.Attributes {
+			switch attr := attr.(type) {
+			case *ast.JSXAttribute:
+				a.optExpr(attr.Value)
+			case *ast.JSXSpreadAttribute:
+				a.expr(attr.Argument)
+			}
+		}
+		a.exprs(e.Children)
+
+	case *ast.JSXFragment:
+		a.exprs(e.Children)
+
+	case *ast.JSXExpressionContainer:
+		a.optExpr(e.Expression)
+
+	case *ast.JSXSpreadChild:
+		a.expr(e.Expression)
+	}
+}
+
+// parameters declares the parameters in the current scope.
+func (a *analyzer) parameters(params *ast.ParameterList) {
+	for _, p := range params.List {
+		a.declareTarget(p.Target, BindingParameter, p.Idx1())
+	}
+	if params.Rest != nil {
+		a.declareTarget(params.Rest, BindingParameter, params.Rest.Idx1())
+	}
+}
+
+// visitParameters visits the default values and the computed keys of the parameters.
+func (a *analyzer) visitParameters(params *ast.ParameterList) {
+	a.bindings(params.List)
+	if params.Rest != nil {
+		a.target(params.Rest, true, false)
+	}
+}
+
+// hasParameterExpressions reports whether the parameters have default values or patterns, in which case the body
+// of the function has its own scope.
+func hasParameterExpressions(params *ast.ParameterList) bool {
+	for _, p := range params.List {
+		if _, ok := p.Target.(*ast.Identifier); !ok || p.Initializer != nil {
+			return true
+		}
+	}
+	if params.Rest != nil {
+		if _, ok := params.Rest.(*ast.Identifier); !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// parametersAndBody declares and visits the parameters and the body of a function in the current scope. name is
+// the name of a function expression (nil otherwise), it's only bound if not shadowed. If the parameters have
+// default values or patterns, the body is a ScopeBlock, so that its declarations are not visible to the parameters.
+func (a *analyzer) parametersAndBody(params *ast.ParameterList, body *ast.BlockStatement, name *ast.Identifier) {
+	a.parameters(params)
+	if hasParameterExpressions(params) {
+		a.declareFunctionName(name)
+		a.visitParameters(params)
+		a.openScope(ScopeBlock, body)
+		a.functionBody(body.List)
+		a.closeScope()
+		return
+	}
+	a.hoistVars(body.List)
+	a.declareLexical(body.List)
+	a.declareFunctionName(name)
+	a.visitParameters(params)
+	a.statements(body.List)
+}
+
+func (a *analyzer) declareFunctionName(name *ast.Identifier) {
+	if name != nil && a.scope.names[name.Name] == nil {
+		a.declare(name, BindingFunctionName, 0)
+	}
+}
+
+func (a *analyzer) function(f *ast.FunctionLiteral, expr bool) {
+	a.openScope(ScopeFunction, f)
+	var name *ast.Identifier
+	if expr {
+		name = f.Name
+	}
+	a.parametersAndBody(f.ParameterList, f.Body, name)
+	a.closeScope()
+}
+
+func (a *analyzer) class(c *ast.ClassLiteral, expr bool) {
+	if expr {
+		a.openScope(ScopeClass, c)
+		if c.Name != nil {
+			a.declare(c.Name, BindingClass, c.Idx1())
+		}
+	}
+	a.optExpr(c.SuperClass)
+	for _, elt := range c.Body {
+		switch elt := elt.(type) {
+		case *ast.FieldDefinition:
+			if elt.Computed {
+				a.expr(elt.Key)
+			}
+			if elt.Initializer != nil {
+				a.openScope(ScopeInitializer, elt)
+				a.expr(elt.Initializer)
+				a.closeScope()
+			}
+		case *ast.MethodDefinition:
+			if elt.Computed {
+				a.expr(elt.Key)
+			}
+			a.function(elt.Body, false)
+		case *ast.ClassStaticBlock:
+			a.openScope(ScopeInitializer, elt)
+			a.functionBody(elt.Block.List)
+			a.closeScope()
+		}
+	}
+	if expr {
+		a.closeScope()
+	}
+}
+
+// lookup resolves the name in the current scope. The arguments binding of the functions is created on demand.
+func (a *analyzer) lookup(id *ast.Identifier) *Binding {
+	for s := a.scope; s != nil; s = s.Parent {
+		if b := s.names[id.Name]; b != nil {
+			return b
+		}
+		if id.Name == "arguments" && s.Kind == ScopeFunction {
+			if _, arrow := s.Node.(*ast.ArrowFunctionLiteral); !arrow {
+				b := &Binding{
+					Name:  id.Name,
+					Kind:  BindingArguments,
+					Scope: s,
+				}
+				if s.names == nil {
+					s.names = make(map[unistring.String]*Binding)
+				}
+				s.names[id.Name] = b
+				s.Bindings = append(s.Bindings, b)
+				return b
+			}
+		}
+	}
+	return nil
+}
+
+func (a *analyzer) use(id *ast.Identifier, read, write bool) {
+	r := &Reference{
+		Identifier: id,
+		Scope:      a.scope,
+		Read:       read,
+		Write:      write,
+	}
+	a.info.Uses[id] = r
+	a.scope.References = append(a.scope.References, r)
+
+	b := a.lookup(id)
+	if b == nil {
+		a.info.Unresolved = append(a.info.Unresolved, r)
+		return
+	}
+	r.Binding = b
+	b.References = append(b.References, r)
+
+	fn := b.Scope.Function()
+	if a.scope.Function() != fn {
+		b.Captured = true
+		for s := a.scope; s != fn; s = s.Parent {
+			if (s.Kind == ScopeFunction || s.Kind == ScopeInitializer) && !contains(s.Captured, b) {
+				s.Captured = append(s.Captured, b)
+			}
+		}
+		return
+	}
+	if b.init > 0 && id.Idx < b.init {
+		r.TDZ = true
+		a.info.TDZ = append(a.info.TDZ, r)
+	}
+}
+
+func contains(list []*Binding, b *Binding) bool {
+	for _, x := range list {
+		if x == b {
+			return true
+		}
+	}
+	return false
+}
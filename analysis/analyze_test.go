@@ -0,0 +1,285 @@
+package analysis_test
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/dop251/goja/analysis"
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/parser"
+	"github.com/dop251/goja/unistring"
+)
+
+func analyze(t *testing.T, src string) (*ast.Program, *analysis.Info) {
+	t.Helper()
+	prg, err := parser.ParseFile(nil, "test.js", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return prg, analysis.Analyze(prg)
+}
+
+func names(refs []*analysis.Reference) string {
+	var list []string
+	for _, r := range refs {
+		list = append(list, r.Identifier.Name.String())
+	}
+	return strings.Join(list, ",")
+}
+
+func bindingNames(list []*analysis.Binding) string {
+	var names []string
+	for _, b := range list {
+		names = append(names, b.Name.String()+":"+b.Kind.String())
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func TestAnalyze(t *testing.T) {
+	const src = `
+var a = 1;
+function f(p, {q, r: [s = a]}, ...rest) {
+	var v = p + q;
+	if (v) {
+		let b = v;
+		var w = b;
+	}
+	return function g() { return arguments.length + v + g.name + undefinedName; };
+}
+const c = (x) => x + a + c;
+class C { m() { return C; } static [a] = a; }
+try {} catch ({message}) { message; }
+a = 2; a += 3; a++;
+[a, c.x] = [];
+({a} = {});
+for (let i = 0; i < 10; i++) {}
+for (const k in {}) k;
+label: console.log(a, c);
+`
+	prg, info := analyze(t, src)
+	global := info.Global
+	if global.Kind != analysis.ScopeGlobal || global.Node != prg {
+		t.Fatal(global)
+	}
+	if s := bindingNames(global.Bindings); s != "C:class,a:var,c:const,f:function" {
+		t.Fatal(s)
+	}
+	if s := names(info.Unresolved); s != "undefinedName,console" {
+		t.Fatal(s)
+	}
+
+	a := global.Binding("a")
+	var kinds []string
+	for _, r := range a.References {
+		k := ""
+		if r.Read {
+			k += "r"
+		}
+		if r.Write {
+			k += "w"
+		}
+		kinds = append(kinds, k)
+	}
+	if s := strings.Join(kinds, ","); s != "r,r,r,r,w,rw,rw,w,w,r" {
+		t.Fatal(s)
+	}
+	if !a.Captured {
+		t.Fatal("a is not captured")
+	}
+
+	fn := prg.Body[1].(*ast.FunctionDeclaration).Function
+	fs := info.Scopes[fn]
+	if fs.Kind != analysis.ScopeFunction || fs.Parent != global {
+		t.Fatal(fs)
+	}
+	if s := bindingNames(fs.Bindings); s != "p:parameter,q:parameter,rest:parameter,s:parameter" {
+		t.Fatal(s)
+	}
+	// the parameters have patterns, so the body has its own scope
+	body := info.Scopes[fn.Body]
+	if body.Kind != analysis.ScopeBlock || body.Parent != fs || bindingNames(body.Bindings) != "v:var,w:var" {
+		t.Fatal(body)
+	}
+	if info.Binding(fn.Name) != global.Binding("f") {
+		t.Fatal("f")
+	}
+	v := body.Binding("v")
+	if !v.Captured || len(v.References) != 3 {
+		t.Fatal(v)
+	}
+
+	// the nested function expression
+	g := fn.Body.List[2].(*ast.ReturnStatement).Argument.(*ast.FunctionLiteral)
+	gs := info.Scopes[g]
+	if s := bindingNames(gs.Bindings); s != "arguments:arguments,g:function name" {
+		t.Fatal(s)
+	}
+	if s := bindingNames(gs.Captured); s != "v:var" {
+		t.Fatal(s)
+	}
+	if gs.Binding("arguments").References[0].Read != true {
+		t.Fatal("arguments")
+	}
+
+	// the block scope
+	block := fn.Body.List[1].(*ast.IfStatement).Consequent.(*ast.BlockStatement)
+	if bs := info.Scopes[block]; bs.Kind != analysis.ScopeBlock || bindingNames(bs.Bindings) != "b:let" || bs.Binding("b").Captured {
+		t.Fatal(bs)
+	}
+
+	// the class name refers to the declaration
+	cls := prg.Body[3].(*ast.ClassDeclaration).Class
+	m := cls.Body[0].(*ast.MethodDefinition).Body.Body.List[0].(*ast.ReturnStatement).Argument.(*ast.Identifier)
+	if info.Binding(m) != global.Binding("C") {
+		t.Fatal("C")
+	}
+	// the reference to c in the arrow function is not evaluated in its TDZ
+	if len(info.TDZ) != 0 {
+		t.Fatal(names(info.TDZ))
+	}
+
+	for id, b := range info.Defs {
+		if info.Uses[id] != nil {
+			t.Fatalf("%s is both a declaration and a reference", id.Name)
+		}
+		if b.Decls == nil {
+			t.Fatal(b)
+		}
+	}
+}
+
+func TestAnalyzeTDZ(t *testing.T) {
+	tests := []struct {
+		src string
+		tdz string
+	}{
+		{`x; let x = 1;`, "x"},
+		{`let x = x;`, "x"},
+		{`let x = 1; x;`, ""},
+		{`function f() { return x } let x = 1;`, ""},
+		{`typeof x; const x = 1;`, "x"},
+		{`{ y; class y {} }`, "y"},
+		{`class C extends C {}`, "C"},
+		{`class C { [C] = 1; static f = C; m() { C } }`, "C"},
+		{`for (let i of i) {}`, "i"},
+		{`function f(a = b, b) {}`, "b"},
+		{`var v = v;`, ""},
+		{`f(); function f() {}`, ""},
+	}
+	for _, test := range tests {
+		_, info := analyze(t, test.src)
+		if s := names(info.TDZ); s != test.tdz {
+			t.Errorf("%s: %q, expected %q", test.src, s, test.tdz)
+		}
+		for _, r := range info.TDZ {
+			if !r.TDZ {
+				t.Errorf("%s: TDZ is not set", test.src)
+			}
+		}
+	}
+}
+
+func TestAnalyzeScopes(t *testing.T) {
+	prg, info := analyze(t, `
+var x = 1;
+function f() {
+	with (o) { x; }
+}
+function g() {
+	eval("x");
+	return function() { x };
+}
+var h = class K { m() { return K } };
+label: for (;;) { let y = x; break label; }
+`)
+	with := prg.Body[1].(*ast.FunctionDeclaration).Function.Body.List[0].(*ast.WithStatement)
+	ws := info.Scopes[with]
+	if ws.Kind != analysis.ScopeWith || !ws.Dynamic || ws.Parent.Dynamic {
+		t.Fatal(ws)
+	}
+	if r := ws.Children[0].References[0]; r.Binding != info.Global.Binding("x") {
+		t.Fatal(r)
+	}
+
+	gs := info.Scopes[prg.Body[2].(*ast.FunctionDeclaration).Function]
+	if !gs.Dynamic || !info.Global.Dynamic || gs.Children[0].Dynamic {
+		t.Fatal("eval")
+	}
+
+	cls := prg.Body[3].(*ast.VariableStatement).List[0].Initializer.(*ast.ClassLiteral)
+	cs := info.Scopes[cls]
+	if cs.Kind != analysis.ScopeClass || bindingNames(cs.Bindings) != "K:class" {
+		t.Fatal(cs)
+	}
+	if k := cs.Binding("K"); !k.Captured || len(k.References) != 1 {
+		t.Fatal(k)
+	}
+	if info.Global.Lookup(unistring.String("K")) != nil || cs.Children[0].Lookup("K") != cs.Binding("K") {
+		t.Fatal("K")
+	}
+	if s := names(info.Unresolved); s != "o,eval" {
+		t.Fatal(s)
+	}
+	if info.Uses[prg.Body[4].(*ast.LabelledStatement).Label] != nil {
+		t.Fatal("label is a reference")
+	}
+}
+
+func TestAnalyzeParameterScope(t *testing.T) {
+	prg, info := analyze(t, `
+var y;
+function ff(x = () => y) { var y; return y; }
+const af = (x = () => y) => { var y; };
+function simple(x) { var y; return () => y; }
+`)
+	outer := info.Global.Binding("y")
+	for _, i := range []int{1, 2} {
+		var fn ast.Node
+		var body *ast.BlockStatement
+		var param *ast.Binding
+		if i == 1 {
+			f := prg.Body[i].(*ast.FunctionDeclaration).Function
+			fn, body, param = f, f.Body, f.ParameterList.List[0]
+		} else {
+			f := prg.Body[i].(*ast.LexicalDeclaration).List[0].Initializer.(*ast.ArrowFunctionLiteral)
+			fn, body, param = f, f.Body.(*ast.BlockStatement), f.ParameterList.List[0]
+		}
+		ref := param.Initializer.(*ast.ArrowFunctionLiteral).Body.(*ast.ExpressionBody).Expression.(*ast.Identifier)
+		if info.Binding(ref) != outer {
+			t.Fatalf("%d: the parameter refers to %v", i, info.Binding(ref))
+		}
+		fs, bs := info.Scopes[fn], info.Scopes[body]
+		if bindingNames(fs.Bindings) != "x:parameter" || bs.Parent != fs || bindingNames(bs.Bindings) != "y:var" {
+			t.Fatal(i, bindingNames(fs.Bindings), bindingNames(bs.Bindings))
+		}
+	}
+	ret := prg.Body[1].(*ast.FunctionDeclaration).Function.Body.List[1].(*ast.ReturnStatement).Argument.(*ast.Identifier)
+	if b := info.Binding(ret); b == outer || b.Kind != analysis.BindingVar {
+		t.Fatal(b)
+	}
+
+	// a simple parameter list shares the scope with the body
+	simple := prg.Body[3].(*ast.FunctionDeclaration).Function
+	if bindingNames(info.Scopes[simple].Bindings) != "x:parameter,y:var" || info.Scopes[simple.Body] != nil {
+		t.Fatal(simple)
+	}
+}
+
+func TestAnalyzeJSX(t *testing.T) {
+	prg, err := parser.ParseFile(nil, "test.jsx", `
+const Item = (props) => <li>{props.text}</li>;
+<ul class={cls} {...rest}><Item text="a" /><UI.Button onClick={() => handler} />{...more}</ul>;
+`, parser.JSX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := analysis.Analyze(prg)
+	if s := names(info.Unresolved); s != "cls,rest,UI,handler,more" {
+		t.Fatal(s)
+	}
+	if item := info.Global.Binding("Item"); len(item.References) != 1 {
+		t.Fatal(item)
+	}
+}
@@ -0,0 +1,212 @@
+/*
+Package analysis implements the scope analysis of the programs produced by the parser: it resolves the identifiers
+to the declarations they refer to and reports the references to the undeclared (i.e. global) variables, the
+variables captured by closures and the accesses to the lexical bindings in their temporal dead zone (TDZ).
+
+	program, err := parser.ParseFile(nil, "test.js", src, 0)
+	...
+	info := analysis.Analyze(program)
+	for _, ref := range info.Unresolved {
+		fmt.Printf("%s is not declared\n", ref.Identifier.Name)
+	}
+
+The analysis is static: the names that may be created or looked up dynamically (inside a with statement or a scope
+containing a direct call to eval()) are resolved as if there were none, such scopes are marked as Dynamic.
+*/
+package analysis
+
+import (
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/file"
+	"github.com/dop251/goja/unistring"
+)
+
+// ScopeKind is the kind of a Scope.
+type ScopeKind int
+
+const (
+	ScopeGlobal      ScopeKind = iota // The top-level scope of the program
+	ScopeFunction                     // A function (including an arrow function or a method), its parameters and body
+	ScopeInitializer                  // A class field initializer or a class static block, which behave like function bodies
+	ScopeBlock                        // A block, a for statement with lexical declarations or a switch statement
+	ScopeCatch                        // A catch clause, its parameter and body
+	ScopeClass                        // A class expression, which binds the class name
+	ScopeWith                         // The body of a with statement
+)
+
+var scopeKindNames = [...]string{
+	ScopeGlobal:      "global",
+	ScopeFunction:    "function",
+	ScopeInitializer: "initializer",
+	ScopeBlock:       "block",
+	ScopeCatch:       "catch",
+	ScopeClass:       "class",
+	ScopeWith:        "with",
+}
+
+func (k ScopeKind) String() string {
+	if k >= 0 && int(k) < len(scopeKindNames) {
+		return scopeKindNames[k]
+	}
+	return "unknown"
+}
+
+// BindingKind is the kind of a Binding.
+type BindingKind int
+
+const (
+	BindingVar          BindingKind = iota // A var declaration
+	BindingLet                             // A let declaration
+	BindingConst                           // A const declaration
+	BindingFunction                        // A function declaration
+	BindingClass                           // A class declaration, or the name of a class expression
+	BindingParameter                       // A function parameter
+	BindingCatch                           // A catch clause parameter
+	BindingFunctionName                    // The name of a function expression
+	BindingArguments                       // The implicit arguments object of a function
+)
+
+var bindingKindNames = [...]string{
+	BindingVar:          "var",
+	BindingLet:          "let",
+	BindingConst:        "const",
+	BindingFunction:     "function",
+	BindingClass:        "class",
+	BindingParameter:    "parameter",
+	BindingCatch:        "catch",
+	BindingFunctionName: "function name",
+	BindingArguments:    "arguments",
+}
+
+func (k BindingKind) String() string {
+	if k >= 0 && int(k) < len(bindingKindNames) {
+		return bindingKindNames[k]
+	}
+	return "unknown"
+}
+
+// A Scope is a lexical environment.
+type Scope struct {
+	Kind ScopeKind
+
+	// The node which introduces the scope: *ast.Program, *ast.FunctionLiteral, *ast.ArrowFunctionLiteral,
+	// *ast.FieldDefinition, *ast.ClassStaticBlock, *ast.BlockStatement, *ast.ForStatement, *ast.ForInStatement,
+	// *ast.ForOfStatement, *ast.SwitchStatement, *ast.CatchStatement, *ast.ClassLiteral or *ast.WithStatement.
+	// If the parameters of a function have default values or patterns, the body of the function is a separate
+	// ScopeBlock (with the body *ast.BlockStatement as the Node), so that its declarations are not visible to
+	// the parameters.
+	Node ast.Node
+
+	Parent   *Scope
+	Children []*Scope
+
+	// The bindings declared in the scope in the order of declaration
+	Bindings []*Binding
+
+	// The references which occur directly in the scope
+	References []*Reference
+
+	// The bindings of the enclosing scopes referenced from inside the function (including the nested functions).
+	// Only set for the function-like scopes (ScopeFunction and ScopeInitializer).
+	Captured []*Binding
+
+	// Set if the names in the scope may be created or resolved dynamically, i.e. for a with statement or if there is
+	// a direct call to eval() in the scope or in a nested scope.
+	Dynamic bool
+
+	names map[unistring.String]*Binding
+}
+
+// Binding returns the binding with the given name declared in the scope or nil if there is none.
+func (s *Scope) Binding(name unistring.String) *Binding {
+	return s.names[name]
+}
+
+// Lookup returns the binding with the given name visible in the scope or nil if it's not declared.
+func (s *Scope) Lookup(name unistring.String) *Binding {
+	for ; s != nil; s = s.Parent {
+		if b := s.names[name]; b != nil {
+			return b
+		}
+	}
+	return nil
+}
+
+// Function returns the innermost function-like scope (ScopeFunction, ScopeInitializer or ScopeGlobal) containing
+// the scope (which may be the scope itself).
+func (s *Scope) Function() *Scope {
+	for s.Kind != ScopeFunction && s.Kind != ScopeInitializer && s.Kind != ScopeGlobal {
+		s = s.Parent
+	}
+	return s
+}
+
+// A Binding is a declared name.
+type Binding struct {
+	Name  unistring.String
+	Kind  BindingKind
+	Scope *Scope
+
+	// The declaring identifiers. There may be more than one for the var and function declarations. The implicit
+	// arguments binding has none.
+	Decls []*ast.Identifier
+
+	// The references to the binding in the order of appearance
+	References []*Reference
+
+	// Set if the binding is referenced from a function other than the one it is declared in
+	Captured bool
+
+	// The position after which the binding is initialised (for the bindings which have a TDZ)
+	init file.Idx
+}
+
+// A Reference is an occurrence of an identifier which refers to a binding (as opposed to declaring one).
+type Reference struct {
+	Identifier *ast.Identifier
+
+	// The scope in which the reference occurs
+	Scope *Scope
+
+	// The binding which the identifier refers to, nil if it is not declared (i.e. it's a global variable)
+	Binding *Binding
+
+	// The kind of access. Both are set for the compound assignments and the increments and the decrements.
+	Read, Write bool
+
+	// Set if the reference is evaluated before the binding has been initialised, which throws a ReferenceError
+	TDZ bool
+}
+
+// Info holds the result of the analysis.
+type Info struct {
+	// The top-level scope
+	Global *Scope
+
+	// The scopes introduced by the nodes (see Scope.Node)
+	Scopes map[ast.Node]*Scope
+
+	// The declaring identifiers mapped to the declared bindings
+	Defs map[*ast.Identifier]*Binding
+
+	// The referencing identifiers mapped to the references
+	Uses map[*ast.Identifier]*Reference
+
+	// The references to the undeclared names in the order of appearance
+	Unresolved []*Reference
+
+	// The references evaluated in the temporal dead zone of the binding in the order of appearance
+	TDZ []*Reference
+}
+
+// Binding returns the binding which the identifier declares or refers to, or nil if there is none (e.g. if it's
+// a reference to an undeclared variable, a property name or a label).
+func (info *Info) Binding(id *ast.Identifier) *Binding {
+	if b := info.Defs[id]; b != nil {
+		return b
+	}
+	if r := info.Uses[id]; r != nil {
+		return r.Binding
+	}
+	return nil
+}
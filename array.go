@@ -370,6 +370,9 @@ func (a *arrayObject) expand(idx uint32) bool {
 				}
 				tl := int(targetLen)
 				newValues := make([]Value, tl, growCap(tl, len(a.values), cap(a.values)))
+				if vm := a.val.runtime.vm; vm != nil {
+					vm.allocated(allocArray, cap(newValues)*allocValueSize)
+				}
 				copy(newValues, a.values)
 				a.values = newValues
 			}
@@ -0,0 +1,276 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// An ApplyFunc is invoked by Apply for each node n, even if n is nil, before and/or after the node's children,
+// using a Cursor describing the current node and providing operations on it.
+//
+// The return value of ApplyFunc controls the syntax tree traversal. See Apply for details.
+type ApplyFunc func(*Cursor) bool
+
+/*
+Apply traverses a syntax tree recursively, starting with root, and calling pre and post for each node as described
+below. Apply returns the syntax tree, possibly modified.
+
+If pre is not nil, it is called for each node before the node's children are traversed (pre-order). If pre returns
+false, no children are traversed, and post is not called for that node.
+
+If post is not nil, and a prior call of pre didn't return false, post is called for each node after its children are
+traversed (post-order). If post returns false, traversal is terminated and Apply returns immediately.
+
+Only fields that refer to AST nodes are considered children; i.e., the positions and the names are not traversed,
+neither are the DeclarationList and the Program.Comments fields. Children are traversed in the order in which the fields are declared (note,
+for TemplateLiteral this means all the Elements first and then all the Expressions). The identifiers embedded by value
+(such as DotExpression.Identifier) are presented as pointers to the respective fields and can only be replaced by
+a node of the same type.
+
+The nodes inserted by the Cursor methods are not traversed, neither is the replacement node (the children of the
+original node are traversed instead). Unlike Walk, the absent children (such as a missing else branch) are passed to pre and post,
+with c.Node() returning nil.
+*/
+func Apply(root Node, pre, post ApplyFunc) (result Node) {
+	parent := &struct{ Node }{root}
+	defer func() {
+		if r := recover(); r != nil && r != abort {
+			panic(r)
+		}
+		result = parent.Node
+	}()
+	a := &application{pre: pre, post: post}
+	a.apply(reflect.ValueOf(parent).Elem().Field(0), parent, "Node", nil)
+	return
+}
+
+var abort = new(int) // singleton, to signal termination of Apply
+
+// A Cursor describes a node encountered during Apply. Information about the node and its parent is available from
+// the Node, Parent, Name, and Index methods.
+//
+// If p is a variable of type and value of the current parent node c.Parent(), and f is the field identifier with
+// name c.Name(), the following invariants hold:
+//
+//	p.f            == c.Node()  if c.Index() <  0
+//	p.f[c.Index()] == c.Node()  if c.Index() >= 0
+//
+// The methods Replace, Delete, InsertBefore, and InsertAfter can be used to change the AST without disrupting Apply.
+type Cursor struct {
+	parent Node
+	name   string
+	iter   *iterator     // valid if non-nil
+	field  reflect.Value // the field (or the slice element) containing the node
+	node   Node
+}
+
+// Node returns the current Node.
+func (c *Cursor) Node() Node { return c.node }
+
+// Parent returns the parent of the current Node.
+func (c *Cursor) Parent() Node { return c.parent }
+
+// Name returns the name of the parent Node field that contains the current Node.
+func (c *Cursor) Name() string { return c.name }
+
+// Index reports the index >= 0 of the current Node in the slice of Nodes that contains it, or a value < 0 if the
+// current Node is not part of a slice. The index of the current node changes if InsertBefore is called while
+// processing the current node.
+func (c *Cursor) Index() int {
+	if c.iter != nil {
+		return c.iter.index
+	}
+	return -1
+}
+
+// slice returns the parent's slice field containing the current Node.
+func (c *Cursor) slice() reflect.Value {
+	return reflect.ValueOf(c.parent).Elem().FieldByName(c.name)
+}
+
+// Replace replaces the current Node with n. The replacement node is not walked by Apply. It panics if n cannot be
+// stored in the field containing the current node.
+func (c *Cursor) Replace(n Node) {
+	v := reflect.ValueOf(n)
+	if !v.IsValid() {
+		v = reflect.Zero(c.field.Type())
+	}
+	if c.field.Kind() == reflect.Struct {
+		// a node embedded by value
+		if v.Type() != reflect.PointerTo(c.field.Type()) {
+			panic(fmt.Sprintf("ast.Cursor.Replace: cannot replace %s.%s with %T", reflect.TypeOf(c.parent).Elem().Name(), c.name, n))
+		}
+		c.field.Set(v.Elem())
+		c.node = n
+		return
+	}
+	if !v.Type().AssignableTo(c.field.Type()) {
+		panic(fmt.Sprintf("ast.Cursor.Replace: cannot replace %s.%s with %T", reflect.TypeOf(c.parent).Elem().Name(), c.name, n))
+	}
+	c.field.Set(v)
+	c.node = n
+}
+
+// Delete deletes the current Node from its containing slice. If the current Node is not part of a slice, Delete
+// panics.
+func (c *Cursor) Delete() {
+	if c.iter == nil {
+		panic("ast.Cursor.Delete: node not contained in slice")
+	}
+	s := c.slice()
+	i := c.Index()
+	l := s.Len()
+	reflect.Copy(s.Slice(i, l), s.Slice(i+1, l))
+	s.Index(l - 1).Set(reflect.Zero(s.Type().Elem()))
+	s.SetLen(l - 1)
+	c.iter.step--
+}
+
+// InsertAfter inserts n after the current Node in its containing slice. If the current Node is not part of a slice,
+// InsertAfter panics. Apply does not traverse n.
+func (c *Cursor) InsertAfter(n Node) {
+	if c.iter == nil {
+		panic("ast.Cursor.InsertAfter: node not contained in slice")
+	}
+	c.insert(c.Index()+1, n)
+	c.iter.step++
+	c.field = c.slice().Index(c.Index())
+}
+
+// InsertBefore inserts n before the current Node in its containing slice. If the current Node is not part of
+// a slice, InsertBefore panics. Apply does not traverse n.
+func (c *Cursor) InsertBefore(n Node) {
+	if c.iter == nil {
+		panic("ast.Cursor.InsertBefore: node not contained in slice")
+	}
+	c.insert(c.Index(), n)
+	c.iter.index++
+	c.field = c.slice().Index(c.Index())
+}
+
+func (c *Cursor) insert(i int, n Node) {
+	s := c.slice()
+	v := reflect.ValueOf(n)
+	if !v.IsValid() {
+		v = reflect.Zero(s.Type().Elem())
+	} else if !v.Type().AssignableTo(s.Type().Elem()) {
+		panic(fmt.Sprintf("ast.Cursor: cannot insert %T into %s.%s", n, reflect.TypeOf(c.parent).Elem().Name(), c.name))
+	}
+	s.Set(reflect.Append(s, reflect.Zero(s.Type().Elem())))
+	reflect.Copy(s.Slice(i+1, s.Len()), s.Slice(i, s.Len()))
+	s.Index(i).Set(v)
+}
+
+// application carries all the shared data so we can pass it around cheaply.
+type application struct {
+	pre, post ApplyFunc
+	cursor    Cursor
+	iter      iterator
+}
+
+// An iterator controls the iteration over a slice of nodes.
+type iterator struct {
+	index, step int
+}
+
+var nodeType = reflect.TypeOf((*Node)(nil)).Elem()
+
+// isNodeType reports whether a field of type t holds a child node, either as a pointer or an interface, or as
+// a struct embedded by value.
+func isNodeType(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		return t.Implements(nodeType)
+	case reflect.Struct:
+		return reflect.PointerTo(t).Implements(nodeType)
+	}
+	return false
+}
+
+func (a *application) apply(field reflect.Value, parent Node, name string, iter *iterator) {
+	var n Node
+	switch field.Kind() {
+	case reflect.Struct:
+		n = field.Addr().Interface().(Node)
+	default:
+		if !field.IsNil() {
+			n = field.Interface().(Node)
+		}
+	}
+
+	// avoid heap-allocating a new cursor for each apply call; reuse a.cursor instead
+	saved := a.cursor
+	a.cursor.parent = parent
+	a.cursor.name = name
+	a.cursor.iter = iter
+	a.cursor.field = field
+	a.cursor.node = n
+
+	if a.pre != nil && !a.pre(&a.cursor) {
+		a.cursor = saved
+		return
+	}
+
+	// walk children
+	// (the order of the fields is the order in which they are declared)
+	if v := reflect.ValueOf(n); v.IsValid() && v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+		if v.Kind() != reflect.Struct {
+			panic(fmt.Sprintf("ast.Apply: unexpected node type %T", n))
+		}
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.Name == "DeclarationList" || f.Name == "Comments" || f.Anonymous && f.Type.Kind() == reflect.Struct || !f.IsExported() {
+				// the hoisted declarations (which also appear in the body), the comments and the embedded structs
+				// (such as the Identifier in a PrivateIdentifier) are not children
+				continue
+			}
+			fv := v.Field(i)
+			switch {
+			case f.Type.Kind() == reflect.Slice && isNodeType(f.Type.Elem()):
+				a.applyList(n, f.Name)
+			case isNodeType(f.Type):
+				a.apply(fv, n, f.Name, nil)
+			}
+		}
+	}
+
+	if a.post != nil && !a.post(&a.cursor) {
+		panic(abort)
+	}
+
+	a.cursor = saved
+}
+
+func (a *application) applyList(parent Node, name string) {
+	// avoid heap-allocating a new iterator for each applyList call; reuse a.iter instead
+	saved := a.iter
+	a.iter.index = 0
+	for {
+		// must reload parent.name each time, since cursor modifications might change it
+		v := reflect.ValueOf(parent).Elem().FieldByName(name)
+		if a.iter.index >= v.Len() {
+			break
+		}
+
+		a.iter.step = 1
+		a.apply(v.Index(a.iter.index), parent, name, &a.iter)
+		a.iter.index += a.iter.step
+	}
+	a.iter = saved
+}
+
+// Rewrite traverses the syntax tree rooted at node in depth-first order and replaces each non-nil node n with f(n),
+// after its children have been rewritten. It returns the result of f for the root. See Apply for the details of
+// the traversal.
+func Rewrite(node Node, f func(Node) Node) Node {
+	return Apply(node, nil, func(c *Cursor) bool {
+		if n := c.Node(); n != nil {
+			if r := f(n); r != n {
+				c.Replace(r)
+			}
+		}
+		return true
+	})
+}
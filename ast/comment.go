@@ -0,0 +1,252 @@
+package ast
+
+import (
+	"strings"
+
+	"github.com/dop251/goja/file"
+)
+
+// A Comment represents a single //-style, /*-style or hashbang (#!) comment. The comments are only recorded by
+// the parser in the parser.ParseComments mode.
+type Comment struct {
+	Idx  file.Idx // The index of the first character of the comment
+	Text string   // The comment text including the delimiters (but excluding the line terminator of a //-comment)
+}
+
+// A CommentGroup represents a sequence of comments with no other tokens and no empty lines between them.
+type CommentGroup struct {
+	List []*Comment // len(List) > 0
+}
+
+// NodeComments holds the comments attached to a node.
+type NodeComments struct {
+	Leading  []*CommentGroup // The comments preceding the node
+	Trailing []*CommentGroup // The comments following the node on the same line (or at the end of the enclosing list)
+	Inner    []*CommentGroup // The comments inside the node which are not attached to any of its children, e.g. in `{ /* empty */ }`
+}
+
+// A CommentMap maps the AST nodes to the comments attached to them. Only the nodes that have comments are present
+// in the map.
+type CommentMap map[Node]*NodeComments
+
+func (self *Comment) Idx0() file.Idx { return self.Idx }
+func (self *Comment) Idx1() file.Idx { return self.Idx + file.Idx(len(self.Text)) }
+
+func (self *CommentGroup) Idx0() file.Idx { return self.List[0].Idx0() }
+func (self *CommentGroup) Idx1() file.Idx { return self.List[len(self.List)-1].Idx1() }
+
+// IsJSDoc reports whether the comment is a /**-style documentation comment.
+func (self *Comment) IsJSDoc() bool {
+	return strings.HasPrefix(self.Text, "/**") && self.Text != "/**/"
+}
+
+// IsLegal reports whether the comment is a "legal" comment (i.e. a license header) which should be preserved even
+// in the minified code: it either starts with //! or /*!, or contains @license or @preserve.
+func (self *Comment) IsLegal() bool {
+	t := self.Text
+	return strings.HasPrefix(t, "/*!") || strings.HasPrefix(t, "//!") ||
+		strings.Contains(t, "@license") || strings.Contains(t, "@preserve")
+}
+
+// Text returns the text of the comment group without the comment delimiters, the leading '*' decorations of the
+// /**-style comments, the trailing whitespace and the leading and trailing empty lines. The lines are separated
+// with '\n' and the result is terminated with a newline unless it is empty.
+func (self *CommentGroup) Text() string {
+	if self == nil {
+		return ""
+	}
+	var lines []string
+	for _, c := range self.List {
+		lines = append(lines, commentLines(c.Text)...)
+	}
+
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// commentLines returns the lines of a comment without the delimiters and the decorations.
+func commentLines(text string) []string {
+	switch {
+	case strings.HasPrefix(text, "//"), strings.HasPrefix(text, "#!"):
+		return []string{strings.TrimRight(strings.TrimPrefix(text[2:], " "), " \t")}
+	}
+	text = strings.TrimSuffix(strings.TrimPrefix(text, "/*"), "*/")
+	decorated := strings.HasPrefix(text, "*")
+	if decorated {
+		text = text[1:]
+	}
+	lines := strings.Split(strings.NewReplacer("\r\n", "\n", "\r", "\n", "\u2028", "\n", "\u2029", "\n").Replace(text), "\n")
+	for i, line := range lines {
+		if decorated && i > 0 {
+			if t := strings.TrimLeft(line, " \t"); strings.HasPrefix(t, "*") {
+				line = strings.TrimPrefix(t[1:], " ")
+			}
+		} else if i == 0 {
+			line = strings.TrimPrefix(line, " ")
+		}
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return lines
+}
+
+// Get returns the comments attached to the node or nil if there are none.
+func (self CommentMap) Get(node Node) *NodeComments {
+	return self[node]
+}
+
+// Leading returns the comment groups preceding the node.
+func (self CommentMap) Leading(node Node) []*CommentGroup {
+	if c := self[node]; c != nil {
+		return c.Leading
+	}
+	return nil
+}
+
+// Trailing returns the comment groups following the node.
+func (self CommentMap) Trailing(node Node) []*CommentGroup {
+	if c := self[node]; c != nil {
+		return c.Trailing
+	}
+	return nil
+}
+
+// JSDoc returns the parsed documentation comment of the node, i.e. the last /**-style comment immediately
+// preceding it, or nil if there is none. Note that the comments preceding an exported or a labelled declaration are
+// attached to the outer statement, the comments preceding a variable declaration are attached to the
+// VariableStatement (or the LexicalDeclaration) rather than to the individual bindings.
+func (self CommentMap) JSDoc(node Node) *JSDoc {
+	leading := self.Leading(node)
+	if len(leading) == 0 {
+		return nil
+	}
+	list := leading[len(leading)-1].List
+	if c := list[len(list)-1]; c.IsJSDoc() {
+		return ParseJSDoc(c)
+	}
+	return nil
+}
+
+// JSDoc is a parsed /**-style documentation comment.
+type JSDoc struct {
+	Comment     *Comment
+	Description string // The text preceding the first block tag
+	Tags        []*JSDocTag
+}
+
+// JSDocTag is a block tag of a documentation comment, such as
+//
+//	@param {string} [name="x"] The name.
+type JSDocTag struct {
+	Tag      string // The tag name without the '@', e.g. "param"
+	Type     string // The type expression without the braces, if any
+	Name     string // The name of the parameter or the property (only for @param, @property and their synonyms)
+	Optional bool   // Whether the name is enclosed in square brackets
+	Default  string // The default value following '=' inside the square brackets
+	Text     string // The rest of the tag text
+}
+
+// Tag returns the first tag with the given name (without the '@') or nil if there is none.
+func (self *JSDoc) Tag(name string) *JSDocTag {
+	for _, t := range self.Tags {
+		if t.Tag == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// jsDocNamedTags are the tags followed by a name.
+var jsDocNamedTags = map[string]bool{
+	"param":    true,
+	"arg":      true,
+	"argument": true,
+	"property": true,
+	"prop":     true,
+}
+
+// ParseJSDoc parses a /**-style documentation comment. The parsing is lenient: the malformed tags are returned as is,
+// with the unrecognised parts in the Text field.
+func ParseJSDoc(c *Comment) *JSDoc {
+	doc := &JSDoc{Comment: c}
+	var tag *JSDocTag
+	var text []string
+	finish := func() {
+		s := strings.TrimSpace(strings.Join(text, "\n"))
+		if tag == nil {
+			doc.Description = s
+		} else {
+			parseJSDocTag(tag, s)
+			doc.Tags = append(doc.Tags, tag)
+		}
+		text = text[:0]
+	}
+	for _, line := range commentLines(c.Text) {
+		if t := strings.TrimLeft(line, " \t"); strings.HasPrefix(t, "@") && len(t) > 1 {
+			finish()
+			name := t[1:]
+			rest := ""
+			if i := strings.IndexAny(name, " \t{"); i >= 0 {
+				name, rest = name[:i], name[i:]
+			}
+			tag = &JSDocTag{Tag: name}
+			line = rest
+		}
+		text = append(text, line)
+	}
+	finish()
+	return doc
+}
+
+func parseJSDocTag(tag *JSDocTag, s string) {
+	if strings.HasPrefix(s, "{") {
+		depth := 0
+		for i := 0; i < len(s); i++ {
+			switch s[i] {
+			case '{':
+				depth++
+			case '}':
+				depth--
+			}
+			if depth == 0 {
+				tag.Type = strings.TrimSpace(s[1:i])
+				s = strings.TrimSpace(s[i+1:])
+				break
+			}
+		}
+	}
+	if jsDocNamedTags[tag.Tag] && s != "" {
+		if strings.HasPrefix(s, "[") {
+			if end := strings.IndexByte(s, ']'); end > 0 {
+				name := s[1:end]
+				if eq := strings.IndexByte(name, '='); eq >= 0 {
+					tag.Default = strings.TrimSpace(name[eq+1:])
+					name = name[:eq]
+				}
+				tag.Name = strings.TrimSpace(name)
+				tag.Optional = true
+				s = s[end+1:]
+			}
+		} else {
+			end := strings.IndexAny(s, " \t\n")
+			if end < 0 {
+				end = len(s)
+			}
+			tag.Name = s[:end]
+			s = s[end:]
+		}
+		s = strings.TrimSpace(s)
+		// "@param name - description"
+		if strings.HasPrefix(s, "- ") {
+			s = strings.TrimSpace(s[2:])
+		}
+	}
+	tag.Text = s
+}
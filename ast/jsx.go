@@ -0,0 +1,118 @@
+package ast
+
+import (
+	"strings"
+
+	"github.com/dop251/goja/file"
+	"github.com/dop251/goja/unistring"
+)
+
+// The JSX nodes are only produced by the parser in the parser.JSX mode. They have no runtime semantics and must be
+// transformed into the regular expressions (see the jsx package) before the program is compiled.
+type (
+	// JSXElement is <Name Attributes...>Children...</Name> or <Name Attributes... />.
+	JSXElement struct {
+		Opening     file.Idx     // The position of the opening "<"
+		Name        Expression   // *Identifier, *ThisExpression, *DotExpression (of those) or *JSXNamespacedName
+		Attributes  []Expression // *JSXAttribute or *JSXSpreadAttribute
+		SelfClosing bool
+		Children    []Expression // *JSXText, *JSXExpressionContainer, *JSXSpreadChild, *JSXElement or *JSXFragment
+		Closing     file.Idx     // The position of the final ">"
+	}
+
+	// JSXFragment is <>Children...</>.
+	JSXFragment struct {
+		Opening  file.Idx
+		Children []Expression
+		Closing  file.Idx
+	}
+
+	// JSXNamespacedName is Namespace:Name, used as an element or an attribute name.
+	JSXNamespacedName struct {
+		Namespace *Identifier
+		Name      *Identifier
+	}
+
+	// JSXAttribute is Name or Name=Value. The Value is nil, a *StringLiteral (the Value of which has the HTML
+	// entities decoded and no escape sequences), a *JSXExpressionContainer, a *JSXElement or a *JSXFragment.
+	JSXAttribute struct {
+		Name  Expression // *Identifier or *JSXNamespacedName
+		Value Expression
+	}
+
+	// JSXSpreadAttribute is {...Argument} in the attribute list.
+	JSXSpreadAttribute struct {
+		LeftBrace  file.Idx
+		Argument   Expression
+		RightBrace file.Idx
+	}
+
+	// JSXExpressionContainer is {Expression}. The Expression is nil if the container is empty (e.g. only contains
+	// a comment).
+	JSXExpressionContainer struct {
+		LeftBrace  file.Idx
+		Expression Expression
+		RightBrace file.Idx
+	}
+
+	// JSXSpreadChild is {...Expression} in the children list.
+	JSXSpreadChild struct {
+		LeftBrace  file.Idx
+		Expression Expression
+		RightBrace file.Idx
+	}
+
+	// JSXText is the text between the tags. The Literal is the source text, the Value has the HTML entities
+	// decoded. The whitespace is preserved in both.
+	JSXText struct {
+		Idx     file.Idx
+		Literal string
+		Value   unistring.String
+	}
+)
+
+func (*JSXElement) _expressionNode()             {}
+func (*JSXFragment) _expressionNode()            {}
+func (*JSXNamespacedName) _expressionNode()      {}
+func (*JSXAttribute) _expressionNode()           {}
+func (*JSXSpreadAttribute) _expressionNode()     {}
+func (*JSXExpressionContainer) _expressionNode() {}
+func (*JSXSpreadChild) _expressionNode()         {}
+func (*JSXText) _expressionNode()                {}
+
+func (self *JSXElement) Idx0() file.Idx             { return self.Opening }
+func (self *JSXFragment) Idx0() file.Idx            { return self.Opening }
+func (self *JSXNamespacedName) Idx0() file.Idx      { return self.Namespace.Idx0() }
+func (self *JSXAttribute) Idx0() file.Idx           { return self.Name.Idx0() }
+func (self *JSXSpreadAttribute) Idx0() file.Idx     { return self.LeftBrace }
+func (self *JSXExpressionContainer) Idx0() file.Idx { return self.LeftBrace }
+func (self *JSXSpreadChild) Idx0() file.Idx         { return self.LeftBrace }
+func (self *JSXText) Idx0() file.Idx                { return self.Idx }
+
+func (self *JSXElement) Idx1() file.Idx        { return self.Closing + 1 }
+func (self *JSXFragment) Idx1() file.Idx       { return self.Closing + 1 }
+func (self *JSXNamespacedName) Idx1() file.Idx { return self.Name.Idx1() }
+func (self *JSXAttribute) Idx1() file.Idx {
+	if self.Value != nil {
+		return self.Value.Idx1()
+	}
+	return self.Name.Idx1()
+}
+func (self *JSXSpreadAttribute) Idx1() file.Idx     { return self.RightBrace + 1 }
+func (self *JSXExpressionContainer) Idx1() file.Idx { return self.RightBrace + 1 }
+func (self *JSXSpreadChild) Idx1() file.Idx         { return self.RightBrace + 1 }
+func (self *JSXText) Idx1() file.Idx                { return file.Idx(int(self.Idx) + len(self.Literal)) }
+
+// IsIntrinsic reports whether the element is an intrinsic (host) element, such as <div>, the name of which is
+// passed to the factory as a string rather than referencing a variable. These are the names starting with a lowercase
+// letter or containing a dash, and the namespaced names.
+func (self *JSXElement) IsIntrinsic() bool {
+	switch n := self.Name.(type) {
+	case *Identifier:
+		name := n.Name.String()
+		return name != "" && name[0] >= 'a' && name[0] <= 'z' || strings.IndexByte(name, '-') >= 0
+	case *JSXNamespacedName:
+		return true
+	}
+	return false
+}
@@ -80,9 +80,10 @@ type (
 	}
 
 	AssignExpression struct {
-		Operator token.Token
-		Left     Expression
-		Right    Expression
+		Operator    token.Token
+		OperatorIdx file.Idx
+		Left        Expression
+		Right       Expression
 	}
 
 	BadExpression struct {
@@ -91,10 +92,11 @@ type (
 	}
 
 	BinaryExpression struct {
-		Operator   token.Token
-		Left       Expression
-		Right      Expression
-		Comparison bool
+		Operator    token.Token
+		OperatorIdx file.Idx
+		Left        Expression
+		Right       Expression
+		Comparison  bool
 	}
 
 	BooleanLiteral struct {
@@ -114,6 +116,7 @@ type (
 		Callee           Expression
 		LeftParenthesis  file.Idx
 		ArgumentList     []Expression
+		TrailingComma    file.Idx // 0 if there is no trailing comma after the last argument
 		RightParenthesis file.Idx
 	}
 
@@ -139,6 +142,7 @@ type (
 
 	Optional struct {
 		Expression
+		QuestionDot file.Idx
 	}
 
 	FunctionLiteral struct {
@@ -194,6 +198,7 @@ type (
 		Callee           Expression
 		LeftParenthesis  file.Idx
 		ArgumentList     []Expression
+		TrailingComma    file.Idx // 0 if there is no trailing comma after the last argument
 		RightParenthesis file.Idx
 	}
 
@@ -222,10 +227,11 @@ type (
 	}
 
 	ParameterList struct {
-		Opening file.Idx
-		List    []*Binding
-		Rest    Expression
-		Closing file.Idx
+		Opening       file.Idx
+		List          []*Binding
+		Rest          Expression
+		TrailingComma file.Idx // 0 if there is no trailing comma after the last parameter
+		Closing       file.Idx
 	}
 
 	Property interface {
@@ -370,6 +376,7 @@ type (
 	CaseStatement struct {
 		Case       file.Idx
 		Test       Expression
+		Colon      file.Idx
 		Consequent []Statement
 	}
 
@@ -635,6 +642,11 @@ type Program struct {
 	DeclarationList []*VariableDeclaration
 
 	File *file.File
+
+	// The comments in the order of appearance and the comments attached to the nodes. Only set in the
+	// parser.ParseComments mode.
+	Comments   []*CommentGroup
+	CommentMap CommentMap
 }
 
 // ==== //
@@ -779,7 +791,12 @@ func (self *BranchStatement) Idx1() file.Idx {
 	}
 	return self.Label.Idx1()
 }
-func (self *CaseStatement) Idx1() file.Idx       { return self.Consequent[len(self.Consequent)-1].Idx1() }
+func (self *CaseStatement) Idx1() file.Idx {
+	if len(self.Consequent) == 0 {
+		return self.Colon + 1
+	}
+	return self.Consequent[len(self.Consequent)-1].Idx1()
+}
 func (self *CatchStatement) Idx1() file.Idx      { return self.Body.Idx1() }
 func (self *DebuggerStatement) Idx1() file.Idx   { return self.Debugger + 8 }
 func (self *DoWhileStatement) Idx1() file.Idx    { return self.RightParenthesis + 1 }
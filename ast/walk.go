@@ -0,0 +1,404 @@
+package ast
+
+import "fmt"
+
+// A Visitor's Visit method is invoked for each node encountered by Walk.
+// If the result visitor w is not nil, Walk visits each of the children
+// of node with the visitor w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+func walkExpressions(v Visitor, list []Expression) {
+	for _, x := range list {
+		if x != nil { // holes in array literals and patterns
+			Walk(v, x)
+		}
+	}
+}
+
+func walkStatements(v Visitor, list []Statement) {
+	for _, s := range list {
+		Walk(v, s)
+	}
+}
+
+func walkBindings(v Visitor, list []*Binding) {
+	for _, b := range list {
+		Walk(v, b)
+	}
+}
+
+func walkProperties(v Visitor, list []Property) {
+	for _, p := range list {
+		Walk(v, p)
+	}
+}
+
+/*
+Walk traverses an AST in depth-first order: It starts by calling v.Visit(node); node must not be nil.
+If the visitor w returned by v.Visit(node) is not nil, Walk is invoked recursively with visitor w for each
+of the non-nil children of node (in the order they appear in the source), followed by a call of w.Visit(nil).
+
+All node types are supported, including the class elements, the binding patterns and the optional chains.
+The DeclarationList fields are not traversed, because they contain the hoisted declarations which also appear
+in the body, neither are the Program.Comments (the comments can be traversed separately by passing the
+comment groups to Walk). The identifiers embedded by value (such as DotExpression.Identifier) are visited as pointers to
+the respective fields.
+*/
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	// Expressions
+	case *BadExpression, *BooleanLiteral, *Identifier, *PrivateIdentifier, *NullLiteral, *NumberLiteral,
+		*RegExpLiteral, *StringLiteral, *TemplateElement, *ThisExpression, *SuperExpression:
+		// nothing to do
+
+	case *YieldExpression:
+		if n.Argument != nil {
+			Walk(v, n.Argument)
+		}
+
+	case *AwaitExpression:
+		Walk(v, n.Argument)
+
+	case *ArrayLiteral:
+		walkExpressions(v, n.Value)
+
+	case *ArrayPattern:
+		walkExpressions(v, n.Elements)
+		if n.Rest != nil {
+			Walk(v, n.Rest)
+		}
+
+	case *AssignExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Right)
+
+	case *BinaryExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Right)
+
+	case *BracketExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Member)
+
+	case *CallExpression:
+		Walk(v, n.Callee)
+		walkExpressions(v, n.ArgumentList)
+
+	case *ConditionalExpression:
+		Walk(v, n.Test)
+		Walk(v, n.Consequent)
+		Walk(v, n.Alternate)
+
+	case *DotExpression:
+		Walk(v, n.Left)
+		Walk(v, &n.Identifier)
+
+	case *PrivateDotExpression:
+		Walk(v, n.Left)
+		Walk(v, &n.Identifier)
+
+	case *OptionalChain:
+		Walk(v, n.Expression)
+
+	case *Optional:
+		Walk(v, n.Expression)
+
+	case *FunctionLiteral:
+		if n.Name != nil {
+			Walk(v, n.Name)
+		}
+		Walk(v, n.ParameterList)
+		Walk(v, n.Body)
+
+	case *ClassLiteral:
+		if n.Name != nil {
+			Walk(v, n.Name)
+		}
+		if n.SuperClass != nil {
+			Walk(v, n.SuperClass)
+		}
+		for _, e := range n.Body {
+			Walk(v, e)
+		}
+
+	case *ExpressionBody:
+		Walk(v, n.Expression)
+
+	case *ArrowFunctionLiteral:
+		Walk(v, n.ParameterList)
+		Walk(v, n.Body)
+
+	case *NewExpression:
+		Walk(v, n.Callee)
+		walkExpressions(v, n.ArgumentList)
+
+	case *ObjectLiteral:
+		walkProperties(v, n.Value)
+
+	case *ObjectPattern:
+		walkProperties(v, n.Properties)
+		if n.Rest != nil {
+			Walk(v, n.Rest)
+		}
+
+	case *ParameterList:
+		walkBindings(v, n.List)
+		if n.Rest != nil {
+			Walk(v, n.Rest)
+		}
+
+	case *PropertyShort:
+		Walk(v, &n.Name)
+		if n.Initializer != nil {
+			Walk(v, n.Initializer)
+		}
+
+	case *PropertyKeyed:
+		Walk(v, n.Key)
+		Walk(v, n.Value)
+
+	case *SpreadElement:
+		Walk(v, n.Expression)
+
+	case *SequenceExpression:
+		walkExpressions(v, n.Sequence)
+
+	case *TemplateLiteral:
+		if n.Tag != nil {
+			Walk(v, n.Tag)
+		}
+		for i, e := range n.Elements {
+			Walk(v, e)
+			if i < len(n.Expressions) {
+				Walk(v, n.Expressions[i])
+			}
+		}
+
+	case *UnaryExpression:
+		Walk(v, n.Operand)
+
+	case *MetaProperty:
+		Walk(v, n.Meta)
+		Walk(v, n.Property)
+
+	case *JSXElement:
+		Walk(v, n.Name)
+		walkExpressions(v, n.Attributes)
+		walkExpressions(v, n.Children)
+
+	case *JSXFragment:
+		walkExpressions(v, n.Children)
+
+	case *JSXNamespacedName:
+		Walk(v, n.Namespace)
+		Walk(v, n.Name)
+
+	case *JSXAttribute:
+		Walk(v, n.Name)
+		if n.Value != nil {
+			Walk(v, n.Value)
+		}
+
+	case *JSXSpreadAttribute:
+		Walk(v, n.Argument)
+
+	case *JSXExpressionContainer:
+		if n.Expression != nil {
+			Walk(v, n.Expression)
+		}
+
+	case *JSXSpreadChild:
+		Walk(v, n.Expression)
+
+	case *JSXText:
+		// nothing to do
+
+	case *Binding:
+		Walk(v, n.Target)
+		if n.Initializer != nil {
+			Walk(v, n.Initializer)
+		}
+
+	// Statements
+	case *BadStatement, *DebuggerStatement, *EmptyStatement:
+		// nothing to do
+
+	case *BlockStatement:
+		walkStatements(v, n.List)
+
+	case *BranchStatement:
+		if n.Label != nil {
+			Walk(v, n.Label)
+		}
+
+	case *CaseStatement:
+		if n.Test != nil {
+			Walk(v, n.Test)
+		}
+		walkStatements(v, n.Consequent)
+
+	case *CatchStatement:
+		if n.Parameter != nil {
+			Walk(v, n.Parameter)
+		}
+		Walk(v, n.Body)
+
+	case *DoWhileStatement:
+		Walk(v, n.Body)
+		Walk(v, n.Test)
+
+	case *ExpressionStatement:
+		Walk(v, n.Expression)
+
+	case *ForInStatement:
+		Walk(v, n.Into)
+		Walk(v, n.Source)
+		Walk(v, n.Body)
+
+	case *ForOfStatement:
+		Walk(v, n.Into)
+		Walk(v, n.Source)
+		Walk(v, n.Body)
+
+	case *ForStatement:
+		if n.Initializer != nil {
+			Walk(v, n.Initializer)
+		}
+		if n.Test != nil {
+			Walk(v, n.Test)
+		}
+		if n.Update != nil {
+			Walk(v, n.Update)
+		}
+		Walk(v, n.Body)
+
+	case *IfStatement:
+		Walk(v, n.Test)
+		Walk(v, n.Consequent)
+		if n.Alternate != nil {
+			Walk(v, n.Alternate)
+		}
+
+	case *LabelledStatement:
+		Walk(v, n.Label)
+		Walk(v, n.Statement)
+
+	case *ReturnStatement:
+		if n.Argument != nil {
+			Walk(v, n.Argument)
+		}
+
+	case *SwitchStatement:
+		Walk(v, n.Discriminant)
+		for _, c := range n.Body {
+			Walk(v, c)
+		}
+
+	case *ThrowStatement:
+		Walk(v, n.Argument)
+
+	case *TryStatement:
+		Walk(v, n.Body)
+		if n.Catch != nil {
+			Walk(v, n.Catch)
+		}
+		if n.Finally != nil {
+			Walk(v, n.Finally)
+		}
+
+	case *VariableStatement:
+		walkBindings(v, n.List)
+
+	case *LexicalDeclaration:
+		walkBindings(v, n.List)
+
+	case *WhileStatement:
+		Walk(v, n.Test)
+		Walk(v, n.Body)
+
+	case *WithStatement:
+		Walk(v, n.Object)
+		Walk(v, n.Body)
+
+	case *FunctionDeclaration:
+		Walk(v, n.Function)
+
+	case *ClassDeclaration:
+		Walk(v, n.Class)
+
+	// Declarations and class elements
+	case *VariableDeclaration:
+		walkBindings(v, n.List)
+
+	case *FieldDefinition:
+		Walk(v, n.Key)
+		if n.Initializer != nil {
+			Walk(v, n.Initializer)
+		}
+
+	case *MethodDefinition:
+		Walk(v, n.Key)
+		Walk(v, n.Body)
+
+	case *ClassStaticBlock:
+		Walk(v, n.Block)
+
+	// For loop parts
+	case *ForLoopInitializerExpression:
+		Walk(v, n.Expression)
+
+	case *ForLoopInitializerVarDeclList:
+		walkBindings(v, n.List)
+
+	case *ForLoopInitializerLexicalDecl:
+		Walk(v, &n.LexicalDeclaration)
+
+	case *ForIntoVar:
+		Walk(v, n.Binding)
+
+	case *ForDeclaration:
+		Walk(v, n.Target)
+
+	case *ForIntoExpression:
+		Walk(v, n.Expression)
+
+	case *Program:
+		walkStatements(v, n.Body)
+
+	// Comments
+	case *Comment:
+		// nothing to do
+
+	case *CommentGroup:
+		for _, c := range n.List {
+			Walk(v, c)
+		}
+
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses an AST in depth-first order: It starts by calling f(node); node must not be nil.
+// If f returns true, Inspect invokes f recursively for each of the non-nil children of node, followed by
+// a call of f(nil). See Walk for the details.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
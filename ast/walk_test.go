@@ -0,0 +1,210 @@
+package ast_test
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/parser"
+)
+
+const walkTestScript = `
+"use strict";
+var a = 1, [b, , ...c] = [1, 2, 3], {d, e: f = 2, ...g} = {};
+let h = a?.b?.[c]?.(d);
+const i = new.target ?? null;
+label: for (let j = 0; j < 10; j++) { if (j) continue label; else break; }
+for (var k in {}) ;
+for (const [l] of []) {}
+do { a++ } while (!a);
+while (false) debugger;
+switch (a) { case 1: a = 2; default: }
+try { throw new Error(a) } catch ({message}) {} finally {}
+function* gen(x = 1, ...rest) { yield* rest; }
+async function af() { await 1; return; }
+const arrow = async (x) => x + 1;
+class C extends Object {
+	#priv = 1;
+	static s;
+	static { this.s = 1; }
+	constructor() { super(); this.#priv; }
+	get [Symbol.iterator]() { return super.x; }
+}
+tag` + "`a${1}b${2}c`" + `(...c);
+a = (1, /re/g, "s", true, 0n, ` + "`${a}`" + `);
+`
+
+func parse(t *testing.T, src string) *ast.Program {
+	prg, err := parser.ParseFile(nil, "test.js", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return prg
+}
+
+func TestWalk(t *testing.T) {
+	prg := parse(t, walkTestScript)
+	seen := make(map[string]bool)
+	depth := 0
+	ast.Inspect(prg, func(n ast.Node) bool {
+		if n == nil {
+			depth--
+			return false
+		}
+		if depth > 0 && n == prg {
+			t.Fatal("root visited twice")
+		}
+		depth++
+		seen[reflect.TypeOf(n).Elem().Name()] = true
+		return true
+	})
+	if depth != 0 {
+		t.Fatalf("unbalanced Visit(nil) calls: %d", depth)
+	}
+
+	for _, typ := range []string{
+		"Program", "VariableStatement", "ArrayPattern", "ObjectPattern", "PropertyShort", "PropertyKeyed",
+		"OptionalChain", "Optional", "MetaProperty", "LabelledStatement", "ForStatement", "ForLoopInitializerLexicalDecl",
+		"BranchStatement", "ForInStatement", "ForIntoVar", "ForOfStatement", "ForDeclaration", "DoWhileStatement",
+		"WhileStatement", "DebuggerStatement", "SwitchStatement", "CaseStatement", "TryStatement", "CatchStatement",
+		"ThrowStatement", "FunctionDeclaration", "FunctionLiteral", "ParameterList", "YieldExpression",
+		"AwaitExpression", "ReturnStatement", "ArrowFunctionLiteral", "ExpressionBody", "ClassDeclaration",
+		"ClassLiteral", "FieldDefinition", "ClassStaticBlock", "MethodDefinition", "PrivateDotExpression",
+		"PrivateIdentifier", "SuperExpression", "TemplateLiteral", "TemplateElement", "SequenceExpression",
+		"RegExpLiteral", "StringLiteral", "BooleanLiteral", "NumberLiteral", "NewExpression", "SpreadElement",
+		"BinaryExpression", "UnaryExpression", "Binding", "DotExpression", "BracketExpression", "CallExpression",
+	} {
+		if !seen[typ] {
+			t.Errorf("%s not visited", typ)
+		}
+	}
+
+	// Apply visits the same nodes
+	count := 0
+	ast.Inspect(prg, func(n ast.Node) bool {
+		if n != nil {
+			count++
+		}
+		return true
+	})
+	ast.Apply(prg, func(c *ast.Cursor) bool {
+		if c.Node() != nil {
+			count--
+		}
+		return true
+	}, nil)
+	if count != 0 {
+		t.Fatalf("Apply and Walk node counts differ by %d", count)
+	}
+}
+
+func TestWalkOrder(t *testing.T) {
+	prg := parse(t, "tag`a${b}c${d}e`; x.y.z")
+	var names []string
+	ast.Inspect(prg, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Identifier:
+			names = append(names, n.Name.String())
+		case *ast.TemplateElement:
+			names = append(names, n.Literal)
+		}
+		return true
+	})
+	if s := strings.Join(names, " "); s != "tag a b c d e x y z" {
+		t.Fatal(s)
+	}
+}
+
+func TestApply(t *testing.T) {
+	prg := parse(t, "a; b; c; d.e")
+	res := ast.Apply(prg, func(c *ast.Cursor) bool {
+		switch n := c.Node().(type) {
+		case *ast.ExpressionStatement:
+			if id, ok := n.Expression.(*ast.Identifier); ok {
+				switch id.Name {
+				case "a":
+					c.InsertBefore(&ast.EmptyStatement{})
+				case "b":
+					c.Delete()
+					return false
+				case "c":
+					c.InsertAfter(&ast.ExpressionStatement{Expression: &ast.Identifier{Name: "f"}})
+				}
+			}
+		case *ast.Identifier:
+			if c.Parent() != nil && c.Name() == "Identifier" {
+				c.Replace(&ast.Identifier{Name: "g"})
+			}
+		}
+		return true
+	}, func(c *ast.Cursor) bool {
+		if id, ok := c.Node().(*ast.Identifier); ok && id.Name == "f" {
+			t.Fatal("inserted node traversed")
+		}
+		return true
+	})
+	if res != prg {
+		t.Fatal("root has changed")
+	}
+	var parts []string
+	for _, st := range prg.Body {
+		switch st := st.(type) {
+		case *ast.EmptyStatement:
+			parts = append(parts, ";")
+		case *ast.ExpressionStatement:
+			switch e := st.Expression.(type) {
+			case *ast.Identifier:
+				parts = append(parts, e.Name.String())
+			case *ast.DotExpression:
+				parts = append(parts, fmt.Sprintf("%s.%s", e.Left.(*ast.Identifier).Name, e.Identifier.Name))
+			}
+		}
+	}
+	if s := strings.Join(parts, " "); s != "; a c f d.g" {
+		t.Fatal(s)
+	}
+}
+
+func TestApplyAbort(t *testing.T) {
+	prg := parse(t, "a; b; c")
+	var visited []string
+	ast.Apply(prg, nil, func(c *ast.Cursor) bool {
+		if id, ok := c.Node().(*ast.Identifier); ok {
+			visited = append(visited, id.Name.String())
+			return id.Name != "b"
+		}
+		return true
+	})
+	if s := strings.Join(visited, " "); s != "a b" {
+		t.Fatal(s)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	prg := parse(t, "x = 1 + 2 * 3")
+	ast.Rewrite(prg, func(n ast.Node) ast.Node {
+		if n, ok := n.(*ast.NumberLiteral); ok {
+			return &ast.NumberLiteral{Idx: n.Idx, Literal: n.Literal, Value: n.Value.(int64) * 10}
+		}
+		return n
+	})
+	var values []int64
+	ast.Inspect(prg, func(n ast.Node) bool {
+		if n, ok := n.(*ast.NumberLiteral); ok {
+			values = append(values, n.Value.(int64))
+		}
+		return true
+	})
+	if fmt.Sprint(values) != "[10 20 30]" {
+		t.Fatal(values)
+	}
+
+	res := ast.Rewrite(&ast.Identifier{Name: "a"}, func(n ast.Node) ast.Node {
+		return &ast.Identifier{Name: "b"}
+	})
+	if id, ok := res.(*ast.Identifier); !ok || id.Name != "b" {
+		t.Fatal(res)
+	}
+}
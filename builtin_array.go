@@ -24,6 +24,9 @@ func (r *Runtime) newArrayObject() *arrayObject {
 }
 
 func setArrayValues(a *arrayObject, values []Value) *arrayObject {
+	if vm := a.val.runtime.vm; vm != nil && vm.allocProf != nil && cap(values) > 0 {
+		vm.allocated(allocArray, cap(values)*allocValueSize)
+	}
 	a.values = values
 	a.length = uint32(len(values))
 	a.objCount = len(values)
@@ -222,7 +225,7 @@ func (r *Runtime) arrayproto_join(call FunctionCall) Value {
 		}
 	}
 
-	return buf.String()
+	return r.stringAllocated(buf.String())
 }
 
 func (r *Runtime) arrayproto_toString(call FunctionCall) Value {
@@ -10,10 +10,17 @@ import (
 func (r *Runtime) makeDate(args []Value, utc bool) (t time.Time, valid bool) {
 	switch {
 	case len(args) >= 2:
-		t = time.Date(1970, time.January, 1, 0, 0, 0, 0, time.Local)
-		t, valid = _dateSetYear(t, FunctionCall{Arguments: args}, 0, utc)
+		loc := r.getLocation()
+		if utc {
+			loc = time.UTC
+		}
+		t = time.Date(1970, time.January, 1, 0, 0, 0, 0, loc)
+		t, valid = _dateSetYear(t, FunctionCall{Arguments: args}, 0, loc)
 	case len(args) == 0:
-		t = r.now()
+		if r.dateTamed() {
+			return
+		}
+		t = r.currentTime()
 		valid = true
 	default: // one argument
 		if o, ok := args[0].(*Object); ok {
@@ -25,7 +32,7 @@ func (r *Runtime) makeDate(args []Value, utc bool) (t time.Time, valid bool) {
 		if !valid {
 			pv := toPrimitive(args[0])
 			if val, ok := pv.(String); ok {
-				return dateParse(val.String())
+				return dateParse(val.String(), r.getLocation())
 			}
 			pv = pv.ToNumber()
 			var n int64
@@ -69,11 +76,14 @@ func (r *Runtime) builtin_newDate(args []Value, proto *Object) *Object {
 }
 
 func (r *Runtime) builtin_date(FunctionCall) Value {
-	return asciiString(dateFormat(r.now()))
+	if r.dateTamed() {
+		return stringInvalidDate
+	}
+	return asciiString(dateFormat(r.currentTime(), r.getLocation()))
 }
 
 func (r *Runtime) date_parse(call FunctionCall) Value {
-	t, set := dateParse(call.Argument(0).toString().String())
+	t, set := dateParse(call.Argument(0).toString().String(), r.getLocation())
 	if set {
 		return intToValue(timeToMsec(t))
 	}
@@ -95,7 +105,10 @@ func (r *Runtime) date_UTC(call FunctionCall) Value {
 }
 
 func (r *Runtime) date_now(FunctionCall) Value {
-	return intToValue(timeToMsec(r.now()))
+	if r.dateTamed() {
+		return _NaN
+	}
+	return intToValue(timeToMsec(r.currentTime()))
 }
 
 func (r *Runtime) dateproto_toString(call FunctionCall) Value {
@@ -544,7 +557,7 @@ func _intArg(call FunctionCall, argNum int) (int64, bool) {
 	return n.ToInteger(), true
 }
 
-func _dateSetYear(t time.Time, call FunctionCall, argNum int, utc bool) (time.Time, bool) {
+func _dateSetYear(t time.Time, call FunctionCall, argNum int, loc *time.Location) (time.Time, bool) {
 	var year int64
 	if argNum == 0 || argNum > 0 && argNum < len(call.Arguments) {
 		var ok bool
@@ -559,10 +572,10 @@ func _dateSetYear(t time.Time, call FunctionCall, argNum int, utc bool) (time.Ti
 		year = int64(t.Year())
 	}
 
-	return _dateSetMonth(year, t, call, argNum+1, utc)
+	return _dateSetMonth(year, t, call, argNum+1, loc)
 }
 
-func _dateSetFullYear(t time.Time, call FunctionCall, argNum int, utc bool) (time.Time, bool) {
+func _dateSetFullYear(t time.Time, call FunctionCall, argNum int, loc *time.Location) (time.Time, bool) {
 	var year int64
 	if argNum == 0 || argNum > 0 && argNum < len(call.Arguments) {
 		var ok bool
@@ -573,10 +586,10 @@ func _dateSetFullYear(t time.Time, call FunctionCall, argNum int, utc bool) (tim
 	} else {
 		year = int64(t.Year())
 	}
-	return _dateSetMonth(year, t, call, argNum+1, utc)
+	return _dateSetMonth(year, t, call, argNum+1, loc)
 }
 
-func _dateSetMonth(year int64, t time.Time, call FunctionCall, argNum int, utc bool) (time.Time, bool) {
+func _dateSetMonth(year int64, t time.Time, call FunctionCall, argNum int, loc *time.Location) (time.Time, bool) {
 	var mon int64
 	if argNum == 0 || argNum > 0 && argNum < len(call.Arguments) {
 		var ok bool
@@ -588,10 +601,10 @@ func _dateSetMonth(year int64, t time.Time, call FunctionCall, argNum int, utc b
 		mon = int64(t.Month()) - 1
 	}
 
-	return _dateSetDay(year, mon, t, call, argNum+1, utc)
+	return _dateSetDay(year, mon, t, call, argNum+1, loc)
 }
 
-func _dateSetDay(year, mon int64, t time.Time, call FunctionCall, argNum int, utc bool) (time.Time, bool) {
+func _dateSetDay(year, mon int64, t time.Time, call FunctionCall, argNum int, loc *time.Location) (time.Time, bool) {
 	var day int64
 	if argNum == 0 || argNum > 0 && argNum < len(call.Arguments) {
 		var ok bool
@@ -603,10 +616,10 @@ func _dateSetDay(year, mon int64, t time.Time, call FunctionCall, argNum int, ut
 		day = int64(t.Day())
 	}
 
-	return _dateSetHours(year, mon, day, t, call, argNum+1, utc)
+	return _dateSetHours(year, mon, day, t, call, argNum+1, loc)
 }
 
-func _dateSetHours(year, mon, day int64, t time.Time, call FunctionCall, argNum int, utc bool) (time.Time, bool) {
+func _dateSetHours(year, mon, day int64, t time.Time, call FunctionCall, argNum int, loc *time.Location) (time.Time, bool) {
 	var hours int64
 	if argNum == 0 || argNum > 0 && argNum < len(call.Arguments) {
 		var ok bool
@@ -617,10 +630,10 @@ func _dateSetHours(year, mon, day int64, t time.Time, call FunctionCall, argNum
 	} else {
 		hours = int64(t.Hour())
 	}
-	return _dateSetMinutes(year, mon, day, hours, t, call, argNum+1, utc)
+	return _dateSetMinutes(year, mon, day, hours, t, call, argNum+1, loc)
 }
 
-func _dateSetMinutes(year, mon, day, hours int64, t time.Time, call FunctionCall, argNum int, utc bool) (time.Time, bool) {
+func _dateSetMinutes(year, mon, day, hours int64, t time.Time, call FunctionCall, argNum int, loc *time.Location) (time.Time, bool) {
 	var min int64
 	if argNum == 0 || argNum > 0 && argNum < len(call.Arguments) {
 		var ok bool
@@ -631,10 +644,10 @@ func _dateSetMinutes(year, mon, day, hours int64, t time.Time, call FunctionCall
 	} else {
 		min = int64(t.Minute())
 	}
-	return _dateSetSeconds(year, mon, day, hours, min, t, call, argNum+1, utc)
+	return _dateSetSeconds(year, mon, day, hours, min, t, call, argNum+1, loc)
 }
 
-func _dateSetSeconds(year, mon, day, hours, min int64, t time.Time, call FunctionCall, argNum int, utc bool) (time.Time, bool) {
+func _dateSetSeconds(year, mon, day, hours, min int64, t time.Time, call FunctionCall, argNum int, loc *time.Location) (time.Time, bool) {
 	var sec int64
 	if argNum == 0 || argNum > 0 && argNum < len(call.Arguments) {
 		var ok bool
@@ -645,10 +658,10 @@ func _dateSetSeconds(year, mon, day, hours, min int64, t time.Time, call Functio
 	} else {
 		sec = int64(t.Second())
 	}
-	return _dateSetMilliseconds(year, mon, day, hours, min, sec, t, call, argNum+1, utc)
+	return _dateSetMilliseconds(year, mon, day, hours, min, sec, t, call, argNum+1, loc)
 }
 
-func _dateSetMilliseconds(year, mon, day, hours, min, sec int64, t time.Time, call FunctionCall, argNum int, utc bool) (time.Time, bool) {
+func _dateSetMilliseconds(year, mon, day, hours, min, sec int64, t time.Time, call FunctionCall, argNum int, loc *time.Location) (time.Time, bool) {
 	var msec int64
 	if argNum == 0 || argNum > 0 && argNum < len(call.Arguments) {
 		var ok bool
@@ -665,20 +678,7 @@ func _dateSetMilliseconds(year, mon, day, hours, min, sec int64, t time.Time, ca
 		return time.Time{}, false
 	}
 
-	var loc *time.Location
-	if utc {
-		loc = time.UTC
-	} else {
-		loc = time.Local
-	}
-	r, ok := mkTime(year, mon, day, hours, min, sec, msec*1e6, loc)
-	if !ok {
-		return time.Time{}, false
-	}
-	if utc {
-		return r.In(time.Local), true
-	}
-	return r, true
+	return mkTime(year, mon, day, hours, min, sec, msec*1e6, loc)
 }
 
 func (r *Runtime) dateproto_setMilliseconds(call FunctionCall) Value {
@@ -735,7 +735,7 @@ func (r *Runtime) dateproto_setSeconds(call FunctionCall) Value {
 	obj := r.toObject(call.This)
 	if d, ok := obj.self.(*dateObject); ok {
 		tv := d.msec
-		t, ok := _dateSetFullYear(d.time(), call, -5, false)
+		t, ok := _dateSetFullYear(d.time(), call, -5, r.getLocation())
 		if !ok {
 			d.unset()
 			return _NaN
@@ -752,7 +752,7 @@ func (r *Runtime) dateproto_setUTCSeconds(call FunctionCall) Value {
 	obj := r.toObject(call.This)
 	if d, ok := obj.self.(*dateObject); ok {
 		tv := d.msec
-		t, ok := _dateSetFullYear(d.timeUTC(), call, -5, true)
+		t, ok := _dateSetFullYear(d.timeUTC(), call, -5, time.UTC)
 		if !ok {
 			d.unset()
 			return _NaN
@@ -769,7 +769,7 @@ func (r *Runtime) dateproto_setMinutes(call FunctionCall) Value {
 	obj := r.toObject(call.This)
 	if d, ok := obj.self.(*dateObject); ok {
 		tv := d.msec
-		t, ok := _dateSetFullYear(d.time(), call, -4, false)
+		t, ok := _dateSetFullYear(d.time(), call, -4, r.getLocation())
 		if !ok {
 			d.unset()
 			return _NaN
@@ -786,7 +786,7 @@ func (r *Runtime) dateproto_setUTCMinutes(call FunctionCall) Value {
 	obj := r.toObject(call.This)
 	if d, ok := obj.self.(*dateObject); ok {
 		tv := d.msec
-		t, ok := _dateSetFullYear(d.timeUTC(), call, -4, true)
+		t, ok := _dateSetFullYear(d.timeUTC(), call, -4, time.UTC)
 		if !ok {
 			d.unset()
 			return _NaN
@@ -803,7 +803,7 @@ func (r *Runtime) dateproto_setHours(call FunctionCall) Value {
 	obj := r.toObject(call.This)
 	if d, ok := obj.self.(*dateObject); ok {
 		tv := d.msec
-		t, ok := _dateSetFullYear(d.time(), call, -3, false)
+		t, ok := _dateSetFullYear(d.time(), call, -3, r.getLocation())
 		if !ok {
 			d.unset()
 			return _NaN
@@ -820,7 +820,7 @@ func (r *Runtime) dateproto_setUTCHours(call FunctionCall) Value {
 	obj := r.toObject(call.This)
 	if d, ok := obj.self.(*dateObject); ok {
 		tv := d.msec
-		t, ok := _dateSetFullYear(d.timeUTC(), call, -3, true)
+		t, ok := _dateSetFullYear(d.timeUTC(), call, -3, time.UTC)
 		if !ok {
 			d.unset()
 			return _NaN
@@ -837,7 +837,7 @@ func (r *Runtime) dateproto_setDate(call FunctionCall) Value {
 	obj := r.toObject(call.This)
 	if d, ok := obj.self.(*dateObject); ok {
 		tv := d.msec
-		t, ok := _dateSetFullYear(d.time(), limitCallArgs(call, 1), -2, false)
+		t, ok := _dateSetFullYear(d.time(), limitCallArgs(call, 1), -2, r.getLocation())
 		if !ok {
 			d.unset()
 			return _NaN
@@ -854,7 +854,7 @@ func (r *Runtime) dateproto_setUTCDate(call FunctionCall) Value {
 	obj := r.toObject(call.This)
 	if d, ok := obj.self.(*dateObject); ok {
 		tv := d.msec
-		t, ok := _dateSetFullYear(d.timeUTC(), limitCallArgs(call, 1), -2, true)
+		t, ok := _dateSetFullYear(d.timeUTC(), limitCallArgs(call, 1), -2, time.UTC)
 		if !ok {
 			d.unset()
 			return _NaN
@@ -871,7 +871,7 @@ func (r *Runtime) dateproto_setMonth(call FunctionCall) Value {
 	obj := r.toObject(call.This)
 	if d, ok := obj.self.(*dateObject); ok {
 		tv := d.msec
-		t, ok := _dateSetFullYear(d.time(), limitCallArgs(call, 2), -1, false)
+		t, ok := _dateSetFullYear(d.time(), limitCallArgs(call, 2), -1, r.getLocation())
 		if !ok {
 			d.unset()
 			return _NaN
@@ -888,7 +888,7 @@ func (r *Runtime) dateproto_setUTCMonth(call FunctionCall) Value {
 	obj := r.toObject(call.This)
 	if d, ok := obj.self.(*dateObject); ok {
 		tv := d.msec
-		t, ok := _dateSetFullYear(d.timeUTC(), limitCallArgs(call, 2), -1, true)
+		t, ok := _dateSetFullYear(d.timeUTC(), limitCallArgs(call, 2), -1, time.UTC)
 		if !ok {
 			d.unset()
 			return _NaN
@@ -908,9 +908,9 @@ func (r *Runtime) dateproto_setFullYear(call FunctionCall) Value {
 		if d.isSet() {
 			t = d.time()
 		} else {
-			t = time.Date(1970, time.January, 1, 0, 0, 0, 0, time.Local)
+			t = time.Date(1970, time.January, 1, 0, 0, 0, 0, r.getLocation())
 		}
-		t, ok := _dateSetFullYear(t, limitCallArgs(call, 3), 0, false)
+		t, ok := _dateSetFullYear(t, limitCallArgs(call, 3), 0, r.getLocation())
 		if !ok {
 			d.unset()
 			return _NaN
@@ -929,7 +929,7 @@ func (r *Runtime) dateproto_setUTCFullYear(call FunctionCall) Value {
 		} else {
 			t = time.Date(1970, time.January, 1, 0, 0, 0, 0, time.UTC)
 		}
-		t, ok := _dateSetFullYear(t, limitCallArgs(call, 3), 0, true)
+		t, ok := _dateSetFullYear(t, limitCallArgs(call, 3), 0, time.UTC)
 		if !ok {
 			d.unset()
 			return _NaN
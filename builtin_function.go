@@ -3,6 +3,9 @@ package goja
 import (
 	"math"
 	"sync"
+
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/parser"
 )
 
 func (r *Runtime) functionCtor(args []Value, proto *Object, async, generator bool) *Object {
@@ -35,11 +38,40 @@ func (r *Runtime) functionCtor(args []Value, proto *Object, async, generator boo
 	}
 	sb.WriteString(asciiString("\n})"))
 
-	ret := r.toObject(r.eval(sb.String(), false, false))
+	kind := CodeGenerationFunction
+	if async {
+		kind = CodeGenerationAsyncFunction
+	} else if generator {
+		kind = CodeGenerationGeneratorFunction
+	}
+	src := sb.String()
+	if newSrc := r.checkCodeGeneration(kind, src); !newSrc.SameAs(src) {
+		r.checkFunctionSource(newSrc, async, generator)
+		src = newSrc
+	}
+	ret := r.toObject(r.eval(src, kind, false))
 	ret.self.setProto(proto, true)
 	return ret
 }
 
+// checkFunctionSource makes sure that the source rewritten by the code generation policy is still a single function
+// expression of the kind being constructed.
+func (r *Runtime) checkFunctionSource(src String, async, generator bool) {
+	prg, err := parser.ParseFile(nil, "<eval>", escapeInvalidUtf16(src), 0, r.parserOptions...)
+	if err != nil {
+		// reported by the compiler
+		return
+	}
+	if len(prg.Body) == 1 {
+		if st, ok := prg.Body[0].(*ast.ExpressionStatement); ok {
+			if fn, ok := st.Expression.(*ast.FunctionLiteral); ok && fn.Async == async && fn.Generator == generator {
+				return
+			}
+		}
+	}
+	panic(r.newSyntaxError("Code generation policy must return a function expression of the same kind", -1))
+}
+
 func (r *Runtime) builtin_Function(args []Value, proto *Object) *Object {
 	return r.functionCtor(args, proto, false, false)
 }
@@ -153,12 +185,9 @@ func (r *Runtime) boundConstruct(f *Object, target func([]Value, *Object) *Objec
 	}
 }
 
-func (r *Runtime) functionproto_bind(call FunctionCall) Value {
-	obj := r.toObject(call.This)
-
-	fcall := r.toCallable(call.This)
-	construct := obj.self.assertConstructor()
-
+// targetFuncLength returns the length of a function wrapping obj which consumes argCount of its arguments
+// (see CopyNameAndLength).
+func targetFuncLength(obj *Object, argCount int64) Value {
 	var l = _positiveZero
 	if obj.self.hasOwnPropertyStr("length") {
 		var li int64
@@ -168,10 +197,9 @@ func (r *Runtime) functionproto_bind(call FunctionCall) Value {
 		case valueFloat:
 			switch lenProp {
 			case _positiveInf:
-				l = lenProp
-				goto lenNotInt
+				return lenProp
 			case _negativeInf:
-				goto lenNotInt
+				return _positiveZero
 			case _negativeZero:
 				// no-op, li == 0
 			default:
@@ -180,15 +208,24 @@ func (r *Runtime) functionproto_bind(call FunctionCall) Value {
 				} // else li = 0
 			}
 		}
-		if len(call.Arguments) > 1 {
-			li -= int64(len(call.Arguments)) - 1
+		if argCount > 0 {
+			li -= argCount
 		}
 		if li < 0 {
 			li = 0
 		}
 		l = intToValue(li)
 	}
-lenNotInt:
+	return l
+}
+
+func (r *Runtime) functionproto_bind(call FunctionCall) Value {
+	obj := r.toObject(call.This)
+
+	fcall := r.toCallable(call.This)
+	construct := obj.self.assertConstructor()
+
+	l := targetFuncLength(obj, int64(len(call.Arguments))-1)
 	name := obj.self.getStr("name", nil)
 	nameStr := stringBound_
 	if s, ok := name.(String); ok {
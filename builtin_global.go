@@ -383,6 +383,7 @@ func createGlobalObjectTemplate() *objectTemplate {
 	t.putStr("encodeURIComponent", func(r *Runtime) Value { return r.methodProp(r.builtin_encodeURIComponent, "encodeURIComponent", 1) })
 	t.putStr("escape", func(r *Runtime) Value { return r.methodProp(r.builtin_escape, "escape", 1) })
 	t.putStr("unescape", func(r *Runtime) Value { return r.methodProp(r.builtin_unescape, "unescape", 1) })
+	t.putStr("structuredClone", func(r *Runtime) Value { return r.methodProp(r.builtin_structuredClone, "structuredClone", 1) })
 
 	// TODO: Annex B
 
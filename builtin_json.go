@@ -262,11 +262,11 @@ func (r *Runtime) builtinJSON_stringify(call FunctionCall) Value {
 
 	if ctx.do(call.Argument(0)) {
 		if ctx.allAscii {
-			return asciiString(ctx.buf.String())
+			return r.stringAllocated(asciiString(ctx.buf.String()))
 		} else {
-			return &importedString{
+			return r.stringAllocated(&importedString{
 				s: ctx.buf.String(),
-			}
+			})
 		}
 	}
 	return _undefined
@@ -213,7 +213,10 @@ func (r *Runtime) math_pow(call FunctionCall) Value {
 }
 
 func (r *Runtime) math_random(call FunctionCall) Value {
-	return floatToValue(r.rand())
+	if r.mathTamed() {
+		panic(r.NewTypeError("Math.random() is disabled by lockdown"))
+	}
+	return floatToValue(r.random())
 }
 
 func (r *Runtime) math_round(call FunctionCall) Value {
@@ -30,6 +30,7 @@ type PromiseRejectionTracker func(p *Promise, operation PromiseRejectionOperatio
 
 type jobCallback struct {
 	callback func(FunctionCall) Value
+	fn       Value // the handler function, if any, used by heap snapshots and async stack traces
 }
 
 type promiseCapability struct {
@@ -45,6 +46,16 @@ type promiseReaction struct {
 	asyncCtx    interface{}
 }
 
+// promiseFuncObject is a native function which settles (or contributes to settling) a Promise, i.e. one of
+// its resolving functions or an element function of a combinator such as Promise.all(). It is used to follow
+// the chain of the dependent promises when capturing async stack traces.
+type promiseFuncObject struct {
+	nativeFuncObject
+	promise *Object
+	// the name of the combinator, for the element functions
+	combinator unistring.String
+}
+
 var typePromise = reflect.TypeOf((*Promise)(nil))
 
 // Promise is a Go wrapper around ECMAScript Promise. Calling Runtime.ToValue() on it
@@ -75,16 +86,50 @@ func (p *Promise) toValue(r *Runtime) Value {
 		return _null
 	}
 	promise := p.val
-	if promise.runtime != r {
+	if promise.runtime.agent != r.agent {
 		panic(r.NewTypeError("Illegal runtime transition of a Promise"))
 	}
 	return promise
 }
 
+func (r *Runtime) newPromiseFunc(call func(FunctionCall) Value, promise *Object, combinator unistring.String) *Object {
+	v := &Object{runtime: r}
+
+	f := &promiseFuncObject{
+		nativeFuncObject: nativeFuncObject{
+			baseFuncObject: baseFuncObject{
+				baseObject: baseObject{
+					class:      classFunction,
+					val:        v,
+					extensible: true,
+					prototype:  r.getFunctionPrototype(),
+				},
+			},
+			f: call,
+		},
+		promise:    promise,
+		combinator: combinator,
+	}
+	v.self = f
+	f.init("", intToValue(1))
+	return v
+}
+
+// promiseFunc returns the handler of the reaction if it's a promiseFuncObject.
+func (reaction *promiseReaction) promiseFunc() *promiseFuncObject {
+	if reaction.handler != nil {
+		if o, ok := reaction.handler.fn.(*Object); ok {
+			f, _ := o.self.(*promiseFuncObject)
+			return f
+		}
+	}
+	return nil
+}
+
 func (p *Promise) createResolvingFunctions() (resolve, reject *Object) {
 	r := p.val.runtime
 	alreadyResolved := false
-	return p.val.runtime.newNativeFunc(func(call FunctionCall) Value {
+	return r.newPromiseFunc(func(call FunctionCall) Value {
 			if alreadyResolved {
 				return _undefined
 			}
@@ -108,15 +153,15 @@ func (p *Promise) createResolvingFunctions() (resolve, reject *Object) {
 				}
 			}
 			return p.fulfill(resolution)
-		}, "", 1),
-		p.val.runtime.newNativeFunc(func(call FunctionCall) Value {
+		}, p.val, ""),
+		r.newPromiseFunc(func(call FunctionCall) Value {
 			if alreadyResolved {
 				return _undefined
 			}
 			alreadyResolved = true
 			reason := call.Argument(0)
 			return p.reject(reason)
-		}, "", 1)
+		}, p.val, "")
 }
 
 func (p *Promise) reject(reason Value) Value {
@@ -125,6 +170,9 @@ func (p *Promise) reject(reason Value) Value {
 	p.fulfillReactions, p.rejectReactions = nil, nil
 	p.state = PromiseStateRejected
 	r := p.val.runtime
+	if hooks := r.vm.hooks; hooks != nil {
+		hooks.PromiseSettled(p)
+	}
 	if !p.handled {
 		r.trackPromiseRejection(p, PromiseRejectionReject)
 	}
@@ -137,7 +185,11 @@ func (p *Promise) fulfill(value Value) Value {
 	p.result = value
 	p.fulfillReactions, p.rejectReactions = nil, nil
 	p.state = PromiseStateFulfilled
-	p.val.runtime.triggerPromiseReactions(reactions, value)
+	r := p.val.runtime
+	if hooks := r.vm.hooks; hooks != nil {
+		hooks.PromiseSettled(p)
+	}
+	r.triggerPromiseReactions(reactions, value)
 	return _undefined
 }
 
@@ -151,7 +203,7 @@ func (p *Promise) export(*objectExportCtx) interface{} {
 
 func (p *Promise) addReactions(fulfillReaction *promiseReaction, rejectReaction *promiseReaction) {
 	r := p.val.runtime
-	if tracker := r.asyncContextTracker; tracker != nil {
+	if tracker := r.agent.asyncContextTracker; tracker != nil {
 		ctx := tracker.Grab()
 		fulfillReaction.asyncCtx = ctx
 		rejectReaction.asyncCtx = ctx
@@ -187,7 +239,7 @@ func (r *Runtime) newPromiseResolveThenableJob(p *Promise, thenable Value, then
 }
 
 func (r *Runtime) enqueuePromiseJob(job func()) {
-	r.jobQueue = append(r.jobQueue, job)
+	r.agent.jobQueue = append(r.agent.jobQueue, job)
 }
 
 func (r *Runtime) triggerPromiseReactions(reactions []*promiseReaction, argument Value) {
@@ -206,17 +258,21 @@ func (r *Runtime) newPromiseReactionJob(reaction *promiseReaction, argument Valu
 				fulfill = true
 			}
 		} else {
-			if tracker := r.asyncContextTracker; tracker != nil {
+			if tracker := r.agent.asyncContextTracker; tracker != nil {
 				tracker.Resumed(reaction.asyncCtx)
 			}
-			ex := r.vm.try(func() {
+			vm := r.vm
+			prevReaction := vm.curReaction
+			vm.curReaction = reaction
+			ex := vm.try(func() {
 				handlerResult = r.callJobCallback(reaction.handler, _undefined, argument)
 				fulfill = true
 			})
+			vm.curReaction = prevReaction
 			if ex != nil {
 				handlerResult = ex.val
 			}
-			if tracker := r.asyncContextTracker; tracker != nil {
+			if tracker := r.agent.asyncContextTracker; tracker != nil {
 				tracker.Exited()
 			}
 		}
@@ -240,6 +296,9 @@ func (r *Runtime) newPromise(proto *Object) *Promise {
 	o.self = po
 	po.prototype = proto
 	po.init()
+	if hooks := r.vm.hooks; hooks != nil {
+		hooks.PromiseCreated(po)
+	}
 	return po
 }
 
@@ -313,10 +372,10 @@ func (r *Runtime) newPromiseCapability(c *Object) *promiseCapability {
 func (r *Runtime) performPromiseThen(p *Promise, onFulfilled, onRejected Value, resultCapability *promiseCapability) Value {
 	var onFulfilledJobCallback, onRejectedJobCallback *jobCallback
 	if f, ok := assertCallable(onFulfilled); ok {
-		onFulfilledJobCallback = &jobCallback{callback: f}
+		onFulfilledJobCallback = &jobCallback{callback: f, fn: onFulfilled}
 	}
 	if f, ok := assertCallable(onRejected); ok {
-		onRejectedJobCallback = &jobCallback{callback: f}
+		onRejectedJobCallback = &jobCallback{callback: f, fn: onRejected}
 	}
 	fulfillReaction := &promiseReaction{
 		capability: resultCapability,
@@ -413,7 +472,7 @@ func (r *Runtime) promise_all(call FunctionCall) Value {
 			values = append(values, _undefined)
 			nextPromise := promiseResolve(FunctionCall{This: c, Arguments: []Value{nextValue}})
 			alreadyCalled := false
-			onFulfilled := r.newNativeFunc(func(call FunctionCall) Value {
+			onFulfilled := r.newPromiseFunc(func(call FunctionCall) Value {
 				if alreadyCalled {
 					return _undefined
 				}
@@ -424,7 +483,7 @@ func (r *Runtime) promise_all(call FunctionCall) Value {
 					pcap.resolve(r.newArrayValues(values))
 				}
 				return _undefined
-			}, "", 1)
+			}, pcap.promise, "Promise.all")
 			remainingElementsCount++
 			r.invoke(nextPromise, "then", onFulfilled, pcap.rejectObj)
 		})
@@ -451,7 +510,7 @@ func (r *Runtime) promise_allSettled(call FunctionCall) Value {
 			nextPromise := promiseResolve(FunctionCall{This: c, Arguments: []Value{nextValue}})
 			alreadyCalled := false
 			reaction := func(status Value, valueKey unistring.String) *Object {
-				return r.newNativeFunc(func(call FunctionCall) Value {
+				return r.newPromiseFunc(func(call FunctionCall) Value {
 					if alreadyCalled {
 						return _undefined
 					}
@@ -465,7 +524,7 @@ func (r *Runtime) promise_allSettled(call FunctionCall) Value {
 						pcap.resolve(r.newArrayValues(values))
 					}
 					return _undefined
-				}, "", 1)
+				}, pcap.promise, "Promise.allSettled")
 			}
 			onFulfilled := reaction(asciiString("fulfilled"), "value")
 			onRejected := reaction(asciiString("rejected"), "reason")
@@ -494,7 +553,7 @@ func (r *Runtime) promise_any(call FunctionCall) Value {
 			errors = append(errors, _undefined)
 			nextPromise := promiseResolve(FunctionCall{This: c, Arguments: []Value{nextValue}})
 			alreadyCalled := false
-			onRejected := r.newNativeFunc(func(call FunctionCall) Value {
+			onRejected := r.newPromiseFunc(func(call FunctionCall) Value {
 				if alreadyCalled {
 					return _undefined
 				}
@@ -507,7 +566,7 @@ func (r *Runtime) promise_any(call FunctionCall) Value {
 					pcap.reject(_error)
 				}
 				return _undefined
-			}, "", 1)
+			}, pcap.promise, "Promise.any")
 
 			remainingElementsCount++
 			r.invoke(nextPromise, "then", pcap.resolveObj, onRejected)
@@ -639,12 +698,12 @@ func (r *Runtime) NewPromise() (promise *Promise, resolve, reject func(reason in
 //
 // See https://tc39.es/ecma262/#sec-host-promise-rejection-tracker for more details.
 func (r *Runtime) SetPromiseRejectionTracker(tracker PromiseRejectionTracker) {
-	r.promiseRejectionTracker = tracker
+	r.agent.promiseRejectionTracker = tracker
 }
 
 // SetAsyncContextTracker registers a handler that allows to track async execution contexts. See AsyncContextTracker
 // documentation for more details. Setting it to nil disables the functionality.
 // This method (as Runtime in general) is not goroutine-safe.
 func (r *Runtime) SetAsyncContextTracker(tracker AsyncContextTracker) {
-	r.asyncContextTracker = tracker
+	r.agent.asyncContextTracker = tracker
 }
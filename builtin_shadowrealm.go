@@ -0,0 +1,204 @@
+package goja
+
+import (
+	"github.com/dop251/goja/unistring"
+)
+
+// ShadowRealmInitializer is called for every realm created by the ShadowRealm constructor before it's returned
+// to the script. It can be used to add host-defined globals to the realm. If it returns an error, the constructor
+// throws it. See Runtime.SetShadowRealmInitializer().
+type ShadowRealmInitializer func(realm *Runtime) error
+
+// ShadowRealmImporter is called by ShadowRealm.prototype.importValue() to load the module identified by the
+// specifier into the realm. It should return the module namespace object (or any object whose properties are the
+// module exports). If it returns an error, the Promise returned by importValue() is rejected with a TypeError.
+// See Runtime.SetShadowRealmImporter().
+type ShadowRealmImporter func(realm *Runtime, specifier string) (*Object, error)
+
+type shadowRealmObject struct {
+	baseObject
+	realm *Runtime
+}
+
+func (r *Runtime) toShadowRealm(v Value, method string) *shadowRealmObject {
+	if obj, ok := v.(*Object); ok {
+		if s, ok := obj.self.(*shadowRealmObject); ok {
+			return s
+		}
+	}
+	panic(r.NewTypeError("Method ShadowRealm.prototype.%s called on incompatible receiver %s", method, r.objectproto_toString(FunctionCall{This: v})))
+}
+
+func (r *Runtime) builtin_newShadowRealm(args []Value, newTarget *Object) *Object {
+	if newTarget == nil {
+		panic(r.needNew("ShadowRealm"))
+	}
+	proto := r.getPrototypeFromCtor(newTarget, r.global.ShadowRealm, r.global.ShadowRealmPrototype)
+	o := &Object{runtime: r}
+
+	s := &shadowRealmObject{}
+	s.class = classShadowRealm
+	s.val = o
+	s.extensible = true
+	o.self = s
+	s.prototype = proto
+	s.init()
+	s.realm = r.NewRealm()
+	if r.shadowRealmInitializer != nil {
+		if err := r.shadowRealmInitializer(s.realm); err != nil {
+			panic(err)
+		}
+	}
+	return o
+}
+
+func (r *Runtime) shadowRealmProto_evaluate(call FunctionCall) Value {
+	s := r.toShadowRealm(call.This, "evaluate")
+	src, ok := call.Argument(0).(String)
+	if !ok {
+		panic(r.NewTypeError("ShadowRealm.prototype.evaluate: sourceText must be a string"))
+	}
+	src = r.checkCodeGeneration(CodeGenerationShadowRealm, src)
+	realm := s.realm
+	// Syntax errors are thrown in the caller realm as they are.
+	p, err := compile("<eval>", escapeInvalidUtf16(src), false, true, r.vm, false, realm.parserOptions...)
+	if err != nil {
+		panic(r.compileError(err))
+	}
+	var res Value
+	if ex := r.vm.try(func() {
+		res = realm.evalGlobal(p)
+	}); ex != nil {
+		panic(r.newShadowRealmError(ex))
+	}
+	return r.getWrappedValue(r, res)
+}
+
+func (r *Runtime) shadowRealmProto_importValue(call FunctionCall) Value {
+	s := r.toShadowRealm(call.This, "importValue")
+	specifier := call.Argument(0).String()
+	exportName, ok := call.Argument(1).(String)
+	if !ok {
+		panic(r.NewTypeError("ShadowRealm.prototype.importValue: exportName must be a string"))
+	}
+	p := r.newPromise(r.getPromisePrototype())
+	if r.shadowRealmImporter == nil {
+		p.reject(r.NewTypeError("Cannot import '%s': modules are not supported", specifier))
+		return p.val
+	}
+	ns, err := r.shadowRealmImporter(s.realm, specifier)
+	if err != nil {
+		if isUncatchableException(err) {
+			panic(err)
+		}
+		p.reject(r.NewTypeError("Cannot import '%s': %v", specifier, err))
+		return p.val
+	}
+	var res Value
+	if ex := r.vm.try(func() {
+		if !ns.hasProperty(exportName) {
+			panic(r.NewTypeError("The module '%s' does not export '%s'", specifier, exportName))
+		}
+		res = r.getWrappedValue(r, ns.get(exportName, nil))
+	}); ex != nil {
+		if o, ok := ex.val.(*Object); !ok || o.runtime != r {
+			ex = &Exception{val: r.newShadowRealmError(ex)}
+		}
+		p.reject(ex.val)
+		return p.val
+	}
+	p.fulfill(res)
+	return p.val
+}
+
+// newShadowRealmError creates a TypeError in the realm r for an exception thrown in another realm.
+func (r *Runtime) newShadowRealmError(ex *Exception) *Object {
+	msg := "an exception was thrown in the ShadowRealm"
+	// converting the value to a string may run the code in the other realm which may throw as well
+	r.vm.try(func() {
+		msg = ex.val.String()
+	})
+	return r.NewTypeError("%s", msg)
+}
+
+// getWrappedValue prepares a value for passing into the realm across the callable boundary: primitives are
+// passed as they are, callable objects are wrapped, the rest of the objects cannot be passed. The errors are
+// thrown in the current realm r.
+func (r *Runtime) getWrappedValue(realm *Runtime, v Value) Value {
+	if obj, ok := v.(*Object); ok {
+		if _, ok := obj.self.assertCallable(); !ok {
+			panic(r.NewTypeError("Cannot pass a non-callable object across the ShadowRealm boundary"))
+		}
+		return realm.newWrappedFunction(obj)
+	}
+	return v
+}
+
+// newWrappedFunction creates a function in the realm r which calls the target function (which belongs to another
+// realm) wrapping the arguments and the result.
+func (r *Runtime) newWrappedFunction(target *Object) *Object {
+	fn, _ := target.self.assertCallable()
+	targetRealm := target.runtime
+	var name unistring.String
+	var length Value
+	if ex := r.vm.try(func() {
+		length = targetFuncLength(target, 0)
+		if s, ok := target.self.getStr("name", nil).(String); ok {
+			name = s.string()
+		}
+	}); ex != nil {
+		panic(r.newShadowRealmError(ex))
+	}
+	return r.newNativeFuncAndConstruct(nil, func(call FunctionCall) Value {
+		args := make([]Value, len(call.Arguments))
+		for i, arg := range call.Arguments {
+			args[i] = r.getWrappedValue(targetRealm, arg)
+		}
+		this := r.getWrappedValue(targetRealm, call.This)
+		var res Value
+		if ex := r.vm.try(func() {
+			res = fn(FunctionCall{This: this, Arguments: args})
+		}); ex != nil {
+			panic(r.newShadowRealmError(ex))
+		}
+		return r.getWrappedValue(r, res)
+	}, nil, nil, name, length).val
+}
+
+func (r *Runtime) createShadowRealmProto(val *Object) objectImpl {
+	o := newBaseObjectObj(val, r.global.ObjectPrototype, classObject)
+
+	o._putProp("constructor", r.getShadowRealm(), true, false, true)
+	o._putProp("evaluate", r.newNativeFunc(r.shadowRealmProto_evaluate, "evaluate", 1), true, false, true)
+	o._putProp("importValue", r.newNativeFunc(r.shadowRealmProto_importValue, "importValue", 2), true, false, true)
+
+	o._putSym(SymToStringTag, valueProp(asciiString(classShadowRealm), false, false, true))
+
+	return o
+}
+
+func (r *Runtime) createShadowRealm(val *Object) objectImpl {
+	o := r.newNativeConstructOnly(val, r.builtin_newShadowRealm, r.getShadowRealmPrototype(), "ShadowRealm", 0)
+
+	return o
+}
+
+func (r *Runtime) getShadowRealmPrototype() *Object {
+	ret := r.global.ShadowRealmPrototype
+	if ret == nil {
+		ret = &Object{runtime: r}
+		r.global.ShadowRealmPrototype = ret
+		ret.self = r.createShadowRealmProto(ret)
+	}
+	return ret
+}
+
+func (r *Runtime) getShadowRealm() *Object {
+	ret := r.global.ShadowRealm
+	if ret == nil {
+		ret = &Object{runtime: r}
+		r.global.ShadowRealm = ret
+		ret.self = r.createShadowRealm(ret)
+	}
+	return ret
+}
@@ -0,0 +1,143 @@
+package goja
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestShadowRealmEvaluate(t *testing.T) {
+	const SCRIPT = `
+	const sr = new ShadowRealm();
+	assert.sameValue(Object.prototype.toString.call(sr), "[object ShadowRealm]");
+	assert.sameValue(sr.evaluate("var x = 1; globalThis.y = 2; x + y"), 3);
+	assert.sameValue(sr.evaluate("x"), 1, "var declarations persist");
+	assert.sameValue(sr.evaluate("let z = 5; z"), 5);
+	assert.sameValue(sr.evaluate("typeof z"), "undefined", "lexical declarations do not persist");
+	assert.sameValue(typeof x, "undefined", "the realm is isolated");
+	assert.sameValue(sr.evaluate("Array.prototype.push = null; typeof Array.prototype.push"), "object");
+	assert.sameValue(typeof Array.prototype.push, "function", "the intrinsics are isolated");
+
+	assert.throws(TypeError, () => sr.evaluate("[]"), "non-callable object");
+	assert.throws(TypeError, () => sr.evaluate(1), "non-string source");
+	assert.throws(SyntaxError, () => sr.evaluate("("), "syntax error");
+	assert.throws(TypeError, () => ShadowRealm());
+	assert.throws(TypeError, () => ShadowRealm.prototype.evaluate.call({}, "1"));
+	try {
+		sr.evaluate("throw new Error('boom')");
+		throw new Test262Error("not thrown");
+	} catch (e) {
+		assert.sameValue(e.constructor, TypeError);
+		assert.sameValue(e.message, "Error: boom");
+	}
+	`
+	vm := New()
+	vm.EnableShadowRealm()
+	vm.testScriptWithTestLib(SCRIPT, _undefined, t)
+}
+
+func TestShadowRealmWrappedFunctions(t *testing.T) {
+	const SCRIPT = `
+	const sr = new ShadowRealm();
+	const add = sr.evaluate("(function add(a, b) { return a + b; })");
+	assert.sameValue(add(1, 2), 3);
+	assert.sameValue(add.name, "add");
+	assert.sameValue(add.length, 2);
+	assert.sameValue(Object.getPrototypeOf(add), Function.prototype);
+	assert.sameValue(add.hasOwnProperty("prototype"), false);
+	assert.throws(TypeError, () => new add());
+	assert.throws(TypeError, () => add({}), "non-callable argument");
+
+	const apply = sr.evaluate("(cb, v) => cb(v) + 1");
+	assert.sameValue(apply(v => v * 2, 20), 41);
+	assert.throws(TypeError, () => apply(() => { throw new Error("inner"); }, 1));
+	assert.throws(TypeError, () => apply(() => ({}), 1), "non-callable result");
+
+	const getFn = sr.evaluate("() => function inner() { return 42; }");
+	assert.sameValue(getFn()(), 42);
+	`
+	vm := New()
+	vm.EnableShadowRealm()
+	vm.testScriptWithTestLib(SCRIPT, _undefined, t)
+}
+
+func TestShadowRealmHost(t *testing.T) {
+	vm := New()
+	vm.EnableShadowRealm()
+	vm.SetShadowRealmInitializer(func(realm *Runtime) error {
+		return realm.Set("hostValue", 42)
+	})
+	vm.SetShadowRealmImporter(func(realm *Runtime, specifier string) (*Object, error) {
+		if specifier != "./mod.js" {
+			return nil, errors.New("not found")
+		}
+		ns := realm.NewObject()
+		_ = ns.Set("double", realm.ToValue(func(x int) int { return x * 2 }))
+		_ = ns.Set("obj", realm.NewObject())
+		return ns, nil
+	})
+	_, err := vm.RunString(TESTLIB + `
+	const sr = new ShadowRealm();
+	assert.sameValue(sr.evaluate("hostValue"), 42);
+	var results = [];
+	sr.importValue("./mod.js", "double").then(double => results.push(double(21)));
+	sr.importValue("./mod.js", "missing").catch(e => results.push(e.constructor.name));
+	sr.importValue("./mod.js", "obj").catch(e => results.push(e.constructor.name));
+	sr.importValue("./other.js", "x").catch(e => results.push(e.message));
+	assert.throws(TypeError, () => sr.importValue("./mod.js", 1));
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := vm.Get("results").Export()
+	expected := []interface{}{int64(42), "TypeError", "TypeError", "Cannot import './other.js': not found"}
+	if len(res.([]interface{})) != len(expected) {
+		t.Fatalf("Unexpected results: %v", res)
+	}
+	for i, v := range res.([]interface{}) {
+		if v != expected[i] {
+			t.Fatalf("%d: %v", i, res)
+		}
+	}
+}
+
+func TestShadowRealmInterrupt(t *testing.T) {
+	vm := New()
+	vm.EnableShadowRealm()
+	vm.Set("interrupt", func() {
+		vm.Interrupt("halt")
+	})
+	_, err := vm.RunString(`
+	const sr = new ShadowRealm();
+	const f = sr.evaluate("cb => { cb(); for (;;) {} }");
+	try {
+		f(interrupt);
+	} catch (e) {}
+	`)
+	var ie *InterruptedError
+	if !errors.As(err, &ie) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestShadowRealmOptIn(t *testing.T) {
+	vm := New()
+	if v, err := vm.RunString(`typeof ShadowRealm`); err != nil || v.String() != "undefined" {
+		t.Fatalf("%v, %v", v, err)
+	}
+	if err := vm.Lockdown(); err != nil {
+		t.Fatal(err)
+	}
+	vm.EnableShadowRealm()
+	_, err := vm.RunString(TESTLIB + `
+	assert.sameValue(typeof ShadowRealm, "function");
+	assert(Object.isFrozen(ShadowRealm.prototype), "frozen after Lockdown");
+	const sr = new ShadowRealm();
+	assert.sameValue(sr.evaluate("typeof ShadowRealm"), "function", "inherited by the realm");
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := vm.NewRealm().RunString(`typeof ShadowRealm`); err != nil || v.String() != "function" {
+		t.Fatalf("%v, %v", v, err)
+	}
+}
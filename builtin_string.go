@@ -571,7 +571,7 @@ func (r *Runtime) stringproto_repeat(call FunctionCall) Value {
 		for i := 0; i < num; i++ {
 			sb.WriteString(string(a))
 		}
-		return asciiString(sb.String())
+		return r.stringAllocated(asciiString(sb.String()))
 	}
 
 	var sb unicodeStringBuilder
@@ -579,7 +579,7 @@ func (r *Runtime) stringproto_repeat(call FunctionCall) Value {
 	for i := 0; i < num; i++ {
 		sb.writeUnicodeString(u)
 	}
-	return sb.String()
+	return r.stringAllocated(sb.String())
 }
 
 func getReplaceValue(replaceValue Value) (str String, rcall func(FunctionCall) Value) {
@@ -62,14 +62,14 @@ func (r *Runtime) symbolproto_valueOf(call FunctionCall) Value {
 func (r *Runtime) symbol_for(call FunctionCall) Value {
 	key := call.Argument(0).toString()
 	keyStr := key.string()
-	if v := r.symbolRegistry[keyStr]; v != nil {
+	if v := r.agent.symbolRegistry[keyStr]; v != nil {
 		return v
 	}
-	if r.symbolRegistry == nil {
-		r.symbolRegistry = make(map[unistring.String]*Symbol)
+	if r.agent.symbolRegistry == nil {
+		r.agent.symbolRegistry = make(map[unistring.String]*Symbol)
 	}
 	v := newSymbol(key)
-	r.symbolRegistry[keyStr] = v
+	r.agent.symbolRegistry[keyStr] = v
 	return v
 }
 
@@ -79,7 +79,7 @@ func (r *Runtime) symbol_keyfor(call FunctionCall) Value {
 	if !ok {
 		panic(r.NewTypeError("%s is not a symbol", arg.String()))
 	}
-	for key, s := range r.symbolRegistry {
+	for key, s := range r.agent.symbolRegistry {
 		if s == sym {
 			return stringValueFromRaw(key)
 		}
@@ -0,0 +1,374 @@
+package goja
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+
+	"github.com/dop251/goja/unistring"
+)
+
+var (
+	errNoCheckpoint      = errors.New("Runtime has no checkpoint")
+	errResetWhileRunning = errors.New("Runtime cannot be reset while JavaScript code is running")
+
+	reflectTypeObjectPtr = reflect.TypeOf((*Object)(nil))
+)
+
+// checkpoint holds the state of all objects (and closure scopes) that were reachable from the global object or the
+// built-ins at the time it was taken.
+type checkpoint struct {
+	global         global
+	symbolRegistry map[unistring.String]*Symbol
+
+	objects []objectState
+	props   []propState
+	stashes []stashState
+}
+
+type objectState struct {
+	obj   *Object
+	self  objectImpl
+	saved reflect.Value // a shallow copy of *self with the containers cloned
+}
+
+type propState struct {
+	prop  *valueProperty
+	saved valueProperty
+}
+
+type stashState struct {
+	s      *stash
+	values []Value
+	names  map[unistring.String]uint32
+}
+
+type checkpointBuilder struct {
+	c       *checkpoint
+	objects map[*Object]struct{}
+	stashes map[*stash]struct{}
+	props   map[*valueProperty]struct{}
+
+	queue []*Object
+}
+
+// The interfaces below are used to access the state which is common to multiple object types.
+
+type baseObjectHolder interface {
+	getBaseObject() *baseObject
+}
+
+type stashHolder interface {
+	getStash() *stash
+}
+
+func (o *baseObject) getBaseObject() *baseObject {
+	return o
+}
+
+func (f *baseJsFuncObject) getStash() *stash {
+	return f.stash
+}
+
+func (m *orderedMap) clone() *orderedMap {
+	c := newOrderedMap(m.hash)
+	for entry := m.iterFirst; entry != nil; entry = entry.iterNext {
+		c.set(entry.key, entry.value)
+	}
+	return c
+}
+
+func cloneNames(m map[unistring.String]uint32) map[unistring.String]uint32 {
+	if m == nil {
+		return nil
+	}
+	c := make(map[unistring.String]uint32, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// cloneContainers replaces the maps and slices that are modified in place with their copies, so that the object
+// does not share them with another copy of itself.
+func cloneContainers(o objectImpl) {
+	if h, ok := o.(baseObjectHolder); ok {
+		b := h.getBaseObject()
+		if b.values != nil {
+			values := make(map[unistring.String]Value, len(b.values))
+			for k, v := range b.values {
+				values[k] = v
+			}
+			b.values = values
+		}
+		if b.propNames != nil {
+			b.propNames = append([]unistring.String(nil), b.propNames...)
+		}
+		if b.symValues != nil {
+			b.symValues = b.symValues.clone()
+		}
+	}
+	switch o := o.(type) {
+	case *arrayObject:
+		o.values = append([]Value(nil), o.values...)
+	case *sparseArrayObject:
+		o.items = append([]sparseArrayItem(nil), o.items...)
+	case *mapObject:
+		o.m = o.m.clone()
+	case *setObject:
+		o.m = o.m.clone()
+	}
+}
+
+func (b *checkpointBuilder) addValue(v Value) {
+	switch v := v.(type) {
+	case *Object:
+		if v != nil {
+			if _, exists := b.objects[v]; !exists {
+				b.objects[v] = struct{}{}
+				b.queue = append(b.queue, v)
+			}
+		}
+	case *valueProperty:
+		if _, exists := b.props[v]; !exists {
+			b.props[v] = struct{}{}
+			b.c.props = append(b.c.props, propState{prop: v, saved: *v})
+			b.addValue(v.value)
+			b.addValue(v.getterFunc)
+			b.addValue(v.setterFunc)
+		}
+	}
+}
+
+func (b *checkpointBuilder) addStash(s *stash) {
+	for ; s != nil; s = s.outer {
+		if _, exists := b.stashes[s]; exists {
+			return
+		}
+		b.stashes[s] = struct{}{}
+		b.c.stashes = append(b.c.stashes, stashState{
+			s:      s,
+			values: append([]Value(nil), s.values...),
+			names:  cloneNames(s.names),
+		})
+		for _, v := range s.values {
+			b.addValue(v)
+		}
+		b.addValue(s.obj)
+	}
+}
+
+func (b *checkpointBuilder) addObject(obj *Object) {
+	self := obj.self
+	saved := reflect.New(reflect.TypeOf(self).Elem())
+	saved.Elem().Set(reflect.ValueOf(self).Elem())
+	cloneContainers(saved.Interface().(objectImpl))
+	b.c.objects = append(b.c.objects, objectState{
+		obj:   obj,
+		self:  self,
+		saved: saved,
+	})
+
+	if h, ok := self.(baseObjectHolder); ok {
+		bo := h.getBaseObject()
+		// Only the materialised values are saved, the rest will be re-created from the template when needed.
+		b.addValue(bo.prototype)
+		for _, v := range bo.values {
+			b.addValue(v)
+		}
+		if bo.symValues != nil {
+			for entry := bo.symValues.iterFirst; entry != nil; entry = entry.iterNext {
+				b.addValue(entry.value)
+			}
+		}
+	}
+	if h, ok := self.(stashHolder); ok {
+		b.addStash(h.getStash())
+	}
+	switch o := self.(type) {
+	case *arrayObject:
+		for _, v := range o.values {
+			b.addValue(v)
+		}
+	case *sparseArrayObject:
+		for _, item := range o.items {
+			b.addValue(item.value)
+		}
+	case *mapObject:
+		for entry := o.m.iterFirst; entry != nil; entry = entry.iterNext {
+			b.addValue(entry.key)
+			b.addValue(entry.value)
+		}
+	case *setObject:
+		for entry := o.m.iterFirst; entry != nil; entry = entry.iterNext {
+			b.addValue(entry.key)
+		}
+	case *boundFuncObject:
+		b.addValue(o.wrapped)
+	case *proxyObject:
+		b.addValue(o.target)
+		if h, ok := o.handler.(*jsProxyHandler); ok {
+			b.addValue(h.handler)
+		}
+	}
+}
+
+/*
+Checkpoint captures the current state of the Runtime so that it can be restored later with Reset. A typical
+use is to set up a Runtime (add host functions, run initialisation scripts, etc.), call Checkpoint and then call
+Reset after running untrusted or tenant-specific code, which is much cheaper than creating and setting up a new
+Runtime:
+
+	vm := goja.New()
+	// set up the Runtime
+	vm.Checkpoint()
+	for req := range requests {
+		_, err := vm.RunProgram(req.prg)
+		// ...
+		err = vm.Reset()
+	}
+
+The checkpoint includes the global object and global lexical declarations (let, const and class), the built-in
+objects and all objects reachable from them, including the variables captured by the reachable functions.
+For every such object its properties, prototype and extensibility are saved, as well as the internal state of
+arrays, Maps, Sets, Dates and primitive wrappers. The contents of ArrayBuffers, WeakMaps and WeakSets are not
+saved. Objects created after the checkpoint are discarded by Reset (unless they are referenced from Go).
+
+The settings of the Runtime (such as SetFieldNameMapper, SetRandSource, etc.) are not affected by Checkpoint or Reset.
+
+Calling Checkpoint replaces the previous checkpoint. It must not be called while JavaScript code is running.
+The cost of Checkpoint and Reset is proportional to the number of reachable objects.
+*/
+func (r *Runtime) Checkpoint() {
+	b := checkpointBuilder{
+		c: &checkpoint{
+			global:         r.global,
+			symbolRegistry: make(map[unistring.String]*Symbol, len(r.agent.symbolRegistry)),
+		},
+		objects: make(map[*Object]struct{}),
+		stashes: make(map[*stash]struct{}),
+		props:   make(map[*valueProperty]struct{}),
+	}
+	for k, v := range r.agent.symbolRegistry {
+		b.c.symbolRegistry[k] = v
+	}
+
+	b.addValue(r.globalObject)
+	// Some built-ins (e.g. %ThrowTypeError%) are not reachable from the global object, so all initialised
+	// intrinsics are included explicitly.
+	g := reflect.ValueOf(&r.global).Elem()
+	for i := 0; i < g.NumField(); i++ {
+		if f := g.Field(i); f.Type() == reflectTypeObjectPtr {
+			b.addValue((*Object)(f.UnsafePointer()))
+		}
+	}
+	if o := r.global.stdRegexpProto; o != nil {
+		b.addValue(o.val)
+	}
+	b.addStash(&r.global.stash)
+
+	for len(b.queue) > 0 {
+		obj := b.queue[len(b.queue)-1]
+		b.queue = b.queue[:len(b.queue)-1]
+		b.addObject(obj)
+	}
+
+	r.checkpoint = b.c
+}
+
+// Reset restores the state of the Runtime captured by the last call to Checkpoint (see Checkpoint for details).
+// It also discards pending promise jobs and clears the interrupt flag. The same checkpoint can be restored
+// multiple times.
+//
+// Returns an error if Checkpoint has not been called or if JavaScript code is currently running.
+func (r *Runtime) Reset() error {
+	c := r.checkpoint
+	if c == nil {
+		return errNoCheckpoint
+	}
+	if len(r.vm.callStack) > 0 {
+		return errResetWhileRunning
+	}
+
+	r.global = c.global
+	r.agent.symbolRegistry = make(map[unistring.String]*Symbol, len(c.symbolRegistry))
+	for k, v := range c.symbolRegistry {
+		r.agent.symbolRegistry[k] = v
+	}
+	for _, st := range c.objects {
+		reflect.ValueOf(st.self).Elem().Set(st.saved.Elem())
+		cloneContainers(st.self)
+		st.obj.self = st.self
+	}
+	for _, st := range c.props {
+		*st.prop = st.saved
+	}
+	for _, st := range c.stashes {
+		st.s.values = append(st.s.values[:0:0], st.values...)
+		st.s.names = cloneNames(st.names)
+	}
+
+	r.agent.jobQueue = nil
+	r.toStringStack = nil
+	r.vm.ClearInterrupt()
+	return nil
+}
+
+// RuntimePool is a pool of Runtimes that have been set up in the same way. When a Runtime is returned to the pool
+// it's reset to the state it was in after the setup (see Runtime.Checkpoint for details of what is restored).
+// RuntimePool is goroutine-safe, however each Runtime obtained from it may only be used by one goroutine at a time,
+// as usual.
+type RuntimePool struct {
+	setup   func(r *Runtime) error
+	maxIdle int
+
+	mu   sync.Mutex
+	idle []*Runtime
+}
+
+// NewRuntimePool creates a new RuntimePool. The setup function (which may be nil) is called for every new Runtime
+// created by the pool. Up to maxIdle Runtimes are kept in the pool, the ones returned in excess of that are
+// discarded.
+func NewRuntimePool(setup func(r *Runtime) error, maxIdle int) *RuntimePool {
+	return &RuntimePool{
+		setup:   setup,
+		maxIdle: maxIdle,
+	}
+}
+
+// Get returns an idle Runtime from the pool or creates a new one if the pool is empty. Returns the error returned
+// by the setup function.
+func (p *RuntimePool) Get() (*Runtime, error) {
+	p.mu.Lock()
+	if n := len(p.idle); n > 0 {
+		r := p.idle[n-1]
+		p.idle[n-1] = nil
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+		return r, nil
+	}
+	p.mu.Unlock()
+
+	r := New()
+	if p.setup != nil {
+		if err := p.setup(r); err != nil {
+			return nil, err
+		}
+	}
+	r.Checkpoint()
+	return r, nil
+}
+
+// Put resets the Runtime and returns it to the pool. The Runtime must have been obtained from the same pool
+// with Get and must not be used after this call. If the Runtime cannot be reset (e.g. because it is still running)
+// it is discarded.
+func (p *RuntimePool) Put(r *Runtime) {
+	if r.Reset() != nil {
+		return
+	}
+	p.mu.Lock()
+	if len(p.idle) < p.maxIdle {
+		p.idle = append(p.idle, r)
+	}
+	p.mu.Unlock()
+}
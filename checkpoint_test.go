@@ -0,0 +1,135 @@
+package goja
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestCheckpointReset(t *testing.T) {
+	vm := New()
+	_, err := vm.RunString(`
+	var config = {name: "test", list: [1, 2]};
+	let counter = 0;
+	const next = (() => {
+		let n = 0;
+		return () => ++n;
+	})();
+	const m = new Map([["k", 1]]);
+	Array.prototype.setupMethod = function() {};
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm.Checkpoint()
+
+	const check = `
+	if (typeof leaked !== "undefined") throw new Error("leaked var");
+	if (typeof leakedLet !== "undefined") throw new Error("leaked let");
+	if (config.name !== "test" || config.extra !== undefined) throw new Error("config: " + JSON.stringify(config));
+	if (config.list.length !== 2) throw new Error("config.list: " + config.list);
+	if (counter !== 0) throw new Error("counter: " + counter);
+	if (next() !== 1) throw new Error("closure");
+	if (m.size !== 1 || m.get("k") !== 1) throw new Error("map");
+	if ([].polluted !== undefined) throw new Error("Array.prototype");
+	if (typeof [].setupMethod !== "function") throw new Error("setupMethod");
+	if (Object.prototype.polluted !== undefined) throw new Error("Object.prototype");
+	if (Map.prototype.polluted !== undefined) throw new Error("Map.prototype");
+	if (JSON.stringify !== origStringify) throw new Error("JSON.stringify");
+	if (Object.isFrozen(Math)) throw new Error("Math is frozen");
+	if (Symbol.for("x").description !== "x") throw new Error("Symbol.for");
+	`
+
+	for i := 0; i < 3; i++ {
+		vm.Set("origStringify", vm.Get("JSON").(*Object).Get("stringify"))
+		if _, err = vm.RunString(check); err != nil {
+			t.Fatal(err)
+		}
+		_, err = vm.RunString(`
+		var leaked = 1;
+		let leakedLet = 2;
+		config.name = "changed";
+		config.extra = true;
+		config.list.push(3);
+		counter++;
+		next();
+		m.set("k", 2).set("k2", 3);
+		Array.prototype.polluted = true;
+		Object.prototype.polluted = true;
+		Map.prototype.polluted = true;
+		JSON.stringify = () => "";
+		Object.freeze(Math);
+		`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := vm.Reset(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCheckpointErrors(t *testing.T) {
+	vm := New()
+	if err := vm.Reset(); err != errNoCheckpoint {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	vm.Checkpoint()
+	vm.Set("reset", func() error {
+		return vm.Reset()
+	})
+	_, err := vm.RunString(`reset()`)
+	if ex, ok := err.(*Exception); !ok || ex.Unwrap() != errResetWhileRunning {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestRuntimePool(t *testing.T) {
+	p := NewRuntimePool(func(r *Runtime) error {
+		_, err := r.RunString(`var requests = 0;`)
+		return err
+	}, 2)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, err := p.Get()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			v, err := r.RunString(`++requests`)
+			if err != nil {
+				t.Error(err)
+			} else if v.ToInteger() != 1 {
+				t.Errorf("requests: %v", v)
+			}
+			p.Put(r)
+		}()
+	}
+	wg.Wait()
+	if len(p.idle) > 2 {
+		t.Fatalf("idle: %d", len(p.idle))
+	}
+}
+
+func BenchmarkRuntimeReset(b *testing.B) {
+	vm := New()
+	_, err := vm.RunString(`
+	var data = [];
+	for (let i = 0; i < 100; i++) {
+		data.push({i, s: "item" + i});
+	}
+	`)
+	if err != nil {
+		b.Fatal(err)
+	}
+	vm.Checkpoint()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := vm.Reset(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
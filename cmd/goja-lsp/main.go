@@ -0,0 +1,42 @@
+// Command goja-lsp is a Language Server Protocol server for the scripts run by goja. It communicates over stdin and
+// stdout, the log goes to stderr. See the lsp package for the supported features.
+//
+// The globals injected by the host can be described in a JSON manifest (see lsp.Manifest) passed with -manifest.
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	"github.com/dop251/goja/lsp"
+)
+
+var manifestFile = flag.String("manifest", "", "JSON file describing the host-injected globals")
+
+func main() {
+	flag.Parse()
+	log.SetOutput(os.Stderr)
+	log.SetPrefix("goja-lsp: ")
+
+	var manifest *lsp.Manifest
+	if *manifestFile != "" {
+		m, err := lsp.LoadManifest(*manifestFile)
+		if err != nil {
+			log.Fatalf("Could not load the manifest: %v", err)
+		}
+		manifest = m
+	}
+
+	err := lsp.NewServer(manifest).Serve(os.Stdin, os.Stdout)
+	switch err {
+	case nil:
+	case io.EOF:
+		// the client has gone away without the exit notification
+	case lsp.ErrExitWithoutShutdown:
+		os.Exit(1)
+	default:
+		log.Fatal(err)
+	}
+}
@@ -3,6 +3,7 @@ package goja
 import (
 	"fmt"
 	"sort"
+	"sync"
 
 	"github.com/dop251/goja/token"
 
@@ -73,6 +74,14 @@ type Program struct {
 	funcName unistring.String
 	src      *file.File
 	srcMap   []srcMapItem
+
+	// true if this is the body of a function, in which case srcMap[0] refers to the function literal
+	isFunc bool
+	// true if srcMap records the beginning of every statement and branch, see CompileForCoverage
+	coverage bool
+
+	// set if this is a stub of a function which has not been compiled yet, see compiler_lazy.go
+	lazy *lazyFunc
 }
 
 type compiler struct {
@@ -90,6 +99,17 @@ type compiler struct {
 	codeScratchpad []instruction
 
 	stringCache map[unistring.String]Value
+
+	// compile the function bodies on the first call, see compiler_lazy.go
+	lazy     bool
+	lazyMu   sync.Mutex
+	lazyRefs []*binding // the bindings of the finalised scopes referred to by a lazily compiled function
+	// set while compiling a lazy function body, the early errors of which (including the nested functions)
+	// have already been checked
+	lazyChecked bool
+
+	// record the beginning of every statement and branch in the source map, see CompileForCoverage
+	coverage bool
 }
 
 type binding struct {
@@ -101,11 +121,15 @@ type binding struct {
 	isArg        bool
 	isVar        bool
 	inStash      bool
+	stashIdx     int
 }
 
 func (b *binding) getAccessPointsForScope(s *scope) *[]int {
 	m := b.accessPoints[s]
 	if m == nil {
+		if b.scope.finalised && b.accessPoints == nil {
+			b.scope.c.lazyRefs = append(b.scope.c.lazyRefs, b)
+		}
 		a := make([]int, 0, 1)
 		m = &a
 		if b.accessPoints == nil {
@@ -265,6 +289,7 @@ func (b *binding) emitResolveVar(strict bool) {
 }
 
 func (b *binding) moveToStash() {
+	b.scope.c.assert(!b.scope.finalised, 0, "moving binding %s to stash after finalisation", b.name)
 	if b.isArg && !b.scope.argsInStash {
 		b.scope.moveArgsToStash()
 	} else {
@@ -310,6 +335,8 @@ type scope struct {
 	argsInStash bool
 	// need 'arguments' object (functions only)
 	argsNeeded bool
+	// the variables have been allocated, see finaliseVarAlloc
+	finalised bool
 }
 
 type block struct {
@@ -409,6 +436,13 @@ func (c *compiler) emitLiteralValue(v Value) {
 	c.emit(loadVal{v})
 }
 
+// addCoverageSrcMap marks the beginning of a statement or a branch if compiling for coverage.
+func (c *compiler) addCoverageSrcMap(offset int) {
+	if c.coverage {
+		c.p.addSrcMap(offset)
+	}
+}
+
 func newCompiler() *compiler {
 	c := &compiler{
 		p: &Program{},
@@ -628,85 +662,8 @@ func (s *scope) finaliseVarAlloc(stackOffset int) (stashSize, stackSize int) {
 			this = true
 		}
 		if allInStash || b.inStash {
-			for scope, aps := range b.accessPoints {
-				var level uint32
-				for sc := scope; sc != nil && sc != s; sc = sc.outer {
-					if sc.needStash || sc.isDynamic() {
-						level++
-					}
-				}
-				if level > 255 {
-					s.c.throwSyntaxError(0, "Maximum nesting level (256) exceeded")
-				}
-				idx := (level << 24) | uint32(stashIdx)
-				base := scope.base
-				code := scope.prg.code
-				if this {
-					if derivedCtor {
-						for _, pc := range *aps {
-							ap := &code[base+pc]
-							switch (*ap).(type) {
-							case loadStack:
-								*ap = loadThisStash(idx)
-							case initStack:
-								*ap = initStash(idx)
-							case initStackP:
-								*ap = initStashP(idx)
-							case resolveThisStack:
-								*ap = resolveThisStash(idx)
-							case _ret:
-								*ap = cret(idx)
-							default:
-								s.c.assert(false, s.c.p.sourceOffset(pc), "Unsupported instruction for 'this'")
-							}
-						}
-					} else {
-						for _, pc := range *aps {
-							ap := &code[base+pc]
-							switch (*ap).(type) {
-							case loadStack:
-								*ap = loadStash(idx)
-							case initStack:
-								*ap = initStash(idx)
-							case initStackP:
-								*ap = initStashP(idx)
-							default:
-								s.c.assert(false, s.c.p.sourceOffset(pc), "Unsupported instruction for 'this'")
-							}
-						}
-					}
-				} else {
-					for _, pc := range *aps {
-						ap := &code[base+pc]
-						switch i := (*ap).(type) {
-						case loadStack:
-							*ap = loadStash(idx)
-						case storeStack:
-							*ap = storeStash(idx)
-						case storeStackP:
-							*ap = storeStashP(idx)
-						case loadStackLex:
-							*ap = loadStashLex(idx)
-						case storeStackLex:
-							*ap = storeStashLex(idx)
-						case storeStackLexP:
-							*ap = storeStashLexP(idx)
-						case initStackP:
-							*ap = initStashP(idx)
-						case initStack:
-							*ap = initStash(idx)
-						case *loadMixed:
-							i.idx = idx
-						case *loadMixedLex:
-							i.idx = idx
-						case *resolveMixed:
-							i.idx = idx
-						default:
-							s.c.assert(false, s.c.p.sourceOffset(pc), "Unsupported instruction for binding: %T", i)
-						}
-					}
-				}
-			}
+			b.stashIdx = stashIdx
+			s.finaliseStashAccessPoints(b, stashIdx, this, derivedCtor)
 			stashIdx++
 		} else {
 			var idx int
@@ -816,12 +773,102 @@ func (s *scope) finaliseVarAlloc(stackOffset int) (stashSize, stackSize int) {
 			}
 		}
 	}
+	if s.c.lazy {
+		// the access points added later by the lazily compiled functions are patched separately (see lazyFunc)
+		for _, b := range s.bindings {
+			b.accessPoints = nil
+		}
+	}
+	s.finalised = true
 	for _, nested := range s.nested {
 		nested.finaliseVarAlloc(stackIdx + stackOffset)
 	}
 	return stashIdx, stackIdx
 }
 
+// finaliseStashAccessPoints patches the access points of a binding placed in the stash.
+func (s *scope) finaliseStashAccessPoints(b *binding, stashIdx int, this, derivedCtor bool) {
+	for scope, aps := range b.accessPoints {
+		var level uint32
+		for sc := scope; sc != nil && sc != s; sc = sc.outer {
+			if sc.needStash || sc.isDynamic() {
+				level++
+			}
+		}
+		if level > 255 {
+			s.c.throwSyntaxError(0, "Maximum nesting level (256) exceeded")
+		}
+		idx := (level << 24) | uint32(stashIdx)
+		base := scope.base
+		code := scope.prg.code
+		if this {
+			if derivedCtor {
+				for _, pc := range *aps {
+					ap := &code[base+pc]
+					switch (*ap).(type) {
+					case loadStack:
+						*ap = loadThisStash(idx)
+					case initStack:
+						*ap = initStash(idx)
+					case initStackP:
+						*ap = initStashP(idx)
+					case resolveThisStack:
+						*ap = resolveThisStash(idx)
+					case _ret:
+						*ap = cret(idx)
+					default:
+						s.c.assert(false, s.c.p.sourceOffset(pc), "Unsupported instruction for 'this'")
+					}
+				}
+			} else {
+				for _, pc := range *aps {
+					ap := &code[base+pc]
+					switch (*ap).(type) {
+					case loadStack:
+						*ap = loadStash(idx)
+					case initStack:
+						*ap = initStash(idx)
+					case initStackP:
+						*ap = initStashP(idx)
+					default:
+						s.c.assert(false, s.c.p.sourceOffset(pc), "Unsupported instruction for 'this'")
+					}
+				}
+			}
+		} else {
+			for _, pc := range *aps {
+				ap := &code[base+pc]
+				switch i := (*ap).(type) {
+				case loadStack:
+					*ap = loadStash(idx)
+				case storeStack:
+					*ap = storeStash(idx)
+				case storeStackP:
+					*ap = storeStashP(idx)
+				case loadStackLex:
+					*ap = loadStashLex(idx)
+				case storeStackLex:
+					*ap = storeStashLex(idx)
+				case storeStackLexP:
+					*ap = storeStashLexP(idx)
+				case initStackP:
+					*ap = initStashP(idx)
+				case initStack:
+					*ap = initStash(idx)
+				case *loadMixed:
+					i.idx = idx
+				case *loadMixedLex:
+					i.idx = idx
+				case *resolveMixed:
+					i.idx = idx
+				default:
+					s.c.assert(false, s.c.p.sourceOffset(pc), "Unsupported instruction for binding: %T", i)
+				}
+			}
+		}
+	}
+}
+
 func (s *scope) moveArgsToStash() {
 	for _, b := range s.bindings {
 		if !b.isArg {
@@ -913,6 +960,7 @@ func (c *compiler) compile(in *ast.Program, strict, inGlobal bool, evalVm *vm) {
 
 	eval := evalVm != nil
 	c.p.src = in.File
+	c.p.coverage = c.coverage
 	c.newScope()
 	scope := c.scope
 	scope.dynamic = true
@@ -1333,6 +1381,38 @@ func (c *compiler) checkIdentifierLName(name unistring.String, offset int) {
 	}
 }
 
+// checkAssignTarget performs checkIdentifierLName for every identifier assigned to by the target, which may be
+// a destructuring pattern. The member expressions are not checked.
+func (c *compiler) checkAssignTarget(target ast.Expression) {
+	switch target := target.(type) {
+	case *ast.Identifier:
+		c.checkIdentifierLName(target.Name, int(target.Idx)-1)
+	case *ast.ObjectPattern:
+		for _, prop := range target.Properties {
+			switch prop := prop.(type) {
+			case *ast.PropertyShort:
+				c.checkIdentifierLName(prop.Name.Name, int(prop.Name.Idx)-1)
+			case *ast.PropertyKeyed:
+				c.checkAssignTarget(prop.Value)
+			}
+		}
+		if target.Rest != nil {
+			c.checkAssignTarget(target.Rest)
+		}
+	case *ast.ArrayPattern:
+		for _, elt := range target.Elements {
+			if elt != nil {
+				c.checkAssignTarget(elt)
+			}
+		}
+		if target.Rest != nil {
+			c.checkAssignTarget(target.Rest)
+		}
+	case *ast.AssignExpression:
+		c.checkAssignTarget(target.Left)
+	}
+}
+
 // Enter a 'dummy' compilation mode. Any code produced after this method is called will be discarded after
 // leaveFunc is called with no additional side effects. This is useful for compiling code inside a
 // constant falsy condition 'if' branch or a loop (i.e 'if (false) { ... } or while (false) { ... }).
@@ -1350,7 +1430,8 @@ func (c *compiler) enterDummyMode() (leaveFunc func()) {
 		}
 	}
 	c.p = &Program{
-		src: c.p.src,
+		src:      c.p.src,
+		coverage: c.coverage,
 	}
 	c.newScope()
 	return func() {
@@ -160,21 +160,27 @@ type compiledUnaryExpr struct {
 type compiledConditionalExpr struct {
 	baseCompiledExpr
 	test, consequent, alternate compiledExpr
+
+	// source offsets of the branches, used for coverage
+	consequentOffset, alternateOffset int
 }
 
 type compiledLogicalOr struct {
 	baseCompiledExpr
 	left, right compiledExpr
+	rightOffset int
 }
 
 type compiledCoalesce struct {
 	baseCompiledExpr
 	left, right compiledExpr
+	rightOffset int
 }
 
 type compiledLogicalAnd struct {
 	baseCompiledExpr
 	left, right compiledExpr
+	rightOffset int
 }
 
 type compiledBinaryExpr struct {
@@ -293,6 +299,9 @@ func (c *compiler) compileExpression(v ast.Expression) compiledExpr {
 		}
 		r.init(c, v.Yield)
 		return r
+	case *ast.JSXElement, *ast.JSXFragment:
+		c.throwSyntaxError(int(v.Idx0())-1, "JSX must be transformed before compilation")
+		panic("unreachable")
 	default:
 		c.assert(false, int(v.Idx0())-1, "Unknown expression type: %T", v)
 		panic("unreachable")
@@ -1320,44 +1329,10 @@ func (c *compiler) newCode(length, minCap int) (buf []instruction) {
 	return
 }
 
-func (e *compiledFunctionLiteral) compile() (prg *Program, name unistring.String, length int, strict bool) {
-	e.c.assert(e.typ != funcNone, e.offset, "compiledFunctionLiteral.typ is not set")
-
-	savedPrg := e.c.p
-	preambleLen := 8 // enter, boxThis, loadStack(0), initThis, createArgs, set, loadCallee, init
-	e.c.p = &Program{
-		src:    e.c.p.src,
-		code:   e.c.newCode(preambleLen, 16),
-		srcMap: []srcMapItem{{srcPos: e.offset}},
-	}
-	e.c.newScope()
+// bindParameters creates the bindings for the formal parameters and 'this' in the function scope and performs
+// the related early error checks.
+func (e *compiledFunctionLiteral) bindParameters() (hasPatterns, hasInits bool, length int, thisBinding *binding) {
 	s := e.c.scope
-	s.funcType = e.typ
-
-	if e.name != nil {
-		name = e.name.Name
-	} else {
-		name = e.lhsName
-	}
-
-	if name != "" {
-		e.c.p.funcName = name
-	}
-	savedBlock := e.c.block
-	defer func() {
-		e.c.block = savedBlock
-	}()
-
-	e.c.block = &block{
-		typ: blockScope,
-	}
-
-	if !s.strict {
-		s.strict = e.strict != nil
-	}
-
-	hasPatterns := false
-	hasInits := false
 	firstDupIdx := -1
 
 	if e.parameterList.Rest != nil {
@@ -1401,7 +1376,6 @@ func (e *compiledFunctionLiteral) compile() (prg *Program, name unistring.String
 		}
 	}
 
-	var thisBinding *binding
 	if e.typ != funcArrow {
 		thisBinding = s.createThisBinding()
 	}
@@ -1420,6 +1394,48 @@ func (e *compiledFunctionLiteral) compile() (prg *Program, name unistring.String
 			e.c.compileParameterPatternBinding(rest)
 		}
 	}
+	return
+}
+
+func (e *compiledFunctionLiteral) compile() (prg *Program, name unistring.String, length int, strict bool) {
+	e.c.assert(e.typ != funcNone, e.offset, "compiledFunctionLiteral.typ is not set")
+
+	savedPrg := e.c.p
+	preambleLen := 8 // enter, boxThis, loadStack(0), initThis, createArgs, set, loadCallee, init
+	e.c.p = &Program{
+		src:      e.c.p.src,
+		code:     e.c.newCode(preambleLen, 16),
+		srcMap:   []srcMapItem{{srcPos: e.offset}},
+		isFunc:   true,
+		coverage: e.c.coverage,
+	}
+	e.c.newScope()
+	s := e.c.scope
+	s.funcType = e.typ
+
+	if e.name != nil {
+		name = e.name.Name
+	} else {
+		name = e.lhsName
+	}
+
+	if name != "" {
+		e.c.p.funcName = name
+	}
+	savedBlock := e.c.block
+	defer func() {
+		e.c.block = savedBlock
+	}()
+
+	e.c.block = &block{
+		typ: blockScope,
+	}
+
+	if !s.strict {
+		s.strict = e.strict != nil
+	}
+
+	hasPatterns, hasInits, length, thisBinding := e.bindParameters()
 
 	paramsCount := len(e.parameterList.List)
 
@@ -1705,7 +1721,18 @@ func (e *compiledFunctionLiteral) compile() (prg *Program, name unistring.String
 }
 
 func (e *compiledFunctionLiteral) emitGetter(putOnStack bool) {
+	if e.canBeLazy() {
+		e.emitLazyGetter(putOnStack)
+		return
+	}
 	p, name, length, strict := e.compile()
+	e.emitNewFunc(p, name, length, strict)
+	if !putOnStack {
+		e.c.emit(pop)
+	}
+}
+
+func (e *compiledFunctionLiteral) emitNewFunc(p *Program, name unistring.String, length int, strict bool) {
 	switch e.typ {
 	case funcArrow:
 		if e.isAsync {
@@ -1736,9 +1763,6 @@ func (e *compiledFunctionLiteral) emitGetter(putOnStack bool) {
 	default:
 		e.c.throwSyntaxErrorf(e.offset, "Unsupported func type: %v", e.typ)
 	}
-	if !putOnStack {
-		e.c.emit(pop)
-	}
 }
 
 func (c *compiler) compileFunctionLiteral(v *ast.FunctionLiteral, isExpr bool) *compiledFunctionLiteral {
@@ -2157,6 +2181,7 @@ func (e *compiledClassLiteral) compileFieldsAndStaticBlocks(elements []clsElemen
 		src:      savedPrg.src,
 		funcName: funcName,
 		code:     e.c.newCode(2, 16),
+		coverage: e.c.coverage,
 	}
 
 	e.c.newScope()
@@ -2549,10 +2574,12 @@ func (e *compiledConditionalExpr) emitGetter(putOnStack bool) {
 	e.test.emitGetter(true)
 	j := len(e.c.p.code)
 	e.c.emit(nil)
+	e.c.addCoverageSrcMap(e.consequentOffset)
 	e.consequent.emitGetter(putOnStack)
 	j1 := len(e.c.p.code)
 	e.c.emit(nil)
 	e.c.p.code[j] = jneP(len(e.c.p.code) - j)
+	e.c.addCoverageSrcMap(e.alternateOffset)
 	e.alternate.emitGetter(putOnStack)
 	e.c.p.code[j1] = jump(len(e.c.p.code) - j1)
 }
@@ -2562,6 +2589,9 @@ func (c *compiler) compileConditionalExpression(v *ast.ConditionalExpression) co
 		test:       c.compileExpression(v.Test),
 		consequent: c.compileExpression(v.Consequent),
 		alternate:  c.compileExpression(v.Alternate),
+
+		consequentOffset: int(v.Consequent.Idx0()) - 1,
+		alternateOffset:  int(v.Alternate.Idx0()) - 1,
 	}
 	r.init(c, v.Idx0())
 	return r
@@ -2601,6 +2631,7 @@ func (e *compiledLogicalOr) emitGetter(putOnStack bool) {
 	j := len(e.c.p.code)
 	e.addSrcMap()
 	e.c.emit(nil)
+	e.c.addCoverageSrcMap(e.rightOffset)
 	e.c.emitExpr(e.right, true)
 	e.c.p.code[j] = jeq(len(e.c.p.code) - j)
 	if !putOnStack {
@@ -2642,6 +2673,7 @@ func (e *compiledCoalesce) emitGetter(putOnStack bool) {
 	j := len(e.c.p.code)
 	e.addSrcMap()
 	e.c.emit(nil)
+	e.c.addCoverageSrcMap(e.rightOffset)
 	e.c.emitExpr(e.right, true)
 	e.c.p.code[j] = jcoalesc(len(e.c.p.code) - j)
 	if !putOnStack {
@@ -2683,6 +2715,7 @@ func (e *compiledLogicalAnd) emitGetter(putOnStack bool) {
 	j = len(e.c.p.code)
 	e.addSrcMap()
 	e.c.emit(nil)
+	e.c.addCoverageSrcMap(e.rightOffset)
 	e.c.emitExpr(e.right, true)
 	e.c.p.code[j] = jne(len(e.c.p.code) - j)
 	if !putOnStack {
@@ -2808,8 +2841,9 @@ func (c *compiler) compilePrivateIn(id *ast.PrivateIdentifier, right ast.Express
 
 func (c *compiler) compileLogicalOr(left, right ast.Expression, idx file.Idx) compiledExpr {
 	r := &compiledLogicalOr{
-		left:  c.compileExpression(left),
-		right: c.compileExpression(right),
+		left:        c.compileExpression(left),
+		right:       c.compileExpression(right),
+		rightOffset: int(right.Idx0()) - 1,
 	}
 	r.init(c, idx)
 	return r
@@ -2817,8 +2851,9 @@ func (c *compiler) compileLogicalOr(left, right ast.Expression, idx file.Idx) co
 
 func (c *compiler) compileCoalesce(left, right ast.Expression, idx file.Idx) compiledExpr {
 	r := &compiledCoalesce{
-		left:  c.compileExpression(left),
-		right: c.compileExpression(right),
+		left:        c.compileExpression(left),
+		right:       c.compileExpression(right),
+		rightOffset: int(right.Idx0()) - 1,
 	}
 	r.init(c, idx)
 	return r
@@ -2826,8 +2861,9 @@ func (c *compiler) compileCoalesce(left, right ast.Expression, idx file.Idx) com
 
 func (c *compiler) compileLogicalAnd(left, right ast.Expression, idx file.Idx) compiledExpr {
 	r := &compiledLogicalAnd{
-		left:  c.compileExpression(left),
-		right: c.compileExpression(right),
+		left:        c.compileExpression(left),
+		right:       c.compileExpression(right),
+		rightOffset: int(right.Idx0()) - 1,
 	}
 	r.init(c, idx)
 	return r
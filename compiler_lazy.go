@@ -0,0 +1,627 @@
+package goja
+
+import (
+	"sync"
+
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/token"
+	"github.com/dop251/goja/unistring"
+)
+
+/*
+Lazy compilation.
+
+In the lazy mode (see CompileLazy) the bodies of the function literals are not compiled along with the code which
+contains them. Instead, the function gets a stub Program referring to a lazyFunc which compiles the body on the first
+invocation (see baseJsFuncObject.funcPrg) and caches the result. Because the stub is a part of the (shared) outer
+Program, the compiled body is shared by all Runtimes running it.
+
+The body is compiled later using the same compiler and the same (by then finalised) scopes, so the names resolve to
+the same bindings as they would in the eager mode. This only works if the variable allocation of the outer scopes
+does not depend on the body, so before emitting the stub all the names used in the body are looked up in the outer
+scopes and the bindings found are moved to the stash. The lookup is conservative (it does not take the declarations
+in the body into account), which may place a few more variables in the stash than necessary.
+
+The early errors must still be reported before anything runs, so the body of each lazily compiled function is
+checked upfront (see checkEarlyErrors). The check only creates the bindings and walks the AST, which is much cheaper
+than compiling.
+
+The functions which may affect the outer scopes in other ways are compiled eagerly. These are the ones containing a
+direct eval(), the arrow functions which use the 'this', 'arguments', 'super' or 'new.target' of the enclosing function,
+the methods and all the functions defined inside a class body.
+*/
+
+// lazyFunc holds what is needed to compile a function body which has not been compiled yet.
+type lazyFunc struct {
+	c     *compiler
+	scope *scope
+	e     *compiledFunctionLiteral
+
+	once sync.Once
+	prg  *Program
+	err  *CompilerSyntaxError
+}
+
+// funcPrg returns the Program of the function, compiling it first if it is a stub.
+func (f *baseJsFuncObject) funcPrg() *Program {
+	if l := f.prg.lazy; l != nil {
+		prg, err := l.compile()
+		if err != nil {
+			panic(f.val.runtime.compileError(err))
+		}
+		f.prg = prg
+	}
+	return f.prg
+}
+
+func (l *lazyFunc) compile() (*Program, error) {
+	l.once.Do(func() {
+		c := l.c
+		c.lazyMu.Lock()
+		defer c.lazyMu.Unlock()
+		defer func() {
+			if x := recover(); x != nil {
+				if err, ok := x.(*CompilerSyntaxError); ok {
+					l.err = err
+				} else {
+					panic(x)
+				}
+			}
+			c.scope, c.p, c.block, c.lazyRefs, c.stringCache = nil, nil, nil, nil, nil
+			c.lazyChecked = false
+			l.c, l.scope, l.e = nil, nil, nil
+		}()
+		c.scope = l.scope
+		c.lazyChecked = true
+		c.p = &Program{
+			src: l.scope.prg.src,
+		}
+		prg, _, _, _ := l.e.compile()
+		for _, b := range c.lazyRefs {
+			c.assert(b.inStash || b.scope.isDynamic(), l.e.offset, "lazily compiled function refers to a stack variable %s", b.name)
+			b.scope.finaliseStashAccessPoints(b, b.stashIdx, false, false)
+			b.accessPoints = nil
+		}
+		l.prg = prg
+	})
+	if l.err != nil {
+		return nil, l.err
+	}
+	return l.prg, nil
+}
+
+// canBeLazy reports whether the function body can be compiled lazily and if so, prepares the outer scopes for it.
+func (e *compiledFunctionLiteral) canBeLazy() bool {
+	c := e.c
+	if !c.lazy || c.classScope != nil || e.typ != funcRegular && e.typ != funcArrow {
+		return false
+	}
+	s := &lazyScan{
+		lazyScanState: &lazyScanState{
+			names: make(map[unistring.String]struct{}),
+		},
+		arrow: e.typ == funcArrow,
+	}
+	ast.Walk(s, e.parameterList)
+	for _, stmt := range e.body {
+		if s.eager {
+			break
+		}
+		ast.Walk(s, stmt)
+	}
+	if s.eager {
+		return false
+	}
+	for name := range s.names {
+		if b, _ := c.scope.lookupName(name); b != nil && !b.inStash {
+			b.moveToStash()
+		}
+	}
+	return true
+}
+
+// emitLazyGetter emits the creation of a function object with a stub Program (see lazyFunc).
+func (e *compiledFunctionLiteral) emitLazyGetter(putOnStack bool) {
+	if !e.c.lazyChecked {
+		e.checkEarlyErrors()
+	}
+	var name unistring.String
+	if e.name != nil {
+		name = e.name.Name
+	} else {
+		name = e.lhsName
+	}
+	length := 0
+	for _, item := range e.parameterList.List {
+		if item.Initializer != nil {
+			break
+		}
+		length++
+	}
+	p := &Program{
+		lazy: &lazyFunc{
+			c:     e.c,
+			scope: e.c.scope,
+			e:     e,
+		},
+		funcName: name,
+		src:      e.c.p.src,
+		srcMap:   []srcMapItem{{srcPos: e.offset}},
+		isFunc:   true,
+	}
+	e.emitNewFunc(p, name, length, e.c.scope.strict || e.strict != nil)
+	if !putOnStack {
+		e.c.emit(pop)
+	}
+}
+
+type lazyScanState struct {
+	names map[unistring.String]struct{}
+	eager bool
+}
+
+// lazyScan collects the names which may refer to the outer bindings and checks the body for the constructs which
+// prevent the lazy compilation. arrow is true while inside the arrow functions only.
+type lazyScan struct {
+	*lazyScanState
+	arrow bool
+}
+
+func (s *lazyScan) Visit(node ast.Node) ast.Visitor {
+	if s.eager {
+		return nil
+	}
+	switch n := node.(type) {
+	case *ast.Identifier:
+		if n.Name == "arguments" {
+			s.eager = s.arrow
+		} else {
+			s.names[n.Name] = struct{}{}
+		}
+	case *ast.ThisExpression, *ast.SuperExpression, *ast.MetaProperty:
+		s.eager = s.arrow
+	case *ast.CallExpression:
+		if id, ok := n.Callee.(*ast.Identifier); ok && id.Name == "eval" {
+			s.eager = true
+		}
+	case *ast.DotExpression:
+		// the property name is not a reference
+		ast.Walk(s, n.Left)
+		return nil
+	case *ast.FunctionLiteral:
+		if s.arrow {
+			return &lazyScan{lazyScanState: s.lazyScanState}
+		}
+	}
+	return s
+}
+
+// checkEarlyErrors performs the early error checks which the compiler would perform when compiling the function body,
+// so that a lazily compiled function is rejected upfront just like in the eager mode. Only the declarations are
+// processed: the bindings are created in a new function scope (which is not linked into the outer scope) by the same
+// methods the compiler uses, so they conflict in the same way. The statements and the expressions are only checked
+// for the context-dependent restrictions (the strict mode, 'super', labels, etc.). The nested functions are checked
+// recursively.
+func (e *compiledFunctionLiteral) checkEarlyErrors() {
+	c := e.c
+	savedScope, savedClassScope := c.scope, c.classScope
+	defer func() {
+		c.scope, c.classScope = savedScope, savedClassScope
+	}()
+	c.newScope()
+	s := c.scope
+	s.funcType = e.typ
+	if !s.strict {
+		s.strict = e.strict != nil
+	}
+
+	hasPatterns, hasInits, _, _ := e.bindParameters()
+	v := &earlyErrorCheck{c: c}
+	ast.Walk(v, e.parameterList)
+
+	funcs := c.extractFunctions(e.body)
+	if hasPatterns || hasInits {
+		var calleeBinding *binding
+		if e.isExpr && e.name != nil {
+			if b, created := s.bindNameLexical(e.name.Name, false, 0); created {
+				calleeBinding = b
+			}
+		}
+		c.newBlockScope()
+		c.scope.variable = true
+		c.compileDeclList(e.declarationList, false)
+		c.createFunctionBindings(funcs)
+		c.compileLexicalDeclarationsFuncBody(e.body, calleeBinding)
+	} else {
+		for _, b := range s.bindings[:len(e.parameterList.List)] {
+			b.isVar = true
+		}
+		c.compileDeclList(e.declarationList, true)
+		c.createFunctionBindings(funcs)
+		c.compileLexicalDeclarations(e.body, true)
+	}
+	v.walkStatements(e.body)
+}
+
+type earlyLabel struct {
+	name unistring.String
+	loop bool
+}
+
+// earlyErrorCheck walks a function body for checkEarlyErrors. The block scopes are entered the same way the compiler
+// does, so that the var declarations can be checked against the lexical ones.
+type earlyErrorCheck struct {
+	c      *compiler
+	labels []earlyLabel // the labels of the enclosing statements within the function
+}
+
+func (v *earlyErrorCheck) walk(nodes ...ast.Node) {
+	for _, n := range nodes {
+		if n != nil {
+			ast.Walk(v, n)
+		}
+	}
+}
+
+func (v *earlyErrorCheck) walkStatements(list []ast.Statement) {
+	for _, st := range list {
+		ast.Walk(v, st)
+	}
+}
+
+// enterScope creates a block scope and returns the function restoring the previous one.
+func (v *earlyErrorCheck) enterScope() func() {
+	c := v.c
+	saved := c.scope
+	c.newBlockScope()
+	return func() {
+		c.scope = saved
+	}
+}
+
+func (v *earlyErrorCheck) checkVarConflicts(target ast.Expression) {
+	v.c.createBindings(target, v.c.checkVarConflict)
+}
+
+func (v *earlyErrorCheck) Visit(node ast.Node) ast.Visitor {
+	c := v.c
+	switch n := node.(type) {
+	case *ast.FunctionDeclaration:
+		c.compileFunctionLiteral(n.Function, false).checkEarlyErrors()
+		return nil
+	case *ast.FunctionLiteral:
+		c.compileFunctionLiteral(n, true).checkEarlyErrors()
+		return nil
+	case *ast.ArrowFunctionLiteral:
+		c.compileArrowFunctionLiteral(n).checkEarlyErrors()
+		return nil
+	case *ast.ClassDeclaration:
+		v.class(n.Class)
+		return nil
+	case *ast.ClassLiteral:
+		v.class(n)
+		return nil
+	case *ast.ObjectLiteral:
+		v.objectLiteral(n)
+		return nil
+
+	case *ast.BlockStatement:
+		saved := c.scope
+		funcs := c.extractFunctions(n.List)
+		if len(funcs) > 0 {
+			c.newBlockScope()
+		}
+		c.createFunctionBindings(funcs)
+		c.compileLexicalDeclarations(n.List, len(funcs) > 0)
+		v.walkStatements(n.List)
+		c.scope = saved
+		return nil
+	case *ast.VariableStatement:
+		for _, b := range n.List {
+			v.checkVarConflicts(b.Target)
+		}
+	case *ast.ForLoopInitializerVarDeclList:
+		for _, b := range n.List {
+			v.checkVarConflicts(b.Target)
+		}
+	case *ast.LexicalDeclaration:
+		if n.Token == token.CONST {
+			for _, b := range n.List {
+				if id, ok := b.Target.(*ast.Identifier); ok && b.Initializer == nil {
+					c.throwSyntaxError(int(id.Idx)-1, "Missing initializer in const declaration")
+				}
+			}
+		}
+	case *ast.ForStatement:
+		if init, ok := n.Initializer.(*ast.ForLoopInitializerLexicalDecl); ok {
+			defer v.enterScope()()
+			c.createLexicalBindings(&init.LexicalDeclaration)
+		}
+		v.walk(n.Initializer, n.Test, n.Update, n.Body)
+		return nil
+	case *ast.ForInStatement:
+		v.forInto(n.Into, n.Source, n.Body)
+		return nil
+	case *ast.ForOfStatement:
+		v.forInto(n.Into, n.Source, n.Body)
+		return nil
+	case *ast.SwitchStatement:
+		v.walk(n.Discriminant)
+		defer v.enterScope()()
+		var funcs []*ast.FunctionDeclaration
+		for _, s := range n.Body {
+			funcs = append(funcs, c.extractFunctions(s.Consequent)...)
+		}
+		c.createFunctionBindings(funcs)
+		for _, s := range n.Body {
+			c.compileLexicalDeclarations(s.Consequent, true)
+		}
+		for _, s := range n.Body {
+			v.walk(s.Test)
+			v.walkStatements(s.Consequent)
+		}
+		return nil
+	case *ast.CatchStatement:
+		if n.Parameter == nil {
+			return v
+		}
+		defer v.enterScope()()
+		list := n.Body.List
+		funcs := c.extractFunctions(list)
+		c.createBindings(n.Parameter, func(name unistring.String, offset int) {
+			if c.scope.strict {
+				switch name {
+				case "arguments", "eval":
+					c.throwSyntaxError(offset, "Catch variable may not be eval or arguments in strict mode")
+				}
+			}
+			c.scope.bindNameLexical(name, true, offset)
+		})
+		for _, decl := range funcs {
+			c.scope.bindNameLexical(decl.Function.Name.Name, true, int(decl.Function.Name.Idx1())-1)
+		}
+		c.compileLexicalDeclarations(list, true)
+		v.walk(n.Parameter)
+		v.walkStatements(list)
+		return nil
+	case *ast.WithStatement:
+		if c.scope.strict {
+			c.throwSyntaxError(int(n.With)-1, "Strict mode code may not include a with statement")
+		}
+	case *ast.LabelledStatement:
+		if c.scope.strict {
+			c.checkIdentifierName(n.Label.Name, int(n.Label.Idx)-1)
+		}
+		var loop bool
+		switch n.Statement.(type) {
+		case *ast.ForStatement, *ast.ForInStatement, *ast.ForOfStatement, *ast.WhileStatement, *ast.DoWhileStatement:
+			loop = true
+		}
+		labels := append(v.labels[:len(v.labels):len(v.labels)], earlyLabel{name: n.Label.Name, loop: loop})
+		ast.Walk(&earlyErrorCheck{c: c, labels: labels}, n.Statement)
+		return nil
+	case *ast.BranchStatement:
+		if n.Token == token.CONTINUE && n.Label != nil {
+			for i := len(v.labels) - 1; i >= 0; i-- {
+				if l := v.labels[i]; l.name == n.Label.Name {
+					if !l.loop {
+						c.throwSyntaxErrorf(int(n.Label.Idx)-1, "Illegal continue statement: '%s' does not denote an iteration statement", n.Label.Name)
+					}
+					break
+				}
+			}
+		}
+		return nil
+
+	case *ast.Identifier:
+		if c.scope.strict {
+			c.checkIdentifierName(n.Name, int(n.Idx)-1)
+		}
+		if n.Name == "arguments" {
+			// rejects it within the class field initializers and the static blocks
+			c.scope.lookupName(n.Name)
+		}
+	case *ast.UnaryExpression:
+		operand := n.Operand
+		if chain, ok := operand.(*ast.OptionalChain); ok {
+			operand = chain.Expression
+		}
+		switch operand := operand.(type) {
+		case *ast.Identifier:
+			if c.scope.strict {
+				switch n.Operator {
+				case token.DELETE:
+					c.throwSyntaxError(int(operand.Idx)-1, "Delete of an unqualified identifier in strict mode")
+				case token.INCREMENT, token.DECREMENT:
+					c.checkIdentifierLName(operand.Name, int(operand.Idx)-1)
+				}
+			}
+		case *ast.PrivateDotExpression:
+			if n.Operator == token.DELETE {
+				r := &compiledPrivateDotExpr{
+					name: operand.Identifier.Name,
+				}
+				r.init(c, operand.Identifier.Idx)
+				r.emitDelete(false)
+			}
+		}
+	case *ast.AssignExpression:
+		if c.scope.strict {
+			c.checkAssignTarget(n.Left)
+		}
+	case *ast.NumberLiteral:
+		c.compileNumberLiteral(n)
+	case *ast.SuperExpression:
+		c.throwSyntaxError(int(n.Idx0())-1, "'super' keyword unexpected here")
+	case *ast.CallExpression:
+		if sup, ok := n.Callee.(*ast.SuperExpression); ok {
+			if s := c.scope.nearestThis(); s == nil || s.funcType != funcDerivedCtor {
+				c.throwSyntaxError(int(sup.Idx0())-1, "'super' keyword unexpected here")
+			}
+			for _, arg := range n.ArgumentList {
+				v.walk(arg)
+			}
+			return nil
+		}
+	case *ast.DotExpression:
+		if sup, ok := n.Left.(*ast.SuperExpression); ok {
+			c.checkSuperBase(sup.Idx)
+			return nil
+		}
+		v.walk(n.Left)
+		return nil
+	case *ast.BracketExpression:
+		if sup, ok := n.Left.(*ast.SuperExpression); ok {
+			c.checkSuperBase(sup.Idx)
+			v.walk(n.Member)
+			return nil
+		}
+	case *ast.MetaProperty:
+		if s := c.scope.nearestThis(); s == nil || s.funcType == funcNone {
+			c.throwSyntaxError(int(n.Idx0())-1, "new.target expression is not allowed here")
+		}
+		return nil
+	case *ast.PrivateDotExpression:
+		c.resolvePrivateName(n.Identifier.Name, int(n.Identifier.Idx)-1)
+		v.walk(n.Left)
+		return nil
+	case *ast.BinaryExpression:
+		if id, ok := n.Left.(*ast.PrivateIdentifier); ok {
+			c.resolvePrivateName(id.Name, int(id.Idx)-1)
+			v.walk(n.Right)
+			return nil
+		}
+	}
+	return v
+}
+
+func (v *earlyErrorCheck) forInto(into ast.ForInto, source ast.Expression, body ast.Statement) {
+	switch into := into.(type) {
+	case *ast.ForDeclaration:
+		defer v.enterScope()()
+		v.c.createLexicalBinding(into.Target, into.IsConst)
+	case *ast.ForIntoVar:
+		if _, ok := into.Binding.Target.(ast.Pattern); ok {
+			v.checkVarConflicts(into.Binding.Target)
+		}
+	case *ast.ForIntoExpression:
+		if v.c.scope.strict {
+			v.c.checkAssignTarget(into.Expression)
+		}
+	}
+	v.walk(into, source, body)
+}
+
+func (v *earlyErrorCheck) objectLiteral(o *ast.ObjectLiteral) {
+	c := v.c
+	hasProto := false
+	for _, prop := range o.Value {
+		switch prop := prop.(type) {
+		case *ast.PropertyKeyed:
+			if prop.Computed {
+				v.walk(prop.Key)
+			} else if key, ok := prop.Key.(*ast.StringLiteral); ok && key.Value == __proto__ {
+				if hasProto {
+					c.throwSyntaxError(int(prop.Idx0())-1, "Duplicate __proto__ fields are not allowed in object literals")
+				}
+				hasProto = true
+			}
+			if fn, ok := prop.Value.(*ast.FunctionLiteral); ok && prop.Kind != ast.PropertyKindValue {
+				f := c.compileFunctionLiteral(fn, true)
+				f.typ = funcMethod
+				f.checkEarlyErrors()
+			} else {
+				v.walk(prop.Value)
+			}
+		case *ast.PropertyShort:
+			if prop.Initializer != nil {
+				c.throwSyntaxError(int(prop.Initializer.Idx0())-1, "Invalid shorthand property initializer")
+			}
+			if c.scope.strict && prop.Name.Name == "let" {
+				c.throwSyntaxError(int(o.Idx0())-1, "'let' cannot be used as a shorthand property in strict mode")
+			}
+			v.walk(&prop.Name)
+		default:
+			v.walk(prop)
+		}
+	}
+}
+
+func (v *earlyErrorCheck) class(cls *ast.ClassLiteral) {
+	c := v.c
+	if cls.Name != nil {
+		c.checkIdentifierLName(cls.Name.Name, int(cls.Name.Idx)-1)
+	}
+	v.walk(cls.SuperClass)
+
+	savedScope, savedClassScope := c.scope, c.classScope
+	defer func() {
+		c.scope, c.classScope = savedScope, savedClassScope
+	}()
+	c.newBlockScope()
+	c.scope.strict = true
+	cs := &classScope{
+		c:     c,
+		outer: c.classScope,
+	}
+	hasCtor := false
+	for _, elt := range cls.Body {
+		switch elt := elt.(type) {
+		case *ast.FieldDefinition:
+			if id, ok := elt.Key.(*ast.PrivateIdentifier); ok {
+				cs.declarePrivateId(id.Name, ast.PropertyKindValue, elt.Static, int(elt.Idx)-1)
+			}
+		case *ast.MethodDefinition:
+			if id, ok := elt.Key.(*ast.StringLiteral); ok && !elt.Static && !elt.Computed && id.Value == "constructor" {
+				if hasCtor {
+					c.throwSyntaxError(int(id.Idx)-1, "A class may only have one constructor")
+				}
+				hasCtor = true
+			}
+			if id, ok := elt.Key.(*ast.PrivateIdentifier); ok {
+				cs.declarePrivateId(id.Name, elt.Kind, elt.Static, int(elt.Idx)-1)
+			}
+		}
+	}
+	c.classScope = cs
+
+	for _, elt := range cls.Body {
+		switch elt := elt.(type) {
+		case *ast.MethodDefinition:
+			if elt.Computed {
+				v.walk(elt.Key)
+			}
+			f := c.compileFunctionLiteral(elt.Body, true)
+			f.typ = funcMethod
+			if id, ok := elt.Key.(*ast.StringLiteral); ok && !elt.Static && !elt.Computed && id.Value == "constructor" {
+				if cls.SuperClass != nil {
+					f.typ = funcDerivedCtor
+				} else {
+					f.typ = funcCtor
+				}
+			}
+			f.checkEarlyErrors()
+		case *ast.FieldDefinition:
+			if elt.Computed {
+				v.walk(elt.Key)
+			}
+			if elt.Initializer != nil {
+				saved := c.scope
+				c.newScope()
+				c.scope.funcType = funcClsInit
+				ast.Walk(&earlyErrorCheck{c: c}, elt.Initializer)
+				c.scope = saved
+			}
+		case *ast.ClassStaticBlock:
+			f := c.compileFunctionLiteral(&ast.FunctionLiteral{
+				Function:        elt.Idx0(),
+				ParameterList:   &ast.ParameterList{},
+				Body:            elt.Block,
+				Source:          elt.Source,
+				DeclarationList: elt.DeclarationList,
+			}, true)
+			f.typ = funcClsInit
+			f.checkEarlyErrors()
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package goja
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+const lazyTestScript = `
+"use strict";
+var log = [];
+let counter = 0;
+function inc(by = 1) {
+	counter += by;
+	return counter;
+}
+const fns = [];
+for (let i = 0; i < 3; i++) {
+	fns.push(() => i * 10 + inc());
+}
+function outer(a, b) {
+	var hidden = a + b;
+	function inner(...rest) {
+		return hidden + rest.length + (typeof notDeclared);
+	}
+	const arrow = () => this === undefined ? arguments.length : "sloppy";
+	return [inner(1, 2), arrow(), eval("hidden")];
+}
+function* gen(n) {
+	for (let i = 0; i < n; i++) yield i + counter;
+}
+async function af(x) {
+	return await x + 1;
+}
+const obj = {
+	m() { return (() => this.v)(); },
+	v: 42,
+};
+class C {
+	#p = 1;
+	get p() { return (() => this.#p)(); }
+}
+function named() { return typeof named; }
+var named2 = function self({a} = {a: 1}) { return self === named2 && a; };
+function unused() {
+	return counter;
+}
+af(1).then(v => log.push("async " + v));
+log.push(fns.map(f => f()).join(), inc(5), outer(1, 2).join(), [...gen(2)].join(), obj.m(), new C().p,
+	named(), named2());
+`
+
+func TestCompileLazy(t *testing.T) {
+	run := func(p *Program) (*Runtime, string) {
+		r := New()
+		if _, err := r.RunProgram(p); err != nil {
+			t.Fatal(err)
+		}
+		v, err := r.RunString("log.join('|')")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r, v.String()
+	}
+	eager, err := Compile("test.js", lazyTestScript, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, expected := run(eager)
+	if expected != "1,12,23|8|5undefined,2,3|8,9|42|1|function|1|async 2" {
+		t.Fatal(expected)
+	}
+
+	lazy, err := CompileLazy("test.js", lazyTestScript, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		r, res := run(lazy)
+		if res != expected {
+			t.Fatalf("%d: %s", i, res)
+		}
+		if prg := r.Get("inc").ToObject(r).self.(*funcObject).prg; prg.lazy != nil || len(prg.code) == 0 {
+			t.Fatal("inc() is not compiled")
+		}
+		if prg := r.Get("unused").ToObject(r).self.(*funcObject).prg; prg.lazy == nil || len(prg.code) != 0 {
+			t.Fatal("unused() is compiled")
+		}
+	}
+}
+
+func TestCompileLazyEarlyErrors(t *testing.T) {
+	for _, src := range []string{
+		"function f() {\n\tlet a;\n\tlet a;\n}",
+		"function f() { let a; var a; }",
+		"function f() { let a; { var a } }",
+		"function f() { 'use strict'; delete x; }",
+		"function f(a, a) { 'use strict'; }",
+		"var f = (a, a) => 1;",
+		"function f({a}) { 'use strict'; }",
+		"function f(a) { let a; }",
+		"function f() { try {} catch (e) { let e; } }",
+		"function f() { for (let i;;) { var i; } }",
+		"function f() { switch (1) { case 1: let a; case 2: var a; } }",
+		"function f() { 'use strict'; with ({}) {} }",
+		"function f() { 'use strict'; return 010; }",
+		"function f() { 'use strict'; eval = 1; }",
+		"function f() { 'use strict'; var let; }",
+		"function f() { const a; }",
+		"function f() { super.x; }",
+		"function f() { return () => { var g = function() { super.x; }; }; }",
+		"function f() { a: { for (;;) continue a; } }",
+		"function f() { return {__proto__: 1, __proto__: 2}; }",
+		"function f() { return {a = 1}; }",
+		"function f() { class C { m() { this.#x; } } }",
+		"function f() { class C { #x; #x; } }",
+		"function f() { class C { constructor() {} constructor() {} } }",
+		"function f() { class C { m() { super(); } } }",
+		"function f() { return function g() { let b; var b; }; }",
+		"function f() { return { m() { let b; { var b; } } }; }",
+	} {
+		_, err := Compile("test.js", src, false)
+		if _, ok := err.(*CompilerSyntaxError); !ok {
+			t.Fatalf("%s: unexpected result of Compile: %v", src, err)
+		}
+		_, lazyErr := CompileLazy("test.js", src, false)
+		if lazyErr == nil || lazyErr.Error() != err.Error() {
+			t.Fatalf("%s: %v, expected %v", src, lazyErr, err)
+		}
+	}
+	if _, err := CompileLazy("test.js", "function f() { return 1 + }", false); err == nil {
+		t.Fatal("expected a parse error")
+	}
+}
+
+// TestCompileLazyCompilerEarlyErrors runs the compiler early error cases within a function body (so that it is
+// compiled lazily) and requires the same result from Compile and CompileLazy.
+func TestCompileLazyCompilerEarlyErrors(t *testing.T) {
+	for _, tc := range []struct {
+		src    string
+		strict bool
+	}{
+		{src: "L: { while (Math.random() > 0.5) { try { continue L; } finally { break; } } }"},
+		{src: "L: { try { continue; } finally { break L; } }"},
+		{src: "L: { while (false) { try { continue L; } finally { break; } } }"},
+		{src: "for (let x = 3 in {}) { }"},
+		{src: "for (let let of [23]) { }"},
+		{src: "let\n++"},
+		{src: "'use strict'; for (;false;) { eval = 1; }"},
+		{src: "'use strict'; for (;false;eval=1) { }"},
+		{src: "var obj = { w\\u0069th: 42 }; var obj = { with() {42} };"},
+		{src: "r\\u0065turn;"},
+		{src: "this.let = 0; l\\u0065t // ASI\na; var a;"},
+		{src: "var let = 1;", strict: true},
+		{src: "let let = 1;"},
+		{src: "while (false) let // ASI\nx = 1;"},
+		{src: "let\nx = 1;", strict: true},
+		{src: "function f() {}let\nx = 1;", strict: true},
+		{src: "let\nlet = 1;"},
+		{src: "with ({}) let\n[a] = 0;"},
+		{src: "let x; { if (false) { var x; } }"},
+		{src: "let eval = 1;", strict: true},
+		{src: "o = {a=1};"},
+		{src: "o = {\"let\"};"},
+		{src: "const [a, b, ...rest,] = [];"},
+		{src: "([a, b, ...rest,] = []);"},
+		{src: "(a) => {'use strict';}"},
+		{src: "(a=0) => {'use strict';}"},
+		{src: "({!:0})"},
+		{src: "({ [\"__proto__\"]() {}, [\"__proto__\"]() {} })"},
+		{src: "function as(requiredArgument = {}) { class something { } };"},
+		{src: "implements = 1;", strict: true},
+		{src: "'use strict'; [eval] = [1];"},
+		{src: "'use strict'; ({a: eval} = {});"},
+		{src: "'use strict'; ({eval} = {});"},
+		{src: "'use strict'; [...eval] = [];"},
+		{src: "'use strict'; [a = 1, {b: [arguments]}] = [];"},
+		{src: "'use strict'; [a.b, c[0]] = [];"},
+		{src: "for (eval in o);", strict: true},
+		{src: "for ([eval] of []);", strict: true},
+		{src: "for (eval in o);"},
+		{src: "class A { x = arguments }"},
+		{src: "class A { x = () => arguments }"},
+		{src: "class A { x = function() { return arguments } }"},
+		{src: "class A { x = {arguments} }"},
+		{src: "class A { static { arguments } }"},
+		{src: "class A { m() { delete this.#a } #a }"},
+		{src: "class A { m() { delete this?.#a } #a }"},
+		{src: "class A { m() { delete this.#a.b } #a }"},
+	} {
+		src := "function f() {\n" + tc.src + "\n}"
+		_, err := Compile("test.js", src, tc.strict)
+		_, lazyErr := CompileLazy("test.js", src, tc.strict)
+		if err == nil {
+			if lazyErr != nil {
+				t.Errorf("%s: unexpected error %v", src, lazyErr)
+			}
+		} else if lazyErr == nil || lazyErr.Error() != err.Error() {
+			t.Errorf("%s: %v, expected %v", src, lazyErr, err)
+		}
+	}
+}
+
+func TestCompileLazyNoFalseEarlyErrors(t *testing.T) {
+	const src = `
+	function f(a, b = a) {
+		var a;
+		{ let b; function h() {} }
+		for (var i = 0; i < 1; i++) { let i = 2; }
+		for (const k in {}) { var x; }
+		try {} catch ({message}) { var y; }
+		switch (a) { case 1: function s() {} }
+		l1: for (let j = 0; j < 1; j++) { l2: { continue l1; } }
+		class C extends Object {
+			#p = () => new.target;
+			static #q() {}
+			get #g() { return 1; }
+			set #g(v) {}
+			constructor() { super(); this.#p; #q in C; }
+			m() { return super.m; }
+			static { let z; var w; }
+		}
+		return { __proto__: null, ["__proto__"]: 1, m() { return super.x; }, a, b };
+	}
+	function g(a, a) { return a; }
+	function h() { var a; { var a; } return new.target; }
+	f(1).a + g(1, 2) + (h() === undefined ? 1 : 0);
+	`
+	p, err := Compile("test.js", src, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := New().RunProgram(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err = CompileLazy("test.js", src, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := New().RunProgram(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.SameAs(expected) {
+		t.Fatalf("%v != %v", res, expected)
+	}
+}
+
+func TestCompileLazyConcurrent(t *testing.T) {
+	var src strings.Builder
+	src.WriteString("var sum = 0;\n")
+	for i := 0; i < 50; i++ {
+		src.WriteString("function f" + string(rune('0'+i/10)) + string(rune('0'+i%10)) + "(x) { let y = x => x + sum; return y(x); }\n")
+	}
+	src.WriteString("for (let i = 0; i < 50; i++) sum += this['f' + String(i).padStart(2, '0')](i);\nsum;")
+	p, err := CompileLazy("test.js", src.String(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	results := make([]int64, 8)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v, err := New().RunProgram(p)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			results[i] = v.ToInteger()
+		}(i)
+	}
+	wg.Wait()
+	for i, res := range results {
+		if res != results[0] {
+			t.Fatalf("%d: %d != %d", i, res, results[0])
+		}
+	}
+}
@@ -8,6 +8,11 @@ import (
 )
 
 func (c *compiler) compileStatement(v ast.Statement, needResult bool) {
+	if c.coverage {
+		if _, ok := v.(*ast.FunctionDeclaration); !ok {
+			c.p.addSrcMap(int(v.Idx0()) - 1)
+		}
+	}
 
 	switch v := v.(type) {
 	case *ast.BlockStatement:
@@ -68,6 +73,7 @@ func (c *compiler) compileLabeledStatement(v *ast.LabelledStatement, needResult
 			c.throwSyntaxErrorf(int(v.Label.Idx-1), "Label '%s' has already been declared", label)
 		}
 	}
+	c.addCoverageSrcMap(int(v.Statement.Idx0()) - 1)
 	switch s := v.Statement.(type) {
 	case *ast.ForInStatement:
 		c.compileLabeledForInStatement(s, needResult, label)
@@ -821,6 +827,9 @@ func (c *compiler) emitPatternAssign(target, init compiledExpr) {
 	if id, ok := target.(*compiledIdentifierExpr); ok {
 		b, noDyn := c.scope.lookupName(id.name)
 		if noDyn {
+			if c.scope.strict {
+				c.checkIdentifierLName(id.name, id.offset)
+			}
 			c.emitNamedOrConst(init, id.name)
 			b.emitSetP()
 		} else {
@@ -147,7 +147,9 @@ const TESTLIBX = `
 		assert.sameValue(lines.length, expected.length + 2, "Stack lengths mismatch");
 		let lnum = 1;
 		for (const [file, func, line, col] of expected) {
-			const expLine = func === "" ?
+			const expLine = file === "native" ?
+				"\tat " + func + " (native)" :
+				func === "" ?
 				"\tat " + file + ":" + line + ":" + col + "(" :
 				"\tat " + func + " (" + file + ":" + line + ":" + col + "(";
 			assert.sameValue(lines[lnum].substring(0, expLine.length), expLine, "line " + lnum);
@@ -0,0 +1,558 @@
+package goja
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/file"
+	"github.com/dop251/goja/parser"
+	"github.com/dop251/goja/token"
+)
+
+/*
+Coverage collects code coverage: it counts how many times each statement, function and branch has been executed.
+Create it with NewCoverage and enable it with Runtime.SetCoverage. The same Coverage can be shared by several
+Runtimes (including the ones running concurrently), in which case the counts are added up.
+
+The counts are kept per Program. When a report is written, the programs compiled from the same source are merged,
+the source is parsed again to find the statements, functions and branches and their locations are mapped through
+the source map (if the source has one), so that the report refers to the original files.
+
+Code that has no name (such as the code run with RunString) and the code run by eval() or the Function constructor
+is not included in the reports.
+
+The statements and the branches are only counted in the code compiled for coverage: the scripts compiled
+with CompileForCoverage and the ones run with RunScript while the coverage is enabled. For the other programs only
+the function calls are counted.
+
+Note that collecting coverage makes the execution noticeably slower.
+*/
+type Coverage struct {
+	mu       sync.Mutex
+	programs map[*Program][]uint32
+}
+
+// NewCoverage creates a new empty Coverage.
+func NewCoverage() *Coverage {
+	return &Coverage{
+		programs: make(map[*Program][]uint32),
+	}
+}
+
+/*
+SetCoverage enables coverage collection. The counts are added to the supplied Coverage. Passing nil disables the
+collection. The setting is shared by all realms (see NewRealm).
+
+Note, the execution with the coverage enabled uses a separate (slower) loop, which is shared with the execution
+hooks (see SetExecutionHooks) and the profiler (see StartProfile).
+*/
+func (r *Runtime) SetCoverage(c *Coverage) {
+	r.vm.coverage = c
+}
+
+// Reset discards all collected counts.
+func (c *Coverage) Reset() {
+	c.mu.Lock()
+	c.programs = make(map[*Program][]uint32)
+	c.mu.Unlock()
+}
+
+func (c *Coverage) programHits(p *Program) []uint32 {
+	c.mu.Lock()
+	hits := c.programs[p]
+	if hits == nil {
+		hits = make([]uint32, len(p.code))
+		c.programs[p] = hits
+	}
+	c.mu.Unlock()
+	return hits
+}
+
+// WriteLCOV writes the report in the LCOV tracefile format.
+func (c *Coverage) WriteLCOV(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range c.report() {
+		fmt.Fprintf(bw, "TN:\nSF:%s\n", f.path)
+		fnHit := 0
+		for _, fn := range f.functions {
+			fmt.Fprintf(bw, "FN:%d,%s\n", fn.decl.start.Line, fn.name)
+		}
+		for _, fn := range f.functions {
+			fmt.Fprintf(bw, "FNDA:%d,%s\n", fn.count, fn.name)
+			if fn.count > 0 {
+				fnHit++
+			}
+		}
+		fmt.Fprintf(bw, "FNF:%d\nFNH:%d\n", len(f.functions), fnHit)
+
+		brFound, brHit := 0, 0
+		for i, br := range f.branches {
+			for j, cnt := range br.counts {
+				brFound++
+				if cnt > 0 {
+					brHit++
+				}
+				if br.count == 0 {
+					fmt.Fprintf(bw, "BRDA:%d,%d,%d,-\n", br.loc.start.Line, i, j)
+				} else {
+					fmt.Fprintf(bw, "BRDA:%d,%d,%d,%d\n", br.loc.start.Line, i, j, cnt)
+				}
+			}
+		}
+		fmt.Fprintf(bw, "BRF:%d\nBRH:%d\n", brFound, brHit)
+
+		lines := f.lineCounts()
+		lineHit := 0
+		for _, l := range lines {
+			fmt.Fprintf(bw, "DA:%d,%d\n", l.line, l.count)
+			if l.count > 0 {
+				lineHit++
+			}
+		}
+		fmt.Fprintf(bw, "LF:%d\nLH:%d\nend_of_record\n", len(lines), lineHit)
+	}
+	return bw.Flush()
+}
+
+type istanbulPos struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+type istanbulRange struct {
+	Start istanbulPos `json:"start"`
+	End   istanbulPos `json:"end"`
+}
+
+type istanbulFunction struct {
+	Name string        `json:"name"`
+	Decl istanbulRange `json:"decl"`
+	Loc  istanbulRange `json:"loc"`
+	Line int           `json:"line"`
+}
+
+type istanbulBranch struct {
+	Loc       istanbulRange   `json:"loc"`
+	Type      string          `json:"type"`
+	Locations []istanbulRange `json:"locations"`
+	Line      int             `json:"line"`
+}
+
+type istanbulFile struct {
+	Path         string                      `json:"path"`
+	StatementMap map[string]istanbulRange    `json:"statementMap"`
+	FnMap        map[string]istanbulFunction `json:"fnMap"`
+	BranchMap    map[string]istanbulBranch   `json:"branchMap"`
+	S            map[string]uint32           `json:"s"`
+	F            map[string]uint32           `json:"f"`
+	B            map[string][]uint32         `json:"b"`
+}
+
+func (r coverageRange) istanbul() istanbulRange {
+	// Istanbul columns are 0-based
+	return istanbulRange{
+		Start: istanbulPos{Line: r.start.Line, Column: r.start.Column - 1},
+		End:   istanbulPos{Line: r.end.Line, Column: r.end.Column - 1},
+	}
+}
+
+// WriteIstanbul writes the report in the Istanbul JSON format (the format of coverage-final.json produced by nyc).
+func (c *Coverage) WriteIstanbul(w io.Writer) error {
+	res := make(map[string]*istanbulFile)
+	for _, f := range c.report() {
+		jf := &istanbulFile{
+			Path:         f.path,
+			StatementMap: make(map[string]istanbulRange, len(f.statements)),
+			FnMap:        make(map[string]istanbulFunction, len(f.functions)),
+			BranchMap:    make(map[string]istanbulBranch, len(f.branches)),
+			S:            make(map[string]uint32, len(f.statements)),
+			F:            make(map[string]uint32, len(f.functions)),
+			B:            make(map[string][]uint32, len(f.branches)),
+		}
+		for i, st := range f.statements {
+			key := fmt.Sprint(i)
+			jf.StatementMap[key] = st.loc.istanbul()
+			jf.S[key] = st.count
+		}
+		for i, fn := range f.functions {
+			key := fmt.Sprint(i)
+			jf.FnMap[key] = istanbulFunction{
+				Name: fn.name,
+				Decl: fn.decl.istanbul(),
+				Loc:  fn.loc.istanbul(),
+				Line: fn.decl.start.Line,
+			}
+			jf.F[key] = fn.count
+		}
+		for i, br := range f.branches {
+			key := fmt.Sprint(i)
+			locations := make([]istanbulRange, len(br.locations))
+			for j, loc := range br.locations {
+				locations[j] = loc.istanbul()
+			}
+			jf.BranchMap[key] = istanbulBranch{
+				Loc:       br.loc.istanbul(),
+				Type:      br.typ,
+				Locations: locations,
+				Line:      br.loc.start.Line,
+			}
+			jf.B[key] = br.counts
+		}
+		res[f.path] = jf
+	}
+	enc := json.NewEncoder(w)
+	return enc.Encode(res)
+}
+
+// WriteGoCover writes the statement counts in the format of the Go coverage profiles (as produced by
+// 'go test -coverprofile' in the 'count' mode), so that the tools that understand this format can be used.
+func (c *Coverage) WriteGoCover(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("mode: count\n")
+	for _, f := range c.report() {
+		for _, st := range f.statements {
+			fmt.Fprintf(bw, "%s:%d.%d,%d.%d 1 %d\n", f.path, st.loc.start.Line, st.loc.start.Column,
+				st.loc.end.Line, st.loc.end.Column, st.count)
+		}
+	}
+	return bw.Flush()
+}
+
+type coverageRange struct {
+	start, end file.Position
+}
+
+type coverageStatement struct {
+	loc   coverageRange
+	count uint32
+}
+
+type coverageFunction struct {
+	name      string
+	decl, loc coverageRange
+	count     uint32
+}
+
+type coverageBranch struct {
+	typ       string
+	loc       coverageRange
+	locations []coverageRange
+	counts    []uint32
+	// the number of times the branching construct has been executed
+	count uint32
+}
+
+type coverageFile struct {
+	path       string
+	statements []coverageStatement
+	functions  []coverageFunction
+	branches   []coverageBranch
+}
+
+type coverageLine struct {
+	line  int
+	count uint32
+}
+
+// lineCounts returns the execution counts of the lines where the statements start, sorted by line.
+func (f *coverageFile) lineCounts() []coverageLine {
+	m := make(map[int]uint32)
+	for _, st := range f.statements {
+		if cnt, exists := m[st.loc.start.Line]; !exists || st.count > cnt {
+			m[st.loc.start.Line] = st.count
+		}
+	}
+	res := make([]coverageLine, 0, len(m))
+	for line, cnt := range m {
+		res = append(res, coverageLine{line: line, count: cnt})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].line < res[j].line
+	})
+	return res
+}
+
+type coverageSourceKey struct {
+	name, src string
+}
+
+// coverageSource is the merged coverage data of the programs compiled from the same source.
+type coverageSource struct {
+	f *file.File
+	// the execution counts of the source positions and the function entries
+	posHits, funcHits map[int]uint32
+}
+
+func (s *coverageSource) addProgram(p *Program, hits []uint32) {
+	hitsAt := func(pc int) uint32 {
+		if pc >= len(hits) {
+			// there is no code after the last statement, use the last instruction
+			pc = len(hits) - 1
+		}
+		if pc < 0 {
+			return 0
+		}
+		return atomic.LoadUint32(&hits[pc])
+	}
+	srcMap := p.srcMap
+	if p.isFunc && len(srcMap) > 0 {
+		s.funcHits[srcMap[0].srcPos] += hitsAt(srcMap[0].pc)
+		srcMap = srcMap[1:]
+	}
+	if !p.coverage {
+		// the source map does not point at the statements and the branches
+		return
+	}
+	// the same position may appear several times within a program, the maximum is used, the counts from different
+	// programs are added up
+	m := make(map[int]uint32, len(srcMap))
+	for _, item := range srcMap {
+		if cnt := hitsAt(item.pc); cnt > m[item.srcPos] {
+			m[item.srcPos] = cnt
+		}
+	}
+	for pos, cnt := range m {
+		s.posHits[pos] += cnt
+	}
+}
+
+// report merges the collected counts and maps them onto the source files.
+func (c *Coverage) report() []*coverageFile {
+	c.mu.Lock()
+	sources := make(map[coverageSourceKey]*coverageSource)
+	var keys []coverageSourceKey
+	for p, hits := range c.programs {
+		if p.src == nil {
+			continue
+		}
+		name := p.src.Name()
+		if name == "" || name == "<eval>" {
+			continue
+		}
+		key := coverageSourceKey{name: name, src: p.src.Source()}
+		s := sources[key]
+		if s == nil {
+			s = &coverageSource{
+				f:        p.src,
+				posHits:  make(map[int]uint32),
+				funcHits: make(map[int]uint32),
+			}
+			sources[key] = s
+			keys = append(keys, key)
+		}
+		s.addProgram(p, hits)
+	}
+	c.mu.Unlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].name != keys[j].name {
+			return keys[i].name < keys[j].name
+		}
+		return keys[i].src < keys[j].src
+	})
+
+	files := make(map[string]*coverageFile)
+	var res []*coverageFile
+	getFile := func(path string) *coverageFile {
+		f := files[path]
+		if f == nil {
+			f = &coverageFile{path: path}
+			files[path] = f
+			res = append(res, f)
+		}
+		return f
+	}
+	for _, key := range keys {
+		sources[key].collect(getFile)
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].path < res[j].path
+	})
+	return res
+}
+
+// collect finds the statements, functions and branches in the source and adds them with their counts
+// to the corresponding files.
+func (s *coverageSource) collect(getFile func(path string) *coverageFile) {
+	prg, err := parser.ParseFile(nil, s.f.Name(), s.f.Source(), 0, parser.WithDisableSourceMaps)
+	if err != nil {
+		// the source has been compiled with different parser options, there is nothing we can do
+		return
+	}
+	rangeOf := func(n ast.Node) coverageRange {
+		return s.rangeOf(int(n.Idx0())-1, int(n.Idx1())-1)
+	}
+	count := func(n ast.Node) uint32 {
+		return s.posHits[int(n.Idx0())-1]
+	}
+	anonymous := 0
+	var visit func(n ast.Node) bool
+	visit = func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.ForLoopInitializerLexicalDecl:
+			// the declaration is a part of the for statement, only its bindings are inspected
+			for _, b := range n.LexicalDeclaration.List {
+				ast.Inspect(b, visit)
+			}
+			return false
+		case *ast.BlockStatement, *ast.FunctionDeclaration, *ast.EmptyStatement, *ast.CaseStatement, *ast.CatchStatement:
+		case ast.Statement:
+			loc := rangeOf(n)
+			f := getFile(loc.start.Filename)
+			f.statements = append(f.statements, coverageStatement{
+				loc:   loc,
+				count: count(n),
+			})
+			if n, ok := n.(*ast.IfStatement); ok {
+				s.addIfBranch(f, n, loc, count(n), rangeOf, count)
+			}
+			if n, ok := n.(*ast.SwitchStatement); ok {
+				s.addSwitchBranch(f, n, loc, count(n), count)
+			}
+		case *ast.FunctionLiteral:
+			var name string
+			if n.Name != nil {
+				name = n.Name.Name.String()
+			}
+			s.addFunction(getFile, name, n.Idx0(), n.ParameterList.Idx1(), n, &anonymous)
+		case *ast.ArrowFunctionLiteral:
+			s.addFunction(getFile, "", n.Idx0(), n.ParameterList.Idx1(), n, &anonymous)
+		case *ast.ConditionalExpression:
+			loc := rangeOf(n)
+			f := getFile(loc.start.Filename)
+			f.branches = append(f.branches, coverageBranch{
+				typ:       "cond-expr",
+				loc:       loc,
+				locations: []coverageRange{rangeOf(n.Consequent), rangeOf(n.Alternate)},
+				counts:    []uint32{count(n.Consequent), count(n.Alternate)},
+				count:     count(n.Consequent) + count(n.Alternate),
+			})
+		case *ast.BinaryExpression:
+			if !isLogicalOperator(n.Operator) {
+				break
+			}
+			loc := rangeOf(n)
+			f := getFile(loc.start.Filename)
+			br := coverageBranch{
+				typ: "binary-expr",
+				loc: loc,
+			}
+			for _, operand := range flattenLogicalExpr(n, nil) {
+				br.locations = append(br.locations, rangeOf(operand))
+				br.counts = append(br.counts, count(operand))
+			}
+			br.count = br.counts[0]
+			f.branches = append(f.branches, br)
+			// the nested logical expressions are included in this branch, but their operands may contain
+			// other branches
+			for _, operand := range flattenLogicalExpr(n, nil) {
+				ast.Inspect(operand, visit)
+			}
+			return false
+		}
+		return true
+	}
+	ast.Inspect(prg, visit)
+}
+
+func (s *coverageSource) rangeOf(start, end int) coverageRange {
+	res := coverageRange{
+		start: s.f.Position(start),
+		end:   s.f.Position(end),
+	}
+	if res.end.Filename != res.start.Filename || res.end.Line < res.start.Line ||
+		res.end.Line == res.start.Line && res.end.Column < res.start.Column {
+		// the source map does not map the end correctly
+		res.end = res.start
+	}
+	return res
+}
+
+func (s *coverageSource) addFunction(getFile func(string) *coverageFile, name string, start, declEnd file.Idx, n ast.Node, anonymous *int) {
+	loc := s.rangeOf(int(start)-1, int(n.Idx1())-1)
+	f := getFile(loc.start.Filename)
+	if name == "" {
+		name = fmt.Sprintf("(anonymous_%d)", *anonymous)
+		*anonymous++
+	}
+	f.functions = append(f.functions, coverageFunction{
+		name:  name,
+		decl:  s.rangeOf(int(start)-1, int(declEnd)-1),
+		loc:   loc,
+		count: s.funcHits[int(start)-1],
+	})
+}
+
+func (s *coverageSource) addIfBranch(f *coverageFile, n *ast.IfStatement, loc coverageRange, cnt uint32,
+	rangeOf func(ast.Node) coverageRange, count func(ast.Node) uint32) {
+	br := coverageBranch{
+		typ:   "if",
+		loc:   loc,
+		count: cnt,
+	}
+	consequent := count(n.Consequent)
+	br.locations = append(br.locations, rangeOf(n.Consequent))
+	br.counts = append(br.counts, consequent)
+	if n.Alternate != nil {
+		br.locations = append(br.locations, rangeOf(n.Alternate))
+		br.counts = append(br.counts, count(n.Alternate))
+	} else {
+		// implicit else
+		var alternate uint32
+		if cnt > consequent {
+			alternate = cnt - consequent
+		}
+		br.locations = append(br.locations, loc)
+		br.counts = append(br.counts, alternate)
+	}
+	f.branches = append(f.branches, br)
+}
+
+func (s *coverageSource) addSwitchBranch(f *coverageFile, n *ast.SwitchStatement, loc coverageRange, cnt uint32,
+	count func(ast.Node) uint32) {
+	br := coverageBranch{
+		typ:   "switch",
+		loc:   loc,
+		count: cnt,
+	}
+	for i, c := range n.Body {
+		end := c.Case
+		if len(c.Consequent) > 0 {
+			end = c.Idx1()
+		} else if c.Test != nil {
+			end = c.Test.Idx1() + 1
+		}
+		br.locations = append(br.locations, s.rangeOf(int(c.Case)-1, int(end)-1))
+		// an empty case falls through to the next one
+		var caseCount uint32
+		for _, next := range n.Body[i:] {
+			if len(next.Consequent) > 0 {
+				caseCount = count(next.Consequent[0])
+				break
+			}
+		}
+		br.counts = append(br.counts, caseCount)
+	}
+	if len(br.locations) > 0 {
+		f.branches = append(f.branches, br)
+	}
+}
+
+func isLogicalOperator(op token.Token) bool {
+	return op == token.LOGICAL_OR || op == token.LOGICAL_AND || op == token.COALESCE
+}
+
+// flattenLogicalExpr returns the operands of a chain of logical expressions, i.e. a, b and c for (a || b) && c.
+func flattenLogicalExpr(e ast.Expression, res []ast.Expression) []ast.Expression {
+	if b, ok := e.(*ast.BinaryExpression); ok && isLogicalOperator(b.Operator) {
+		res = flattenLogicalExpr(b.Left, res)
+		return flattenLogicalExpr(b.Right, res)
+	}
+	return append(res, e)
+}
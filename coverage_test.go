@@ -0,0 +1,265 @@
+package goja
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+const coverageTestScript = `function f(a) {
+	if (a > 1) {
+		return a ? 1 : 2;
+	}
+	return a || 3;
+}
+const g = x => x && f(x);
+for (let i = 0; i < 3; i++) f(i);
+switch (f(0)) {
+case 1:
+case 3:
+	g(1);
+	break;
+default:
+	g(0);
+}
+`
+
+func TestCoverageLCOV(t *testing.T) {
+	vm := New()
+	cov := NewCoverage()
+	vm.SetCoverage(cov)
+	if _, err := vm.RunScript("test.js", coverageTestScript); err != nil {
+		t.Fatal(err)
+	}
+	// not included in the report
+	if _, err := vm.RunString("f(5); eval('f(6)')"); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := cov.WriteLCOV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	const expected = `TN:
+SF:test.js
+FN:1,f
+FN:7,(anonymous_0)
+FNDA:7,f
+FNDA:1,(anonymous_0)
+FNF:2
+FNH:2
+BRDA:2,0,0,3
+BRDA:2,0,1,4
+BRDA:3,1,0,3
+BRDA:3,1,1,0
+BRDA:5,2,0,4
+BRDA:5,2,1,2
+BRDA:7,3,0,1
+BRDA:7,3,1,1
+BRDA:9,4,0,1
+BRDA:9,4,1,1
+BRDA:9,4,2,0
+BRF:11
+BRH:9
+DA:2,7
+DA:3,3
+DA:5,4
+DA:7,1
+DA:8,3
+DA:9,1
+DA:12,1
+DA:13,1
+DA:15,0
+LF:9
+LH:8
+end_of_record
+`
+	if s := buf.String(); s != expected {
+		t.Fatalf("Unexpected report:\n%s", s)
+	}
+
+	buf.Reset()
+	if err := cov.WriteGoCover(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if s := buf.String(); !strings.HasPrefix(s, "mode: count\ntest.js:2.2,4.3 1 7\n") {
+		t.Fatalf("Unexpected report:\n%s", s)
+	}
+
+	cov.Reset()
+	buf.Reset()
+	if err := cov.WriteLCOV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Fatal(buf.String())
+	}
+}
+
+func TestCoverageIstanbul(t *testing.T) {
+	prg, err := CompileForCoverage("test.js", coverageTestScript, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cov := NewCoverage()
+	// the counts from different runtimes are added up
+	for i := 0; i < 2; i++ {
+		vm := New()
+		vm.SetCoverage(cov)
+		if _, err := vm.RunProgram(prg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := cov.WriteIstanbul(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var res map[string]struct {
+		Path         string
+		StatementMap map[string]istanbulRange
+		FnMap        map[string]istanbulFunction
+		BranchMap    map[string]istanbulBranch
+		S            map[string]uint32
+		F            map[string]uint32
+		B            map[string][]uint32
+	}
+	if err := json.Unmarshal(buf.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	f, ok := res["test.js"]
+	if !ok || len(res) != 1 {
+		t.Fatal(buf.String())
+	}
+	if n := len(f.StatementMap); n != 10 || len(f.S) != n {
+		t.Fatalf("statements: %d", n)
+	}
+	if loc := f.StatementMap["0"]; loc != (istanbulRange{Start: istanbulPos{2, 1}, End: istanbulPos{4, 2}}) {
+		t.Fatalf("statement 0: %+v", loc)
+	}
+	if s := f.S["0"]; s != 10 {
+		t.Fatalf("s[0]: %d", s)
+	}
+	if fn := f.FnMap["0"]; fn.Name != "f" || fn.Line != 1 || f.F["0"] != 10 {
+		t.Fatalf("function 0: %+v, %d", fn, f.F["0"])
+	}
+	if br := f.BranchMap["1"]; br.Type != "cond-expr" || len(br.Locations) != 2 || br.Locations[1].Start != (istanbulPos{3, 17}) {
+		t.Fatalf("branch 1: %+v", br)
+	}
+	if b := f.B["1"]; len(b) != 2 || b[0] != 2 || b[1] != 0 {
+		t.Fatalf("b[1]: %v", b)
+	}
+}
+
+func TestCoverageSourceMap(t *testing.T) {
+	// gen.js lines 1 and 2 are mapped onto orig.js lines 3 and 4
+	sourceMap := base64.StdEncoding.EncodeToString([]byte(`{"version":3,"file":"gen.js","sources":["orig.js"],"names":[],"mappings":"AAEA;AACA;AACA"}`))
+	src := "var a = 0;\nif (a) a++;\n//# sourceMappingURL=data:application/json;base64," + sourceMap
+
+	vm := New()
+	cov := NewCoverage()
+	vm.SetCoverage(cov)
+	if _, err := vm.RunScript("gen.js", src); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := cov.WriteLCOV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	const expected = `TN:
+SF:orig.js
+FNF:0
+FNH:0
+BRDA:4,0,0,0
+BRDA:4,0,1,1
+BRF:2
+BRH:1
+DA:3,1
+DA:4,1
+LF:2
+LH:2
+end_of_record
+`
+	if s := buf.String(); s != expected {
+		t.Fatalf("Unexpected report:\n%s", s)
+	}
+}
+
+func TestCoverageNotCompiledForCoverage(t *testing.T) {
+	prg := MustCompile("test.js", coverageTestScript, false)
+	covPrg, err := CompileForCoverage("test.js", coverageTestScript, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prg.srcMap) >= len(covPrg.srcMap) {
+		t.Fatal("the source map is not smaller")
+	}
+	vm := New()
+	cov := NewCoverage()
+	vm.SetCoverage(cov)
+	if _, err := vm.RunProgram(prg); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := cov.WriteLCOV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	s := buf.String()
+	if !strings.Contains(s, "FNDA:5,f\n") || !strings.Contains(s, "LH:0\n") || !strings.Contains(s, "BRH:0\n") {
+		t.Fatalf("Unexpected report:\n%s", s)
+	}
+}
+
+func TestCoverageWithHooksAndProfiler(t *testing.T) {
+	vm := New()
+	vm.Set("spin", func() {
+		time.Sleep(time.Millisecond)
+	})
+	cov := NewCoverage()
+	vm.SetCoverage(cov)
+	var h testHooks
+	vm.SetExecutionHooks(&h)
+	var prof bytes.Buffer
+	if err := vm.StartProfile(&prof, ProfileOptions{Interval: time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := vm.RunScript("test.js", `
+	function f() {
+		for (let i = 0; i < 5; i++) spin();
+	}
+	for (let i = 0; i < 10; i++) f();
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.StopProfile(); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := cov.WriteLCOV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if s := buf.String(); !strings.Contains(s, "FNDA:10,f\n") || !strings.Contains(s, "DA:3,50\n") {
+		t.Fatalf("Unexpected report:\n%s", s)
+	}
+	entered := 0
+	for _, e := range h.events {
+		if e == "enter f:2" {
+			entered++
+		}
+	}
+	if entered != 10 {
+		t.Fatalf("Unexpected events: %v", h.events)
+	}
+	pr, err := profile.Parse(&prof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pr.Sample) == 0 {
+		t.Fatal("No samples were recorded")
+	}
+}
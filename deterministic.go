@@ -0,0 +1,247 @@
+package goja
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/dop251/goja/unistring"
+)
+
+// ErrReplayDiverged is wrapped by the error returned when a replayed run does not match the recording
+// (see Runtime.StartReplay).
+var ErrReplayDiverged = errors.New("replay diverged from the recording")
+
+// DeterministicOptions configures the deterministic mode (see Runtime.SetDeterministic).
+type DeterministicOptions struct {
+	// Seed for Math.random().
+	Seed int64
+	// The time returned by the first reading of the clock (Date.now(), new Date(), etc.).
+	// If zero, the Unix epoch is used.
+	StartTime time.Time
+	// The amount of time by which the clock advances after every reading. If zero, the clock does not advance.
+	TimeStep time.Duration
+	// The local time zone. If nil, UTC is used.
+	Location *time.Location
+}
+
+/*
+SetDeterministic makes the execution of scripts in this Runtime deterministic, i.e. the same script with the same
+host functions always produces the same results. It replaces the random source (see SetRandSource) with a seeded
+pseudo-random generator, the time source (see SetTimeSource) with a virtual clock and sets the local time zone (see
+SetTimeZone). It also makes the order in which the properties of wrapped Go maps are enumerated stable (the keys are
+sorted), whereas by default it follows the Go map iteration order which is randomised.
+
+Note that the Runtime does not implement WeakRef or FinalizationRegistry and the contents of WeakMaps and WeakSets
+cannot be enumerated, so garbage collection has no observable effect on scripts. The iteration order of Maps, Sets
+and object properties is defined by the specification and does not depend on hashing.
+
+The remaining sources of non-determinism are the host functions, see StartRecording and StartReplay.
+*/
+func (r *Runtime) SetDeterministic(opts DeterministicOptions) {
+	r.rand = rand.New(rand.NewSource(opts.Seed)).Float64
+	now := opts.StartTime
+	if now.IsZero() {
+		now = time.Unix(0, 0)
+	}
+	step := opts.TimeStep
+	r.now = func() time.Time {
+		t := now
+		now = now.Add(step)
+		return t
+	}
+	if opts.Location != nil {
+		r.location = opts.Location
+	} else {
+		r.location = time.UTC
+	}
+	r.deterministic = true
+}
+
+// RecordingEntryKind identifies the source of a RecordingEntry.
+type RecordingEntryKind string
+
+const (
+	// RecordingHostCall is a call of a Go function from JavaScript.
+	RecordingHostCall RecordingEntryKind = "call"
+	// RecordingTime is a reading of the current time.
+	RecordingTime RecordingEntryKind = "time"
+	// RecordingRandom is a call to Math.random().
+	RecordingRandom RecordingEntryKind = "random"
+)
+
+// RecordingEntry is a single non-deterministic input of a run.
+type RecordingEntry struct {
+	Kind RecordingEntryKind `json:"kind"`
+
+	// The name of the host function. It's only used in error messages, as it may differ between builds.
+	Name string `json:"name,omitempty"`
+	// The value returned or thrown by the host function.
+	Value *SerializedValue `json:"value,omitempty"`
+	// Thrown is true if the host function has thrown the Value.
+	Thrown bool `json:"thrown,omitempty"`
+	// If not empty, the value could not be recorded and this is the reason. Such entries cannot be replayed.
+	Error string `json:"error,omitempty"`
+
+	Time   time.Time `json:"time,omitzero"`
+	Random float64   `json:"random,omitempty"`
+}
+
+// Recording is a log of the non-deterministic inputs of a run, see Runtime.StartRecording. It can be marshalled
+// into JSON and stored, for example, as a test fixture.
+type Recording struct {
+	Entries []RecordingEntry `json:"entries"`
+}
+
+type recorder struct {
+	rec    *Recording
+	replay bool
+	pos    int
+}
+
+/*
+StartRecording starts recording the non-deterministic inputs of the scripts: the results of the host (Go) function
+calls, the readings of the time source and the values returned by Math.random(). The returned Recording is appended
+to until StopRecording is called. It can later be passed to StartReplay to re-run the same scripts with the same
+inputs without calling the host functions.
+
+Only the functions created by ToValue() from Go functions (including the methods of wrapped Go values) are recorded,
+the constructors are not. The results are copied using the structured clone algorithm (see StructuredSerialize),
+so when replaying, the wrapped Go values are returned as plain objects. If a result cannot be cloned (e.g. it's
+a function or a Promise) the corresponding entry has its Error set and the replay fails when it reaches it.
+The side effects of the host functions (such as calling JavaScript callbacks) are not recorded.
+
+The recording is shared by all realms (see NewRealm). Calling StartRecording or StartReplay replaces the
+current recording.
+*/
+func (r *Runtime) StartRecording() *Recording {
+	rec := &Recording{}
+	r.agent.recorder = &recorder{rec: rec}
+	return rec
+}
+
+/*
+StartReplay replays the recording made by StartRecording: instead of calling a host function (or reading the time,
+or generating a random number) the next entry of the recording is used. If the scripts request an input which does
+not match the next entry (for example, the time is read instead of calling a host function) or the recording is
+exhausted, the execution is aborted with an *InterruptedError wrapping ErrReplayDiverged.
+
+For the replay to be exact, the scripts must be the same and the Runtime must be set up in the same way as the
+recorded one (apart from the behaviour of the host functions).
+*/
+func (r *Runtime) StartReplay(rec *Recording) {
+	r.agent.recorder = &recorder{rec: rec, replay: true}
+}
+
+// StopRecording stops recording or replaying. It returns the number of entries that have been recorded or replayed.
+func (r *Runtime) StopRecording() int {
+	rc := r.agent.recorder
+	if rc == nil {
+		return 0
+	}
+	r.agent.recorder = nil
+	if rc.replay {
+		return rc.pos
+	}
+	return len(rc.rec.Entries)
+}
+
+func (r *Runtime) replayDiverged(format string, args ...interface{}) {
+	ex := &InterruptedError{
+		iface: fmt.Errorf("%w: "+format, append([]interface{}{ErrReplayDiverged}, args...)...),
+	}
+	ex.stack = r.vm.captureStack(nil, 0)
+	panic(ex)
+}
+
+// nextEntry returns the next entry to replay, checking its kind.
+func (r *Runtime) nextEntry(rc *recorder, kind RecordingEntryKind, name string) *RecordingEntry {
+	if rc.pos >= len(rc.rec.Entries) {
+		r.replayDiverged("unexpected %s %s at the end of the recording", kind, name)
+	}
+	e := &rc.rec.Entries[rc.pos]
+	if e.Kind != kind {
+		r.replayDiverged("entry %d: expected %s %s, got %s %s", rc.pos, e.Kind, e.Name, kind, name)
+	}
+	rc.pos++
+	return e
+}
+
+func (r *Runtime) currentTime() time.Time {
+	rc := r.agent.recorder
+	if rc == nil {
+		return r.now()
+	}
+	if rc.replay {
+		return r.nextEntry(rc, RecordingTime, "").Time
+	}
+	t := r.now()
+	rc.rec.Entries = append(rc.rec.Entries, RecordingEntry{Kind: RecordingTime, Time: t})
+	return t
+}
+
+func (r *Runtime) random() float64 {
+	rc := r.agent.recorder
+	if rc == nil {
+		return r.rand()
+	}
+	if rc.replay {
+		return r.nextEntry(rc, RecordingRandom, "").Random
+	}
+	f := r.rand()
+	rc.rec.Entries = append(rc.rec.Entries, RecordingEntry{Kind: RecordingRandom, Random: f})
+	return f
+}
+
+// hostFunc wraps a host function so that its calls are recorded or replayed (see StartRecording).
+func (r *Runtime) hostFunc(name unistring.String, f func(FunctionCall) Value) func(FunctionCall) Value {
+	return func(call FunctionCall) Value {
+		rc := r.agent.recorder
+		if rc == nil {
+			return f(call)
+		}
+		if rc.replay {
+			e := r.nextEntry(rc, RecordingHostCall, name.String())
+			if e.Error != "" || e.Value == nil {
+				r.replayDiverged("entry %d: the result of %s was not recorded: %s", rc.pos-1, e.Name, e.Error)
+			}
+			v := r.structuredDeserialize(e.Value)
+			if e.Thrown {
+				panic(v)
+			}
+			return v
+		}
+		var res Value
+		ex := r.vm.try(func() {
+			res = f(call)
+		})
+		e := RecordingEntry{Kind: RecordingHostCall, Name: name.String()}
+		if ex != nil {
+			res = ex.val
+			e.Thrown = true
+		}
+		if sErr := r.vm.try(func() {
+			e.Value = r.structuredSerialize(res, nil)
+		}); sErr != nil {
+			e.Error = sErr.Error()
+		}
+		rc.rec.Entries = append(rc.rec.Entries, e)
+		if ex != nil {
+			panic(ex)
+		}
+		return res
+	}
+}
+
+// sortGoMapKeys sorts the keys of a wrapped Go map in the deterministic mode.
+func (r *Runtime) sortGoMapKeys(keys []reflect.Value, toString func(reflect.Value) String) {
+	if !r.deterministic {
+		return
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return toString(keys[i]).CompareTo(toString(keys[j])) < 0
+	})
+}
@@ -0,0 +1,183 @@
+package goja
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDeterministic(t *testing.T) {
+	const SCRIPT = `
+	const res = [];
+	for (let i = 0; i < 3; i++) {
+		res.push(Math.random());
+	}
+	res.push(Date.now(), Date.now(), new Date().getTimezoneOffset(), String(new Date(2020, 0, 1)));
+	res.push(Object.keys(m).join(), JSON.stringify(m2));
+	res.join();
+	`
+	run := func() string {
+		vm := New()
+		loc := time.FixedZone("XYZ", 3*3600)
+		vm.SetDeterministic(DeterministicOptions{
+			Seed:      42,
+			StartTime: time.UnixMilli(1000),
+			TimeStep:  time.Millisecond,
+			Location:  loc,
+		})
+		m := make(map[string]interface{})
+		m2 := make(map[int]string)
+		for i := 0; i < 20; i++ {
+			m[string(rune('a'+i))] = i
+			m2[i] = "x"
+		}
+		vm.Set("m", m)
+		vm.Set("m2", m2)
+		v, err := vm.RunString(SCRIPT)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v.String()
+	}
+	res := run()
+	for i := 0; i < 5; i++ {
+		if r := run(); r != res {
+			t.Fatalf("%s != %s", r, res)
+		}
+	}
+	vm := New()
+	vm.SetDeterministic(DeterministicOptions{})
+	v, err := vm.RunString(`[Date.now(), Date.now(), new Date().getTimezoneOffset()].join()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := v.String(); s != "0,0,0" {
+		t.Fatal(s)
+	}
+}
+
+func TestSetTimeZone(t *testing.T) {
+	vm := New()
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm.SetTimeZone(loc)
+	_, err = vm.RunString(TESTLIB + `
+	var d = new Date(2016, 8, 1, 12, 23, 45);
+	assert.sameValue(d.getHours(), 12);
+	assert.sameValue(d.getUTCHours(), 16);
+	assert.sameValue(d.getTimezoneOffset(), 240);
+	d.setUTCHours(13);
+	assert.sameValue(d.getHours(), 9);
+	assert.sameValue(Date.parse("2016-09-01T12:00:00"), Date.UTC(2016, 8, 1, 16));
+	assert.sameValue(new Date(2016, 0, 1).getTimezoneOffset(), 300);
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := vm.RunString(`new Date(2016, 8, 1)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tm := v.Export().(time.Time); tm.Location() != loc || tm.Hour() != 0 {
+		t.Fatal(tm)
+	}
+}
+
+func TestRecordReplay(t *testing.T) {
+	const SCRIPT = `
+	var n = 0;
+	const res = [];
+	res.push(fetch("a").value, Math.random() < 1, typeof Date.now());
+	try {
+		fetch("fail");
+	} catch (e) {
+		res.push(e.message);
+	}
+	res.push(counter(), counter(), JSON.stringify(fetch("b")));
+	res.join();
+	`
+	calls := 0
+	setup := func(vm *Runtime) {
+		vm.Set("fetch", func(url string) (map[string]interface{}, error) {
+			calls++
+			if url == "fail" {
+				return nil, errors.New("network error")
+			}
+			return map[string]interface{}{"value": url + "!"}, nil
+		})
+		vm.Set("counter", func(call FunctionCall) Value {
+			calls++
+			return vm.ToValue(calls)
+		})
+	}
+
+	vm := New()
+	setup(vm)
+	rec := vm.StartRecording()
+	expected, err := vm.RunString(SCRIPT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := vm.StopRecording(); n != 7 {
+		t.Fatalf("Recorded %d entries", n)
+	}
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rec1 Recording
+	if err := json.Unmarshal(data, &rec1); err != nil {
+		t.Fatal(err)
+	}
+
+	calls = 100
+	vm = New()
+	setup(vm)
+	vm.StartReplay(&rec1)
+	res, err := vm.RunString(SCRIPT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.String() != expected.String() {
+		t.Fatalf("%s != %s", res, expected)
+	}
+	if calls != 100 {
+		t.Fatal("host functions were called during replay")
+	}
+	if n := vm.StopRecording(); n != 7 {
+		t.Fatalf("Replayed %d entries", n)
+	}
+
+	vm.StartReplay(&rec1)
+	_, err = vm.RunString(`Math.random()`)
+	if !errors.Is(err, ErrReplayDiverged) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	vm.StartReplay(&Recording{})
+	_, err = vm.RunString(`counter()`)
+	if !errors.Is(err, ErrReplayDiverged) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestRecordNonCloneable(t *testing.T) {
+	vm := New()
+	vm.Set("getFn", func() func() {
+		return func() {}
+	})
+	rec := vm.StartRecording()
+	if _, err := vm.RunString(`getFn()()`); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.Entries) != 2 || rec.Entries[0].Error == "" {
+		t.Fatalf("Unexpected entries: %+v", rec.Entries)
+	}
+	vm.StartReplay(rec)
+	if _, err := vm.RunString(`getFn()`); !errors.Is(err, ErrReplayDiverged) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
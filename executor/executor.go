@@ -0,0 +1,511 @@
+/*
+Package executor provides a goroutine-safe way of using a goja Runtime.
+
+An Executor owns a Runtime and runs all submitted tasks (Go functions and scripts) on a single goroutine, one at
+a time. Between the tasks it runs the pending promise jobs. Results are delivered via goja.Future, so they can be
+awaited from any goroutine, or returned directly to a script running in another Runtime.
+
+Unless disabled with WithDisableTimers, the following globals are available to the scripts:
+
+	setTimeout(callback, delay[, ...args])
+	setInterval(callback, delay[, ...args])
+	clearTimeout(id)
+	clearInterval(id)
+*/
+package executor
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// ErrClosed is returned for tasks submitted after the Executor has been closed, and for tasks that were pending
+// at the time it was closed.
+var ErrClosed = errors.New("executor is closed")
+
+// Option represents one of the options for the Executor.
+type Option func(*options)
+
+type options struct {
+	setup         func(vm *goja.Runtime) error
+	errorHandler  func(err error)
+	disableTimers bool
+}
+
+// WithSetup sets a function that is called on the executor goroutine before any tasks are run. It can be used to
+// add host functions to the Runtime. If it returns an error, New returns that error.
+func WithSetup(setup func(vm *goja.Runtime) error) Option {
+	return func(opts *options) {
+		opts.setup = setup
+	}
+}
+
+// WithErrorHandler sets a function which is called (on the executor goroutine) when a timer callback throws an
+// exception. If not set, such exceptions are ignored.
+func WithErrorHandler(handler func(err error)) Option {
+	return func(opts *options) {
+		opts.errorHandler = handler
+	}
+}
+
+// WithDisableTimers is an option to not add the timer functions (setTimeout, etc.) to the Runtime.
+func WithDisableTimers(opts *options) {
+	opts.disableTimers = true
+}
+
+// ScriptError is returned when a task results in a JavaScript exception. Its message is computed on the executor
+// goroutine, so unlike *goja.Exception it can be safely used from any goroutine. The underlying *goja.Exception is
+// available via errors.As(), however its Value() must only be accessed from within a task.
+type ScriptError struct {
+	msg string
+	ex  *goja.Exception
+}
+
+func (e *ScriptError) Error() string {
+	return e.msg
+}
+
+func (e *ScriptError) Unwrap() error {
+	return e.ex
+}
+
+type task struct {
+	ctx       context.Context
+	run       func(vm *goja.Runtime, complete func(value interface{}, err error))
+	complete  func(value interface{}, err error)
+	completed bool
+}
+
+// Executor owns a Runtime and runs tasks on it using a dedicated goroutine. All methods of Executor are
+// goroutine-safe.
+type Executor struct {
+	opts options
+	vm   *goja.Runtime
+
+	jobs queue
+
+	mu      sync.Mutex
+	current *task
+	pending map[*task]struct{}
+	closed  chan struct{}
+	done    chan struct{}
+
+	// the fields below are only accessed from the executor goroutine
+	timers     map[int64]*time.Timer
+	lastTimer  int64
+	runPending goja.Callable
+	unsettled  map[*task]struct{} // tasks that have started, but not completed yet (i.e. awaiting a Promise)
+}
+
+// queue is an unbounded goroutine-safe FIFO queue of jobs.
+type queue struct {
+	mu     sync.Mutex
+	jobs   []func()
+	notify chan struct{}
+}
+
+func (q *queue) push(job func()) {
+	q.mu.Lock()
+	q.jobs = append(q.jobs, job)
+	q.mu.Unlock()
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (q *queue) pop() (job func()) {
+	q.mu.Lock()
+	if len(q.jobs) > 0 {
+		job = q.jobs[0]
+		q.jobs[0] = nil
+		q.jobs = q.jobs[1:]
+	}
+	q.mu.Unlock()
+	return
+}
+
+// New creates an Executor and starts its goroutine.
+func New(opts ...Option) (*Executor, error) {
+	e := &Executor{
+		vm:        goja.New(),
+		closed:    make(chan struct{}),
+		done:      make(chan struct{}),
+		timers:    make(map[int64]*time.Timer),
+		pending:   make(map[*task]struct{}),
+		unsettled: make(map[*task]struct{}),
+	}
+	e.jobs.notify = make(chan struct{}, 1)
+	for _, opt := range opts {
+		opt(&e.opts)
+	}
+	initErr := make(chan error, 1)
+	go e.run(initErr)
+	if err := <-initErr; err != nil {
+		<-e.done
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *Executor) init() (err error) {
+	vm := e.vm
+	vm.SetAsyncScheduler(e.jobs.push)
+	// Calling any function from Go at the top level runs the pending promise jobs.
+	e.runPending, _ = goja.AssertFunction(vm.ToValue(func(goja.FunctionCall) goja.Value {
+		return goja.Undefined()
+	}))
+	if !e.opts.disableTimers {
+		if ex := vm.Try(func() {
+			e.initTimers()
+		}); ex != nil {
+			return ex
+		}
+	}
+	if e.opts.setup != nil {
+		return e.opts.setup(vm)
+	}
+	return nil
+}
+
+func (e *Executor) run(initErr chan<- error) {
+	defer close(e.done)
+	err := e.init()
+	initErr <- err
+	if err != nil {
+		e.close()
+		return
+	}
+	for {
+		select {
+		case <-e.closed:
+			e.shutdown()
+			return
+		default:
+		}
+		if job := e.jobs.pop(); job != nil {
+			job()
+			continue
+		}
+		select {
+		case <-e.jobs.notify:
+		case <-e.closed:
+		}
+	}
+}
+
+func (e *Executor) shutdown() {
+	for id, t := range e.timers {
+		t.Stop()
+		delete(e.timers, id)
+	}
+	for t := range e.unsettled {
+		e.finish(t, nil, ErrClosed)
+	}
+	e.mu.Lock()
+	for t := range e.pending {
+		t.complete(nil, ErrClosed)
+	}
+	e.pending = nil
+	e.mu.Unlock()
+}
+
+// Close stops the Executor. The currently running task (if any) is interrupted and completes with
+// a *goja.InterruptedError, a running timer or AfterFunc callback is interrupted as well. The pending
+// tasks complete with ErrClosed. Timers are stopped.
+func (e *Executor) Close() {
+	e.mu.Lock()
+	e.closeLocked()
+	// The interrupt is requested unconditionally because the callbacks run without a current task.
+	// Once closed, the Runtime does not run any more code, so the interrupt never needs to be cleared.
+	e.vm.Interrupt(ErrClosed)
+	e.mu.Unlock()
+}
+
+func (e *Executor) close() {
+	e.mu.Lock()
+	e.closeLocked()
+	e.mu.Unlock()
+}
+
+func (e *Executor) closeLocked() {
+	if !e.isClosed() {
+		close(e.closed)
+	}
+}
+
+// Done returns a channel which is closed when the executor goroutine exits.
+func (e *Executor) Done() <-chan struct{} {
+	return e.done
+}
+
+func (e *Executor) isClosed() bool {
+	select {
+	case <-e.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func wrapError(err error) error {
+	var ex *goja.Exception
+	if errors.As(err, &ex) {
+		var interrupted *goja.InterruptedError
+		if !errors.As(err, &interrupted) {
+			return &ScriptError{msg: ex.Error(), ex: ex}
+		}
+	}
+	return err
+}
+
+func (e *Executor) finish(t *task, value interface{}, err error) {
+	if !t.completed {
+		t.completed = true
+		delete(e.unsettled, t)
+		t.complete(value, wrapError(err))
+	}
+}
+
+func (e *Executor) call(t *task) {
+	e.unsettled[t] = struct{}{}
+	complete := func(value interface{}, err error) {
+		e.finish(t, value, err)
+	}
+	defer func() {
+		if x := recover(); x != nil {
+			if err, ok := x.(error); ok {
+				complete(nil, err)
+				return
+			}
+			panic(x)
+		}
+	}()
+	t.run(e.vm, complete)
+}
+
+func (e *Executor) runTask(t *task) {
+	e.mu.Lock()
+	if _, exists := e.pending[t]; !exists {
+		e.mu.Unlock()
+		return
+	}
+	delete(e.pending, t)
+	if err := t.ctx.Err(); err != nil {
+		e.mu.Unlock()
+		t.complete(nil, err)
+		return
+	}
+	e.current = t
+	e.mu.Unlock()
+	stop := context.AfterFunc(t.ctx, func() {
+		e.mu.Lock()
+		if e.current == t {
+			e.vm.Interrupt(t.ctx.Err())
+		}
+		e.mu.Unlock()
+	})
+
+	e.call(t)
+
+	stop()
+	e.mu.Lock()
+	e.current = nil
+	if !e.isClosed() {
+		e.vm.ClearInterrupt()
+	}
+	e.mu.Unlock()
+	_, _ = e.runPending(nil)
+}
+
+func (e *Executor) submit(ctx context.Context, run func(vm *goja.Runtime, complete func(value interface{}, err error))) *goja.Future {
+	f, complete := goja.NewFuture()
+	t := &task{
+		ctx:      ctx,
+		run:      run,
+		complete: complete,
+	}
+	e.mu.Lock()
+	if e.isClosed() {
+		e.mu.Unlock()
+		complete(nil, ErrClosed)
+		return f
+	}
+	e.pending[t] = struct{}{}
+	e.mu.Unlock()
+	e.jobs.push(func() {
+		e.runTask(t)
+	})
+	return f
+}
+
+// Submit schedules fn to be run on the executor goroutine and returns a Future that completes with the result.
+// The returned value must be safe to use from other goroutines, i.e. it should not contain goja.Values or objects
+// that belong to the Runtime (use Value.Export() if needed).
+//
+// If ctx is done before fn starts, it is not run and the Future completes with ctx.Err(). If ctx is done while
+// fn is running JavaScript code, the code is interrupted (see goja.Runtime.Interrupt()).
+//
+// If fn panics with an error (e.g. a *goja.Exception), the Future completes with that error. JavaScript exceptions
+// are converted into *ScriptError.
+func (e *Executor) Submit(ctx context.Context, fn func(vm *goja.Runtime) (interface{}, error)) *goja.Future {
+	return e.submit(ctx, func(vm *goja.Runtime, complete func(value interface{}, err error)) {
+		complete(fn(vm))
+	})
+}
+
+// RunProgram runs the program and returns a Future that completes with the exported (see goja.Value.Export())
+// result. If the result is a Promise, the Future completes when the Promise is settled, or when ctx is done,
+// whichever happens first.
+func (e *Executor) RunProgram(ctx context.Context, prg *goja.Program) *goja.Future {
+	return e.submit(ctx, func(vm *goja.Runtime, complete func(value interface{}, err error)) {
+		v, err := vm.RunProgram(prg)
+		if err != nil {
+			complete(nil, err)
+			return
+		}
+		if _, ok := v.Export().(*goja.Promise); ok {
+			e.awaitPromise(ctx, vm, v, complete)
+			return
+		}
+		complete(v.Export(), nil)
+	})
+}
+
+// RunScript compiles and runs the script. See RunProgram for details.
+func (e *Executor) RunScript(ctx context.Context, name, src string) *goja.Future {
+	prg, err := goja.Compile(name, src, false)
+	if err != nil {
+		f, complete := goja.NewFuture()
+		complete(nil, err)
+		return f
+	}
+	return e.RunProgram(ctx, prg)
+}
+
+func (e *Executor) awaitPromise(ctx context.Context, vm *goja.Runtime, v goja.Value, complete func(value interface{}, err error)) {
+	stop := context.AfterFunc(ctx, func() {
+		e.jobs.push(func() {
+			complete(nil, ctx.Err())
+		})
+	})
+	then, _ := goja.AssertFunction(v.ToObject(vm).Get("then"))
+	_, err := then(v, vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		stop()
+		complete(call.Argument(0).Export(), nil)
+		return goja.Undefined()
+	}), vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		stop()
+		reason := call.Argument(0)
+		// throwing the reason is the way to obtain an *goja.Exception for it
+		complete(nil, vm.Try(func() {
+			panic(reason)
+		}))
+		return goja.Undefined()
+	}))
+	if err != nil {
+		complete(nil, err)
+	}
+}
+
+func (e *Executor) runCallback(fn func(vm *goja.Runtime)) {
+	defer func() {
+		if x := recover(); x != nil {
+			if err, ok := x.(error); ok {
+				if e.opts.errorHandler != nil {
+					e.opts.errorHandler(wrapError(err))
+				}
+				return
+			}
+			panic(x)
+		}
+	}()
+	fn(e.vm)
+	_, _ = e.runPending(nil)
+}
+
+// AfterFunc schedules fn to be run on the executor goroutine after the duration d. The returned function cancels
+// the call; it returns false if the call has already started (or has already been cancelled).
+// If fn panics with an error, it's passed to the error handler (see WithErrorHandler).
+func (e *Executor) AfterFunc(d time.Duration, fn func(vm *goja.Runtime)) (cancel func() bool) {
+	var started atomic.Bool
+	t := time.AfterFunc(d, func() {
+		e.jobs.push(func() {
+			if started.CompareAndSwap(false, true) {
+				e.runCallback(fn)
+			}
+		})
+	})
+	return func() bool {
+		t.Stop()
+		return started.CompareAndSwap(false, true)
+	}
+}
+
+func (e *Executor) initTimers() {
+	vm := e.vm
+	global := vm.GlobalObject()
+	global.Set("setTimeout", func(call goja.FunctionCall) goja.Value {
+		return e.setTimer(call, false)
+	})
+	global.Set("setInterval", func(call goja.FunctionCall) goja.Value {
+		return e.setTimer(call, true)
+	})
+	clearTimer := func(call goja.FunctionCall) goja.Value {
+		e.clearTimer(call.Argument(0).ToInteger())
+		return goja.Undefined()
+	}
+	global.Set("clearTimeout", clearTimer)
+	global.Set("clearInterval", clearTimer)
+}
+
+func (e *Executor) setTimer(call goja.FunctionCall, repeat bool) goja.Value {
+	vm := e.vm
+	fn, ok := goja.AssertFunction(call.Argument(0))
+	if !ok {
+		panic(vm.NewTypeError("The \"callback\" argument must be a function"))
+	}
+	delay := time.Duration(call.Argument(1).ToInteger()) * time.Millisecond
+	if delay < 0 {
+		delay = 0
+	}
+	var args []goja.Value
+	if len(call.Arguments) > 2 {
+		args = append(args, call.Arguments[2:]...)
+	}
+	e.lastTimer++
+	id := e.lastTimer
+	var t *time.Timer
+	t = time.AfterFunc(delay, func() {
+		e.jobs.push(func() {
+			if e.timers[id] != t {
+				// cleared
+				return
+			}
+			if repeat {
+				t.Reset(delay)
+			} else {
+				delete(e.timers, id)
+			}
+			e.runCallback(func(vm *goja.Runtime) {
+				if _, err := fn(nil, args...); err != nil {
+					panic(err)
+				}
+			})
+		})
+	})
+	e.timers[id] = t
+	return vm.ToValue(id)
+}
+
+func (e *Executor) clearTimer(id int64) {
+	if t := e.timers[id]; t != nil {
+		t.Stop()
+		delete(e.timers, id)
+	}
+}
@@ -0,0 +1,268 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+func newExecutor(t *testing.T, opts ...Option) *Executor {
+	t.Helper()
+	e, err := New(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(e.Close)
+	return e
+}
+
+func result(t *testing.T, f *goja.Future) (interface{}, error) {
+	t.Helper()
+	select {
+	case <-f.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+	return f.Result()
+}
+
+func TestSubmit(t *testing.T) {
+	e := newExecutor(t)
+	done := make(chan struct{})
+	for i := 0; i < 10; i++ {
+		go func(i int) {
+			res, err := result(t, e.Submit(context.Background(), func(vm *goja.Runtime) (interface{}, error) {
+				v, err := vm.RunString(`var counter = (typeof counter === "undefined" ? 0 : counter) + 1; counter`)
+				if err != nil {
+					return nil, err
+				}
+				return v.Export(), nil
+			}))
+			if err != nil {
+				t.Error(err)
+			}
+			if n := res.(int64); n < 1 || n > 10 {
+				t.Errorf("unexpected counter: %d", n)
+			}
+			done <- struct{}{}
+		}(i)
+	}
+	for i := 0; i < 10; i++ {
+		<-done
+	}
+	res, err := result(t, e.RunScript(context.Background(), "test.js", "counter"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != int64(10) {
+		t.Fatal(res)
+	}
+}
+
+func TestRunScriptPromise(t *testing.T) {
+	e := newExecutor(t)
+	res, err := result(t, e.RunScript(context.Background(), "test.js", `
+	(async () => {
+		await new Promise(resolve => setTimeout(resolve, 10));
+		return "done";
+	})()
+	`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != "done" {
+		t.Fatal(res)
+	}
+
+	_, err = result(t, e.RunScript(context.Background(), "test.js", `Promise.reject(new TypeError("rejected"))`))
+	var scriptErr *ScriptError
+	if !errors.As(err, &scriptErr) || !strings.HasPrefix(scriptErr.Error(), "TypeError: rejected") {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = result(t, e.RunScript(ctx, "test.js", `new Promise(() => {})`))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestScriptError(t *testing.T) {
+	e := newExecutor(t)
+	_, err := result(t, e.RunScript(context.Background(), "test.js", `throw new Error("boom")`))
+	var scriptErr *ScriptError
+	if !errors.As(err, &scriptErr) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var ex *goja.Exception
+	if !errors.As(err, &ex) {
+		t.Fatal("no exception")
+	}
+	if msg := scriptErr.Error(); !strings.HasPrefix(msg, "Error: boom at test.js:1:7") {
+		t.Fatal(msg)
+	}
+
+	_, err = result(t, e.RunScript(context.Background(), "test.js", `(`))
+	var syntaxErr *goja.CompilerSyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	e := newExecutor(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	f := e.RunScript(ctx, "test.js", `for (;;) {}`)
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	_, err := result(t, f)
+	var interrupted *goja.InterruptedError
+	if !errors.As(err, &interrupted) || interrupted.Value() != context.Canceled {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	_, err = result(t, e.RunScript(ctx, "test.js", `1`))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// the executor must remain usable
+	res, err := result(t, e.RunScript(context.Background(), "test.js", `1+1`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != int64(2) {
+		t.Fatal(res)
+	}
+}
+
+func TestClose(t *testing.T) {
+	e := newExecutor(t)
+	running := e.RunScript(context.Background(), "test.js", `for (;;) {}`)
+	pending := e.RunScript(context.Background(), "test.js", `1`)
+	awaiting, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsettled := awaiting.RunScript(context.Background(), "test.js", `new Promise(() => {})`)
+	time.Sleep(10 * time.Millisecond)
+	e.Close()
+	awaiting.Close()
+
+	var interrupted *goja.InterruptedError
+	if _, err := result(t, running); !errors.As(err, &interrupted) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := result(t, pending); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := result(t, unsettled); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := result(t, e.RunScript(context.Background(), "test.js", `1`)); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	<-e.Done()
+}
+
+func TestCloseRunawayCallback(t *testing.T) {
+	errs := make(chan error, 1)
+	started := make(chan struct{})
+	e := newExecutor(t, WithErrorHandler(func(err error) {
+		errs <- err
+	}), WithSetup(func(vm *goja.Runtime) error {
+		return vm.Set("started", func() { close(started) })
+	}))
+	if _, err := result(t, e.RunScript(context.Background(), "test.js", `setTimeout(() => { started(); for (;;) {} }, 0)`)); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	e.Close()
+	select {
+	case <-e.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for Done()")
+	}
+	var interrupted *goja.InterruptedError
+	if err := <-errs; !errors.As(err, &interrupted) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestTimers(t *testing.T) {
+	errs := make(chan error, 1)
+	e := newExecutor(t, WithErrorHandler(func(err error) {
+		errs <- err
+	}))
+	res, err := result(t, e.RunScript(context.Background(), "test.js", `
+	new Promise(resolve => {
+		const calls = [];
+		const cleared = setTimeout(() => calls.push("cleared"), 0);
+		clearTimeout(cleared);
+		setTimeout((a, b) => calls.push(a + b), 5, "time", "out");
+		let n = 0;
+		const id = setInterval(() => {
+			calls.push("interval");
+			if (++n === 3) {
+				clearInterval(id);
+				setTimeout(() => resolve(calls.join()), 20);
+			}
+		}, 1);
+	})
+	`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != "interval,interval,interval,timeout" && res != "interval,interval,timeout,interval" &&
+		res != "interval,timeout,interval,interval" && res != "timeout,interval,interval,interval" {
+		t.Fatal(res)
+	}
+
+	if _, err := result(t, e.RunScript(context.Background(), "test.js", `setTimeout(() => { throw new Error("in timer"); }, 0)`)); err != nil {
+		t.Fatal(err)
+	}
+	var scriptErr *ScriptError
+	if err := <-errs; !errors.As(err, &scriptErr) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	e1 := newExecutor(t, WithDisableTimers)
+	res, err = result(t, e1.RunScript(context.Background(), "test.js", `typeof setTimeout`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != "undefined" {
+		t.Fatal(res)
+	}
+}
+
+func TestAfterFunc(t *testing.T) {
+	e := newExecutor(t)
+	called := make(chan interface{}, 1)
+	e.AfterFunc(time.Millisecond, func(vm *goja.Runtime) {
+		called <- vm.Get("x")
+	})
+	if !e.AfterFunc(time.Hour, func(vm *goja.Runtime) {
+		t.Error("should not be called")
+	})() {
+		t.Fatal("cancel failed")
+	}
+	if v := <-called; v != nil {
+		t.Fatal(v)
+	}
+}
+
+func TestSetupError(t *testing.T) {
+	setupErr := errors.New("setup failed")
+	_, err := New(WithSetup(func(*goja.Runtime) error {
+		return setupErr
+	}))
+	if err != setupErr {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package goja
 import (
 	"fmt"
 	"reflect"
+	"time"
 
 	"github.com/dop251/goja/unistring"
 )
@@ -326,6 +327,7 @@ func (f *classFuncObject) _initFields(instance *Object) {
 	if f.initFields != nil {
 		vm := f.val.runtime.vm
 		vm.pushCtx()
+		vm.r = f.val.runtime
 		vm.prg = f.initFields
 		vm.stash = f.stash
 		vm.privEnv = f.privEnv
@@ -397,6 +399,12 @@ func (f *arrowFuncObject) Call(call FunctionCall) Value {
 func (f *baseJsFuncObject) __call(args []Value, newTarget, this Value) (Value, *Exception) {
 	vm := f.val.runtime.vm
 
+	if f.prg.lazy != nil {
+		if ex := vm.try(func() { f.funcPrg() }); ex != nil {
+			return nil, ex
+		}
+	}
+
 	vm.stack.expand(vm.sp + len(args) + 1)
 	vm.stack[vm.sp] = f.val
 	vm.sp++
@@ -424,6 +432,7 @@ func (f *baseJsFuncObject) __call(args []Value, newTarget, this Value) (Value, *
 		vm.pushCtx()
 	}
 
+	vm.r = f.val.runtime
 	vm.args = len(args)
 	vm.prg = f.prg
 	vm.stash = f.stash
@@ -479,9 +488,11 @@ func (f *funcObject) assertConstructor() func(args []Value, newTarget *Object) *
 }
 
 func (f *baseJsFuncObject) vmCall(vm *vm, n int) {
+	prg := f.funcPrg()
 	vm.pushCtx()
+	vm.r = f.val.runtime
 	vm.args = n
-	vm.prg = f.prg
+	vm.prg = prg
 	vm.stash = f.stash
 	vm.privEnv = f.privEnv
 	vm.pc = 0
@@ -493,9 +504,11 @@ func (f *arrowFuncObject) assertCallable() (func(FunctionCall) Value, bool) {
 }
 
 func (f *arrowFuncObject) vmCall(vm *vm, n int) {
+	prg := f.funcPrg()
 	vm.pushCtx()
+	vm.r = f.val.runtime
 	vm.args = n
-	vm.prg = f.prg
+	vm.prg = prg
 	vm.stash = f.stash
 	vm.privEnv = f.privEnv
 	vm.pc = 0
@@ -683,9 +696,14 @@ type asyncRunner struct {
 	promiseCap *promiseCapability
 	f          *Object
 	vmCall     func(*vm, int)
+
+	// set while awaiting if a profile is active
+	awaitProf  *profiler
+	awaitStart time.Time
 }
 
 func (ar *asyncRunner) onFulfilled(call FunctionCall) Value {
+	ar.gen.vm.profileAwait(ar)
 	ar.gen.vm.curAsyncRunner = ar
 	defer func() {
 		ar.gen.vm.curAsyncRunner = nil
@@ -697,6 +715,7 @@ func (ar *asyncRunner) onFulfilled(call FunctionCall) Value {
 }
 
 func (ar *asyncRunner) onRejected(call FunctionCall) Value {
+	ar.gen.vm.profileAwait(ar)
 	ar.gen.vm.curAsyncRunner = ar
 	defer func() {
 		ar.gen.vm.curAsyncRunner = nil
@@ -719,6 +738,9 @@ func (ar *asyncRunner) step(res Value, done bool, ex *Exception) {
 	}
 
 	// await
+	if p := r.vm.activeProfiler(); p != nil {
+		ar.awaitProf, ar.awaitStart = p, time.Now()
+	}
 	promise := r.promiseResolve(r.getPromise(), res)
 	promise.self.(*Promise).addReactions(&promiseReaction{
 		typ:         promiseReactionFulfill,
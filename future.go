@@ -0,0 +1,273 @@
+package goja
+
+import (
+	gocontext "context"
+	"errors"
+	"reflect"
+	"sync"
+)
+
+// AsyncScheduler delivers the results of asynchronous Go operations (see Future) back to the Runtime.
+// It is called from arbitrary goroutines and must arrange for job to be called on the goroutine that
+// owns the Runtime, when no JavaScript code is running. For example, with the event loop from goja_nodejs:
+//
+//	vm.SetAsyncScheduler(func(job func()) {
+//	    loop.RunOnLoop(func(*goja.Runtime) {
+//	        job()
+//	    })
+//	})
+type AsyncScheduler func(job func())
+
+// Future represents the result of an asynchronous Go operation. When a Future is converted into a JavaScript
+// value (either with Runtime.ToValue() or by being returned from a Go function) it becomes a Promise which is settled
+// on the Runtime's goroutine once the Future completes. See Runtime.SetAsyncScheduler() for details on how the
+// result is delivered.
+//
+// Unlike most of the types in this package, Future is goroutine-safe.
+type Future struct {
+	done  chan struct{}
+	once  sync.Once
+	value interface{}
+	err   error
+}
+
+// NewFuture creates a new Future and a function that completes it. Only the first call to complete has any effect.
+// If err is not nil, the resulting Promise is rejected: *Exception values are rejected with their JavaScript value,
+// any other errors are wrapped in a GoError. Otherwise, the Promise is resolved with value converted using
+// Runtime.ToValue() on the Runtime's goroutine.
+func NewFuture() (f *Future, complete func(value interface{}, err error)) {
+	f = &Future{
+		done: make(chan struct{}),
+	}
+	return f, f.complete
+}
+
+// Async runs fn in a new goroutine and returns a Future that completes with its result.
+func Async(fn func() (interface{}, error)) *Future {
+	f, complete := NewFuture()
+	go func() {
+		complete(fn())
+	}()
+	return f
+}
+
+func (f *Future) complete(value interface{}, err error) {
+	f.once.Do(func() {
+		f.value, f.err = value, err
+		close(f.done)
+	})
+}
+
+// Done returns a channel that is closed when the Future completes.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Result blocks until the Future completes and returns its result.
+func (f *Future) Result() (interface{}, error) {
+	<-f.done
+	return f.value, f.err
+}
+
+func (f *Future) isDone() bool {
+	select {
+	case <-f.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (f *Future) toValue(r *Runtime) Value {
+	if f == nil {
+		return _null
+	}
+	return r.futureToPromise(f)
+}
+
+type asyncQueue struct {
+	mu     sync.Mutex
+	jobs   []func()
+	wakeup chan struct{}
+}
+
+func newAsyncQueue() *asyncQueue {
+	return &asyncQueue{
+		wakeup: make(chan struct{}, 1),
+	}
+}
+
+func (q *asyncQueue) schedule(job func()) {
+	q.mu.Lock()
+	q.jobs = append(q.jobs, job)
+	q.mu.Unlock()
+	select {
+	case q.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+func (q *asyncQueue) run() {
+	q.mu.Lock()
+	jobs := q.jobs
+	q.jobs = nil
+	q.mu.Unlock()
+	for _, job := range jobs {
+		job()
+	}
+}
+
+func (r *Runtime) getAsyncScheduler() AsyncScheduler {
+	if s := r.agent.asyncScheduler; s != nil {
+		return s
+	}
+	if r.agent.asyncQueue == nil {
+		r.agent.asyncQueue = newAsyncQueue()
+	}
+	return r.agent.asyncQueue.schedule
+}
+
+func (r *Runtime) settlePromise(p *Promise, value interface{}, err error) {
+	resolve, reject := p.createResolvingFunctions()
+	if err != nil {
+		var reason Value
+		if ex, ok := err.(*Exception); ok {
+			reason = ex.val
+		} else {
+			reason = r.NewGoError(err)
+		}
+		fn, _ := AssertFunction(reject)
+		_, _ = fn(nil, reason)
+		return
+	}
+	fn, _ := AssertFunction(resolve)
+	_, _ = fn(nil, r.ToValue(value))
+}
+
+func (r *Runtime) futureToPromise(f *Future) Value {
+	p := r.newPromise(r.getPromisePrototype())
+	if f.isDone() {
+		r.settlePromise(p, f.value, f.err)
+		return p.val
+	}
+	schedule := r.getAsyncScheduler()
+	go func() {
+		<-f.done
+		schedule(func() {
+			r.settlePromise(p, f.value, f.err)
+		})
+	}()
+	return p.val
+}
+
+// chanToFuture converts a receive-only channel returned by a Go function into a Future which completes with the
+// first value received from the channel (or undefined if the channel is closed without sending anything).
+// If the received value is a non-nil error, the Future completes with that error.
+func chanToFuture(ch reflect.Value) *Future {
+	f, complete := NewFuture()
+	go func() {
+		v, ok := ch.Recv()
+		if !ok {
+			complete(_undefined, nil)
+			return
+		}
+		value := v.Interface()
+		if err, isErr := value.(error); isErr && err != nil {
+			complete(nil, err)
+			return
+		}
+		complete(value, nil)
+	}()
+	return f
+}
+
+func isRecvChan(typ reflect.Type) bool {
+	return typ.Kind() == reflect.Chan && typ.ChanDir() == reflect.RecvDir
+}
+
+var errAwaitWhileRunning = errors.New("AwaitPromise cannot be called while JavaScript code is running")
+
+// SetAsyncScheduler sets the scheduler used to deliver results of asynchronous Go operations (Futures and
+// receive-only channels returned from Go functions) back to the Runtime.
+//
+// If not set (or set to nil), the results are kept in an internal goroutine-safe queue which is processed by
+// AwaitPromise().
+func (r *Runtime) SetAsyncScheduler(scheduler AsyncScheduler) {
+	r.agent.asyncScheduler = scheduler
+}
+
+// AwaitPromise waits until the Promise is settled or ctx is done. If the Promise is fulfilled, its result is returned.
+// If it is rejected, the returned error is an *Exception containing the rejection reason.
+//
+// If no AsyncScheduler is set, this method must be called on the goroutine that owns the Runtime, when no JavaScript
+// code is running. While waiting, it processes the results of asynchronous Go operations as they arrive.
+//
+// If a custom AsyncScheduler is set, this method must be called from a goroutine other than the one that runs the
+// scheduled jobs (otherwise it will block forever): the Promise is inspected via a job submitted to the scheduler.
+// Note, in this case the returned Value belongs to the Runtime and must not be used concurrently with it.
+func (r *Runtime) AwaitPromise(ctx gocontext.Context, p *Promise) (Value, error) {
+	if r.agent.asyncScheduler != nil {
+		return r.awaitPromiseScheduled(ctx, p)
+	}
+	if len(r.vm.callStack) > 0 {
+		return nil, errAwaitWhileRunning
+	}
+	q := r.agent.asyncQueue
+	if q == nil {
+		q = newAsyncQueue()
+		r.agent.asyncQueue = q
+	}
+	for {
+		q.run()
+		switch p.state {
+		case PromiseStateFulfilled:
+			return p.result, nil
+		case PromiseStateRejected:
+			return nil, r.handledRejection(p)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-q.wakeup:
+		}
+	}
+}
+
+func (r *Runtime) handledRejection(p *Promise) error {
+	if !p.handled {
+		r.trackPromiseRejection(p, PromiseRejectionHandle)
+		p.handled = true
+	}
+	return &Exception{val: p.result}
+}
+
+type promiseOutcome struct {
+	value Value
+	err   error
+}
+
+func (r *Runtime) awaitPromiseScheduled(ctx gocontext.Context, p *Promise) (Value, error) {
+	ch := make(chan promiseOutcome, 1)
+	r.agent.asyncScheduler(func() {
+		switch p.state {
+		case PromiseStateFulfilled:
+			ch <- promiseOutcome{value: p.result}
+		case PromiseStateRejected:
+			ch <- promiseOutcome{err: r.handledRejection(p)}
+		default:
+			r.performPromiseThen(p, r.newNativeFunc(func(call FunctionCall) Value {
+				ch <- promiseOutcome{value: call.Argument(0)}
+				return _undefined
+			}, "", 1), r.newNativeFunc(func(call FunctionCall) Value {
+				ch <- promiseOutcome{err: &Exception{val: call.Argument(0)}}
+				return _undefined
+			}, "", 1), nil)
+		}
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		return res.value, res.err
+	}
+}
@@ -0,0 +1,154 @@
+package goja
+
+import (
+	gocontext "context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFutureFromGoFunc(t *testing.T) {
+	vm := New()
+	vm.Set("fetch", func(n int) *Future {
+		return Async(func() (interface{}, error) {
+			time.Sleep(10 * time.Millisecond)
+			return n * 2, nil
+		})
+	})
+	v, err := vm.RunString(`
+	(async function() {
+		const a = await fetch(1);
+		const b = await fetch(a);
+		return a + b;
+	})();
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := vm.AwaitPromise(gocontext.Background(), v.Export().(*Promise))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.SameAs(valueInt(6)) {
+		t.Fatal(res)
+	}
+}
+
+func TestFutureReject(t *testing.T) {
+	vm := New()
+	vm.Set("fail", func() *Future {
+		f, complete := NewFuture()
+		go complete(nil, errors.New("boom"))
+		return f
+	})
+	v, err := vm.RunString(`
+	fail().catch(e => e.value.Error() + "!");
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := vm.AwaitPromise(gocontext.Background(), v.Export().(*Promise))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.String() != "boom!" {
+		t.Fatal(res)
+	}
+}
+
+func TestFutureChan(t *testing.T) {
+	vm := New()
+	vm.Set("recv", func(v string) <-chan string {
+		ch := make(chan string)
+		go func() {
+			ch <- v
+		}()
+		return ch
+	})
+	vm.Set("closed", func() (<-chan int, error) {
+		ch := make(chan int)
+		close(ch)
+		return ch, nil
+	})
+	v, err := vm.RunString(`
+	Promise.all([recv("a"), closed()]).then(([a, b]) => a + b);
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := vm.AwaitPromise(gocontext.Background(), v.Export().(*Promise))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.String() != "aundefined" {
+		t.Fatal(res)
+	}
+}
+
+func TestAwaitPromiseRejected(t *testing.T) {
+	vm := New()
+	v, err := vm.RunString(`Promise.reject(new Error("test"))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = vm.AwaitPromise(gocontext.Background(), v.Export().(*Promise))
+	var ex *Exception
+	if !errors.As(err, &ex) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ex.Value().ToObject(vm).Get("message").String() != "test" {
+		t.Fatal(ex)
+	}
+}
+
+func TestAwaitPromiseContext(t *testing.T) {
+	vm := New()
+	v, err := vm.RunString(`new Promise(() => {})`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := gocontext.WithTimeout(gocontext.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = vm.AwaitPromise(ctx, v.Export().(*Promise))
+	if !errors.Is(err, gocontext.DeadlineExceeded) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestAwaitPromiseScheduler(t *testing.T) {
+	vm := New()
+	jobs := make(chan func(), 10)
+	vm.SetAsyncScheduler(func(job func()) {
+		jobs <- job
+	})
+	vm.Set("delay", func(v string) *Future {
+		return Async(func() (interface{}, error) {
+			time.Sleep(10 * time.Millisecond)
+			return v, nil
+		})
+	})
+	v, err := vm.RunString(`delay("done")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := v.Export().(*Promise)
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case job := <-jobs:
+				job()
+			case <-stop:
+				return
+			}
+		}
+	}()
+	res, err := vm.AwaitPromise(gocontext.Background(), p)
+	close(stop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.String() != "done" {
+		t.Fatal(res)
+	}
+}
@@ -20,6 +20,8 @@ import (
 
 var cpuprofile = flag.String("cpuprofile", "", "write cpu profile to file")
 var timelimit = flag.Int("timelimit", 0, "max time to run (in seconds)")
+var coverage = flag.String("coverage", "", "write code coverage report to file")
+var coverageFormat = flag.String("coverage-format", "lcov", "code coverage report format: lcov, istanbul or gocover")
 
 func readSource(filename string) ([]byte, error) {
 	if filename == "" || filename == "-" {
@@ -84,14 +86,45 @@ func run() error {
 		})
 	}
 
+	compile := goja.Compile
+	var cov *goja.Coverage
+	if *coverage != "" {
+		cov = goja.NewCoverage()
+		vm.SetCoverage(cov)
+		compile = goja.CompileForCoverage
+	}
+
 	//log.Println("Compiling...")
-	prg, err := goja.Compile(filename, string(src), false)
+	prg, err := compile(filename, string(src), false)
 	if err != nil {
 		return err
 	}
 	//log.Println("Running...")
 	_, err = vm.RunProgram(prg)
 	//log.Println("Finished.")
+	if cov != nil {
+		if err1 := writeCoverage(cov); err1 != nil && err == nil {
+			err = err1
+		}
+	}
+	return err
+}
+
+var coverageWriters = map[string]func(*goja.Coverage, io.Writer) error{
+	"lcov":     (*goja.Coverage).WriteLCOV,
+	"istanbul": (*goja.Coverage).WriteIstanbul,
+	"gocover":  (*goja.Coverage).WriteGoCover,
+}
+
+func writeCoverage(cov *goja.Coverage) error {
+	f, err := os.Create(*coverage)
+	if err != nil {
+		return err
+	}
+	err = coverageWriters[*coverageFormat](cov, f)
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
 	return err
 }
 
@@ -103,6 +136,11 @@ func main() {
 		}
 	}()
 	flag.Parse()
+	if coverageWriters[*coverageFormat] == nil {
+		fmt.Fprintf(flag.CommandLine.Output(), "unknown coverage format: %s\n", *coverageFormat)
+		flag.Usage()
+		os.Exit(2)
+	}
 	if *cpuprofile != "" {
 		f, err := os.Create(*cpuprofile)
 		if err != nil {
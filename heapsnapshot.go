@@ -0,0 +1,703 @@
+package goja
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"weak"
+
+	"github.com/dop251/goja/unistring"
+)
+
+// HeapNodeType is the type of HeapNode. The values are the same as in the Chrome heap snapshot format.
+type HeapNodeType string
+
+const (
+	// HeapNodeHidden is an internal structure, such as a closure scope.
+	HeapNodeHidden HeapNodeType = "hidden"
+	HeapNodeArray  HeapNodeType = "array"
+	HeapNodeString HeapNodeType = "string"
+	HeapNodeObject HeapNodeType = "object"
+	// HeapNodeClosure is a function.
+	HeapNodeClosure HeapNodeType = "closure"
+	HeapNodeRegExp  HeapNodeType = "regexp"
+	// HeapNodeNative is an object backed by a Go value or the contents of an ArrayBuffer.
+	HeapNodeNative HeapNodeType = "native"
+	// HeapNodeSynthetic is the root node and the groups of roots.
+	HeapNodeSynthetic HeapNodeType = "synthetic"
+	HeapNodeSymbol    HeapNodeType = "symbol"
+	HeapNodeBigInt    HeapNodeType = "bigint"
+)
+
+// HeapEdgeType is the type of HeapEdge. The values are the same as in the Chrome heap snapshot format.
+type HeapEdgeType string
+
+const (
+	// HeapEdgeContext is a reference from a closure scope to a variable.
+	HeapEdgeContext HeapEdgeType = "context"
+	// HeapEdgeElement is a reference from an array to its element.
+	HeapEdgeElement HeapEdgeType = "element"
+	// HeapEdgeProperty is a reference from an object to a property value (or a getter or a setter).
+	HeapEdgeProperty HeapEdgeType = "property"
+	// HeapEdgeInternal is a reference which is not visible to scripts, such as the one from a function to its
+	// closure scope, or from a Proxy to its target.
+	HeapEdgeInternal HeapEdgeType = "internal"
+	// HeapEdgeHidden is an unnamed internal reference, such as the one from a Map to its entry.
+	HeapEdgeHidden HeapEdgeType = "hidden"
+	// HeapEdgeShortcut is a reference from the root.
+	HeapEdgeShortcut HeapEdgeType = "shortcut"
+	// HeapEdgeWeak is a reference which does not keep the target alive, such as the one from a WeakMap to its key.
+	HeapEdgeWeak HeapEdgeType = "weak"
+)
+
+// HeapNode is a node of the object graph captured by Runtime.TakeHeapSnapshot.
+type HeapNode struct {
+	// The identifier of the node. For objects and closure scopes it remains the same across the snapshots
+	// taken from the same Runtime, so that the snapshots can be compared.
+	ID   uint64
+	Type HeapNodeType
+	// The constructor name for objects, the function name for functions, the contents for strings, etc.
+	Name string
+	// The approximate size of the node itself in bytes (not including the nodes it references).
+	SelfSize int
+	// The value represented by this node, nil for internal nodes (such as closure scopes and the root).
+	Value Value
+	Edges []HeapEdge
+
+	obj *Object
+	st  *stash
+}
+
+// HeapEdge is a reference from one HeapNode to another.
+type HeapEdge struct {
+	Type HeapEdgeType
+	// The name of the edge, empty for element and hidden edges.
+	Name string
+	// The index for element and hidden edges.
+	Index int
+	To    *HeapNode
+}
+
+// HeapSnapshot is the object graph of a Runtime, see Runtime.TakeHeapSnapshot.
+type HeapSnapshot struct {
+	// The root node. It references the global object, the global lexical scope and (if the snapshot is taken while
+	// JavaScript code is running) the values on the stack.
+	Root *HeapNode
+	// All nodes, including the root which is always the first one.
+	Nodes []*HeapNode
+}
+
+type heapIDs struct {
+	objects map[weak.Pointer[Object]]uint64
+	stashes map[weak.Pointer[stash]]uint64
+	last    uint64
+}
+
+type heapSnapshotBuilder struct {
+	r   *Runtime
+	s   *HeapSnapshot
+	ids *heapIDs
+
+	objects map[*Object]*HeapNode
+	stashes map[*stash]*HeapNode
+	strings map[string]*HeapNode
+	symbols map[*Symbol]*HeapNode
+
+	queue []*HeapNode
+}
+
+func (ids *heapIDs) prune() {
+	for p := range ids.objects {
+		if p.Value() == nil {
+			delete(ids.objects, p)
+		}
+	}
+	for p := range ids.stashes {
+		if p.Value() == nil {
+			delete(ids.stashes, p)
+		}
+	}
+}
+
+func (ids *heapIDs) next() uint64 {
+	ids.last++
+	return ids.last
+}
+
+func (b *heapSnapshotBuilder) newNode(typ HeapNodeType, name string, size int, id uint64) *HeapNode {
+	if id == 0 {
+		id = b.ids.next()
+	}
+	n := &HeapNode{
+		ID:       id,
+		Type:     typ,
+		Name:     name,
+		SelfSize: size,
+	}
+	b.s.Nodes = append(b.s.Nodes, n)
+	return n
+}
+
+func (n *HeapNode) addEdge(typ HeapEdgeType, name string, to *HeapNode) {
+	if to != nil {
+		n.Edges = append(n.Edges, HeapEdge{Type: typ, Name: name, To: to})
+	}
+}
+
+func (n *HeapNode) addIndexEdge(typ HeapEdgeType, idx int, to *HeapNode) {
+	if to != nil {
+		n.Edges = append(n.Edges, HeapEdge{Type: typ, Index: idx, To: to})
+	}
+}
+
+// valueNode returns the node for the value, or nil if the value is not represented in the graph
+// (numbers, booleans, undefined, etc.).
+func (b *heapSnapshotBuilder) valueNode(v Value) *HeapNode {
+	switch v := v.(type) {
+	case *Object:
+		if v == nil {
+			return nil
+		}
+		return b.objectNode(v)
+	case String:
+		s := v.String()
+		n := b.strings[s]
+		if n == nil {
+			size := 16 + v.Length()
+			if _, ok := v.(asciiString); !ok {
+				size += v.Length()
+			}
+			n = b.newNode(HeapNodeString, s, size, 0)
+			n.Value = v
+			b.strings[s] = n
+		}
+		return n
+	case *Symbol:
+		n := b.symbols[v]
+		if n == nil {
+			n = b.newNode(HeapNodeSymbol, v.descriptiveString().String(), 32, 0)
+			n.Value = v
+			b.symbols[v] = n
+		}
+		return n
+	case *valueBigInt:
+		n := b.newNode(HeapNodeBigInt, v.String(), 16+len((*big.Int)(v).Bits())*8, 0)
+		n.Value = v
+		return n
+	}
+	return nil
+}
+
+func (b *heapSnapshotBuilder) objectNode(o *Object) *HeapNode {
+	if n := b.objects[o]; n != nil {
+		return n
+	}
+	p := weak.Make(o)
+	id := b.ids.objects[p]
+	if id == 0 {
+		id = b.ids.next()
+		b.ids.objects[p] = id
+	}
+	n := b.newNode(HeapNodeObject, "", 0, id)
+	n.Value = o
+	n.obj = o
+	b.objects[o] = n
+	b.queue = append(b.queue, n)
+	return n
+}
+
+func (b *heapSnapshotBuilder) stashNode(s *stash) *HeapNode {
+	if s == nil {
+		return nil
+	}
+	if n := b.stashes[s]; n != nil {
+		return n
+	}
+	p := weak.Make(s)
+	id := b.ids.stashes[p]
+	if id == 0 {
+		id = b.ids.next()
+		b.ids.stashes[p] = id
+	}
+	n := b.newNode(HeapNodeHidden, "system / Context", 32+16*(len(s.values)+len(s.extraArgs)), id)
+	n.st = s
+	b.stashes[s] = n
+	b.queue = append(b.queue, n)
+	return n
+}
+
+// dataPropValue returns the value of an own data property without calling getters or materialising lazily
+// initialised properties.
+func dataPropValue(o *Object, name unistring.String) Value {
+	if h, ok := o.self.(baseObjectHolder); ok {
+		v := h.getBaseObject().values[name]
+		if prop, ok := v.(*valueProperty); ok {
+			if prop.accessor {
+				return nil
+			}
+			return prop.value
+		}
+		return v
+	}
+	return nil
+}
+
+func heapFuncName(o *Object) string {
+	if s, ok := dataPropValue(o, "name").(String); ok {
+		return s.String()
+	}
+	return ""
+}
+
+// heapObjectName returns the name of the constructor of the object (or its class name if the constructor cannot be
+// determined without side effects).
+func heapObjectName(o *Object) string {
+	if h, ok := o.self.(baseObjectHolder); ok {
+		if proto := h.getBaseObject().prototype; proto != nil {
+			if ctor, ok := dataPropValue(proto, "constructor").(*Object); ok {
+				if name := heapFuncName(ctor); name != "" {
+					return name
+				}
+			}
+		}
+	}
+	return o.self.className()
+}
+
+// goObjectName returns the name of the Go type for the objects backed by Go values.
+func goObjectName(o objectImpl) (string, bool) {
+	switch o := o.(type) {
+	case *objectGoReflect:
+		return o.origValue.Type().String(), true
+	case *objectGoArrayReflect:
+		return o.origValue.Type().String(), true
+	case *objectGoSliceReflect:
+		return o.origValue.Type().String(), true
+	case *objectGoMapReflect:
+		return o.origValue.Type().String(), true
+	case *objectGoMapSimple:
+		return "map[string]interface {}", true
+	case *objectGoSlice:
+		return "[]interface {}", true
+	case *dynamicObject:
+		return fmt.Sprintf("%T", o.d), true
+	case *dynamicArray:
+		return fmt.Sprintf("%T", o.a), true
+	}
+	return "", false
+}
+
+func (b *heapSnapshotBuilder) fillObject(n *HeapNode) {
+	o := n.obj
+	self := o.self
+	n.Name = heapObjectName(o)
+	n.SelfSize = 64
+
+	if name, ok := goObjectName(self); ok {
+		// The properties of Go values are not traversed as it would require wrapping them.
+		n.Type = HeapNodeNative
+		n.Name = name
+		n.addEdge(HeapEdgeProperty, "__proto__", b.valueNode(self.proto()))
+		return
+	}
+
+	if h, ok := self.(baseObjectHolder); ok {
+		bo := h.getBaseObject()
+		n.SelfSize += 16 * len(bo.values)
+		for _, name := range bo.propNames {
+			switch v := bo.values[name].(type) {
+			case *valueProperty:
+				if v.accessor {
+					n.addEdge(HeapEdgeProperty, "get "+name.String(), b.valueNode(v.getterFunc))
+					n.addEdge(HeapEdgeProperty, "set "+name.String(), b.valueNode(v.setterFunc))
+				} else {
+					n.addEdge(HeapEdgeProperty, name.String(), b.valueNode(v.value))
+				}
+			default:
+				n.addEdge(HeapEdgeProperty, name.String(), b.valueNode(v))
+			}
+		}
+		if bo.symValues != nil {
+			for entry := bo.symValues.iterFirst; entry != nil; entry = entry.iterNext {
+				name := entry.key.(*Symbol).descriptiveString().String()
+				if prop, ok := entry.value.(*valueProperty); ok {
+					if prop.accessor {
+						n.addEdge(HeapEdgeProperty, "get "+name, b.valueNode(prop.getterFunc))
+						n.addEdge(HeapEdgeProperty, "set "+name, b.valueNode(prop.setterFunc))
+					} else {
+						n.addEdge(HeapEdgeProperty, name, b.valueNode(prop.value))
+					}
+				} else {
+					n.addEdge(HeapEdgeProperty, name, b.valueNode(entry.value))
+				}
+			}
+		}
+		for _, elements := range bo.privateElements {
+			for _, v := range elements.fields {
+				n.addEdge(HeapEdgeInternal, "private", b.valueNode(v))
+			}
+			for _, v := range elements.methods {
+				n.addEdge(HeapEdgeInternal, "private", b.valueNode(v))
+			}
+		}
+		// not using proto() to avoid calling the Proxy trap
+		n.addEdge(HeapEdgeProperty, "__proto__", b.valueNode(bo.prototype))
+	}
+
+	if _, ok := self.assertCallable(); ok {
+		n.Type = HeapNodeClosure
+		n.Name = heapFuncName(o)
+	}
+	if h, ok := self.(stashHolder); ok {
+		n.addEdge(HeapEdgeInternal, "context", b.stashNode(h.getStash()))
+	}
+
+	switch self := self.(type) {
+	case *arrayObject:
+		n.Type = HeapNodeArray
+		n.SelfSize += 16 * len(self.values)
+		for i, v := range self.values {
+			n.addIndexEdge(HeapEdgeElement, i, b.valueNode(v))
+		}
+	case *sparseArrayObject:
+		n.Type = HeapNodeArray
+		n.SelfSize += 24 * len(self.items)
+		for _, item := range self.items {
+			n.addIndexEdge(HeapEdgeElement, int(item.idx), b.valueNode(item.value))
+		}
+	case *mapObject:
+		n.SelfSize += 48 * self.m.size
+		i := 0
+		for entry := self.m.iterFirst; entry != nil; entry = entry.iterNext {
+			n.addIndexEdge(HeapEdgeHidden, i, b.valueNode(entry.key))
+			n.addIndexEdge(HeapEdgeHidden, i+1, b.valueNode(entry.value))
+			i += 2
+		}
+	case *setObject:
+		n.SelfSize += 48 * self.m.size
+		i := 0
+		for entry := self.m.iterFirst; entry != nil; entry = entry.iterNext {
+			n.addIndexEdge(HeapEdgeHidden, i, b.valueNode(entry.key))
+			i++
+		}
+	case *weakMapObject:
+		b.addWeakMapEdges(n, &self.m, true)
+	case *weakSetObject:
+		b.addWeakMapEdges(n, &self.s, false)
+	case *boundFuncObject:
+		n.addEdge(HeapEdgeInternal, "bound_function", b.valueNode(self.wrapped))
+	case *methodFuncObject:
+		n.addEdge(HeapEdgeInternal, "home_object", b.valueNode(self.homeObject))
+	case *arrowFuncObject:
+		n.addEdge(HeapEdgeInternal, "function", b.valueNode(self.funcObj))
+	case *proxyObject:
+		n.addEdge(HeapEdgeInternal, "target", b.valueNode(self.target))
+		if h, ok := self.handler.(*jsProxyHandler); ok {
+			n.addEdge(HeapEdgeInternal, "handler", b.valueNode(h.handler))
+		}
+	case *primitiveValueObject:
+		n.addEdge(HeapEdgeInternal, "value", b.valueNode(self.pValue))
+	case *Promise:
+		n.addEdge(HeapEdgeInternal, "result", b.valueNode(self.result))
+		b.addReactionEdges(n, self.fulfillReactions)
+		b.addReactionEdges(n, self.rejectReactions)
+	case *promiseFuncObject:
+		n.addEdge(HeapEdgeInternal, "promise", b.valueNode(self.promise))
+	case *generatorObject:
+		b.addExecCtxEdges(n, &self.gen.ctx)
+	case *regexpObject:
+		n.Type = HeapNodeRegExp
+		n.Name = "/" + self.source.String() + "/"
+	case *arrayBufferObject:
+		if len(self.data) > 0 {
+			data := b.newNode(HeapNodeNative, "system / JSArrayBufferData", len(self.data), 0)
+			n.addEdge(HeapEdgeInternal, "backing_store", data)
+		}
+	case *typedArrayObject:
+		if self.viewedArrayBuf != nil {
+			n.addEdge(HeapEdgeInternal, "buffer", b.valueNode(self.viewedArrayBuf.val))
+		}
+	case *dataViewObject:
+		if self.viewedArrayBuf != nil {
+			n.addEdge(HeapEdgeInternal, "buffer", b.valueNode(self.viewedArrayBuf.val))
+		}
+	}
+}
+
+func (b *heapSnapshotBuilder) addWeakMapEdges(n *HeapNode, m *weakMap, hasValues bool) {
+	m.Lock()
+	defer m.Unlock()
+	n.SelfSize += 32 * len(m.m)
+	i := 0
+	for k, v := range m.m {
+		key := k.Value()
+		if key == nil {
+			continue
+		}
+		n.addIndexEdge(HeapEdgeWeak, i, b.valueNode(key))
+		if hasValues {
+			n.addIndexEdge(HeapEdgeHidden, i+1, b.valueNode(v))
+		}
+		i += 2
+	}
+}
+
+func (b *heapSnapshotBuilder) addReactionEdges(n *HeapNode, reactions []*promiseReaction) {
+	for _, reaction := range reactions {
+		if reaction.handler != nil {
+			n.addEdge(HeapEdgeInternal, "reaction", b.valueNode(reaction.handler.fn))
+		}
+		if c := reaction.capability; c != nil {
+			n.addEdge(HeapEdgeInternal, "dependent", b.valueNode(c.promise))
+		}
+		if ar := reaction.asyncRunner; ar != nil {
+			n.addEdge(HeapEdgeInternal, "async_function", b.valueNode(ar.f))
+			b.addExecCtxEdges(n, &ar.gen.ctx)
+		}
+	}
+}
+
+// addExecCtxEdges adds the references from a suspended generator or async function.
+func (b *heapSnapshotBuilder) addExecCtxEdges(n *HeapNode, ctx *execCtx) {
+	n.addEdge(HeapEdgeInternal, "context", b.stashNode(ctx.stash))
+	for i, v := range ctx.stack {
+		n.addIndexEdge(HeapEdgeHidden, i, b.valueNode(v))
+	}
+}
+
+func (b *heapSnapshotBuilder) fillStash(n *HeapNode) {
+	s := n.st
+	named := make([]bool, len(s.values))
+	for name, idx := range s.names {
+		idx &^= maskTyp
+		if int(idx) < len(s.values) {
+			named[idx] = true
+			n.addEdge(HeapEdgeContext, name.String(), b.valueNode(s.values[idx]))
+		}
+	}
+	for i, v := range s.values {
+		if !named[i] {
+			n.addIndexEdge(HeapEdgeHidden, i, b.valueNode(v))
+		}
+	}
+	for i, v := range s.extraArgs {
+		n.addIndexEdge(HeapEdgeHidden, len(s.values)+i, b.valueNode(v))
+	}
+	n.addEdge(HeapEdgeInternal, "extension", b.valueNode(s.obj))
+	n.addEdge(HeapEdgeInternal, "previous", b.stashNode(s.outer))
+}
+
+/*
+TakeHeapSnapshot captures the graph of the objects reachable from the global object and the global lexical scope
+(and from the stack, if JavaScript code is running). Besides objects, the graph includes strings, symbols and
+BigInts and the closure scopes. The edges represent properties (including getters and setters), array elements,
+prototypes (the "__proto__" edges), the references from functions to their closure scopes (the "context" edges)
+and from the scopes to the variables (the variables are named only in the scopes that may be accessed
+dynamically, i.e. by a direct eval() or a 'with' statement, otherwise they are represented by "hidden" edges with
+the slot index), as well as the internal references (such as the contents of Maps and Sets,
+the targets of bound functions and Proxies, the reactions of Promises, etc.).
+
+Taking a snapshot has no side effects: no getters or Proxy traps are called and the lazily initialised
+built-ins are not initialised. The objects backed by Go values are represented by "native" nodes, their contents
+are not included. Neither are the objects that are only referenced from Go.
+
+The sizes of the nodes are approximations, they are only meant to be used for comparison.
+
+It must not be called concurrently with running JavaScript code in the same Runtime (but can be called from a Go
+function called from JavaScript).
+*/
+func (r *Runtime) TakeHeapSnapshot() *HeapSnapshot {
+	if r.heapIDs == nil {
+		r.heapIDs = &heapIDs{
+			objects: make(map[weak.Pointer[Object]]uint64),
+			stashes: make(map[weak.Pointer[stash]]uint64),
+		}
+	} else {
+		r.heapIDs.prune()
+	}
+	b := heapSnapshotBuilder{
+		r:       r,
+		s:       &HeapSnapshot{},
+		ids:     r.heapIDs,
+		objects: make(map[*Object]*HeapNode),
+		stashes: make(map[*stash]*HeapNode),
+		strings: make(map[string]*HeapNode),
+		symbols: make(map[*Symbol]*HeapNode),
+	}
+	// the root always has the same ID
+	root := b.newNode(HeapNodeSynthetic, "", 0, ^uint64(0))
+	b.s.Root = root
+	root.addEdge(HeapEdgeShortcut, "global", b.valueNode(r.globalObject))
+	root.addEdge(HeapEdgeShortcut, "(global lexical scope)", b.stashNode(&r.global.stash))
+	if sp := r.vm.sp; sp > 0 {
+		stack := b.newNode(HeapNodeSynthetic, "(stack)", 0, 0)
+		for i, v := range r.vm.stack[:sp] {
+			stack.addIndexEdge(HeapEdgeHidden, i, b.valueNode(v))
+		}
+		root.addEdge(HeapEdgeShortcut, "(stack)", stack)
+	}
+
+	for len(b.queue) > 0 {
+		n := b.queue[0]
+		b.queue = b.queue[1:]
+		if n.obj != nil {
+			b.fillObject(n)
+		} else {
+			b.fillStash(n)
+		}
+	}
+	return b.s
+}
+
+// WriteHeapSnapshot takes a heap snapshot (see TakeHeapSnapshot) and writes it in the Chrome .heapsnapshot format
+// which can be loaded into the Memory tab of Chrome DevTools.
+func (r *Runtime) WriteHeapSnapshot(w io.Writer) error {
+	return r.TakeHeapSnapshot().Write(w)
+}
+
+/*
+Walk traverses the graph in the breadth-first order starting from the root and calls f for every reachable node
+(exactly once) with the path by which the node has been reached, which is one of the shortest retaining paths.
+If f returns false, the edges of the node are not followed. The path must not be modified or retained after
+f returns.
+*/
+func (s *HeapSnapshot) Walk(f func(path []*HeapEdge, node *HeapNode) bool) {
+	type item struct {
+		node   *HeapNode
+		parent int
+		edge   *HeapEdge
+	}
+	items := []item{{node: s.Root, parent: -1}}
+	seen := map[*HeapNode]struct{}{s.Root: {}}
+	var path []*HeapEdge
+	for i := 0; i < len(items); i++ {
+		it := items[i]
+		path = path[:0]
+		for j := i; items[j].parent >= 0; j = items[j].parent {
+			path = append(path, items[j].edge)
+		}
+		for l, r := 0, len(path)-1; l < r; l, r = l+1, r-1 {
+			path[l], path[r] = path[r], path[l]
+		}
+		if !f(path, it.node) {
+			continue
+		}
+		for k := range it.node.Edges {
+			e := &it.node.Edges[k]
+			if _, exists := seen[e.To]; !exists {
+				seen[e.To] = struct{}{}
+				items = append(items, item{node: e.To, parent: i, edge: e})
+			}
+		}
+	}
+}
+
+var heapSnapshotNodeTypes = []HeapNodeType{HeapNodeHidden, HeapNodeArray, HeapNodeString, HeapNodeObject,
+	"code", HeapNodeClosure, HeapNodeRegExp, "number", HeapNodeNative, HeapNodeSynthetic, "concatenated string",
+	"sliced string", HeapNodeSymbol, HeapNodeBigInt}
+
+var heapSnapshotEdgeTypes = []HeapEdgeType{HeapEdgeContext, HeapEdgeElement, HeapEdgeProperty, HeapEdgeInternal,
+	HeapEdgeHidden, HeapEdgeShortcut, HeapEdgeWeak}
+
+const heapSnapshotNodeFieldCount = 7
+
+type heapSnapshotJSON struct {
+	Snapshot struct {
+		Meta               map[string]interface{} `json:"meta"`
+		NodeCount          int                    `json:"node_count"`
+		EdgeCount          int                    `json:"edge_count"`
+		TraceFunctionCount int                    `json:"trace_function_count"`
+	} `json:"snapshot"`
+	Nodes              []uint64 `json:"nodes"`
+	Edges              []uint64 `json:"edges"`
+	TraceFunctionInfos []int    `json:"trace_function_infos"`
+	TraceTree          []int    `json:"trace_tree"`
+	Samples            []int    `json:"samples"`
+	Locations          []int    `json:"locations"`
+	Strings            []string `json:"strings"`
+}
+
+// Write writes the snapshot in the Chrome .heapsnapshot format.
+func (s *HeapSnapshot) Write(w io.Writer) error {
+	var res heapSnapshotJSON
+	nodeTypes := make(map[HeapNodeType]uint64, len(heapSnapshotNodeTypes))
+	for i, t := range heapSnapshotNodeTypes {
+		nodeTypes[t] = uint64(i)
+	}
+	edgeTypes := make(map[HeapEdgeType]uint64, len(heapSnapshotEdgeTypes))
+	for i, t := range heapSnapshotEdgeTypes {
+		edgeTypes[t] = uint64(i)
+	}
+	res.Snapshot.Meta = map[string]interface{}{
+		"node_fields": []string{"type", "name", "id", "self_size", "edge_count", "trace_node_id", "detachedness"},
+		"node_types": []interface{}{heapSnapshotNodeTypes, "string", "number", "number", "number", "number",
+			"number"},
+		"edge_fields":                []string{"type", "name_or_index", "to_node"},
+		"edge_types":                 []interface{}{heapSnapshotEdgeTypes, "string_or_number", "node"},
+		"trace_function_info_fields": []string{"function_id", "name", "script_name", "script_id", "line", "column"},
+		"trace_node_fields":          []string{"id", "function_info_index", "count", "size", "children"},
+		"sample_fields":              []string{"timestamp_us", "last_assigned_id"},
+		"location_fields":            []string{"object_index", "script_id", "line", "column"},
+	}
+
+	stringIdx := make(map[string]uint64)
+	str := func(s string) uint64 {
+		idx, exists := stringIdx[s]
+		if !exists {
+			idx = uint64(len(res.Strings))
+			res.Strings = append(res.Strings, s)
+			stringIdx[s] = idx
+		}
+		return idx
+	}
+	nodeIdx := make(map[*HeapNode]uint64, len(s.Nodes))
+	for i, n := range s.Nodes {
+		nodeIdx[n] = uint64(i * heapSnapshotNodeFieldCount)
+	}
+	res.Nodes = make([]uint64, 0, len(s.Nodes)*heapSnapshotNodeFieldCount)
+	for _, n := range s.Nodes {
+		name := n.Name
+		if len(name) > 1024 {
+			name = name[:1024]
+		}
+		id := n.ID
+		if n == s.Root {
+			// the root has ID 1 in the snapshots made by V8
+			id = 1
+		} else {
+			// the IDs of JavaScript objects are odd in the snapshots made by V8
+			id = id*2 + 1
+		}
+		res.Nodes = append(res.Nodes, nodeTypes[n.Type], str(name), id, uint64(n.SelfSize), uint64(len(n.Edges)), 0, 0)
+		for _, e := range n.Edges {
+			var nameOrIndex uint64
+			if e.Type == HeapEdgeElement || e.Type == HeapEdgeHidden || e.Name == "" {
+				nameOrIndex = uint64(e.Index)
+			} else {
+				nameOrIndex = str(e.Name)
+			}
+			res.Edges = append(res.Edges, edgeTypes[e.Type], nameOrIndex, nodeIdx[e.To])
+		}
+	}
+	res.Snapshot.NodeCount = len(s.Nodes)
+	res.Snapshot.EdgeCount = len(res.Edges) / 3
+	res.TraceFunctionInfos = []int{}
+	res.TraceTree = []int{}
+	res.Samples = []int{}
+	res.Locations = []int{}
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(&res); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func (n *HeapNode) String() string {
+	return string(n.Type) + " " + strconv.Quote(n.Name) + " @" + strconv.FormatUint(n.ID, 10)
+}
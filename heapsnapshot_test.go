@@ -0,0 +1,156 @@
+package goja
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestHeapSnapshotWalk(t *testing.T) {
+	vm := New()
+	_, err := vm.RunString(`
+	class Leak {}
+	var holder = (function() {
+		const retained = [new Leak(), "str"];
+		return function() { return retained; };
+	})();
+	var named = (function() {
+		const retainedByName = new Leak();
+		return function() { return eval("retainedByName"); };
+	})();
+	var m = new Map([["key", {nested: true}]]);
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := vm.TakeHeapSnapshot()
+	if s.Root != s.Nodes[0] {
+		t.Fatal("root is not the first node")
+	}
+	var leakPath []*HeapEdge
+	var leakNode *HeapNode
+	foundNamed := false
+	seen := make(map[*HeapNode]bool)
+	s.Walk(func(path []*HeapEdge, n *HeapNode) bool {
+		if seen[n] {
+			t.Fatalf("node %v is visited twice", n)
+		}
+		seen[n] = true
+		if n.Type == HeapNodeObject && n.Name == "Leak" {
+			if path[len(path)-1].Name == "retainedByName" {
+				if path[len(path)-1].Type != HeapEdgeContext {
+					t.Fatalf("unexpected edge: %+v", path[len(path)-1])
+				}
+				foundNamed = true
+			} else {
+				leakPath = append([]*HeapEdge(nil), path...)
+				leakNode = n
+			}
+		}
+		return true
+	})
+	if leakNode == nil || !foundNamed {
+		t.Fatal("Leak instance not found")
+	}
+	var names []string
+	for _, e := range leakPath {
+		if e.Name != "" {
+			names = append(names, e.Name)
+		}
+	}
+	// global -> holder -> (closure scope) -> retained -> [0]. The closure scope is not dynamic,
+	// so the variable has no name.
+	expected := []string{"global", "holder", "context"}
+	if len(names) != len(expected) {
+		t.Fatalf("unexpected path: %v", names)
+	}
+	for i, name := range expected {
+		if names[i] != name {
+			t.Fatalf("unexpected path: %v", names)
+		}
+	}
+	if last := leakPath[len(leakPath)-1]; last.Type != HeapEdgeElement || last.Index != 0 {
+		t.Fatalf("unexpected last edge: %+v", last)
+	}
+	if e := leakPath[3]; e.Type != HeapEdgeHidden || e.To.Type != HeapNodeArray {
+		t.Fatalf("unexpected variable edge: %+v", e)
+	}
+	if leakPath[2].To.Type != HeapNodeHidden || leakPath[1].To.Type != HeapNodeClosure {
+		t.Fatal("unexpected node types")
+	}
+
+	s1 := vm.TakeHeapSnapshot()
+	for _, n := range s1.Nodes {
+		if n.Value == leakNode.Value {
+			if n.ID != leakNode.ID {
+				t.Fatalf("ID is not stable: %d, %d", n.ID, leakNode.ID)
+			}
+			return
+		}
+	}
+	t.Fatal("Leak instance not found in the second snapshot")
+}
+
+func TestHeapSnapshotWrite(t *testing.T) {
+	vm := New()
+	_, err := vm.RunString(`
+	var o = {s: "hello", arr: [1, 2, {}], sym: Symbol("x")};
+	var p = new Proxy({}, {getPrototypeOf() { throw new Error("trap called"); }});
+	var buf = new Uint8Array(16);
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	err = vm.WriteHeapSnapshot(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res struct {
+		Snapshot struct {
+			Meta struct {
+				NodeFields []string `json:"node_fields"`
+				EdgeFields []string `json:"edge_fields"`
+			} `json:"meta"`
+			NodeCount int `json:"node_count"`
+			EdgeCount int `json:"edge_count"`
+		} `json:"snapshot"`
+		Nodes   []int    `json:"nodes"`
+		Edges   []int    `json:"edges"`
+		Strings []string `json:"strings"`
+	}
+	err = json.Unmarshal(b.Bytes(), &res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeFields := len(res.Snapshot.Meta.NodeFields)
+	edgeFields := len(res.Snapshot.Meta.EdgeFields)
+	if len(res.Nodes) != res.Snapshot.NodeCount*nodeFields {
+		t.Fatalf("nodes: %d, node_count: %d", len(res.Nodes), res.Snapshot.NodeCount)
+	}
+	if len(res.Edges) != res.Snapshot.EdgeCount*edgeFields {
+		t.Fatalf("edges: %d, edge_count: %d", len(res.Edges), res.Snapshot.EdgeCount)
+	}
+	edgeCount := 0
+	for i := 0; i < len(res.Nodes); i += nodeFields {
+		edgeCount += res.Nodes[i+4]
+	}
+	if edgeCount != res.Snapshot.EdgeCount {
+		t.Fatalf("sum of edge_count: %d, edge_count: %d", edgeCount, res.Snapshot.EdgeCount)
+	}
+	for i := 2; i < len(res.Edges); i += edgeFields {
+		if to := res.Edges[i]; to%nodeFields != 0 || to >= len(res.Nodes) {
+			t.Fatalf("invalid to_node: %d", to)
+		}
+	}
+	found := false
+	for _, s := range res.Strings {
+		if s == "hello" {
+			found = true
+			break
+		}
+	}
+	if !found {
+		t.Fatal("string not found")
+	}
+}
@@ -0,0 +1,96 @@
+package goja
+
+/*
+ExecutionHooks receives the execution events of a Runtime. It can be used to produce tracing spans for JavaScript
+function calls and for the lifecycle of Promises.
+
+The methods are called synchronously from the goroutine running the Runtime. They must not run any JavaScript code
+in the same Runtime. The StackFrame and the Exception values may be retained.
+
+To register it call Runtime.SetExecutionHooks().
+*/
+type ExecutionHooks interface {
+	// FunctionEnter is called when a JavaScript function starts executing. For generators and async functions
+	// it's also called every time the execution is resumed after yield or await. Native (Go) functions,
+	// including the built-ins, are not reported. The position of the frame is the beginning of the function
+	// (or the resumption point).
+	FunctionEnter(frame StackFrame)
+
+	// FunctionExit is called when the function entered earlier returns, suspends (at yield or await) or exits due
+	// to an exception. The frame is the one passed to the matching FunctionEnter call. Every FunctionEnter call
+	// is followed by exactly one FunctionExit call and the calls are properly nested.
+	FunctionExit(frame StackFrame)
+
+	// ExceptionThrown is called when an exception is thrown, either by JavaScript code or by a native function.
+	// The caught argument is true if there is an enclosing try/catch statement, which means the exception is
+	// most likely to be handled by JavaScript code. The exceptions which cause a Promise to be rejected (for
+	// example, when thrown inside an async function) are reported as not caught.
+	ExceptionThrown(ex *Exception, caught bool)
+
+	// PromiseCreated is called when a Promise is created (either by JavaScript code, including async functions,
+	// or by Runtime.NewPromise).
+	PromiseCreated(p *Promise)
+
+	// PromiseSettled is called when a Promise is fulfilled or rejected. The State and the Result of the
+	// Promise are already set.
+	PromiseSettled(p *Promise)
+}
+
+type hookFrame struct {
+	frame StackFrame
+	// the length of the call stack at which the frame is executed
+	depth int
+}
+
+// SetExecutionHooks registers the hooks which receive the execution events. Setting it to nil disables the
+// functionality. When no hooks are set, the overhead is a single branch on every entry into the interpreter loop
+// (and on the relatively rare events, such as exceptions and Promise creation).
+// Note, the execution with the hooks set uses a separate (slower) loop, which is shared with the coverage collection
+// (see SetCoverage) and the profiler (see StartProfile).
+// This method (as Runtime in general) is not goroutine-safe. It must not be called while the Runtime is running.
+func (r *Runtime) SetExecutionHooks(hooks ExecutionHooks) {
+	vm := r.vm
+	vm.hooks = hooks
+	vm.hookFrames = nil
+	vm.hookEx = nil
+}
+
+// syncHooks reports the functions which have been exited or entered since the last call, by comparing the current
+// call stack with the frames reported so far.
+func (vm *vm) syncHooks() {
+	depth := len(vm.callStack)
+	for n := len(vm.hookFrames); n > 0; n-- {
+		top := &vm.hookFrames[n-1]
+		if top.depth < depth || top.depth == depth && top.frame.prg == vm.prg {
+			break
+		}
+		frame := top.frame
+		*top = hookFrame{}
+		vm.hookFrames = vm.hookFrames[:n-1]
+		vm.hooks.FunctionExit(frame)
+	}
+	if prg := vm.prg; prg != nil && prg.isFunc && depth > 0 {
+		if n := len(vm.hookFrames); n == 0 || vm.hookFrames[n-1].depth < depth {
+			frame := StackFrame{prg: prg, pc: vm.pc, funcName: prg.funcName}
+			vm.hookFrames = append(vm.hookFrames, hookFrame{frame: frame, depth: depth})
+			vm.hooks.FunctionEnter(frame)
+		}
+	}
+}
+
+// hookException reports the exception unless it has already been reported (which happens when it propagates
+// through a native function).
+func (vm *vm) hookException(ex *Exception) {
+	if ex == vm.hookEx {
+		return
+	}
+	vm.hookEx = ex
+	caught := false
+	for i := len(vm.tryStack) - 1; i >= 0; i-- {
+		if vm.tryStack[i].catchPos >= 0 {
+			caught = true
+			break
+		}
+	}
+	vm.hooks.ExceptionThrown(ex, caught)
+}
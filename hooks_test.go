@@ -0,0 +1,107 @@
+package goja
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type testHooks struct {
+	events []string
+}
+
+func (h *testHooks) FunctionEnter(frame StackFrame) {
+	h.events = append(h.events, fmt.Sprintf("enter %s:%d", frame.FuncName(), frame.Position().Line))
+}
+
+func (h *testHooks) FunctionExit(frame StackFrame) {
+	h.events = append(h.events, "exit "+frame.FuncName())
+}
+
+func (h *testHooks) ExceptionThrown(ex *Exception, caught bool) {
+	h.events = append(h.events, fmt.Sprintf("throw %s %v", ex.Value(), caught))
+}
+
+func (h *testHooks) PromiseCreated(p *Promise) {
+	h.events = append(h.events, "promise")
+}
+
+func (h *testHooks) PromiseSettled(p *Promise) {
+	h.events = append(h.events, fmt.Sprintf("settled %d %s", p.State(), p.Result()))
+}
+
+func TestExecutionHooks(t *testing.T) {
+	vm := New()
+	var h testHooks
+	vm.SetExecutionHooks(&h)
+	_, err := vm.RunScript("test.js", `
+function inner(x) {
+	if (x) {
+		throw "err";
+	}
+	return 1;
+}
+function outer() {
+	try {
+		inner(true);
+	} catch (e) {
+	}
+	return [1, 2].map(x => inner(false));
+}
+async function af() {
+	await undefined;
+	throw "async";
+}
+outer();
+af();
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"enter outer:8",
+		"enter inner:2",
+		"throw err true",
+		"exit inner",
+		"enter <anonymous>:13",
+		"enter inner:2",
+		"exit inner",
+		"exit <anonymous>",
+		"enter <anonymous>:13",
+		"enter inner:2",
+		"exit inner",
+		"exit <anonymous>",
+		"exit outer",
+		"promise",
+		"enter af:15",
+		"promise",
+		"settled 1 undefined",
+		"exit af",
+		"enter af:16",
+		"throw async false",
+		"exit af",
+		"settled 2 async",
+	}
+	if got, exp := strings.Join(h.events, "\n"), strings.Join(expected, "\n"); got != exp {
+		t.Fatalf("Unexpected events:\n%s\nexpected:\n%s", got, exp)
+	}
+
+	h.events = nil
+	inner, _ := AssertFunction(vm.Get("inner"))
+	_, err = inner(nil, valueTrue)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if got, exp := strings.Join(h.events, "\n"), "enter inner:2\nthrow err false\nexit inner"; got != exp {
+		t.Fatalf("Unexpected events:\n%s", got)
+	}
+
+	h.events = nil
+	vm.SetExecutionHooks(nil)
+	if _, err := vm.RunString("outer()"); err != nil {
+		t.Fatal(err)
+	}
+	if len(h.events) != 0 {
+		t.Fatalf("Unexpected events: %v", h.events)
+	}
+}
@@ -0,0 +1,440 @@
+/*
+Package jsx implements the transformation of the JSX elements and fragments (as parsed in the parser.JSX mode) into
+the function calls creating them, so that the program can be compiled.
+
+	program, err := parser.ParseFile(nil, "page.jsx", src, parser.JSX)
+	...
+	if err := jsx.Transform(program); err != nil {
+		...
+	}
+	prg, err := goja.CompileAST(program, false)
+
+Two runtimes are supported, like in Babel and TypeScript. With the Classic runtime <div id="a">text</div> is
+transformed into
+
+	React.createElement("div", {id: "a"}, "text")
+
+and with the Automatic runtime into
+
+	var _jsxRuntime = require("react/jsx-runtime");
+	_jsxRuntime.jsx("div", {id: "a", children: "text"});
+
+The runtime and the names can be changed for a single file with the @jsxRuntime, @jsx, @jsxFrag and
+@jsxImportSource pragmas in the comments (which are only available if the program is parsed in the
+parser.ParseComments mode), e.g. a "@jsx h" comment makes the Classic runtime call h(type, props, ...children).
+*/
+package jsx
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/file"
+	"github.com/dop251/goja/parser"
+	"github.com/dop251/goja/unistring"
+)
+
+// Runtime selects the functions the JSX is transformed into.
+type Runtime int
+
+const (
+	// Classic calls Factory(type, props, ...children), with Fragment as the type of the fragments.
+	Classic Runtime = iota
+	// Automatic calls jsx(type, props, key) (or jsxs if there are several children) from the <ImportSource>/jsx-runtime
+	// module, with the children passed in props. The module is loaded with require().
+	Automatic
+)
+
+// A Config controls the transformation. The zero value is the Classic runtime with the React defaults.
+type Config struct {
+	Runtime Runtime
+
+	// The function creating the elements and the type of the fragments in the Classic runtime, as dotted paths.
+	// If empty, "React.createElement" and "React.Fragment" are used.
+	Factory, Fragment string
+
+	// The module providing the Automatic runtime (with the "/jsx-runtime" suffix added). If empty, "react" is used.
+	// If an element has a key after a spread attribute (which cannot be passed to jsx()), the element is created
+	// with the createElement function of this module instead.
+	ImportSource string
+}
+
+// Transform transforms the program using the default configuration.
+func Transform(prg *ast.Program) error {
+	return (&Config{}).Transform(prg)
+}
+
+var pragmaRe = regexp.MustCompile(`@(jsx|jsxFrag|jsxRuntime|jsxImportSource)\s+(\S+)`)
+
+// Transform replaces all the JSX nodes in the program with the function calls. The program is modified in place.
+// An error is returned if the configuration (including the pragmas) is invalid, in which case the program is not
+// modified.
+func (cfg *Config) Transform(prg *ast.Program) error {
+	t := &transformer{
+		runtime:      cfg.Runtime,
+		factory:      cfg.Factory,
+		fragment:     cfg.Fragment,
+		importSource: cfg.ImportSource,
+		prg:          prg,
+	}
+	for _, g := range prg.Comments {
+		for _, c := range g.List {
+			for _, m := range pragmaRe.FindAllStringSubmatch(c.Text, -1) {
+				switch m[1] {
+				case "jsx":
+					t.factory = m[2]
+				case "jsxFrag":
+					t.fragment = m[2]
+				case "jsxImportSource":
+					t.importSource = m[2]
+				case "jsxRuntime":
+					switch m[2] {
+					case "classic":
+						t.runtime = Classic
+					case "automatic":
+						t.runtime = Automatic
+					default:
+						return fmt.Errorf("jsx: invalid runtime %q", m[2])
+					}
+				}
+			}
+		}
+	}
+	if t.factory == "" {
+		t.factory = "React.createElement"
+	}
+	if t.fragment == "" {
+		t.fragment = "React.Fragment"
+	}
+	if t.importSource == "" {
+		t.importSource = "react"
+	}
+	for _, path := range []string{t.factory, t.fragment} {
+		if !isPath(path) {
+			return fmt.Errorf("jsx: invalid factory %q", path)
+		}
+	}
+
+	ast.Rewrite(prg, func(n ast.Node) ast.Node {
+		switch n := n.(type) {
+		case *ast.JSXElement:
+			return t.element(n)
+		case *ast.JSXFragment:
+			return t.fragmentCall(n)
+		}
+		return n
+	})
+	t.declareModules()
+	return nil
+}
+
+// isPath reports whether s is an identifier or a dotted path of identifiers, such as React.createElement.
+func isPath(s string) bool {
+	for _, part := range strings.Split(s, ".") {
+		if !parser.IsIdentifier(part) {
+			return false
+		}
+	}
+	return true
+}
+
+type transformer struct {
+	runtime                         Runtime
+	factory, fragment, importSource string
+	prg                             *ast.Program
+
+	// the variables holding the modules required by the Automatic runtime, nil until used
+	jsxRuntime, react *ast.Identifier
+	moduleIdx         file.Idx
+	names             map[unistring.String]bool
+}
+
+func (t *transformer) element(e *ast.JSXElement) ast.Expression {
+	var tag ast.Expression
+	switch name := e.Name.(type) {
+	case *ast.Identifier:
+		if e.IsIntrinsic() {
+			tag = str(name.Name.String(), name.Idx)
+		} else {
+			tag = name
+		}
+	case *ast.JSXNamespacedName:
+		tag = str(name.Namespace.Name.String()+":"+name.Name.Name.String(), name.Idx0())
+	default:
+		tag = name
+	}
+
+	if t.runtime == Classic {
+		return t.createElement(t.path(t.factory, e.Opening), tag, e.Attributes, e.Children, e.Opening, e.Closing)
+	}
+
+	// the key is passed separately, unless it follows a spread attribute, which may contain a key too
+	var key ast.Expression
+	attrs := make([]ast.Expression, 0, len(e.Attributes))
+	spread := false
+	for _, attr := range e.Attributes {
+		switch a := attr.(type) {
+		case *ast.JSXSpreadAttribute:
+			spread = true
+		case *ast.JSXAttribute:
+			if id, ok := a.Name.(*ast.Identifier); ok && id.Name == "key" {
+				if spread {
+					return t.createElement(t.member(t.module(&t.react, e.Opening), "createElement", e.Opening), tag, e.Attributes, e.Children, e.Opening, e.Closing)
+				}
+				key = t.attributeValue(a)
+				continue
+			}
+		}
+		attrs = append(attrs, attr)
+	}
+	return t.jsxCall(tag, attrs, e.Children, key, e.Opening, e.Closing)
+}
+
+func (t *transformer) fragmentCall(e *ast.JSXFragment) ast.Expression {
+	if t.runtime == Classic {
+		return t.createElement(t.path(t.factory, e.Opening), t.path(t.fragment, e.Opening), nil, e.Children, e.Opening, e.Closing)
+	}
+	return t.jsxCall(t.member(t.module(&t.jsxRuntime, e.Opening), "Fragment", e.Opening), nil, e.Children, nil, e.Opening, e.Closing)
+}
+
+// createElement returns factory(tag, props, ...children).
+func (t *transformer) createElement(factory, tag ast.Expression, attrs, children []ast.Expression, opening, closing file.Idx) ast.Expression {
+	var props ast.Expression
+	if len(attrs) > 0 {
+		props = t.props(attrs, opening, closing)
+	} else {
+		props = &ast.NullLiteral{Idx: opening}
+	}
+	args := append([]ast.Expression{tag, props}, t.children(children)...)
+	return call(factory, args, opening, closing)
+}
+
+// jsxCall returns jsx(tag, {...props, children}, key) or jsxs(...) if there are several children.
+func (t *transformer) jsxCall(tag ast.Expression, attrs, children []ast.Expression, key ast.Expression, opening, closing file.Idx) ast.Expression {
+	props := t.props(attrs, opening, closing)
+	fn := "jsx"
+	list := t.children(children)
+	if len(list) == 1 && !isSpread(list[0]) {
+		props.Value = append(props.Value, keyed("children", list[0]))
+	} else if len(list) > 0 {
+		fn = "jsxs"
+		props.Value = append(props.Value, keyed("children", &ast.ArrayLiteral{
+			LeftBracket:  opening,
+			Value:        list,
+			RightBracket: closing,
+		}))
+	}
+	args := []ast.Expression{tag, props}
+	if key != nil {
+		args = append(args, key)
+	}
+	return call(t.member(t.module(&t.jsxRuntime, opening), fn, opening), args, opening, closing)
+}
+
+// props returns the object literal with the attributes.
+func (t *transformer) props(attrs []ast.Expression, opening, closing file.Idx) *ast.ObjectLiteral {
+	obj := &ast.ObjectLiteral{
+		LeftBrace:  opening,
+		RightBrace: closing,
+	}
+	for _, attr := range attrs {
+		switch a := attr.(type) {
+		case *ast.JSXAttribute:
+			var name string
+			switch n := a.Name.(type) {
+			case *ast.Identifier:
+				name = n.Name.String()
+			case *ast.JSXNamespacedName:
+				name = n.Namespace.Name.String() + ":" + n.Name.Name.String()
+			}
+			prop := keyed(name, t.attributeValue(a))
+			prop.Key.(*ast.StringLiteral).Idx = a.Idx0()
+			obj.Value = append(obj.Value, prop)
+		case *ast.JSXSpreadAttribute:
+			obj.Value = append(obj.Value, &ast.SpreadElement{Expression: a.Argument})
+		}
+	}
+	return obj
+}
+
+var attrNewlineRe = regexp.MustCompile(`\n\s+`)
+
+func (t *transformer) attributeValue(a *ast.JSXAttribute) ast.Expression {
+	switch v := a.Value.(type) {
+	case nil:
+		return &ast.BooleanLiteral{Idx: a.Idx0(), Value: true}
+	case *ast.StringLiteral:
+		// like Babel, the line breaks with the indentation following them are collapsed
+		return str(attrNewlineRe.ReplaceAllString(v.Value.String(), " "), v.Idx)
+	case *ast.JSXExpressionContainer:
+		return v.Expression
+	default:
+		return v
+	}
+}
+
+// children returns the arguments for the children: the text is trimmed (see text) and the empty expressions
+// are dropped.
+func (t *transformer) children(list []ast.Expression) []ast.Expression {
+	var args []ast.Expression
+	for _, child := range list {
+		switch c := child.(type) {
+		case *ast.JSXText:
+			if s := text(c.Value.String()); s != "" {
+				args = append(args, str(s, c.Idx))
+			}
+		case *ast.JSXExpressionContainer:
+			if c.Expression != nil {
+				args = append(args, c.Expression)
+			}
+		case *ast.JSXSpreadChild:
+			args = append(args, &ast.SpreadElement{Expression: c.Expression})
+		default:
+			args = append(args, c)
+		}
+	}
+	return args
+}
+
+// text returns the JSX text as a string the way React does it: the lines are trimmed (except the beginning
+// of the first one and the end of the last one), the empty ones are dropped and the rest are joined with spaces.
+func text(s string) string {
+	lines := strings.Split(strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(s), "\n")
+	var b strings.Builder
+	for i, line := range lines {
+		line = strings.ReplaceAll(line, "\t", " ")
+		if i > 0 {
+			line = strings.TrimLeft(line, " ")
+		}
+		if i < len(lines)-1 {
+			line = strings.TrimRight(line, " ")
+		}
+		if line != "" {
+			if b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteString(line)
+		}
+	}
+	return b.String()
+}
+
+// path returns the expression for a dotted path, such as React.createElement.
+func (t *transformer) path(path string, idx file.Idx) ast.Expression {
+	parts := strings.Split(path, ".")
+	var e ast.Expression
+	if parts[0] == "this" {
+		e = &ast.ThisExpression{Idx: idx}
+	} else {
+		e = &ast.Identifier{Name: unistring.NewFromString(parts[0]), Idx: idx}
+	}
+	for _, part := range parts[1:] {
+		e = t.member(e, part, idx)
+	}
+	return e
+}
+
+func (t *transformer) member(obj ast.Expression, name string, idx file.Idx) ast.Expression {
+	return &ast.DotExpression{
+		Left:       obj,
+		Identifier: ast.Identifier{Name: unistring.NewFromString(name), Idx: idx},
+	}
+}
+
+// module returns the variable holding the module (the jsx-runtime or the import source itself), declaring it
+// on the first use.
+func (t *transformer) module(v **ast.Identifier, idx file.Idx) ast.Expression {
+	if *v == nil {
+		if t.moduleIdx == 0 {
+			t.moduleIdx = idx
+		}
+		if t.names == nil {
+			t.names = make(map[unistring.String]bool)
+			ast.Inspect(t.prg, func(n ast.Node) bool {
+				if id, ok := n.(*ast.Identifier); ok {
+					t.names[id.Name] = true
+				}
+				return true
+			})
+		}
+		base := "_react"
+		if v == &t.jsxRuntime {
+			base = "_jsxRuntime"
+		}
+		name := unistring.NewFromString(base)
+		for i := 2; t.names[name]; i++ {
+			name = unistring.NewFromString(fmt.Sprintf("%s%d", base, i))
+		}
+		t.names[name] = true
+		*v = &ast.Identifier{Name: name, Idx: t.moduleIdx}
+	}
+	return &ast.Identifier{Name: (*v).Name, Idx: idx}
+}
+
+// declareModules adds the var declarations requiring the modules used by the Automatic runtime after the directive
+// prologue of the program.
+func (t *transformer) declareModules() {
+	var list []*ast.Binding
+	for _, m := range []struct {
+		id   *ast.Identifier
+		path string
+	}{
+		{t.jsxRuntime, t.importSource + "/jsx-runtime"},
+		{t.react, t.importSource},
+	} {
+		if m.id != nil {
+			list = append(list, &ast.Binding{
+				Target:      m.id,
+				Initializer: call(&ast.Identifier{Name: "require", Idx: t.moduleIdx}, []ast.Expression{str(m.path, t.moduleIdx)}, t.moduleIdx, t.moduleIdx),
+			})
+		}
+	}
+	if len(list) == 0 {
+		return
+	}
+	i := 0
+	for ; i < len(t.prg.Body); i++ {
+		if s, ok := t.prg.Body[i].(*ast.ExpressionStatement); !ok {
+			break
+		} else if _, ok := s.Expression.(*ast.StringLiteral); !ok {
+			break
+		}
+	}
+	body := make([]ast.Statement, 0, len(t.prg.Body)+1)
+	body = append(body, t.prg.Body[:i]...)
+	body = append(body, &ast.VariableStatement{Var: t.moduleIdx, List: list})
+	t.prg.Body = append(body, t.prg.Body[i:]...)
+	t.prg.DeclarationList = append(t.prg.DeclarationList, &ast.VariableDeclaration{Var: t.moduleIdx, List: list})
+}
+
+func isSpread(e ast.Expression) bool {
+	_, ok := e.(*ast.SpreadElement)
+	return ok
+}
+
+func str(s string, idx file.Idx) *ast.StringLiteral {
+	return &ast.StringLiteral{Idx: idx, Value: unistring.NewFromString(s)}
+}
+
+func keyed(name string, value ast.Expression) *ast.PropertyKeyed {
+	key := str(name, value.Idx0())
+	if parser.IsIdentifier(name) {
+		key.Literal = name
+	}
+	return &ast.PropertyKeyed{
+		Key:   key,
+		Kind:  ast.PropertyKindValue,
+		Value: value,
+	}
+}
+
+func call(callee ast.Expression, args []ast.Expression, opening, closing file.Idx) *ast.CallExpression {
+	return &ast.CallExpression{
+		Callee:           callee,
+		LeftParenthesis:  opening,
+		ArgumentList:     args,
+		RightParenthesis: closing,
+	}
+}
@@ -0,0 +1,141 @@
+package jsx_test
+
+import (
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja/jsx"
+	"github.com/dop251/goja/parser"
+	"github.com/dop251/goja/printer"
+)
+
+func transform(t *testing.T, cfg *jsx.Config, src string) string {
+	t.Helper()
+	prg, err := parser.ParseFile(nil, "test.jsx", src, parser.JSX|parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Transform(prg); err != nil {
+		t.Fatal(err)
+	}
+	return printer.Sprint(prg)
+}
+
+func TestTransform(t *testing.T) {
+	for _, test := range []struct {
+		cfg       jsx.Config
+		src, want string
+	}{
+		{
+			src:  "<div id=\"a\" {...p} data-x={1} b c=\"x\n  y\" d='\\'>text</div>",
+			want: `React.createElement("div", { id: "a", ...p, "data-x": 1, b: true, c: "x y", d: "\\" }, "text");` + "\n",
+		},
+		{
+			src: `<Foo.Bar>
+	  first  line
+	  {/* empty */}
+	  second &amp; {x}  <br />
+	</Foo.Bar>`,
+			want: `React.createElement(Foo.Bar, null, "first  line", "second & ", x, "  ", React.createElement("br", null));` + "\n",
+		},
+		{
+			cfg:  jsx.Config{Factory: "h", Fragment: "Fragment"},
+			src:  `<><App {...props} />{...rest}</>`,
+			want: `h(Fragment, null, h(App, { ...props }), ...rest);` + "\n",
+		},
+		{
+			cfg: jsx.Config{Runtime: jsx.Automatic},
+			src: `"use strict"; <div key="k" a={1}><b /><>{c}</></div>; <p>{x}</p>; <a {...p} key="k" />`,
+			want: `"use strict";
+var _jsxRuntime = require("react/jsx-runtime"), _react = require("react");
+_jsxRuntime.jsxs("div", { a: 1, children: [_jsxRuntime.jsx("b", {}), _jsxRuntime.jsx(_jsxRuntime.Fragment, { children: c })] }, "k");
+_jsxRuntime.jsx("p", { children: x });
+_react.createElement("a", { ...p, key: "k" });
+`,
+		},
+		{
+			cfg:  jsx.Config{Runtime: jsx.Automatic, ImportSource: "preact"},
+			src:  `var _jsxRuntime; <svg:rect xlink:href="#a" />`,
+			want: "var _jsxRuntime2 = require(\"preact/jsx-runtime\");\nvar _jsxRuntime;\n_jsxRuntime2.jsx(\"svg:rect\", { \"xlink:href\": \"#a\" });\n",
+		},
+		{
+			src:  "/** @jsx h.create\n * @jsxFrag h.Frag */\n<><a /></>",
+			want: "h.create(h.Frag, null, h.create(\"a\", null));\n",
+		},
+		{
+			src:  "// @jsxRuntime automatic\n// @jsxImportSource lib\n<a />",
+			want: "var _jsxRuntime = require(\"lib/jsx-runtime\");\n_jsxRuntime.jsx(\"a\", {});\n",
+		},
+	} {
+		if got := transform(t, &test.cfg, test.src); got != test.want {
+			t.Errorf("%s:\n%s\nexpected\n%s", test.src, got, test.want)
+		}
+	}
+}
+
+func TestTransformErrors(t *testing.T) {
+	for _, test := range []struct {
+		cfg      jsx.Config
+		src, err string
+	}{
+		{jsx.Config{Factory: "h()"}, "<a />", `jsx: invalid factory "h()"`},
+		{jsx.Config{}, "// @jsxRuntime server\n<a />", `jsx: invalid runtime "server"`},
+	} {
+		prg, err := parser.ParseFile(nil, "test.jsx", test.src, parser.JSX|parser.ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := test.cfg.Transform(prg); err == nil || err.Error() != test.err {
+			t.Errorf("%s: %v", test.src, err)
+		}
+	}
+
+	// the untransformed JSX is not compiled
+	prg, err := parser.ParseFile(nil, "test.jsx", "x = <a />", parser.JSX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := goja.CompileAST(prg, false); err == nil || err.Error() != "SyntaxError: JSX must be transformed before compilation at test.jsx:1:5" {
+		t.Fatal(err)
+	}
+}
+
+func TestTransformRun(t *testing.T) {
+	const src = `
+function render(el) {
+	if (Array.isArray(el)) return el.map(render).join("");
+	if (typeof el !== "object") return String(el);
+	if (typeof el.type === "function") return render(el.type(el.props));
+	const children = [].concat(el.props.children ?? []).map(render).join("");
+	return el.type ? "<" + el.type + ">" + children + "</" + el.type + ">" : children;
+}
+const Item = ({text}) => <li>{text}</li>;
+render(<ul>{["a", "b"].map(t => <Item key={t} text={t} />)}<>c</></ul>);
+`
+	prg, err := parser.ParseFile(nil, "test.jsx", src, parser.JSX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := (&jsx.Config{Runtime: jsx.Automatic}).Transform(prg); err != nil {
+		t.Fatal(err)
+	}
+	p, err := goja.CompileAST(prg, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := goja.New()
+	r.Set("require", func(name string) (goja.Value, error) {
+		return r.RunString(`({
+			jsx(type, props, key) { return {type, props, key} },
+			get jsxs() { return this.jsx },
+			Fragment: null,
+		})`)
+	})
+	v, err := r.RunProgram(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := v.String(); s != "<ul><li>a</li><li>b</li>c</ul>" {
+		t.Fatal(s)
+	}
+}
@@ -0,0 +1,229 @@
+package goja
+
+import (
+	"errors"
+
+	"github.com/dop251/goja/unistring"
+)
+
+var errAlreadyLockedDown = errors.New("Runtime is already locked down")
+
+// TamingPolicy defines how Lockdown treats a source of non-determinism (see WithDateTaming and WithMathTaming).
+type TamingPolicy int
+
+const (
+	// TamingSafe disables the functionality.
+	TamingSafe TamingPolicy = iota
+	// TamingUnsafe leaves the functionality unchanged.
+	TamingUnsafe
+)
+
+// LockdownOption represents one of the options for Runtime.Lockdown().
+type LockdownOption func(*lockdownOptions)
+
+type lockdownOptions struct {
+	dateTaming TamingPolicy
+	mathTaming TamingPolicy
+
+	// all objects frozen by Lockdown, harden() does not need to descend into them.
+	intrinsics map[*Object]struct{}
+}
+
+// WithDateTaming sets the taming policy for the current time. With TamingSafe (the default) Date.now() returns NaN,
+// and both Date() and new Date() without arguments return an invalid date. Note that when TamingUnsafe is used,
+// the time source can still be controlled with SetTimeSource().
+func WithDateTaming(policy TamingPolicy) LockdownOption {
+	return func(opts *lockdownOptions) {
+		opts.dateTaming = policy
+	}
+}
+
+// WithMathTaming sets the taming policy for Math.random(). With TamingSafe (the default) it throws a TypeError.
+// Note that when TamingUnsafe is used, the random source can still be controlled with SetRandSource().
+func WithMathTaming(policy TamingPolicy) LockdownOption {
+	return func(opts *lockdownOptions) {
+		opts.mathTaming = policy
+	}
+}
+
+// The names of the properties that are commonly assigned to objects inheriting from the built-in prototypes.
+// After freezing, such an assignment would fail (the so-called "override mistake"), so these properties are
+// converted into accessors that define an own property on the receiver instead.
+var lockdownOverridableProps = []unistring.String{
+	"constructor",
+	"message",
+	"name",
+	"toLocaleString",
+	"toString",
+	"valueOf",
+}
+
+/*
+Lockdown hardens the Runtime against tampering with the built-in objects, so that the scripts sharing the Runtime
+(e.g. untrusted plugins) cannot affect each other by monkey-patching Array.prototype, Object.prototype, etc.
+
+It materialises all built-in objects (including those not directly reachable from the global object, such as
+%ArrayIteratorPrototype% or %GeneratorFunction%) and freezes them along with everything reachable from them.
+The writable data properties listed below are converted into accessors, so that assigning them to an object which
+inherits from a frozen built-in still creates an own property, rather than failing:
+
+	constructor, message, name, toLocaleString, toString, valueOf
+
+The current time and Math.random() are disabled unless configured otherwise (see WithDateTaming and WithMathTaming).
+
+Lockdown also adds a harden() global function which deep-freezes its argument (i.e. the object, its prototypes, and
+all objects reachable from its properties) and returns it.
+
+The global object itself is not frozen, so that scripts can still declare global variables. The globals added by the
+host before calling Lockdown are left as they are, use harden() if needed.
+
+Lockdown can only be called once per Runtime.
+*/
+func (r *Runtime) Lockdown(opts ...LockdownOption) error {
+	if r.lockdown != nil {
+		return errAlreadyLockedDown
+	}
+	lo := &lockdownOptions{
+		intrinsics: make(map[*Object]struct{}),
+	}
+	for _, opt := range opts {
+		opt(lo)
+	}
+
+	harden := r.newNativeFunc(r.builtin_harden, "harden", 1)
+
+	// the intrinsics that are not reachable from the global object
+	roots := []*Object{
+		harden,
+		r.getThrower(),
+		r.getIteratorPrototype(),
+		r.getArrayIteratorPrototype(),
+		r.getMapIteratorPrototype(),
+		r.getSetIteratorPrototype(),
+		r.getStringIteratorPrototype(),
+		r.getRegExpStringIteratorPrototype(),
+		r.getGeneratorFunction(),
+		r.getGeneratorPrototype(),
+		r.getAsyncFunction(),
+	}
+	for _, name := range getGlobalObjectTemplate().propNames {
+		if o, ok := r.globalObject.self.getStr(name, nil).(*Object); ok {
+			roots = append(roots, o)
+		}
+	}
+	if r.shadowRealm {
+		roots = append(roots, r.getShadowRealm())
+	}
+
+	ex := r.vm.try(func() {
+		// the global object is not frozen, even if it's reachable
+		r.deepFreeze(roots, lo.intrinsics, map[*Object]struct{}{r.globalObject: {}}, true)
+	})
+	if ex != nil {
+		return ex
+	}
+
+	r.globalObject.self._putProp("harden", harden, true, false, true)
+	r.lockdown = lo
+	return nil
+}
+
+func (r *Runtime) dateTamed() bool {
+	return r.lockdown != nil && r.lockdown.dateTaming == TamingSafe
+}
+
+func (r *Runtime) mathTamed() bool {
+	return r.lockdown != nil && r.lockdown.mathTaming == TamingSafe
+}
+
+// tameOverride converts a data property into an accessor, so that the assignment to an object inheriting
+// from obj results in creating an own property (see lockdownOverridableProps).
+func (r *Runtime) tameOverride(obj *Object, name unistring.String, prop *valueProperty) {
+	value := prop.value
+	key := stringValueFromRaw(name)
+	getter := r.newNativeFunc(func(FunctionCall) Value {
+		return value
+	}, "get "+name, 0)
+	setter := r.newNativeFunc(func(call FunctionCall) Value {
+		this, ok := call.This.(*Object)
+		if !ok {
+			panic(r.NewTypeError("Cannot assign to read only property '%s'", name))
+		}
+		if this == obj {
+			panic(r.NewTypeError("Cannot assign to read only property '%s' of object", name))
+		}
+		if this.hasOwnProperty(key) {
+			this.setStr(name, call.Argument(0), this, true)
+		} else {
+			createDataPropertyOrThrow(this, key, call.Argument(0))
+		}
+		return _undefined
+	}, "set "+name, 1)
+	obj.defineOwnProperty(key, PropertyDescriptor{
+		Getter:       getter,
+		Setter:       setter,
+		Enumerable:   ToFlag(prop.enumerable),
+		Configurable: FLAG_TRUE,
+	}, true)
+}
+
+// deepFreeze freezes the objects and everything reachable from them via properties and prototypes. The frozen
+// objects are added to the seen set. The objects in the skip set (which may be nil) are assumed to be frozen already.
+func (r *Runtime) deepFreeze(roots []*Object, seen, skip map[*Object]struct{}, tame bool) {
+	queue := make([]*Object, 0, len(roots))
+	add := func(v Value) {
+		if o, ok := v.(*Object); ok && o != nil {
+			if _, exists := skip[o]; exists {
+				return
+			}
+			if _, exists := seen[o]; !exists {
+				seen[o] = struct{}{}
+				queue = append(queue, o)
+			}
+		}
+	}
+	for _, o := range roots {
+		add(o)
+	}
+	for len(queue) > 0 {
+		obj := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+
+		if tame {
+			for _, name := range lockdownOverridableProps {
+				if prop, ok := obj.self.getOwnPropStr(name).(*valueProperty); ok && !prop.accessor && prop.writable && prop.configurable {
+					r.tameOverride(obj, name, prop)
+				}
+			}
+		}
+
+		r.object_freeze(FunctionCall{Arguments: []Value{obj}})
+
+		add(obj.self.proto())
+		for item, next := obj.self.iterateKeys()(); next != nil; item, next = next() {
+			switch prop := obj.getOwnProp(item.name).(type) {
+			case *valueProperty:
+				if prop.accessor {
+					add(prop.getterFunc)
+					add(prop.setterFunc)
+				} else {
+					add(prop.value)
+				}
+			default:
+				add(prop)
+			}
+		}
+	}
+}
+
+func (r *Runtime) builtin_harden(call FunctionCall) Value {
+	arg := call.Argument(0)
+	if obj, ok := arg.(*Object); ok {
+		var intrinsics map[*Object]struct{}
+		if r.lockdown != nil {
+			intrinsics = r.lockdown.intrinsics
+		}
+		r.deepFreeze([]*Object{obj}, make(map[*Object]struct{}), intrinsics, false)
+	}
+	return arg
+}
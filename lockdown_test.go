@@ -0,0 +1,68 @@
+package goja
+
+import (
+	"testing"
+)
+
+func TestLockdown(t *testing.T) {
+	vm := New()
+	if err := vm.Lockdown(); err != nil {
+		t.Fatal(err)
+	}
+	_, err := vm.RunProgram(MustCompile("test.js", TESTLIB+`
+	assert.throws(TypeError, () => { Array.prototype.push = null; }, "Array.prototype");
+	assert.throws(TypeError, () => { Object.prototype.polluted = 1; }, "Object.prototype");
+	assert.throws(TypeError, () => { JSON.parse = null; }, "JSON");
+	assert(Object.isFrozen(Object.getPrototypeOf([][Symbol.iterator]())), "%ArrayIteratorPrototype%");
+	assert(Object.isFrozen(Object.getPrototypeOf(function*() {})), "%GeneratorFunction.prototype%");
+	assert(Object.isFrozen(Object.getPrototypeOf(async function() {}).constructor), "%AsyncFunction%");
+	assert(Object.isFrozen(Map.prototype), "Map.prototype");
+	assert(!Object.isFrozen(globalThis), "globalThis");
+
+	// override mistake
+	function Point() {}
+	Point.prototype.toString = function() { return "point"; };
+	assert.sameValue(String(new Point()), "point", "toString override");
+	class MyError extends Error {
+		constructor() {
+			super("my");
+			this.name = "MyError";
+		}
+	}
+	assert.sameValue(String(new MyError()), "MyError: my", "name override");
+	assert.throws(TypeError, () => { Object.prototype.toString = null; }, "toString on the prototype itself");
+	assert.sameValue({}.toString(), "[object Object]");
+
+	// taming
+	assert(isNaN(Date.now()), "Date.now()");
+	assert(isNaN(new Date().getTime()), "new Date()");
+	assert.sameValue(Date(), "Invalid Date", "Date()");
+	assert.sameValue(new Date(0).getTime(), 0, "new Date(0)");
+	assert.throws(TypeError, () => Math.random());
+
+	// harden
+	const o = harden({a: {b: [1, 2]}, f() {}});
+	assert(Object.isFrozen(o) && Object.isFrozen(o.a) && Object.isFrozen(o.a.b) && Object.isFrozen(o.f), "deep");
+	assert.sameValue(harden(1), 1, "primitive");
+	`, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.Lockdown(); err != errAlreadyLockedDown {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestLockdownTamingPolicy(t *testing.T) {
+	vm := New()
+	if err := vm.Lockdown(WithDateTaming(TamingUnsafe), WithMathTaming(TamingUnsafe)); err != nil {
+		t.Fatal(err)
+	}
+	_, err := vm.RunString(`
+	if (isNaN(Date.now())) throw new Error("Date.now()");
+	if (typeof Math.random() !== "number") throw new Error("Math.random()");
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
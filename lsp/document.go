@@ -0,0 +1,495 @@
+package lsp
+
+import (
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja/analysis"
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/file"
+	"github.com/dop251/goja/jsx"
+	"github.com/dop251/goja/parser"
+	"github.com/dop251/goja/token"
+)
+
+// A document is an open text document with the results of its analysis.
+type document struct {
+	uri     string
+	text    string
+	version int
+
+	lines []int // the offsets of the line starts
+
+	prg         *ast.Program // nil if the source could not be parsed at all
+	info        *analysis.Info
+	diagnostics []Diagnostic
+}
+
+func newDocument(uri, text string, version int) *document {
+	d := newLines(text)
+	d.uri, d.version = uri, version
+	d.analyze()
+	return d
+}
+
+// newLines returns a document without the analysis, only suitable for the position conversion.
+func newLines(text string) *document {
+	d := &document{
+		text:  text,
+		lines: []int{0},
+	}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			d.lines = append(d.lines, i+1)
+		}
+	}
+	return d
+}
+
+// filename returns the path of the document (or the URI itself if it's not a file URI).
+func (d *document) filename() string {
+	if u, err := url.Parse(d.uri); err == nil && u.Scheme == "file" {
+		return u.Path
+	}
+	return d.uri
+}
+
+// mode returns the parser mode for the document based on the file extension.
+func (d *document) mode() parser.Mode {
+	switch strings.ToLower(path.Ext(d.filename())) {
+	case ".ts", ".mts", ".cts":
+		return parser.TypeScript
+	case ".tsx":
+		return parser.TypeScript | parser.JSX
+	case ".jsx":
+		return parser.JSX
+	}
+	return 0
+}
+
+func (d *document) analyze() {
+	mode := d.mode()
+	prg, err := parser.ParseFile(nil, d.filename(), d.text, mode|parser.ErrorRecovery, parser.WithDisableSourceMaps)
+	if err != nil {
+		if list, ok := err.(parser.ErrorList); ok {
+			for _, e := range list {
+				d.addDiagnostic(d.lineColumnOffset(e.Position), d.lineColumnOffset(e.End), e.Message)
+			}
+		} else {
+			d.addDiagnostic(0, 0, err.Error())
+		}
+	}
+	if prg == nil {
+		return
+	}
+	d.prg = prg
+	d.info = analysis.Analyze(prg)
+	if err == nil {
+		d.compile(mode)
+	}
+}
+
+// compile reports the early errors detected by the compiler.
+func (d *document) compile(mode parser.Mode) {
+	prg := d.prg
+	if mode&parser.JSX != 0 {
+		// the transformation modifies the AST, so it's done on a separate copy
+		var err error
+		if prg, err = parser.ParseFile(nil, d.filename(), d.text, mode, parser.WithDisableSourceMaps); err != nil {
+			return
+		}
+		if err := jsx.Transform(prg); err != nil {
+			d.addDiagnostic(0, 0, err.Error())
+			return
+		}
+	}
+	if _, err := goja.CompileAST(prg, false); err != nil {
+		if e, ok := err.(*goja.CompilerSyntaxError); ok {
+			d.addDiagnostic(e.Offset, d.wordEnd(e.Offset), e.Message)
+		} else {
+			d.addDiagnostic(0, 0, err.Error())
+		}
+	}
+}
+
+func (d *document) addDiagnostic(start, end int, msg string) {
+	d.diagnostics = append(d.diagnostics, Diagnostic{
+		Range: Range{
+			Start: d.position(start),
+			End:   d.position(end),
+		},
+		Severity: SeverityError,
+		Source:   "goja",
+		Message:  msg,
+	})
+}
+
+// wordEnd returns the end of the identifier or the keyword starting at the offset.
+func (d *document) wordEnd(offset int) int {
+	end := offset
+	for end < len(d.text) {
+		r, size := utf8.DecodeRuneInString(d.text[end:])
+		if r != '$' && r != '_' && !isLetterOrDigit(r) {
+			break
+		}
+		end += size
+	}
+	return end
+}
+
+func isLetterOrDigit(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r >= utf8.RuneSelf
+}
+
+// position converts a byte offset into an LSP position.
+func (d *document) position(offset int) Position {
+	if offset > len(d.text) {
+		offset = len(d.text)
+	} else if offset < 0 {
+		offset = 0
+	}
+	line := sort.Search(len(d.lines), func(i int) bool { return d.lines[i] > offset }) - 1
+	char := 0
+	for _, r := range d.text[d.lines[line]:offset] {
+		char += len(utf16.Encode([]rune{r}))
+	}
+	return Position{Line: line, Character: char}
+}
+
+// offset converts an LSP position into a byte offset.
+func (d *document) offset(pos Position) int {
+	if pos.Line < 0 {
+		return 0
+	}
+	if pos.Line >= len(d.lines) {
+		return len(d.text)
+	}
+	offset := d.lines[pos.Line]
+	for char := 0; char < pos.Character && offset < len(d.text); {
+		r, size := utf8.DecodeRuneInString(d.text[offset:])
+		if r == '\n' {
+			break
+		}
+		char += len(utf16.Encode([]rune{r}))
+		offset += size
+	}
+	return offset
+}
+
+// lineColumnOffset converts a position reported by the parser (with the column in bytes) into a byte offset.
+func (d *document) lineColumnOffset(pos file.Position) int {
+	if pos.Line < 1 {
+		return 0
+	}
+	if pos.Line > len(d.lines) {
+		return len(d.text)
+	}
+	offset := d.lines[pos.Line-1] + pos.Column - 1
+	if offset > len(d.text) {
+		offset = len(d.text)
+	}
+	return offset
+}
+
+func (d *document) rangeOf(idx0, idx1 file.Idx) Range {
+	return Range{
+		Start: d.position(int(idx0) - 1),
+		End:   d.position(int(idx1) - 1),
+	}
+}
+
+func (d *document) location(n ast.Node) Location {
+	return Location{
+		URI:   d.uri,
+		Range: d.rangeOf(n.Idx0(), n.Idx1()),
+	}
+}
+
+// identifierAt returns the identifier at the offset (including the offset right after it) and its parent node.
+func (d *document) identifierAt(offset int) (*ast.Identifier, ast.Node) {
+	if d.prg == nil {
+		return nil, nil
+	}
+	var stack []ast.Node
+	var id *ast.Identifier
+	var parent ast.Node
+	ast.Inspect(d.prg, func(n ast.Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return false
+		}
+		if i, ok := n.(*ast.Identifier); ok && int(i.Idx)-1 <= offset && offset <= int(i.Idx1())-1 {
+			id, parent = i, stack[len(stack)-1]
+		}
+		stack = append(stack, n)
+		return true
+	})
+	return id, parent
+}
+
+func (d *document) binding(pos Position) *analysis.Binding {
+	id, _ := d.identifierAt(d.offset(pos))
+	if id == nil {
+		return nil
+	}
+	return d.info.Binding(id)
+}
+
+func (d *document) definition(pos Position) []Location {
+	b := d.binding(pos)
+	if b == nil {
+		return nil
+	}
+	locations := make([]Location, 0, len(b.Decls))
+	for _, id := range b.Decls {
+		locations = append(locations, d.location(id))
+	}
+	return locations
+}
+
+func (d *document) references(pos Position, includeDeclaration bool) []Location {
+	b := d.binding(pos)
+	if b == nil {
+		return nil
+	}
+	var locations []Location
+	if includeDeclaration {
+		for _, id := range b.Decls {
+			locations = append(locations, d.location(id))
+		}
+	}
+	for _, ref := range b.References {
+		locations = append(locations, d.location(ref.Identifier))
+	}
+	return locations
+}
+
+func (d *document) hover(pos Position, manifest *Manifest) *Hover {
+	id, parent := d.identifierAt(d.offset(pos))
+	if id == nil {
+		return nil
+	}
+	var text string
+	if b := d.info.Binding(id); b != nil {
+		text = "```js\n(" + b.Kind.String() + ") " + b.Name.String() + "\n```"
+	} else if sym := d.manifestSymbol(id, parent, manifest); sym != nil {
+		text = sym.markdown()
+	} else {
+		return nil
+	}
+	r := d.rangeOf(id.Idx0(), id.Idx1())
+	return &Hover{
+		Contents: MarkupContent{
+			Kind:  "markdown",
+			Value: text,
+		},
+		Range: &r,
+	}
+}
+
+// manifestSymbol returns the description of the host-injected global (or a member of one) the identifier refers to.
+func (d *document) manifestSymbol(id *ast.Identifier, parent ast.Node, manifest *Manifest) *Symbol {
+	if dot, ok := parent.(*ast.DotExpression); ok && &dot.Identifier == id {
+		if sym := d.manifestExpr(dot.Left, manifest); sym != nil {
+			return sym.Member(id.Name.String())
+		}
+		return nil
+	}
+	return d.manifestExpr(id, manifest)
+}
+
+func (d *document) manifestExpr(expr ast.Expression, manifest *Manifest) *Symbol {
+	switch e := expr.(type) {
+	case *ast.Identifier:
+		if ref := d.info.Uses[e]; ref != nil && ref.Binding == nil {
+			return manifest.Global(e.Name.String())
+		}
+	case *ast.DotExpression:
+		if sym := d.manifestExpr(e.Left, manifest); sym != nil {
+			return sym.Member(e.Identifier.Name.String())
+		}
+	}
+	return nil
+}
+
+// symbols returns the outline of the document.
+func (d *document) symbols() []DocumentSymbol {
+	if d.prg == nil {
+		return nil
+	}
+	return d.collectSymbols(d.prg)
+}
+
+func (d *document) collectSymbols(nodes ...ast.Node) []DocumentSymbol {
+	c := &symbolCollector{d: d}
+	for _, n := range nodes {
+		if n != nil {
+			ast.Walk(c, n)
+		}
+	}
+	return c.symbols
+}
+
+// symbolCollector collects the declarations of the functions, the classes and the variables. The declarations inside
+// the functions become the children of the function symbol, except for the anonymous functions whose declarations
+// are attributed to the enclosing symbol.
+type symbolCollector struct {
+	d       *document
+	symbols []DocumentSymbol
+}
+
+func (c *symbolCollector) Visit(node ast.Node) ast.Visitor {
+	switch n := node.(type) {
+	case nil:
+		return nil
+	case *ast.FunctionDeclaration:
+		c.symbols = append(c.symbols, c.function(n.Function.Name, n.Function, n))
+		return nil
+	case *ast.ClassDeclaration:
+		c.symbols = append(c.symbols, c.class(n.Class.Name, n.Class, n))
+		return nil
+	case *ast.VariableStatement:
+		c.bindings(n.List, SymbolVariable)
+		return nil
+	case *ast.LexicalDeclaration:
+		kind := SymbolVariable
+		if n.Token == token.CONST {
+			kind = SymbolConstant
+		}
+		c.bindings(n.List, kind)
+		return nil
+	case *ast.ForLoopInitializerVarDeclList, *ast.ForLoopInitializerLexicalDecl, *ast.ForIntoVar, *ast.ForDeclaration:
+		// the loop variables are not shown
+		return nil
+	}
+	return c
+}
+
+func (c *symbolCollector) bindings(list []*ast.Binding, kind SymbolKind) {
+	for _, b := range list {
+		if id, ok := b.Target.(*ast.Identifier); ok {
+			switch init := b.Initializer.(type) {
+			case *ast.FunctionLiteral:
+				c.symbols = append(c.symbols, c.function(id, init, b))
+				continue
+			case *ast.ArrowFunctionLiteral:
+				c.symbols = append(c.symbols, c.arrowFunction(id, init, b))
+				continue
+			case *ast.ClassLiteral:
+				c.symbols = append(c.symbols, c.class(id, init, b))
+				continue
+			}
+			c.symbols = append(c.symbols, c.symbol(id.Name.String(), kind, b, id))
+		} else {
+			ast.Inspect(b.Target, func(n ast.Node) bool {
+				if id, ok := n.(*ast.Identifier); ok && c.d.info.Defs[id] != nil {
+					c.symbols = append(c.symbols, c.symbol(id.Name.String(), kind, id, id))
+				}
+				return true
+			})
+		}
+		if b.Initializer != nil {
+			ast.Walk(c, b.Initializer)
+		}
+	}
+}
+
+func (c *symbolCollector) symbol(name string, kind SymbolKind, node, nameNode ast.Node) DocumentSymbol {
+	return DocumentSymbol{
+		Name:           name,
+		Kind:           kind,
+		Range:          c.d.rangeOf(node.Idx0(), node.Idx1()),
+		SelectionRange: c.d.rangeOf(nameNode.Idx0(), nameNode.Idx1()),
+	}
+}
+
+func (c *symbolCollector) params(params *ast.ParameterList) string {
+	if params == nil || params.Closing == 0 {
+		return ""
+	}
+	from, to := int(params.Opening)-1, int(params.Closing)
+	if from < 0 || to > len(c.d.text) || from > to {
+		return ""
+	}
+	return c.d.text[from:to]
+}
+
+func (c *symbolCollector) function(name *ast.Identifier, f *ast.FunctionLiteral, node ast.Node) DocumentSymbol {
+	var sym DocumentSymbol
+	if name != nil {
+		sym = c.symbol(name.Name.String(), SymbolFunction, node, name)
+	} else {
+		sym = c.symbol("<anonymous>", SymbolFunction, node, f)
+	}
+	sym.Detail = c.params(f.ParameterList)
+	sym.Children = c.d.collectSymbols(f.Body)
+	return sym
+}
+
+func (c *symbolCollector) arrowFunction(name *ast.Identifier, f *ast.ArrowFunctionLiteral, node ast.Node) DocumentSymbol {
+	sym := c.symbol(name.Name.String(), SymbolFunction, node, name)
+	sym.Detail = c.params(f.ParameterList)
+	sym.Children = c.d.collectSymbols(f.Body)
+	return sym
+}
+
+func (c *symbolCollector) class(name *ast.Identifier, cls *ast.ClassLiteral, node ast.Node) DocumentSymbol {
+	var sym DocumentSymbol
+	if name == nil {
+		name = cls.Name
+	}
+	if name != nil {
+		sym = c.symbol(name.Name.String(), SymbolClass, node, name)
+	} else {
+		sym = c.symbol("<anonymous>", SymbolClass, node, cls)
+	}
+	for _, el := range cls.Body {
+		switch el := el.(type) {
+		case *ast.MethodDefinition:
+			kind := SymbolMethod
+			name := c.keyName(el.Key, el.Computed)
+			switch {
+			case el.Kind == ast.PropertyKindGet || el.Kind == ast.PropertyKindSet:
+				kind = SymbolProperty
+			case name == "constructor" && !el.Static:
+				kind = SymbolConstructor
+			}
+			m := c.symbol(name, kind, el, el.Key)
+			m.Detail = c.params(el.Body.ParameterList)
+			m.Children = c.d.collectSymbols(el.Body.Body)
+			sym.Children = append(sym.Children, m)
+		case *ast.FieldDefinition:
+			f := c.symbol(c.keyName(el.Key, el.Computed), SymbolField, el, el.Key)
+			if el.Initializer != nil {
+				f.Children = c.d.collectSymbols(el.Initializer)
+			}
+			sym.Children = append(sym.Children, f)
+		}
+	}
+	return sym
+}
+
+func (c *symbolCollector) keyName(key ast.Expression, computed bool) string {
+	if !computed {
+		switch k := key.(type) {
+		case *ast.StringLiteral:
+			return k.Value.String()
+		case *ast.PrivateIdentifier:
+			return "#" + k.Name.String()
+		case *ast.Identifier:
+			return k.Name.String()
+		case *ast.NumberLiteral:
+			return k.Literal
+		}
+	}
+	from, to := int(key.Idx0())-1, int(key.Idx1())-1
+	if from < 0 || to > len(c.d.text) || from > to {
+		return "[]"
+	}
+	return "[" + c.d.text[from:to] + "]"
+}
@@ -0,0 +1,92 @@
+package lsp
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+// A Manifest describes the globals which the host injects into the Runtime (with Runtime.Set and the like), so that
+// the server can show their documentation on hover. It can be built in Go and passed to NewServer or loaded from
+// a JSON file (see LoadManifest) which is usually generated by marshalling a Manifest built by the host:
+//
+//	{"globals": [
+//		{"name": "fetch", "kind": "function", "signature": "fetch(url: string): Promise<Response>", "doc": "Fetches a URL."},
+//		{"name": "app", "kind": "object", "members": [
+//			{"name": "version", "kind": "property", "signature": "version: string"}
+//		]}
+//	]}
+type Manifest struct {
+	Globals []*Symbol `json:"globals"`
+}
+
+// A Symbol describes a global or a member of one.
+type Symbol struct {
+	Name string `json:"name"`
+
+	// A free-form kind shown with the signature, such as "function", "object", "class" or "property"
+	Kind string `json:"kind,omitempty"`
+
+	// The signature or the type, e.g. "fetch(url: string): Promise<Response>". The name is used if empty.
+	Signature string `json:"signature,omitempty"`
+
+	// The documentation in Markdown
+	Doc string `json:"doc,omitempty"`
+
+	Members []*Symbol `json:"members,omitempty"`
+}
+
+// LoadManifest reads a Manifest from a JSON file.
+func LoadManifest(filename string) (*Manifest, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{}
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Global returns the description of the global with the given name or nil if there is none.
+func (m *Manifest) Global(name string) *Symbol {
+	if m == nil {
+		return nil
+	}
+	return lookupSymbol(m.Globals, name)
+}
+
+// Member returns the description of the member with the given name or nil if there is none.
+func (s *Symbol) Member(name string) *Symbol {
+	return lookupSymbol(s.Members, name)
+}
+
+func lookupSymbol(list []*Symbol, name string) *Symbol {
+	for _, s := range list {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// markdown returns the hover text for the symbol.
+func (s *Symbol) markdown() string {
+	var b strings.Builder
+	b.WriteString("```js\n")
+	if s.Kind != "" {
+		b.WriteString("(" + s.Kind + ") ")
+	}
+	if s.Signature != "" {
+		b.WriteString(s.Signature)
+	} else {
+		b.WriteString(s.Name)
+	}
+	b.WriteString("\n```")
+	if s.Doc != "" {
+		b.WriteString("\n\n")
+		b.WriteString(s.Doc)
+	}
+	return b.String()
+}
@@ -0,0 +1,372 @@
+/*
+Package lsp implements a Language Server Protocol server for the scripts run by goja.
+
+The server communicates over a pair of streams (usually stdin and stdout, see cmd/goja-lsp) and supports:
+
+  - diagnostics: the syntax errors reported by the parser as well as the early errors detected by the compiler
+    (e.g. a redeclared lexical binding);
+  - go to definition and find references using the scope information provided by the analysis package;
+  - hover for the local bindings and for the globals injected by the host described by a Manifest;
+  - document symbols (the functions, the classes with their members and the variables).
+
+The documents with the .ts, .tsx and .jsx extensions are parsed in the TypeScript and/or the JSX mode respectively.
+Only full document synchronisation is advertised, although the incremental changes are applied as well.
+*/
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/textproto"
+	"strconv"
+	"sync"
+)
+
+// ErrExitWithoutShutdown is returned by Serve if the client sent the 'exit' notification without a prior 'shutdown'
+// request. The LSP specification requires the server to exit with the code 1 in this case.
+var ErrExitWithoutShutdown = errors.New("exit without shutdown")
+
+// Server is a Language Server Protocol server. It is created with NewServer.
+type Server struct {
+	manifest *Manifest
+
+	// Logger is used to log the internal errors. If nil, the standard logger is used.
+	Logger *log.Logger
+
+	docs     map[string]*document
+	shutdown bool
+
+	outMu sync.Mutex
+	out   *bufio.Writer
+}
+
+// NewServer creates a new Server. The manifest describes the host-injected globals, it can be nil.
+func NewServer(manifest *Manifest) *Server {
+	return &Server{
+		manifest: manifest,
+		docs:     make(map[string]*document),
+	}
+}
+
+// Serve reads the requests from in and writes the responses and the notifications to out until the client sends
+// the 'exit' notification (in which case the returned error is nil or ErrExitWithoutShutdown) or in is closed
+// (io.EOF is returned).
+func (s *Server) Serve(in io.Reader, out io.Writer) error {
+	r := bufio.NewReader(in)
+	s.out = bufio.NewWriter(out)
+	for {
+		body, err := readMessage(r)
+		if err != nil {
+			return err
+		}
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			s.reply(nil, nil, &responseError{Code: codeParseError, Message: err.Error()})
+			continue
+		}
+		if req.Method == "exit" {
+			if !s.shutdown {
+				return ErrExitWithoutShutdown
+			}
+			return nil
+		}
+		s.handle(&req)
+	}
+}
+
+func readMessage(r *bufio.Reader) ([]byte, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+		return nil, fmt.Errorf("invalid header: %w", err)
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid Content-Length: %q", header.Get("Content-Length"))
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func (s *Server) write(v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		s.logf("Could not marshal a message: %v", err)
+		return
+	}
+	s.outMu.Lock()
+	defer s.outMu.Unlock()
+	fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n", len(b))
+	s.out.Write(b)
+	if err := s.out.Flush(); err != nil {
+		s.logf("Could not write a message: %v", err)
+	}
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.Logger != nil {
+		s.Logger.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+func (s *Server) reply(id *json.RawMessage, result interface{}, rerr *responseError) {
+	resp := response{
+		JSONRPC: "2.0",
+		ID:      id,
+		Error:   rerr,
+	}
+	if rerr == nil {
+		b, err := json.Marshal(result)
+		if err != nil {
+			resp.Error = &responseError{Code: codeInvalidRequest, Message: err.Error()}
+		} else {
+			resp.Result = b
+		}
+	}
+	s.write(resp)
+}
+
+func (s *Server) notify(method string, params interface{}) {
+	s.write(notification{
+		JSONRPC: "2.0",
+		Method:  method,
+		Params:  params,
+	})
+}
+
+type handlerFunc func(s *Server, params json.RawMessage) (interface{}, error)
+
+var handlers = map[string]handlerFunc{
+	"initialize":                  (*Server).initialize,
+	"initialized":                 nil,
+	"shutdown":                    (*Server).shutdownRequest,
+	"textDocument/didOpen":        (*Server).didOpen,
+	"textDocument/didChange":      (*Server).didChange,
+	"textDocument/didClose":       (*Server).didClose,
+	"textDocument/didSave":        nil,
+	"textDocument/definition":     (*Server).definition,
+	"textDocument/references":     (*Server).references,
+	"textDocument/hover":          (*Server).hover,
+	"textDocument/documentSymbol": (*Server).documentSymbol,
+}
+
+// invalidParamsError is returned by the handlers if the params could not be decoded.
+type invalidParamsError struct {
+	err error
+}
+
+func (e *invalidParamsError) Error() string {
+	return "invalid params: " + e.err.Error()
+}
+
+func decodeParams(params json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &invalidParamsError{err: err}
+	}
+	return nil
+}
+
+func (s *Server) handle(req *request) {
+	h, ok := handlers[req.Method]
+	if !ok {
+		if req.ID != nil {
+			s.reply(req.ID, nil, &responseError{Code: codeMethodNotFound, Message: "method not found: " + req.Method})
+		}
+		return
+	}
+	if h == nil {
+		if req.ID != nil {
+			s.reply(req.ID, nil, nil)
+		}
+		return
+	}
+	result, err := s.call(h, req)
+	if req.ID == nil {
+		if err != nil {
+			s.logf("%s: %v", req.Method, err)
+		}
+		return
+	}
+	if err != nil {
+		code := codeInvalidRequest
+		if _, ok := err.(*invalidParamsError); ok {
+			code = codeInvalidParams
+		}
+		s.reply(req.ID, nil, &responseError{Code: code, Message: err.Error()})
+		return
+	}
+	s.reply(req.ID, result, nil)
+}
+
+// call invokes the handler converting a panic into an error, so that a bug does not bring the whole server down.
+func (s *Server) call(h handlerFunc, req *request) (result interface{}, err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			s.logf("%s: panic: %v", req.Method, x)
+			err = fmt.Errorf("internal error: %v", x)
+		}
+	}()
+	return h(s, req.Params)
+}
+
+func (s *Server) initialize(json.RawMessage) (interface{}, error) {
+	return map[string]interface{}{
+		"capabilities": map[string]interface{}{
+			"textDocumentSync": map[string]interface{}{
+				"openClose": true,
+				"change":    1, // full
+			},
+			"definitionProvider":     true,
+			"referencesProvider":     true,
+			"hoverProvider":          true,
+			"documentSymbolProvider": true,
+		},
+		"serverInfo": map[string]interface{}{
+			"name": "goja-lsp",
+		},
+	}, nil
+}
+
+func (s *Server) shutdownRequest(json.RawMessage) (interface{}, error) {
+	s.shutdown = true
+	return nil, nil
+}
+
+func (s *Server) publishDiagnostics(d *document) {
+	diagnostics := d.diagnostics
+	if diagnostics == nil {
+		diagnostics = []Diagnostic{}
+	}
+	s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+		URI:         d.uri,
+		Diagnostics: diagnostics,
+	})
+}
+
+func (s *Server) didOpen(params json.RawMessage) (interface{}, error) {
+	var p didOpenParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	d := newDocument(p.TextDocument.URI, p.TextDocument.Text, p.TextDocument.Version)
+	s.docs[d.uri] = d
+	s.publishDiagnostics(d)
+	return nil, nil
+}
+
+func (s *Server) didChange(params json.RawMessage) (interface{}, error) {
+	var p didChangeParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	d := s.docs[p.TextDocument.URI]
+	if d == nil {
+		return nil, fmt.Errorf("unknown document: %s", p.TextDocument.URI)
+	}
+	text := d.text
+	for _, change := range p.ContentChanges {
+		if change.Range == nil {
+			text = change.Text
+			continue
+		}
+		// the positions are relative to the text with the preceding changes applied
+		cur := newLines(text)
+		start, end := cur.offset(change.Range.Start), cur.offset(change.Range.End)
+		if end < start {
+			end = start
+		}
+		text = text[:start] + change.Text + text[end:]
+	}
+	d = newDocument(d.uri, text, p.TextDocument.Version)
+	s.docs[d.uri] = d
+	s.publishDiagnostics(d)
+	return nil, nil
+}
+
+func (s *Server) didClose(params json.RawMessage) (interface{}, error) {
+	var p didCloseParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	delete(s.docs, p.TextDocument.URI)
+	s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+		URI:         p.TextDocument.URI,
+		Diagnostics: []Diagnostic{},
+	})
+	return nil, nil
+}
+
+func (s *Server) positionParams(params json.RawMessage, p *textDocumentPositionParams) (*document, error) {
+	if err := decodeParams(params, p); err != nil {
+		return nil, err
+	}
+	d := s.docs[p.TextDocument.URI]
+	if d == nil || d.prg == nil {
+		return nil, nil
+	}
+	return d, nil
+}
+
+func (s *Server) definition(params json.RawMessage) (interface{}, error) {
+	var p textDocumentPositionParams
+	d, err := s.positionParams(params, &p)
+	if d == nil {
+		return nil, err
+	}
+	return emptyIfNil(d.definition(p.Position)), nil
+}
+
+func (s *Server) references(params json.RawMessage) (interface{}, error) {
+	var p referenceParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	d, err := s.positionParams(params, &p.textDocumentPositionParams)
+	if d == nil {
+		return nil, err
+	}
+	return emptyIfNil(d.references(p.Position, p.Context.IncludeDeclaration)), nil
+}
+
+func emptyIfNil(locations []Location) []Location {
+	if locations == nil {
+		return []Location{}
+	}
+	return locations
+}
+
+func (s *Server) hover(params json.RawMessage) (interface{}, error) {
+	var p textDocumentPositionParams
+	d, err := s.positionParams(params, &p)
+	if d == nil {
+		return nil, err
+	}
+	return d.hover(p.Position, s.manifest), nil
+}
+
+func (s *Server) documentSymbol(params json.RawMessage) (interface{}, error) {
+	var p documentSymbolParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	d := s.docs[p.TextDocument.URI]
+	if d == nil {
+		return []DocumentSymbol{}, nil
+	}
+	symbols := d.symbols()
+	if symbols == nil {
+		symbols = []DocumentSymbol{}
+	}
+	return symbols, nil
+}
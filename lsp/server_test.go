@@ -0,0 +1,367 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testClient struct {
+	t      *testing.T
+	in     bytes.Buffer
+	nextID int
+}
+
+func (c *testClient) send(id int, method string, params interface{}) {
+	msg := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+	}
+	if id != 0 {
+		msg["id"] = id
+	}
+	b, err := json.Marshal(msg)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	fmt.Fprintf(&c.in, "Content-Length: %d\r\n\r\n%s", len(b), b)
+}
+
+func (c *testClient) request(method string, params interface{}) int {
+	c.nextID++
+	c.send(c.nextID, method, params)
+	return c.nextID
+}
+
+func (c *testClient) notify(method string, params interface{}) {
+	c.send(0, method, params)
+}
+
+type testMessage struct {
+	ID     int             `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *responseError  `json:"error"`
+}
+
+// run serves the queued messages and returns the responses by the request id and the notifications in order.
+func (c *testClient) run(manifest *Manifest) (map[int]testMessage, []testMessage, error) {
+	var out bytes.Buffer
+	err := NewServer(manifest).Serve(&c.in, &out)
+	responses := make(map[int]testMessage)
+	var notifications []testMessage
+	r := bufio.NewReader(&out)
+	for {
+		body, rerr := readMessage(r)
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			c.t.Fatal(rerr)
+		}
+		var msg testMessage
+		if err := json.Unmarshal(body, &msg); err != nil {
+			c.t.Fatal(err)
+		}
+		if msg.Method != "" {
+			notifications = append(notifications, msg)
+		} else {
+			responses[msg.ID] = msg
+		}
+	}
+	return responses, notifications, err
+}
+
+func decode(t *testing.T, b json.RawMessage, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(b, v); err != nil {
+		t.Fatalf("%v: %s", err, b)
+	}
+}
+
+func docPosition(uri string, line, char int) map[string]interface{} {
+	return map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri},
+		"position":     Position{Line: line, Character: char},
+	}
+}
+
+func openDocument(c *testClient, uri, text string) {
+	c.notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{
+			"uri":        uri,
+			"languageId": "javascript",
+			"version":    1,
+			"text":       text,
+		},
+	})
+}
+
+func rng(l0, c0, l1, c1 int) Range {
+	return Range{Start: Position{Line: l0, Character: c0}, End: Position{Line: l1, Character: c1}}
+}
+
+func TestServerLifecycle(t *testing.T) {
+	c := &testClient{t: t}
+	initID := c.request("initialize", map[string]interface{}{"capabilities": map[string]interface{}{}})
+	c.notify("initialized", map[string]interface{}{})
+	unknownID := c.request("textDocument/rename", map[string]interface{}{})
+	shutdownID := c.request("shutdown", nil)
+	c.notify("exit", nil)
+	responses, _, err := c.run(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var init struct {
+		Capabilities map[string]interface{} `json:"capabilities"`
+	}
+	decode(t, responses[initID].Result, &init)
+	for _, p := range []string{"definitionProvider", "referencesProvider", "hoverProvider", "documentSymbolProvider"} {
+		if init.Capabilities[p] != true {
+			t.Errorf("%s: %v", p, init.Capabilities[p])
+		}
+	}
+	if e := responses[unknownID].Error; e == nil || e.Code != codeMethodNotFound {
+		t.Fatal(e)
+	}
+	if r := responses[shutdownID]; r.Error != nil || string(r.Result) != "null" {
+		t.Fatal(r)
+	}
+
+	c = &testClient{t: t}
+	c.notify("exit", nil)
+	if _, _, err := c.run(nil); err != ErrExitWithoutShutdown {
+		t.Fatal(err)
+	}
+}
+
+func TestServerDiagnostics(t *testing.T) {
+	c := &testClient{t: t}
+	openDocument(c, "file:///parse.js", "let a = 1;\nlet b = ;\n")
+	openDocument(c, "file:///early.js", "function f() {\n  let a;\n  let a;\n}\n")
+	openDocument(c, "file:///ok.ts", "let s: string = \"ä😀\";\n")
+	c.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": "file:///parse.js", "version": 2},
+		"contentChanges": []map[string]interface{}{
+			{"range": rng(1, 8, 1, 8), "text": "2"},
+		},
+	})
+	c.notify("textDocument/didClose", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": "file:///ok.ts"},
+	})
+	_, notifications, err := c.run(nil)
+	if err != io.EOF {
+		t.Fatal(err)
+	}
+	var published []publishDiagnosticsParams
+	for _, n := range notifications {
+		if n.Method != "textDocument/publishDiagnostics" {
+			t.Fatal(n.Method)
+		}
+		var p publishDiagnosticsParams
+		decode(t, n.Params, &p)
+		if p.Diagnostics == nil {
+			t.Fatalf("%s: diagnostics is null", p.URI)
+		}
+		published = append(published, p)
+	}
+	if len(published) != 5 {
+		t.Fatal(published)
+	}
+
+	if d := published[0].Diagnostics; len(d) != 1 || d[0].Range.Start != (Position{Line: 1, Character: 8}) ||
+		d[0].Severity != SeverityError || !strings.Contains(d[0].Message, "Unexpected token ;") {
+		t.Fatalf("parse error: %+v", d)
+	}
+	if d := published[1].Diagnostics; len(d) != 1 || d[0].Range != rng(2, 6, 2, 7) ||
+		!strings.Contains(d[0].Message, "Identifier 'a' has already been declared") {
+		t.Fatalf("early error: %+v", d)
+	}
+	for i, uri := range []string{"file:///ok.ts", "file:///parse.js", "file:///ok.ts"} {
+		if p := published[i+2]; p.URI != uri || len(p.Diagnostics) != 0 {
+			t.Fatalf("%d: %+v", i+2, p)
+		}
+	}
+}
+
+const navigationSrc = `let count = 0;
+function inc(by) {
+	count += by;
+	return count;
+}
+{
+	let count = "shadow";
+	count;
+}
+inc(1);
+`
+
+func TestServerNavigation(t *testing.T) {
+	const uri = "file:///nav.js"
+	c := &testClient{t: t}
+	openDocument(c, uri, navigationSrc)
+	defID := c.request("textDocument/definition", docPosition(uri, 3, 9))
+	shadowDefID := c.request("textDocument/definition", docPosition(uri, 7, 2))
+	globalDefID := c.request("textDocument/definition", docPosition(uri, 0, 6))
+	noneID := c.request("textDocument/definition", docPosition(uri, 9, 7))
+	refs := docPosition(uri, 0, 5)
+	refs["context"] = map[string]interface{}{"includeDeclaration": true}
+	refsID := c.request("textDocument/references", refs)
+	refs = docPosition(uri, 1, 13)
+	refs["context"] = map[string]interface{}{"includeDeclaration": false}
+	paramRefsID := c.request("textDocument/references", refs)
+	responses, _, _ := c.run(nil)
+
+	locations := func(id int) []Range {
+		t.Helper()
+		var locs []Location
+		decode(t, responses[id].Result, &locs)
+		if locs == nil {
+			t.Fatalf("%d: %s", id, responses[id].Result)
+		}
+		res := make([]Range, 0, len(locs))
+		for _, l := range locs {
+			if l.URI != uri {
+				t.Fatal(l.URI)
+			}
+			res = append(res, l.Range)
+		}
+		return res
+	}
+
+	if r := locations(defID); !reflect.DeepEqual(r, []Range{rng(0, 4, 0, 9)}) {
+		t.Fatalf("definition: %v", r)
+	}
+	if r := locations(shadowDefID); !reflect.DeepEqual(r, []Range{rng(6, 5, 6, 10)}) {
+		t.Fatalf("shadowed definition: %v", r)
+	}
+	if r := locations(globalDefID); !reflect.DeepEqual(r, []Range{rng(0, 4, 0, 9)}) {
+		t.Fatalf("definition at the declaration: %v", r)
+	}
+	if r := locations(noneID); len(r) != 0 {
+		t.Fatalf("definition of a number: %v", r)
+	}
+	if r := locations(refsID); !reflect.DeepEqual(r, []Range{rng(0, 4, 0, 9), rng(2, 1, 2, 6), rng(3, 8, 3, 13)}) {
+		t.Fatalf("references: %v", r)
+	}
+	if r := locations(paramRefsID); !reflect.DeepEqual(r, []Range{rng(2, 10, 2, 12)}) {
+		t.Fatalf("parameter references: %v", r)
+	}
+}
+
+func TestServerHover(t *testing.T) {
+	const uri = "file:///hover.js"
+	manifest := &Manifest{
+		Globals: []*Symbol{
+			{Name: "fetch", Kind: "function", Signature: "fetch(url: string): Promise<Response>", Doc: "Fetches a URL."},
+			{Name: "app", Kind: "object", Members: []*Symbol{
+				{Name: "config", Kind: "property", Members: []*Symbol{
+					{Name: "debug", Kind: "property", Signature: "debug: boolean"},
+				}},
+			}},
+		},
+	}
+	c := &testClient{t: t}
+	openDocument(c, uri, "const x = 1;\nfetch(app.config.debug, x);\nfunction g(fetch) { return fetch; }\n")
+	fetchID := c.request("textDocument/hover", docPosition(uri, 1, 2))
+	memberID := c.request("textDocument/hover", docPosition(uri, 1, 18))
+	localID := c.request("textDocument/hover", docPosition(uri, 1, 24))
+	shadowedID := c.request("textDocument/hover", docPosition(uri, 2, 29))
+	noneID := c.request("textDocument/hover", docPosition(uri, 1, 23))
+	responses, _, _ := c.run(manifest)
+
+	hover := func(id int) *Hover {
+		t.Helper()
+		var h *Hover
+		decode(t, responses[id].Result, &h)
+		return h
+	}
+	if h := hover(fetchID); h == nil || h.Contents.Kind != "markdown" ||
+		h.Contents.Value != "```js\n(function) fetch(url: string): Promise<Response>\n```\n\nFetches a URL." ||
+		*h.Range != rng(1, 0, 1, 5) {
+		t.Fatalf("global: %+v", h)
+	}
+	if h := hover(memberID); h == nil || h.Contents.Value != "```js\n(property) debug: boolean\n```" || *h.Range != rng(1, 17, 1, 22) {
+		t.Fatalf("member: %+v", h)
+	}
+	if h := hover(localID); h == nil || h.Contents.Value != "```js\n(const) x\n```" {
+		t.Fatalf("local: %+v", h)
+	}
+	if h := hover(shadowedID); h == nil || h.Contents.Value != "```js\n(parameter) fetch\n```" {
+		t.Fatalf("shadowed: %+v", h)
+	}
+	if h := hover(noneID); h != nil {
+		t.Fatalf("none: %+v", h)
+	}
+}
+
+func TestServerDocumentSymbols(t *testing.T) {
+	const uri = "file:///symbols.js"
+	c := &testClient{t: t}
+	openDocument(c, uri, `var a = 1, {b, c: [d]} = {};
+const MAX = 10;
+function outer(x, y = 2) {
+	let inner = () => {
+		const deep = 1;
+	};
+	[1].forEach(function () { var flat; });
+	for (let i = 0; i < 1; i++) {}
+}
+class C extends Object {
+	#p = 1;
+	static s;
+	constructor() { super(); }
+	get v() { return 1; }
+	m(q) {}
+	["comp" + "uted"]() {}
+}
+let K = class {};
+`)
+	id := c.request("textDocument/documentSymbol", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri},
+	})
+	responses, _, _ := c.run(nil)
+	var symbols []DocumentSymbol
+	decode(t, responses[id].Result, &symbols)
+
+	var dump func(prefix string, list []DocumentSymbol) []string
+	dump = func(prefix string, list []DocumentSymbol) []string {
+		var res []string
+		for _, s := range list {
+			res = append(res, fmt.Sprintf("%s%s %d %s", prefix, s.Name, s.Kind, s.Detail))
+			res = append(res, dump(prefix+"  ", s.Children)...)
+		}
+		return res
+	}
+	expected := []string{
+		"a 13 ",
+		"b 13 ",
+		"d 13 ",
+		"MAX 14 ",
+		"outer 12 (x, y = 2)",
+		"  inner 12 ()",
+		"    deep 14 ",
+		"  flat 13 ",
+		"C 5 ",
+		"  #p 8 ",
+		"  s 8 ",
+		"  constructor 9 ()",
+		"  v 7 ()",
+		"  m 6 (q)",
+		"  [\"comp\" + \"uted\"] 6 ()",
+		"K 5 ",
+	}
+	if res := dump("", symbols); !reflect.DeepEqual(res, expected) {
+		t.Fatalf("%q", res)
+	}
+	if s := symbols[4]; s.Range != rng(2, 0, 8, 1) || s.SelectionRange != rng(2, 9, 2, 14) {
+		t.Fatalf("%+v", s)
+	}
+}
@@ -17,6 +17,7 @@ const (
 	classMap           = "Map"
 	classMath          = "Math"
 	classSet           = "Set"
+	classShadowRealm   = "ShadowRealm"
 	classFunction      = "Function"
 	classAsyncFunction = "AsyncFunction"
 	classNumber        = "Number"
@@ -270,6 +271,7 @@ func (f ConstructorCall) Argument(idx int) Value {
 
 func (o *baseObject) init() {
 	o.values = make(map[unistring.String]Value)
+	objectAllocated(o)
 }
 
 func (o *baseObject) className() string {
@@ -250,15 +250,19 @@ func (i *gomapReflectPropIter) next() (propIterItem, iterNextFunc) {
 }
 
 func (o *objectGoMapReflect) iterateStringKeys() iterNextFunc {
+	keys := o.fieldsValue.MapKeys()
+	o.val.runtime.sortGoMapKeys(keys, o.keyToString)
 	return (&gomapReflectPropIter{
 		o:    o,
-		keys: o.fieldsValue.MapKeys(),
+		keys: keys,
 	}).next
 }
 
 func (o *objectGoMapReflect) stringKeys(_ bool, accum []Value) []Value {
 	// all own keys are enumerable
-	for _, key := range o.fieldsValue.MapKeys() {
+	keys := o.fieldsValue.MapKeys()
+	o.val.runtime.sortGoMapKeys(keys, o.keyToString)
+	for _, key := range keys {
 		accum = append(accum, o.keyToString(key))
 	}
 
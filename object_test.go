@@ -537,6 +537,25 @@ func BenchmarkPut(b *testing.B) {
 	}
 }
 
+func BenchmarkNewObject(b *testing.B) {
+	vm := New()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		vm.NewObject()
+	}
+}
+
+func BenchmarkObjectLiteral(b *testing.B) {
+	vm := New()
+	prg := MustCompile("test.js", "for (let i = 0; i < 100; i++) { ({a: i, b: [i]}); }", false)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := vm.RunProgram(prg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func BenchmarkPutStr(b *testing.B) {
 	v := &Object{}
 
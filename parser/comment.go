@@ -0,0 +1,164 @@
+package parser
+
+import (
+	"unicode"
+
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/file"
+)
+
+// recordComment records the comment which starts at idx and ends at the current character if comments are being
+// parsed. The same comment may be scanned more than once (see peek and mark), so the comments which do not follow
+// the last recorded one are ignored.
+func (self *_parser) recordComment(idx file.Idx) {
+	if self.mode&ParseComments == 0 {
+		return
+	}
+	if n := len(self.comments); n > 0 && self.comments[n-1].Idx >= idx {
+		return
+	}
+	self.comments = append(self.comments, &ast.Comment{
+		Idx:  idx,
+		Text: self.str[int(idx)-self.base : self.chrOffset],
+	})
+}
+
+// hasLineTerminator reports whether there is a line terminator between the two indexes.
+func (self *_parser) hasLineTerminator(idx0, idx1 file.Idx) bool {
+	for _, chr := range self.slice(idx0, idx1) {
+		if isLineTerminator(chr) {
+			return true
+		}
+	}
+	return false
+}
+
+// lineBreaks returns the number of line breaks between the two indexes, a CRLF sequence counts as one.
+func (self *_parser) lineBreaks(idx0, idx1 file.Idx) int {
+	n := 0
+	s := self.slice(idx0, idx1)
+	for i, chr := range s {
+		if isLineTerminator(chr) && !(chr == '\r' && i+1 < len(s) && s[i+1] == '\n') {
+			n++
+		}
+	}
+	return n
+}
+
+// groupComments combines the recorded comments into groups. A group ends at an empty line, at a token, or, if it
+// follows a token on the same line (i.e. it is a trailing comment), at the end of that line. The hashbang comment
+// always forms a group of its own.
+func (self *_parser) groupComments() []*ast.CommentGroup {
+	var groups []*ast.CommentGroup
+	var group *ast.CommentGroup
+	trailing := false
+	for _, c := range self.comments {
+		if group != nil {
+			last := group.List[len(group.List)-1]
+			gap := self.slice(last.Idx1(), c.Idx)
+			lines := self.lineBreaks(last.Idx1(), c.Idx)
+			if !isWhiteSpace(gap) || lines > 1 || trailing && lines > 0 || last.Idx == self.idxOf(0) && last.Text[0] == '#' {
+				group = nil
+			}
+		}
+		if group == nil {
+			group = &ast.CommentGroup{}
+			groups = append(groups, group)
+			lineStart := int(c.Idx) - self.base
+			for lineStart > 0 && !isLineTerminator(rune(self.str[lineStart-1])) {
+				lineStart--
+			}
+			trailing = !isWhiteSpace(self.str[lineStart : int(c.Idx)-self.base])
+		}
+		group.List = append(group.List, c)
+	}
+	return groups
+}
+
+func isWhiteSpace(s string) bool {
+	for _, chr := range s {
+		if !unicode.IsSpace(chr) && chr != '\ufeff' && !isLineTerminator(chr) {
+			return false
+		}
+	}
+	return true
+}
+
+// attachComments groups the recorded comments and attaches them to the nodes of the program.
+func (self *_parser) attachComments(prg *ast.Program) {
+	prg.Comments = self.groupComments()
+	if len(prg.Comments) == 0 {
+		return
+	}
+	prg.CommentMap = make(ast.CommentMap)
+	for _, g := range prg.Comments {
+		self.attachComment(prg.CommentMap, prg, g)
+	}
+}
+
+// children returns the direct children of the node in the source order.
+func children(node ast.Node) []ast.Node {
+	var list []ast.Node
+	ast.Inspect(node, func(n ast.Node) bool {
+		if n == node {
+			return true
+		}
+		if n != nil {
+			list = append(list, n)
+		}
+		return false
+	})
+	return list
+}
+
+// attachComment attaches the comment group to the innermost node enclosing it or to one of its children:
+//   - to the preceding child as a trailing comment if the group starts on the same line where the child ends
+//     and is not followed by another child on the same line;
+//   - otherwise to the following child as a leading comment;
+//   - otherwise (i.e. after the last child) to the preceding child as a trailing comment;
+//   - if the node has no children, as an inner comment of the node itself.
+func (self *_parser) attachComment(m ast.CommentMap, node ast.Node, g *ast.CommentGroup) {
+	for {
+		var prev, next ast.Node
+		var enclosing ast.Node
+		for _, child := range children(node) {
+			if child.Idx1() <= g.Idx0() {
+				prev = child
+				continue
+			}
+			if child.Idx0() <= g.Idx0() {
+				enclosing = child
+			} else {
+				next = child
+			}
+			break
+		}
+		if enclosing != nil {
+			node = enclosing
+			continue
+		}
+
+		var list *[]*ast.CommentGroup
+		get := func(n ast.Node) *ast.NodeComments {
+			c := m[n]
+			if c == nil {
+				c = &ast.NodeComments{}
+				m[n] = c
+			}
+			return c
+		}
+		switch {
+		case prev != nil && !self.hasLineTerminator(prev.Idx1(), g.Idx0()) &&
+			(next == nil || self.hasLineTerminator(g.Idx1(), next.Idx0())):
+			list = &get(prev).Trailing
+		case next != nil:
+			list = &get(next).Leading
+		case prev != nil:
+			list = &get(prev).Trailing
+		default:
+			list = &get(node).Inner
+		}
+		*list = append(*list, g)
+		return
+	}
+}
@@ -0,0 +1,98 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/dop251/goja/ast"
+)
+
+func TestParseComments(t *testing.T) {
+	tt(t, func() {
+		const src = `#!/usr/bin/env node
+/*! license */
+
+/**
+ * Adds the numbers.
+ * @param {number} a - The first one.
+ * @param {number} [b=2] The second one.
+ * @returns {number}
+ */
+function add(a, b) {
+	// leading
+	return a + b; // trailing
+}
+class C {
+	/** Method. */
+	m(/* inner */) {}
+}
+function empty() { /* empty */ }
+var x = /re/; // x
+// at the end
+`
+		prg, err := ParseFile(nil, "", src, ParseComments)
+		is(err, nil)
+
+		var texts []string
+		for _, g := range prg.Comments {
+			texts = append(texts, g.Text())
+		}
+		is(len(texts), 10)
+		is(texts[0], "/usr/bin/env node\n")
+		is(texts[1], "! license\n")
+		is(texts[2], "Adds the numbers.\n@param {number} a - The first one.\n@param {number} [b=2] The second one.\n@returns {number}\n")
+		is(texts[4], "trailing\n")
+		is(texts[6], "inner\n")
+
+		m := prg.CommentMap
+		fn := prg.Body[0].(*ast.FunctionDeclaration)
+		is(len(m.Leading(fn)), 3)
+		ret := fn.Function.Body.List[0]
+		is(m.Leading(ret)[0].Text(), "leading\n")
+		is(m.Trailing(ret)[0].Text(), "trailing\n")
+
+		doc := m.JSDoc(fn)
+		is(doc.Description, "Adds the numbers.")
+		is(len(doc.Tags), 3)
+		is(*doc.Tags[0], ast.JSDocTag{Tag: "param", Type: "number", Name: "a", Text: "The first one."})
+		is(*doc.Tags[1], ast.JSDocTag{Tag: "param", Type: "number", Name: "b", Optional: true, Default: "2", Text: "The second one."})
+		is(*doc.Tag("returns"), ast.JSDocTag{Tag: "returns", Type: "number"})
+		is(doc.Tag("throws") == nil, true)
+
+		method := prg.Body[1].(*ast.ClassDeclaration).Class.Body[0].(*ast.MethodDefinition)
+		is(m.JSDoc(method).Description, "Method.")
+		is(m.Get(method.Body.ParameterList).Inner[0].Text(), "inner\n")
+
+		empty := prg.Body[2].(*ast.FunctionDeclaration).Function.Body
+		is(m.Get(empty).Inner[0].Text(), "empty\n")
+		is(m.JSDoc(prg.Body[2]) == nil, true)
+
+		trailing := m.Trailing(prg.Body[3])
+		is(len(trailing), 2)
+		is(trailing[0].Text(), "x\n")
+		is(trailing[1].Text(), "at the end\n")
+	})
+
+	tt(t, func() {
+		// the comments are not recorded by default
+		prg, err := ParseFile(nil, "", "// a\na /* b */ + c", 0)
+		is(err, nil)
+		is(len(prg.Comments), 0)
+		is(prg.CommentMap == nil, true)
+
+		// the lookahead scans the comments more than once
+		prg, err = ParseFile(nil, "", "(a /* 1 */, b) /* 2 */ => /* 3 */ a", ParseComments)
+		is(err, nil)
+		is(len(prg.Comments), 3)
+
+		prg, err = ParseFile(nil, "", "/* only */", ParseComments)
+		is(err, nil)
+		is(prg.CommentMap.Get(prg).Inner[0].Text(), "only\n")
+
+		// a case without statements
+		prg, err = ParseFile(nil, "", "switch (v) {\n case 1:\n // fallthrough\n case 2: break;\n}", ParseComments)
+		is(err, nil)
+		cases := prg.Body[0].(*ast.SwitchStatement).Body
+		is(cases[0].Idx1(), cases[0].Colon+1)
+		is(prg.CommentMap.Leading(cases[1])[0].Text(), "fallthrough\n")
+	})
+}
@@ -52,6 +52,10 @@ const (
 type Error struct {
 	Position file.Position
 	Message  string
+
+	// The position immediately after the offending token. It is the same as Position if the error does not refer
+	// to a token.
+	End file.Position
 }
 
 // FIXME Should this be "SyntaxError"?
@@ -86,7 +90,17 @@ func (self *_parser) error(place interface{}, msg string, msgValues ...interface
 
 	position := self.position(idx)
 	msg = fmt.Sprintf(msg, msgValues...)
-	self.errors.Add(position, msg)
+	if self.mode&ErrorRecovery != 0 {
+		// the same error may be reported by several nested constructs while recovering
+		if n := len(self.errors); n > 0 && self.errors[n-1].Position == position {
+			return self.errors[n-1]
+		}
+	}
+	end := position
+	if idx == self.idx && self.token != token.EOF && self.chrOffset > int(idx)-self.base {
+		end = self.position(self.idxOf(self.chrOffset))
+	}
+	self.errors = append(self.errors, &Error{Position: position, Message: msg, End: end})
 	return self.errors[len(self.errors)-1]
 }
 
@@ -126,7 +140,7 @@ type ErrorList []*Error
 
 // Add adds an Error with given position and message to an ErrorList.
 func (self *ErrorList) Add(position file.Position, msg string) {
-	*self = append(*self, &Error{position, msg})
+	*self = append(*self, &Error{Position: position, Message: msg, End: position})
 }
 
 // Reset resets an ErrorList to no errors.
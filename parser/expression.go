@@ -95,6 +95,14 @@ func (self *_parser) parsePrimaryExpression() ast.Expression {
 		return self.parseFunction(false, false, idx)
 	case token.CLASS:
 		return self.parseClass(false)
+	case token.LESS:
+		if self.mode&JSX != 0 {
+			node := self.parseJSXElement()
+			// a line break after the final ">" ends the statement like after the "}" of an object literal
+			self.insertSemicolon = true
+			self.next()
+			return node
+		}
 	}
 
 	if self.isBindingId(self.token) {
@@ -307,6 +315,9 @@ func (self *_parser) parseVariableDeclaration(declarationList *[]*ast.Binding) *
 	node := &ast.Binding{
 		Target: self.parseBindingTarget(),
 	}
+	if self.mode&TypeScript != 0 {
+		self.skipBindingType(node.Target)
+	}
 
 	if declarationList != nil {
 		*declarationList = append(*declarationList, node)
@@ -419,7 +430,7 @@ func (self *_parser) parseObjectProperty() ast.Property {
 			}
 		}
 		switch {
-		case self.token == token.LEFT_PARENTHESIS:
+		case self.token == token.LEFT_PARENTHESIS || self.token == token.LESS && self.mode&TypeScript != 0:
 			return &ast.PropertyKeyed{
 				Key:      value,
 				Kind:     ast.PropertyKindMethod,
@@ -481,6 +492,16 @@ func (self *_parser) parseObjectProperty() ast.Property {
 }
 
 func (self *_parser) parseMethodDefinition(keyStartIdx file.Idx, kind ast.PropertyKind, generator, async bool) *ast.FunctionLiteral {
+	node := self.parseMethodParameters(keyStartIdx, kind, generator, async)
+	self.parseMethodBody(node)
+	return node
+}
+
+// parseMethodParameters parses the parameters of a method definition, the body is parsed by parseMethodBody.
+func (self *_parser) parseMethodParameters(keyStartIdx file.Idx, kind ast.PropertyKind, generator, async bool) *ast.FunctionLiteral {
+	if self.mode&TypeScript != 0 && self.token == token.LESS {
+		self.skipTypeParameters()
+	}
 	idx1 := self.idx
 	if generator != self.scope.allowYield {
 		self.scope.allowYield = generator
@@ -495,6 +516,9 @@ func (self *_parser) parseMethodDefinition(keyStartIdx file.Idx, kind ast.Proper
 		}()
 	}
 	parameterList := self.parseFunctionParameterList()
+	if self.mode&TypeScript != 0 {
+		self.skipTypeAnnotation()
+	}
 	switch kind {
 	case ast.PropertyKindGet:
 		if len(parameterList.List) > 0 || parameterList.Rest != nil {
@@ -505,15 +529,17 @@ func (self *_parser) parseMethodDefinition(keyStartIdx file.Idx, kind ast.Proper
 			self.error(idx1, "Setter must have exactly one formal parameter.")
 		}
 	}
-	node := &ast.FunctionLiteral{
+	return &ast.FunctionLiteral{
 		Function:      keyStartIdx,
 		ParameterList: parameterList,
 		Generator:     generator,
 		Async:         async,
 	}
-	node.Body, node.DeclarationList = self.parseFunctionBlock(async, async, generator)
-	node.Source = self.slice(keyStartIdx, node.Body.Idx1())
-	return node
+}
+
+func (self *_parser) parseMethodBody(node *ast.FunctionLiteral) {
+	node.Body, node.DeclarationList = self.parseFunctionBlock(node.Async, node.Async, node.Generator)
+	node.Source = self.slice(node.Function, node.Body.Idx1())
 }
 
 func (self *_parser) parseObjectLiteral() *ast.ObjectLiteral {
@@ -610,9 +636,10 @@ func (self *_parser) parseTaggedTemplateLiteral(tag ast.Expression) *ast.Templat
 	return l
 }
 
-func (self *_parser) parseArgumentList() (argumentList []ast.Expression, idx0, idx1 file.Idx) {
+func (self *_parser) parseArgumentList() (argumentList []ast.Expression, idx0, trailingComma, idx1 file.Idx) {
 	idx0 = self.expect(token.LEFT_PARENTHESIS)
 	for self.token != token.RIGHT_PARENTHESIS {
+		trailingComma = 0
 		var item ast.Expression
 		if self.token == token.ELLIPSIS {
 			self.next()
@@ -626,6 +653,7 @@ func (self *_parser) parseArgumentList() (argumentList []ast.Expression, idx0, i
 		if self.token != token.COMMA {
 			break
 		}
+		trailingComma = self.idx
 		self.next()
 	}
 	idx1 = self.expect(token.RIGHT_PARENTHESIS)
@@ -633,11 +661,12 @@ func (self *_parser) parseArgumentList() (argumentList []ast.Expression, idx0, i
 }
 
 func (self *_parser) parseCallExpression(left ast.Expression) ast.Expression {
-	argumentList, idx0, idx1 := self.parseArgumentList()
+	argumentList, idx0, trailingComma, idx1 := self.parseArgumentList()
 	return &ast.CallExpression{
 		Callee:           left,
 		LeftParenthesis:  idx0,
 		ArgumentList:     argumentList,
+		TrailingComma:    trailingComma,
 		RightParenthesis: idx1,
 	}
 }
@@ -716,8 +745,9 @@ func (self *_parser) parseNewExpression() ast.Expression {
 		Callee: callee,
 	}
 	if self.token == token.LEFT_PARENTHESIS {
-		argumentList, idx0, idx1 := self.parseArgumentList()
+		argumentList, idx0, trailingComma, idx1 := self.parseArgumentList()
 		node.ArgumentList = argumentList
+		node.TrailingComma = trailingComma
 		node.LeftParenthesis = idx0
 		node.RightParenthesis = idx1
 	}
@@ -741,6 +771,10 @@ L:
 			left = self.parseBracketMember(left)
 		case token.BACKTICK:
 			left = self.parseTaggedTemplateLiteral(left)
+		case token.LESS:
+			if self.mode&TypeScript == 0 || !self.skipTypeArgumentsInExpression() {
+				break L
+			}
 		default:
 			break L
 		}
@@ -775,6 +809,16 @@ L:
 			left = self.parseBracketMember(left)
 		case token.LEFT_PARENTHESIS:
 			left = self.parseCallExpression(left)
+		case token.LESS:
+			if self.mode&TypeScript == 0 || !self.skipTypeArgumentsInExpression() {
+				break L
+			}
+		case token.NOT:
+			// a non-null assertion: x!
+			if self.mode&TypeScript == 0 || self.implicitSemicolon {
+				break L
+			}
+			self.next()
 		case token.BACKTICK:
 			if optionalChain {
 				self.error(self.idx, "Invalid template literal on optional chain")
@@ -784,7 +828,7 @@ L:
 			left = self.parseTaggedTemplateLiteral(left)
 		case token.QUESTION_DOT:
 			optionalChain = true
-			left = &ast.Optional{Expression: left}
+			left = &ast.Optional{Expression: left, QuestionDot: self.idx}
 
 			switch self.peek() {
 			case token.LEFT_BRACKET, token.LEFT_PARENTHESIS, token.BACKTICK:
@@ -864,6 +908,12 @@ func (self *_parser) parseUnaryExpression() ast.Expression {
 			Idx:      idx,
 			Operand:  self.parseUnaryExpression(),
 		}
+	case token.LESS:
+		if self.mode&TypeScript != 0 && self.mode&JSX == 0 {
+			// a type assertion: <T>x
+			self.skipTypeArguments()
+			return self.parseUnaryExpression()
+		}
 	case token.AWAIT:
 		if self.scope.allowAwait {
 			idx := self.idx
@@ -900,11 +950,13 @@ func (self *_parser) parseExponentiationExpression() ast.Expression {
 			}
 		}
 		for {
+			idx := self.idx
 			self.next()
 			left = &ast.BinaryExpression{
-				Operator: token.EXPONENT,
-				Left:     left,
-				Right:    self.parseExponentiationExpression(),
+				Operator:    token.EXPONENT,
+				OperatorIdx: idx,
+				Left:        left,
+				Right:       self.parseExponentiationExpression(),
 			}
 			if self.token != token.EXPONENT {
 				break
@@ -921,11 +973,13 @@ func (self *_parser) parseMultiplicativeExpression() ast.Expression {
 	for self.token == token.MULTIPLY || self.token == token.SLASH ||
 		self.token == token.REMAINDER {
 		tkn := self.token
+		idx := self.idx
 		self.next()
 		left = &ast.BinaryExpression{
-			Operator: tkn,
-			Left:     left,
-			Right:    self.parseExponentiationExpression(),
+			Operator:    tkn,
+			OperatorIdx: idx,
+			Left:        left,
+			Right:       self.parseExponentiationExpression(),
 		}
 	}
 
@@ -937,11 +991,13 @@ func (self *_parser) parseAdditiveExpression() ast.Expression {
 
 	for self.token == token.PLUS || self.token == token.MINUS {
 		tkn := self.token
+		idx := self.idx
 		self.next()
 		left = &ast.BinaryExpression{
-			Operator: tkn,
-			Left:     left,
-			Right:    self.parseMultiplicativeExpression(),
+			Operator:    tkn,
+			OperatorIdx: idx,
+			Left:        left,
+			Right:       self.parseMultiplicativeExpression(),
 		}
 	}
 
@@ -954,11 +1010,13 @@ func (self *_parser) parseShiftExpression() ast.Expression {
 	for self.token == token.SHIFT_LEFT || self.token == token.SHIFT_RIGHT ||
 		self.token == token.UNSIGNED_SHIFT_RIGHT {
 		tkn := self.token
+		idx := self.idx
 		self.next()
 		left = &ast.BinaryExpression{
-			Operator: tkn,
-			Left:     left,
-			Right:    self.parseAdditiveExpression(),
+			Operator:    tkn,
+			OperatorIdx: idx,
+			Left:        left,
+			Right:       self.parseAdditiveExpression(),
 		}
 	}
 
@@ -975,16 +1033,26 @@ func (self *_parser) parseRelationalExpression() ast.Expression {
 		}
 		self.next()
 		if self.token == token.IN {
+			idx := self.idx
 			self.next()
 			return &ast.BinaryExpression{
-				Operator: self.token,
-				Left:     left,
-				Right:    self.parseShiftExpression(),
+				Operator:    self.token,
+				OperatorIdx: idx,
+				Left:        left,
+				Right:       self.parseShiftExpression(),
 			}
 		}
 		return left
 	}
 	left := self.parseShiftExpression()
+	for self.mode&TypeScript != 0 && self.token == token.IDENTIFIER && (self.literal == "as" || self.literal == "satisfies") && !self.implicitSemicolon {
+		self.next()
+		if self.token == token.CONST {
+			self.next()
+		} else {
+			self.skipType()
+		}
+	}
 
 	allowIn := self.scope.allowIn
 	self.scope.allowIn = true
@@ -995,31 +1063,37 @@ func (self *_parser) parseRelationalExpression() ast.Expression {
 	switch self.token {
 	case token.LESS, token.LESS_OR_EQUAL, token.GREATER, token.GREATER_OR_EQUAL:
 		tkn := self.token
+		idx := self.idx
 		self.next()
 		return &ast.BinaryExpression{
-			Operator:   tkn,
-			Left:       left,
-			Right:      self.parseRelationalExpression(),
-			Comparison: true,
+			Operator:    tkn,
+			OperatorIdx: idx,
+			Left:        left,
+			Right:       self.parseRelationalExpression(),
+			Comparison:  true,
 		}
 	case token.INSTANCEOF:
 		tkn := self.token
+		idx := self.idx
 		self.next()
 		return &ast.BinaryExpression{
-			Operator: tkn,
-			Left:     left,
-			Right:    self.parseRelationalExpression(),
+			Operator:    tkn,
+			OperatorIdx: idx,
+			Left:        left,
+			Right:       self.parseRelationalExpression(),
 		}
 	case token.IN:
 		if !allowIn {
 			return left
 		}
 		tkn := self.token
+		idx := self.idx
 		self.next()
 		return &ast.BinaryExpression{
-			Operator: tkn,
-			Left:     left,
-			Right:    self.parseRelationalExpression(),
+			Operator:    tkn,
+			OperatorIdx: idx,
+			Left:        left,
+			Right:       self.parseRelationalExpression(),
 		}
 	}
 
@@ -1032,12 +1106,14 @@ func (self *_parser) parseEqualityExpression() ast.Expression {
 	for self.token == token.EQUAL || self.token == token.NOT_EQUAL ||
 		self.token == token.STRICT_EQUAL || self.token == token.STRICT_NOT_EQUAL {
 		tkn := self.token
+		idx := self.idx
 		self.next()
 		left = &ast.BinaryExpression{
-			Operator:   tkn,
-			Left:       left,
-			Right:      self.parseRelationalExpression(),
-			Comparison: true,
+			Operator:    tkn,
+			OperatorIdx: idx,
+			Left:        left,
+			Right:       self.parseRelationalExpression(),
+			Comparison:  true,
 		}
 	}
 
@@ -1049,11 +1125,13 @@ func (self *_parser) parseBitwiseAndExpression() ast.Expression {
 
 	for self.token == token.AND {
 		tkn := self.token
+		idx := self.idx
 		self.next()
 		left = &ast.BinaryExpression{
-			Operator: tkn,
-			Left:     left,
-			Right:    self.parseEqualityExpression(),
+			Operator:    tkn,
+			OperatorIdx: idx,
+			Left:        left,
+			Right:       self.parseEqualityExpression(),
 		}
 	}
 
@@ -1065,11 +1143,13 @@ func (self *_parser) parseBitwiseExclusiveOrExpression() ast.Expression {
 
 	for self.token == token.EXCLUSIVE_OR {
 		tkn := self.token
+		idx := self.idx
 		self.next()
 		left = &ast.BinaryExpression{
-			Operator: tkn,
-			Left:     left,
-			Right:    self.parseBitwiseAndExpression(),
+			Operator:    tkn,
+			OperatorIdx: idx,
+			Left:        left,
+			Right:       self.parseBitwiseAndExpression(),
 		}
 	}
 
@@ -1081,11 +1161,13 @@ func (self *_parser) parseBitwiseOrExpression() ast.Expression {
 
 	for self.token == token.OR {
 		tkn := self.token
+		idx := self.idx
 		self.next()
 		left = &ast.BinaryExpression{
-			Operator: tkn,
-			Left:     left,
-			Right:    self.parseBitwiseExclusiveOrExpression(),
+			Operator:    tkn,
+			OperatorIdx: idx,
+			Left:        left,
+			Right:       self.parseBitwiseExclusiveOrExpression(),
 		}
 	}
 
@@ -1097,11 +1179,13 @@ func (self *_parser) parseLogicalAndExpression() ast.Expression {
 
 	for self.token == token.LOGICAL_AND {
 		tkn := self.token
+		idx := self.idx
 		self.next()
 		left = &ast.BinaryExpression{
-			Operator: tkn,
-			Left:     left,
-			Right:    self.parseBitwiseOrExpression(),
+			Operator:    tkn,
+			OperatorIdx: idx,
+			Left:        left,
+			Right:       self.parseBitwiseOrExpression(),
 		}
 	}
 
@@ -1124,11 +1208,13 @@ func (self *_parser) parseLogicalOrExpression() ast.Expression {
 		for {
 			switch self.token {
 			case token.LOGICAL_OR:
+				opIdx := self.idx
 				self.next()
 				left = &ast.BinaryExpression{
-					Operator: token.LOGICAL_OR,
-					Left:     left,
-					Right:    self.parseLogicalAndExpression(),
+					Operator:    token.LOGICAL_OR,
+					OperatorIdx: opIdx,
+					Left:        left,
+					Right:       self.parseLogicalAndExpression(),
 				}
 			case token.COALESCE:
 				idx = self.idx
@@ -1151,9 +1237,10 @@ func (self *_parser) parseLogicalOrExpression() ast.Expression {
 				}
 
 				left = &ast.BinaryExpression{
-					Operator: token.COALESCE,
-					Left:     left,
-					Right:    right,
+					Operator:    token.COALESCE,
+					OperatorIdx: idx,
+					Left:        left,
+					Right:       right,
 				}
 			case token.LOGICAL_OR:
 				idx = self.idx
@@ -1176,6 +1263,7 @@ func (self *_parser) parseConditionalExpression() ast.Expression {
 		self.next()
 		allowIn := self.scope.allowIn
 		self.scope.allowIn = true
+		self.consequent = true
 		consequent := self.parseAssignmentExpression()
 		self.scope.allowIn = allowIn
 		self.expect(token.COLON)
@@ -1235,6 +1323,8 @@ func (self *_parser) parseAssignmentExpression() ast.Expression {
 	start := self.idx
 	parenthesis := false
 	async := false
+	consequent := self.consequent
+	self.consequent = false
 	var state parserState
 	switch self.token {
 	case token.LEFT_PARENTHESIS:
@@ -1249,6 +1339,18 @@ func (self *_parser) parseAssignmentExpression() ast.Expression {
 		} else if tok == token.LEFT_PARENTHESIS {
 			self.mark(&state)
 			async = true
+		} else if tok == token.LESS && self.mode&TypeScript != 0 {
+			// async <T>(x: T) => ...
+			if node := self.parseTypedArrowFunction(start, true); node != nil {
+				return node
+			}
+		}
+	case token.LESS:
+		if self.mode&TypeScript != 0 && (self.mode&JSX == 0 || self.isJSXTypeParameters()) {
+			// <T>(x: T) => ...
+			if node := self.parseTypedArrowFunction(start, false); node != nil {
+				return node
+			}
 		}
 	case token.YIELD:
 		if self.scope.allowYield {
@@ -1259,6 +1361,12 @@ func (self *_parser) parseAssignmentExpression() ast.Expression {
 		self.tokenToBindingId()
 	}
 	left := self.parseConditionalExpression()
+	if self.mode&TypeScript != 0 && (parenthesis || async) && (len(self.errors) > state.errorCount || self.token == token.COLON) {
+		// (x: T) => ... or (x): T => ...
+		if node := self.reparseAsTypedArrowFunction(&state, start, async, consequent); node != nil {
+			return node
+		}
+	}
 	var operator token.Token
 	switch self.token {
 	case token.ASSIGN:
@@ -1351,9 +1459,10 @@ func (self *_parser) parseAssignmentExpression() ast.Expression {
 		}
 		if ok {
 			return &ast.AssignExpression{
-				Left:     left,
-				Operator: operator,
-				Right:    self.parseAssignmentExpression(),
+				Left:        left,
+				Operator:    operator,
+				OperatorIdx: idx,
+				Right:       self.parseAssignmentExpression(),
 			}
 		}
 		self.error(left.Idx0(), "Invalid left-hand side in assignment")
@@ -1415,6 +1524,10 @@ func (self *_parser) parseExpression() ast.Expression {
 }
 
 func (self *_parser) checkComma(from, to file.Idx) {
+	if from >= to {
+		// can only happen when recovering from an error (see expect)
+		return
+	}
 	if pos := strings.IndexByte(self.str[int(from)-self.base:int(to)-self.base], ','); pos >= 0 {
 		self.error(from+file.Idx(pos), "Comma is not allowed here")
 	}
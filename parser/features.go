@@ -0,0 +1,292 @@
+package parser
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/file"
+	"github.com/dop251/goja/token"
+)
+
+// An Edition is an ECMAScript edition, see WithEdition.
+type Edition int
+
+const (
+	ES5    Edition = 5
+	ES2015 Edition = 2015 + iota - 1
+	ES2016
+	ES2017
+	ES2018
+	ES2019
+	ES2020
+	ES2021
+	ES2022
+	ES2023
+	ES2024
+	ES2025
+)
+
+func (e Edition) String() string {
+	if e == ES5 {
+		return "ES5"
+	}
+	return fmt.Sprintf("ES%d", int(e))
+}
+
+// A Feature is a syntax feature which can be disallowed with WithoutFeatures or WithEdition.
+type Feature uint
+
+const (
+	FeatureLexicalDeclarations    Feature = iota // let and const declarations (ES2015)
+	FeatureArrowFunctions                        // (ES2015)
+	FeatureClasses                               // (ES2015)
+	FeatureTemplateLiterals                      // including the tagged templates (ES2015)
+	FeatureDestructuring                         // the array and object patterns (ES2015)
+	FeatureDefaultParameters                     // (ES2015)
+	FeatureRestParameters                        // (ES2015)
+	FeatureSpread                                // in the array literals and the arguments (ES2015)
+	FeatureForOf                                 // (ES2015)
+	FeatureGenerators                            // (ES2015)
+	FeatureEnhancedObjectLiterals                // the shorthand properties, the methods and the computed keys (ES2015)
+	FeatureNewTarget                             // (ES2015)
+	FeatureBinaryOctalLiterals                   // 0b and 0o (ES2015)
+	FeatureExponentiation                        // ** and **= (ES2016)
+	FeatureAsyncFunctions                        // including the async arrow functions and methods (ES2017)
+	FeatureTrailingCommas                        // in the parameter and the argument lists (ES2017)
+	FeatureObjectRestSpread                      // ...rest in the object patterns and ...spread in the object literals (ES2018)
+	FeatureOptionalCatchBinding                  // catch without a parameter (ES2019)
+	FeatureOptionalChaining                      // ?. (ES2020)
+	FeatureNullishCoalescing                     // ?? (ES2020)
+	FeatureBigInt                                // the BigInt literals (ES2020)
+	FeatureLogicalAssignment                     // &&=, ||= and ??= (ES2021)
+	FeatureNumericSeparators                     // 1_000 (ES2021)
+	FeatureClassFields                           // the public instance and static fields (ES2022)
+	FeaturePrivateMembers                        // #private fields and methods, #x in obj (ES2022)
+	FeatureClassStaticBlocks                     // (ES2022)
+	FeatureHashbang                              // #! at the beginning of the source (ES2023)
+)
+
+var features = [...]struct {
+	name    string
+	edition Edition
+}{
+	FeatureLexicalDeclarations:    {"let and const declarations", ES2015},
+	FeatureArrowFunctions:         {"arrow functions", ES2015},
+	FeatureClasses:                {"classes", ES2015},
+	FeatureTemplateLiterals:       {"template literals", ES2015},
+	FeatureDestructuring:          {"destructuring", ES2015},
+	FeatureDefaultParameters:      {"default parameters", ES2015},
+	FeatureRestParameters:         {"rest parameters", ES2015},
+	FeatureSpread:                 {"spread syntax", ES2015},
+	FeatureForOf:                  {"for-of loops", ES2015},
+	FeatureGenerators:             {"generators", ES2015},
+	FeatureEnhancedObjectLiterals: {"shorthand properties, methods and computed keys", ES2015},
+	FeatureNewTarget:              {"new.target", ES2015},
+	FeatureBinaryOctalLiterals:    {"binary and octal literals", ES2015},
+	FeatureExponentiation:         {"exponentiation operator", ES2016},
+	FeatureAsyncFunctions:         {"async functions", ES2017},
+	FeatureTrailingCommas:         {"trailing commas in parameter and argument lists", ES2017},
+	FeatureObjectRestSpread:       {"object rest and spread properties", ES2018},
+	FeatureOptionalCatchBinding:   {"optional catch binding", ES2019},
+	FeatureOptionalChaining:       {"optional chaining", ES2020},
+	FeatureNullishCoalescing:      {"nullish coalescing operator", ES2020},
+	FeatureBigInt:                 {"BigInt literals", ES2020},
+	FeatureLogicalAssignment:      {"logical assignment operators", ES2021},
+	FeatureNumericSeparators:      {"numeric separators", ES2021},
+	FeatureClassFields:            {"class fields", ES2022},
+	FeaturePrivateMembers:         {"private class members", ES2022},
+	FeatureClassStaticBlocks:      {"class static blocks", ES2022},
+	FeatureHashbang:               {"hashbang comments", ES2023},
+}
+
+func (f Feature) String() string {
+	if int(f) < len(features) {
+		return features[f].name
+	}
+	return fmt.Sprintf("Feature(%d)", int(f))
+}
+
+// Edition returns the ECMAScript edition which has introduced the feature.
+func (f Feature) Edition() Edition {
+	if int(f) < len(features) {
+		return features[f].edition
+	}
+	return 0
+}
+
+// WithEdition is an option to restrict the syntax to the given ECMAScript edition: the syntax features introduced
+// by the later editions are reported as errors. By default all the supported syntax is allowed.
+//
+// Only the syntax of the program is checked (see Feature for the list), not the syntax of the regular expressions,
+// the escape sequences in the strings or the availability of the built-in objects.
+func WithEdition(edition Edition) Option {
+	return func(opts *options) {
+		opts.edition = edition
+	}
+}
+
+// WithoutFeatures is an option to report the given syntax features as errors, regardless of the edition.
+func WithoutFeatures(features ...Feature) Option {
+	return func(opts *options) {
+		for _, f := range features {
+			opts.disabledFeatures |= 1 << f
+		}
+	}
+}
+
+// featureChecker reports the disallowed syntax features found in the AST.
+type featureChecker struct {
+	p *_parser
+}
+
+func (self *_parser) checkFeatures(program *ast.Program) {
+	if self.opts.edition == 0 && self.opts.disabledFeatures == 0 {
+		return
+	}
+	if strings.HasPrefix(self.str, "#!") {
+		self.checkFeature(FeatureHashbang, 0)
+	}
+	ast.Walk(featureChecker{self}, program)
+}
+
+func (self *_parser) checkFeature(f Feature, offset int) {
+	switch {
+	case self.opts.disabledFeatures&(1<<f) != 0:
+		self.error(offset, "Disabled syntax: %s", f)
+	case self.opts.edition != 0 && f.Edition() > self.opts.edition:
+		self.error(offset, "Unsupported syntax in %s: %s (%s)", self.opts.edition, f, f.Edition())
+	}
+}
+
+func (v featureChecker) Visit(node ast.Node) ast.Visitor {
+	if node == nil {
+		return nil
+	}
+	checkAt := func(f Feature, idx file.Idx) {
+		v.p.checkFeature(f, int(idx)-v.p.base)
+	}
+	check := func(f Feature, n ast.Node) {
+		checkAt(f, n.Idx0())
+	}
+	switch n := node.(type) {
+	case *ast.LexicalDeclaration, *ast.ForDeclaration:
+		check(FeatureLexicalDeclarations, n)
+	case *ast.ArrowFunctionLiteral:
+		check(FeatureArrowFunctions, n)
+		if n.Async {
+			check(FeatureAsyncFunctions, n)
+		}
+	case *ast.ClassLiteral:
+		check(FeatureClasses, n)
+	case *ast.TemplateLiteral:
+		check(FeatureTemplateLiterals, n)
+	case *ast.ArrayPattern:
+		check(FeatureDestructuring, n)
+	case *ast.ObjectPattern:
+		check(FeatureDestructuring, n)
+		if n.Rest != nil {
+			check(FeatureObjectRestSpread, n.Rest)
+		}
+	case *ast.ParameterList:
+		for _, b := range n.List {
+			if b.Initializer != nil {
+				check(FeatureDefaultParameters, b.Initializer)
+			}
+		}
+		if n.Rest != nil {
+			check(FeatureRestParameters, n.Rest)
+		}
+		if n.TrailingComma != 0 {
+			checkAt(FeatureTrailingCommas, n.TrailingComma)
+		}
+	case *ast.ArrayLiteral:
+		for _, e := range n.Value {
+			if e, ok := e.(*ast.SpreadElement); ok {
+				check(FeatureSpread, e)
+			}
+		}
+	case *ast.CallExpression:
+		for _, e := range n.ArgumentList {
+			if e, ok := e.(*ast.SpreadElement); ok {
+				check(FeatureSpread, e)
+			}
+		}
+		if n.TrailingComma != 0 {
+			checkAt(FeatureTrailingCommas, n.TrailingComma)
+		}
+	case *ast.NewExpression:
+		for _, e := range n.ArgumentList {
+			if e, ok := e.(*ast.SpreadElement); ok {
+				check(FeatureSpread, e)
+			}
+		}
+		if n.TrailingComma != 0 {
+			checkAt(FeatureTrailingCommas, n.TrailingComma)
+		}
+	case *ast.ForOfStatement:
+		check(FeatureForOf, n)
+	case *ast.FunctionLiteral:
+		if n.Generator {
+			check(FeatureGenerators, n)
+		}
+		if n.Async {
+			check(FeatureAsyncFunctions, n)
+		}
+	case *ast.ObjectLiteral:
+		for _, p := range n.Value {
+			switch p := p.(type) {
+			case *ast.PropertyShort:
+				check(FeatureEnhancedObjectLiterals, p)
+			case *ast.PropertyKeyed:
+				if p.Kind == ast.PropertyKindMethod || p.Computed {
+					check(FeatureEnhancedObjectLiterals, p)
+				}
+			case *ast.SpreadElement:
+				check(FeatureObjectRestSpread, p)
+			}
+		}
+	case *ast.MetaProperty:
+		if n.Meta.Name == "new" {
+			check(FeatureNewTarget, n.Meta)
+		}
+	case *ast.NumberLiteral:
+		if len(n.Literal) > 1 && n.Literal[0] == '0' && strings.ContainsAny(n.Literal[1:2], "bBoO") {
+			check(FeatureBinaryOctalLiterals, n)
+		}
+		if _, ok := n.Value.(*big.Int); ok {
+			check(FeatureBigInt, n)
+		}
+		if strings.IndexByte(n.Literal, '_') >= 0 {
+			check(FeatureNumericSeparators, n)
+		}
+	case *ast.BinaryExpression:
+		switch n.Operator {
+		case token.EXPONENT:
+			checkAt(FeatureExponentiation, n.OperatorIdx)
+		case token.COALESCE:
+			checkAt(FeatureNullishCoalescing, n.OperatorIdx)
+		}
+	case *ast.AssignExpression:
+		switch n.Operator {
+		case token.EXPONENT:
+			checkAt(FeatureExponentiation, n.OperatorIdx)
+		case token.LOGICAL_AND, token.LOGICAL_OR, token.COALESCE:
+			checkAt(FeatureLogicalAssignment, n.OperatorIdx)
+		}
+	case *ast.CatchStatement:
+		if n.Parameter == nil {
+			check(FeatureOptionalCatchBinding, n)
+		}
+	case *ast.Optional:
+		checkAt(FeatureOptionalChaining, n.QuestionDot)
+	case *ast.FieldDefinition:
+		check(FeatureClassFields, n)
+	case *ast.PrivateIdentifier:
+		check(FeaturePrivateMembers, n)
+	case *ast.ClassStaticBlock:
+		check(FeatureClassStaticBlocks, n)
+	}
+	return v
+}
@@ -0,0 +1,77 @@
+package parser
+
+import (
+	"testing"
+)
+
+func TestFeatures(t *testing.T) {
+	tt(t, func() {
+		test := func(src, err string, options ...Option) {
+			t.Helper()
+			_, e := ParseFile(nil, "", src, 0, options...)
+			if err == "" {
+				is(e, nil)
+			} else {
+				is(e, "(anonymous): "+err)
+			}
+		}
+		es5 := WithEdition(ES5)
+
+		test("var a = [1, 2]; function f(x) { return x && x.y || {get z() { return 0 }} }", "", es5)
+		test("x => x", "Line 1:1 Unsupported syntax in ES5: arrow functions (ES2015)", es5)
+		test("var x; let y", "Line 1:8 Unsupported syntax in ES5: let and const declarations (ES2015)", es5)
+		test("for (const x in o);", "Line 1:6 Unsupported syntax in ES5: let and const declarations (ES2015)", es5)
+		test("for (var x of o);", "Line 1:1 Unsupported syntax in ES5: for-of loops (ES2015)", es5)
+		test("function f(a, b = 1) {}", "Line 1:19 Unsupported syntax in ES5: default parameters (ES2015)", es5)
+		test("function f(a, ...b) {}", "Line 1:18 Unsupported syntax in ES5: rest parameters (ES2015)", es5)
+		test("f(...a)", "Line 1:6 Unsupported syntax in ES5: spread syntax (ES2015)", es5)
+		test("var {a} = o", "Line 1:5 Unsupported syntax in ES5: destructuring (ES2015)", es5)
+		test("x = {a}", "Line 1:6 Unsupported syntax in ES5: shorthand properties, methods and computed keys (ES2015)", es5)
+		test("x = {[a]: 1}", "Line 1:7 Unsupported syntax in ES5: shorthand properties, methods and computed keys (ES2015)", es5)
+		test("x = `a${b}`", "Line 1:5 Unsupported syntax in ES5: template literals (ES2015)", es5)
+		test("x = 0b101", "Line 1:5 Unsupported syntax in ES5: binary and octal literals (ES2015)", es5)
+		test("function f() { new.target }", "Line 1:16 Unsupported syntax in ES5: new.target (ES2015)", es5)
+		test("function* g() {}", "Line 1:1 Unsupported syntax in ES5: generators (ES2015)", es5)
+
+		test("x = 2 ** 3", "Line 1:7 Unsupported syntax in ES2015: exponentiation operator (ES2016)", WithEdition(ES2015))
+		test("x **= 3", "Line 1:3 Unsupported syntax in ES2015: exponentiation operator (ES2016)", WithEdition(ES2015))
+		test("x = 2 ** 3", "", WithEdition(ES2016))
+		test("async function f() { await x }", "Line 1:1 Unsupported syntax in ES2016: async functions (ES2017)", WithEdition(ES2016))
+		test("x = async () => 1", "Line 1:5 Unsupported syntax in ES2016: async functions (ES2017)", WithEdition(ES2016))
+		test("function f(a, b,) {}", "Line 1:16 Unsupported syntax in ES2016: trailing commas in parameter and argument lists (ES2017)", WithEdition(ES2016))
+		test("x = (a,) => a", "Line 1:7 Unsupported syntax in ES2016: trailing commas in parameter and argument lists (ES2017)", WithEdition(ES2016))
+		test("f(a, b,)", "Line 1:7 Unsupported syntax in ES5: trailing commas in parameter and argument lists (ES2017)", es5)
+		test("new F(a,)", "Line 1:8 Unsupported syntax in ES5: trailing commas in parameter and argument lists (ES2017)", es5)
+		test("function f(a, b) {} f(a, b); new F(a)", "", es5)
+		test("function f(a,) {} f(a,)", "", WithEdition(ES2017))
+		test("x = {...a}", "Line 1:9 Unsupported syntax in ES2017: object rest and spread properties (ES2018)", WithEdition(ES2017))
+		test("try {} catch {}", "Line 1:8 Unsupported syntax in ES2018: optional catch binding (ES2019)", WithEdition(ES2018))
+		test("a ?. b", "Line 1:3 Unsupported syntax in ES2019: optional chaining (ES2020)", WithEdition(ES2019))
+		test("x = a.b ?? c", "Line 1:9 Unsupported syntax in ES2019: nullish coalescing operator (ES2020)", WithEdition(ES2019))
+		test("x = 1n", "Line 1:5 Unsupported syntax in ES2019: BigInt literals (ES2020)", WithEdition(ES2019))
+		test("x ??= 1", "Line 1:3 Unsupported syntax in ES2020: logical assignment operators (ES2021)", WithEdition(ES2020))
+		test("x = 1_000", "Line 1:5 Unsupported syntax in ES2020: numeric separators (ES2021)", WithEdition(ES2020))
+		test("class A { x = 1 }", "Line 1:11 Unsupported syntax in ES2021: class fields (ES2022)", WithEdition(ES2021))
+		test("class A { #m() { return #m in this } }", "Line 1:11 Unsupported syntax in ES2021: private class members (ES2022) (and 1 more errors)", WithEdition(ES2021))
+		test("class A { static {} }", "Line 1:11 Unsupported syntax in ES2021: class static blocks (ES2022)", WithEdition(ES2021))
+		test("#!/usr/bin/env goja\n1", "Line 1:1 Unsupported syntax in ES2022: hashbang comments (ES2023)", WithEdition(ES2022))
+		test("#!/usr/bin/env goja\nclass A { static #x = a?.b ?? 1n }", "", WithEdition(ES2023))
+
+		// all the errors are reported
+		test("let f = () => 1", "Line 1:1 Unsupported syntax in ES5: let and const declarations (ES2015) (and 1 more errors)", es5)
+
+		noClasses := WithoutFeatures(FeatureClasses, FeatureOptionalChaining)
+		test("x = class {}", "Line 1:5 Disabled syntax: classes", noClasses)
+		test("x = a.b?.[c]", "Line 1:8 Disabled syntax: optional chaining", noClasses)
+		test("x = a?.b", "Line 1:6 Disabled syntax: optional chaining", noClasses, WithEdition(ES2015))
+		test("x = 1n", "", WithoutFeatures(FeaturePrivateMembers))
+		test("x = 1n", "Line 1:5 Disabled syntax: BigInt literals", WithoutFeatures(FeatureBigInt))
+
+		_, err := ParseFunction("a, b = 1", "return a", WithEdition(ES5))
+		is(err, "(anonymous): Line 1:18 Unsupported syntax in ES5: default parameters (ES2015)")
+
+		is(FeatureOptionalChaining.Edition(), ES2020)
+		is(FeatureOptionalChaining.String(), "optional chaining")
+		is(ES2025.String(), "ES2025")
+	})
+}
@@ -0,0 +1,360 @@
+package parser
+
+import (
+	"html"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/file"
+	"github.com/dop251/goja/token"
+	"github.com/dop251/goja/unistring"
+)
+
+// The JSX text and the attribute strings are not JavaScript tokens, so they are scanned directly from the current
+// character. The parser keeps the lexer positioned right after the ">" of a tag (see jsxTagEnd) or the "}" of an
+// expression container when it reads the text which follows them.
+
+// parseJSXElement parses an element or a fragment starting at the current "<" up to its final ">", which is left as
+// the current token with the lexer positioned right after it.
+func (self *_parser) parseJSXElement() ast.Expression {
+	opening := self.idx
+	self.next()
+	if self.isJSXTagEnd() {
+		node := &ast.JSXFragment{
+			Opening: opening,
+		}
+		self.jsxTagEnd()
+		node.Children, node.Closing = self.parseJSXChildren(nil)
+		return node
+	}
+
+	node := &ast.JSXElement{
+		Opening: opening,
+		Name:    self.parseJSXElementName(),
+	}
+	if self.mode&TypeScript != 0 && self.token == token.LESS {
+		// <Component<T> ...>
+		self.skipTypeArguments()
+	}
+	for !self.isJSXTagEnd() && self.token != token.SLASH {
+		switch {
+		case self.token == token.LEFT_BRACE:
+			leftBrace := self.idx
+			self.next()
+			self.expect(token.ELLIPSIS)
+			argument := self.parseAssignmentExpression()
+			node.Attributes = append(node.Attributes, &ast.JSXSpreadAttribute{
+				LeftBrace:  leftBrace,
+				Argument:   argument,
+				RightBrace: self.expect(token.RIGHT_BRACE),
+			})
+		case token.IsId(self.token):
+			attr := &ast.JSXAttribute{
+				Name: self.parseJSXAttributeName(),
+			}
+			if self.token == token.ASSIGN {
+				attr.Value = self.parseJSXAttributeValue()
+			}
+			node.Attributes = append(node.Attributes, attr)
+		default:
+			self.errorUnexpectedToken(self.token)
+			node.Closing = self.idx
+			return node
+		}
+	}
+	if self.token == token.SLASH {
+		self.next()
+		node.SelfClosing = true
+		node.Closing = self.jsxTagEnd()
+		return node
+	}
+	self.jsxTagEnd()
+	node.Children, node.Closing = self.parseJSXChildren(node.Name)
+	return node
+}
+
+// parseJSXChildren parses the children of an element (or a fragment if name is nil) and its closing tag. It returns
+// the position of the final ">".
+func (self *_parser) parseJSXChildren(name ast.Expression) (children []ast.Expression, closing file.Idx) {
+	for {
+		if text := self.scanJSXText(); text != nil {
+			children = append(children, text)
+		}
+		self.next()
+		switch self.token {
+		case token.LEFT_BRACE:
+			leftBrace := self.idx
+			self.next()
+			if self.token == token.ELLIPSIS {
+				self.next()
+				children = append(children, &ast.JSXSpreadChild{
+					LeftBrace:  leftBrace,
+					Expression: self.parseAssignmentExpression(),
+					RightBrace: self.idx,
+				})
+			} else {
+				var expr ast.Expression
+				if self.token != token.RIGHT_BRACE {
+					expr = self.parseAssignmentExpression()
+				}
+				children = append(children, &ast.JSXExpressionContainer{
+					LeftBrace:  leftBrace,
+					Expression: expr,
+					RightBrace: self.idx,
+				})
+			}
+			if self.token != token.RIGHT_BRACE {
+				// the "}" is not consumed, the text continues right after it
+				self.errorUnexpectedToken(self.token)
+				return children, self.idx
+			}
+		case token.LESS:
+			if self.peek() != token.SLASH {
+				children = append(children, self.parseJSXElement())
+				if !self.isJSXTagEnd() {
+					return children, self.idx
+				}
+				continue
+			}
+			self.next()
+			self.next()
+			if name == nil {
+				return children, self.jsxTagEnd()
+			}
+			closingIdx := self.idx
+			if closingName := self.parseJSXElementName(); jsxNameString(closingName) != jsxNameString(name) {
+				self.error(closingIdx, "Expected corresponding JSX closing tag for <%s>", jsxNameString(name))
+			}
+			return children, self.jsxTagEnd()
+		default:
+			self.errorUnexpectedToken(self.token)
+			return children, self.idx
+		}
+	}
+}
+
+// scanJSXText scans the text up to the next "<" or "{" (or the end of the source). It returns nil if the text is
+// empty.
+func (self *_parser) scanJSXText() *ast.JSXText {
+	start := self.chrOffset
+	for self.chr != '<' && self.chr != '{' && self.chr != -1 {
+		self.read()
+	}
+	if self.chrOffset == start {
+		return nil
+	}
+	literal := self.str[start:self.chrOffset]
+	return &ast.JSXText{
+		Idx:     self.idxOf(start),
+		Literal: literal,
+		Value:   unistring.NewFromString(decodeJSXEntities(literal)),
+	}
+}
+
+// isJSXTagEnd reports whether the current token starts with the ">" ending a tag. The lexer may have combined it
+// with the text following it into a longer token, such as ">=".
+func (self *_parser) isJSXTagEnd() bool {
+	switch self.token {
+	case token.GREATER, token.GREATER_OR_EQUAL, token.SHIFT_RIGHT, token.SHIFT_RIGHT_ASSIGN,
+		token.UNSIGNED_SHIFT_RIGHT, token.UNSIGNED_SHIFT_RIGHT_ASSIGN:
+		return true
+	}
+	return false
+}
+
+// jsxTagEnd checks that the current token starts with the ">" ending a tag and positions the lexer right after it.
+// It returns the position of the ">".
+func (self *_parser) jsxTagEnd() file.Idx {
+	idx := self.idx
+	if !self.isJSXTagEnd() {
+		self.errorUnexpectedToken(self.token)
+		return idx
+	}
+	self.offset = int(idx) - self.base + 1
+	self.read()
+	return idx
+}
+
+// parseJSXIdentifier parses an identifier which, unlike a JavaScript one, may contain dashes (e.g. data-id).
+// The reserved words are allowed.
+func (self *_parser) parseJSXIdentifier() *ast.Identifier {
+	idx := self.idx
+	if !token.IsId(self.token) {
+		self.errorUnexpectedToken(self.token)
+		return &ast.Identifier{Idx: idx}
+	}
+	name := self.parsedLiteral
+	if self.chr == '-' {
+		for self.chr == '-' || isIdentifierPart(self.chr) {
+			self.read()
+		}
+		name = unistring.NewFromString(self.str[int(idx)-self.base : self.chrOffset])
+	}
+	self.next()
+	return &ast.Identifier{
+		Name: name,
+		Idx:  idx,
+	}
+}
+
+func (self *_parser) parseJSXAttributeName() ast.Expression {
+	id := self.parseJSXIdentifier()
+	if self.token == token.COLON {
+		self.next()
+		return &ast.JSXNamespacedName{
+			Namespace: id,
+			Name:      self.parseJSXIdentifier(),
+		}
+	}
+	return id
+}
+
+func (self *_parser) parseJSXElementName() ast.Expression {
+	id := self.parseJSXIdentifier()
+	if self.token == token.COLON {
+		self.next()
+		return &ast.JSXNamespacedName{
+			Namespace: id,
+			Name:      self.parseJSXIdentifier(),
+		}
+	}
+	var name ast.Expression = id
+	if id.Name == "this" {
+		name = &ast.ThisExpression{
+			Idx: id.Idx,
+		}
+	}
+	for self.token == token.PERIOD {
+		self.next()
+		if !token.IsId(self.token) {
+			self.errorUnexpectedToken(self.token)
+			break
+		}
+		name = &ast.DotExpression{
+			Left: name,
+			Identifier: ast.Identifier{
+				Name: self.parsedLiteral,
+				Idx:  self.idx,
+			},
+		}
+		self.next()
+	}
+	return name
+}
+
+// parseJSXAttributeValue parses the value following the current "=". The strings are scanned as is, without
+// the escape sequences, so the scanning starts right after the "=".
+func (self *_parser) parseJSXAttributeValue() ast.Expression {
+	for isLineWhiteSpace(self.chr) || isLineTerminator(self.chr) {
+		self.read()
+	}
+	if quote := self.chr; quote == '"' || quote == '\'' {
+		start := self.chrOffset
+		self.read()
+		for self.chr != quote {
+			if self.chr == -1 {
+				self.error(start, "Unterminated string literal")
+				break
+			}
+			self.read()
+		}
+		self.read()
+		literal := self.str[start:self.chrOffset]
+		self.next()
+		value := ""
+		if len(literal) >= 2 && literal[len(literal)-1] == byte(quote) {
+			value = decodeJSXEntities(literal[1 : len(literal)-1])
+		}
+		return &ast.StringLiteral{
+			Idx:     self.idxOf(start),
+			Literal: literal,
+			Value:   unistring.NewFromString(value),
+		}
+	}
+
+	self.next()
+	switch self.token {
+	case token.LEFT_BRACE:
+		leftBrace := self.idx
+		self.next()
+		if self.token == token.RIGHT_BRACE {
+			self.error(leftBrace, "JSX attributes must only be assigned a non-empty expression")
+			self.next()
+			return &ast.BadExpression{From: leftBrace, To: leftBrace + 2}
+		}
+		expr := self.parseAssignmentExpression()
+		return &ast.JSXExpressionContainer{
+			LeftBrace:  leftBrace,
+			Expression: expr,
+			RightBrace: self.expect(token.RIGHT_BRACE),
+		}
+	case token.LESS:
+		node := self.parseJSXElement()
+		if self.isJSXTagEnd() {
+			self.next()
+		}
+		return node
+	}
+	idx := self.idx
+	self.errorUnexpectedToken(self.token)
+	return &ast.BadExpression{From: idx, To: idx}
+}
+
+// isJSXTypeParameters reports whether the current "<" starts the type parameters of a generic arrow function
+// rather than a JSX element in the TypeScript JSX mode. Like TypeScript, only <T,> and <T extends U> are
+// the type parameters.
+func (self *_parser) isJSXTypeParameters() bool {
+	var state parserState
+	self.mark(&state)
+	defer self.restore(&state)
+	self.next()
+	if !token.IsId(self.token) {
+		return false
+	}
+	self.next()
+	return self.token == token.COMMA || self.token == token.EXTENDS
+}
+
+func jsxNameString(name ast.Expression) string {
+	switch n := name.(type) {
+	case *ast.Identifier:
+		return n.Name.String()
+	case *ast.ThisExpression:
+		return "this"
+	case *ast.DotExpression:
+		return jsxNameString(n.Left) + "." + n.Identifier.Name.String()
+	case *ast.JSXNamespacedName:
+		return n.Namespace.Name.String() + ":" + n.Name.Name.String()
+	}
+	return ""
+}
+
+// decodeJSXEntities decodes the HTML character references terminated by a semicolon, such as &amp; or &#x20;.
+func decodeJSXEntities(s string) string {
+	if strings.IndexByte(s, '&') < 0 {
+		return s
+	}
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(s, '&')
+		if i < 0 {
+			break
+		}
+		b.WriteString(s[:i])
+		s = s[i:]
+		if j := strings.IndexByte(s, ';'); j > 1 && j <= 32 {
+			// html.UnescapeString also accepts a prefix of a reference which is a legacy entity (&ampx; is "&x;"),
+			// but a reference decoded as a whole is at most two characters long
+			if r := html.UnescapeString(s[:j+1]); r != s[:j+1] && utf8.RuneCountInString(r) <= 2 {
+				b.WriteString(r)
+				s = s[j+1:]
+				continue
+			}
+		}
+		b.WriteByte('&')
+		s = s[1:]
+	}
+	b.WriteString(s)
+	return b.String()
+}
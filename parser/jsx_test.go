@@ -0,0 +1,79 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/file"
+)
+
+func TestJSX(t *testing.T) {
+	tt(t, func() {
+		parse := func(src string, mode Mode) ast.Expression {
+			prg, err := ParseFile(nil, "", src, JSX|mode)
+			is(err, nil)
+			return prg.Body[0].(*ast.ExpressionStatement).Expression
+		}
+
+		el := parse(`<a-b c="x&amp;y\n" d {...e} f:g={1}>t &lt;{h}{/* c */}<i/>{...j}</a-b>`, 0).(*ast.JSXElement)
+		is(el.Name.(*ast.Identifier).Name, "a-b")
+		is(el.IsIntrinsic(), true)
+		is(el.Idx0(), file.Idx(1))
+		is(el.Idx1(), file.Idx(71))
+		is(len(el.Attributes), 4)
+		c := el.Attributes[0].(*ast.JSXAttribute)
+		is(c.Value.(*ast.StringLiteral).Literal, `"x&amp;y\n"`)
+		is(c.Value.(*ast.StringLiteral).Value, `x&y\n`)
+		is(el.Attributes[1].(*ast.JSXAttribute).Value, nil)
+		is(el.Attributes[2].(*ast.JSXSpreadAttribute).Argument.(*ast.Identifier).Name, "e")
+		fg := el.Attributes[3].(*ast.JSXAttribute)
+		is(fg.Name.(*ast.JSXNamespacedName).Name.Name, "g")
+		is(fg.Value.(*ast.JSXExpressionContainer).Expression.(*ast.NumberLiteral).Value, int64(1))
+		is(len(el.Children), 5)
+		text := el.Children[0].(*ast.JSXText)
+		is(text.Literal, "t &lt;")
+		is(text.Value, "t <")
+		is(el.Children[1].(*ast.JSXExpressionContainer).Expression.(*ast.Identifier).Name, "h")
+		is(el.Children[2].(*ast.JSXExpressionContainer).Expression, nil)
+		is(el.Children[3].(*ast.JSXElement).SelfClosing, true)
+		is(el.Children[4].(*ast.JSXSpreadChild).Expression.(*ast.Identifier).Name, "j")
+
+		// the ">" of a tag followed by the text which the lexer would combine with it
+		frag := parse("<>>=<this.A.B/></>", 0).(*ast.JSXFragment)
+		is(frag.Children[0].(*ast.JSXText).Literal, ">=")
+		name := frag.Children[1].(*ast.JSXElement).Name.(*ast.DotExpression)
+		is(name.Identifier.Name, "B")
+		_, ok := name.Left.(*ast.DotExpression).Left.(*ast.ThisExpression)
+		is(ok, true)
+		is(frag.Children[1].(*ast.JSXElement).IsIntrinsic(), false)
+
+		// a line break after an element ends the statement
+		prg, err := ParseFile(nil, "", "x = <a></a>\nf()", JSX)
+		is(err, nil)
+		is(len(prg.Body), 2)
+
+		// in TSX the type parameters of an arrow function need a comma or a constraint
+		_, ok = parse("<T,>(x: T) => x", TypeScript).(*ast.ArrowFunctionLiteral)
+		is(ok, true)
+		_, ok = parse("<T extends {}>(x: T) => x", TypeScript).(*ast.ArrowFunctionLiteral)
+		is(ok, true)
+		_, ok = parse("<T>(x) => x</T>", TypeScript).(*ast.JSXElement)
+		is(ok, true)
+		is(len(parse(`<A<string> b="c" />`, TypeScript).(*ast.JSXElement).Attributes), 1)
+
+		for _, test := range []struct {
+			src, err string
+		}{
+			{"<a></b>", "(anonymous): Line 1:6 Expected corresponding JSX closing tag for <a>"},
+			{"<a.b></a>", "(anonymous): Line 1:8 Expected corresponding JSX closing tag for <a.b>"},
+			{"<a b={}/>", "(anonymous): Line 1:6 JSX attributes must only be assigned a non-empty expression"},
+			{"<a>", "(anonymous): Line 1:4 Unexpected end of input"},
+			{`<a b="c/>`, "(anonymous): Line 1:6 Unterminated string literal (and 1 more errors)"},
+		} {
+			_, err := ParseFile(nil, "", test.src, JSX)
+			is(err, test.err)
+		}
+		_, err = ParseFile(nil, "", "<a/>", 0)
+		is(err, "(anonymous): Line 1:1 Unexpected token <")
+	})
+}
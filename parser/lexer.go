@@ -367,12 +367,14 @@ func (self *_parser) scan() (tkn token.Token, literal string, parsedLiteral unis
 			case '/':
 				if self.chr == '/' {
 					self.skipSingleLineComment()
+					self.recordComment(idx)
 					continue
 				} else if self.chr == '*' {
 					if self.skipMultiLineComment() {
 						self.insertSemicolon = false
 						self.implicitSemicolon = true
 					}
+					self.recordComment(idx)
 					continue
 				} else {
 					// Could be division, could be RegExp literal
@@ -442,6 +444,7 @@ func (self *_parser) scan() (tkn token.Token, literal string, parsedLiteral unis
 			case '#':
 				if self.chrOffset == 1 && self.chr == '!' {
 					self.skipSingleLineComment()
+					self.recordComment(idx)
 					continue
 				}
 
@@ -49,15 +49,21 @@ type Mode uint
 
 const (
 	IgnoreRegExpErrors Mode = 1 << iota // Ignore RegExp compatibility errors (allow backtracking)
+	ParseComments                       // Record the comments in ast.Program and attach them to the nodes
+	ErrorRecovery                       // Recover from syntax errors at the statement and the bracket boundaries, report each error once
+	TypeScript                          // Accept the erasable TypeScript syntax (type annotations, interfaces, etc.) and drop it
+	JSX                                 // Accept the JSX elements and fragments (see package jsx for transforming them)
 )
 
 type options struct {
 	disableSourceMaps bool
 	sourceMapLoader   func(path string) ([]byte, error)
+	edition           Edition
+	disabledFeatures  uint64
 }
 
 // Option represents one of the options for the parser to use in the Parse methods. Currently supported are:
-// WithDisableSourceMaps and WithSourceMapLoader.
+// WithDisableSourceMaps, WithSourceMapLoader, WithEdition and WithoutFeatures.
 type Option func(*options)
 
 // WithDisableSourceMaps is an option to disable source maps support. May save a bit of time when source maps
@@ -95,17 +101,23 @@ type _parser struct {
 	insertSemicolon   bool // If we see a newline, then insert an implicit semicolon
 	implicitSemicolon bool // An implicit semicolon exists
 
+	consequent bool // The next assignment expression is the consequent of a conditional expression
+
 	errors ErrorList
 
 	recover struct {
 		// Scratch when trying to seek to the next statement, etc.
 		idx   file.Idx
 		count int
+		// The last position where expect has left an unexpected token in place (in the ErrorRecovery mode)
+		expectIdx file.Idx
 	}
 
 	mode Mode
 	opts options
 
+	comments []*ast.Comment // Only recorded in the ParseComments mode
+
 	file *file.File
 }
 
@@ -162,6 +174,23 @@ func ReadSource(filename string, src interface{}) ([]byte, error) {
 //
 //	// Parse some JavaScript, yielding a *ast.Program and/or an ErrorList
 //	program, err := parser.ParseFile(nil, "", `if (abc > 1) {}`, 0)
+//
+// In the ErrorRecovery mode the parser skips the erroneous parts of the source up to the end of the statement or
+// the enclosing bracket, substituting them with ast.BadExpression and ast.BadStatement nodes, and continues parsing.
+// The returned program is then usable even if there were syntax errors, and the ErrorList contains all the errors
+// (each one once).
+//
+// In the TypeScript mode the parser accepts the TypeScript syntax which can be erased without changing the runtime
+// semantics: the type annotations, the type parameters and arguments, the as and satisfies expressions, the non-null
+// assertions, the interfaces, the type aliases, the ambient (declare) declarations, the overload signatures, the
+// abstract members and the modifiers of the class members. The resulting program is the same as the one parsed from
+// the source with this syntax replaced by whitespace. The enums, the namespaces and the parameter properties have
+// runtime semantics and are reported as errors.
+//
+// In the JSX mode the parser accepts the JSX elements and fragments as primary expressions, producing ast.JSXElement
+// and ast.JSXFragment nodes. Such a program cannot be compiled as is, it must be transformed first, e.g. with
+// jsx.Transform. In the combined TypeScript and JSX mode (i.e. TSX) the type assertions in the <T>x form are not
+// available and the type parameters of a generic arrow function must be written as <T,> or <T extends U>.
 func ParseFile(fileSet *file.FileSet, filename string, src interface{}, mode Mode, options ...Option) (*ast.Program, error) {
 	str, err := ReadSource(filename, src)
 	if err != nil {
@@ -213,6 +242,7 @@ func (self *_parser) parse() (*ast.Program, error) {
 	defer self.closeScope()
 	self.next()
 	program := self.parseProgram()
+	self.checkFeatures(program)
 	if false {
 		self.errors.Sort()
 	}
@@ -258,6 +288,12 @@ func (self *_parser) expect(value token.Token) file.Idx {
 	idx := self.idx
 	if self.token != value {
 		self.errorUnexpectedToken(self.token)
+		if self.mode&ErrorRecovery != 0 && self.idx != self.recover.expectIdx && self.atBoundary() {
+			// Leave the token for the enclosing construct. If no progress is made by the next call, the token
+			// is consumed to avoid an endless loop.
+			self.recover.expectIdx = self.idx
+			return idx
+		}
 	}
 	self.next()
 	return idx
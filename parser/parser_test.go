@@ -1353,3 +1353,56 @@ func TestParseTemplateLiteralWithTail(t *testing.T) {
 		t.Fatal(prg.Body[0])
 	}
 }
+
+func TestErrorRecovery(t *testing.T) {
+	tt(t, func() {
+		const src = "a = ;\nb = 1;\nfunction f() { x = ; return x }\n}\nlet c = 1 +\nd(e, ;\nlast()"
+		prg, err := ParseFile(nil, "", src, ErrorRecovery)
+		list, ok := err.(ErrorList)
+		is(ok, true)
+		is(len(list), 4)
+		is(list[0].Error(), "(anonymous): Line 1:5 Unexpected token ;")
+		is(list[0].End.Column, 6)
+		is(list[1].Position.Line, 3)
+		is(list[2].Error(), "(anonymous): Line 4:1 Unexpected token }")
+		is(list[3].Position.Line, 6)
+
+		is(len(prg.Body), 6)
+		is(prg.Body[0].(*ast.ExpressionStatement).Expression.(*ast.AssignExpression).Right.(*ast.BadExpression).From, 5)
+		is(prg.Body[1].(*ast.ExpressionStatement).Expression.(*ast.AssignExpression).Left.(*ast.Identifier).Name, "b")
+		body := prg.Body[2].(*ast.FunctionDeclaration).Function.Body.List
+		is(len(body), 2)
+		_, ok = body[1].(*ast.ReturnStatement)
+		is(ok, true)
+		_, ok = prg.Body[3].(*ast.BadStatement)
+		is(ok, true)
+		_, ok = prg.Body[4].(*ast.LexicalDeclaration)
+		is(ok, true)
+		is(prg.Body[5].(*ast.ExpressionStatement).Expression.(*ast.CallExpression).Callee.(*ast.Identifier).Name, "last")
+
+		// without the mode the parsing does not stop at the line boundaries
+		prg, err = ParseFile(nil, "", src, 0)
+		is(err != nil, true)
+		is(len(prg.Body) < 6, true)
+	})
+
+	tt(t, func() {
+		// the recovery terminates and does not panic on arbitrarily broken input
+		const src = "var a = [1, , ...b], {c, d: [e] = f} = g;\nclass C extends D { #p = 1; static { this.x = `${a}` } m(x = 1, ...y) { return (a, b) => ({a}) } }\n" +
+			"for (let i = 0; i < 1; i++) { if (a) { b() } else switch (c) { case 1: break; default: } }\nx?.y?.[z]?.(1); try {} catch ({m}) {} finally {}\n"
+		for i := 0; i <= len(src); i++ {
+			for _, ins := range []string{"", "(", ")", "{", "}", "[", "]", ";", "=", "=>", "`", "/", "class ", "async "} {
+				s := src[:i] + ins
+				if i < len(src) {
+					if ins == "" {
+						s += src[i+1:]
+					} else {
+						s += src[i:]
+					}
+				}
+				prg, _ := ParseFile(nil, "", s, ErrorRecovery)
+				is(prg != nil, true)
+			}
+		}
+	})
+}
@@ -28,6 +28,9 @@ func (self *_parser) parseEmptyStatement() ast.Statement {
 
 func (self *_parser) parseStatementList() (list []ast.Statement) {
 	for self.token != token.RIGHT_BRACE && self.token != token.EOF {
+		if self.mode&TypeScript != 0 && self.skipTypeDeclaration() {
+			continue
+		}
 		self.scope.allowLet = true
 		list = append(list, self.parseStatement())
 	}
@@ -43,6 +46,14 @@ func (self *_parser) parseStatement() ast.Statement {
 	}
 
 	switch self.token {
+	case token.RIGHT_BRACE, token.RIGHT_PARENTHESIS, token.RIGHT_BRACKET:
+		if self.mode&ErrorRecovery != 0 {
+			// an unbalanced closing bracket, skip it
+			idx := self.idx
+			self.errorUnexpectedToken(self.token)
+			self.next()
+			return &ast.BadStatement{From: idx, To: idx + 1}
+		}
 	case token.SEMICOLON:
 		return self.parseEmptyStatement()
 	case token.LEFT_BRACE:
@@ -87,6 +98,15 @@ func (self *_parser) parseStatement() ast.Statement {
 		return &ast.ClassDeclaration{
 			Class: self.parseClass(true),
 		}
+	case token.IDENTIFIER:
+		if self.mode&TypeScript != 0 && self.literal == "abstract" {
+			if tkn, _, sameLine := self.lookahead(); tkn == token.CLASS && sameLine {
+				self.next()
+				return &ast.ClassDeclaration{
+					Class: self.parseClass(true),
+				}
+			}
+		}
 	case token.SWITCH:
 		return self.parseSwitchStatement()
 	case token.RETURN:
@@ -141,6 +161,9 @@ func (self *_parser) parseTryStatement() ast.Statement {
 		if self.token == token.LEFT_PARENTHESIS {
 			self.next()
 			parameter = self.parseBindingTarget()
+			if self.mode&TypeScript != 0 {
+				self.skipTypeAnnotation()
+			}
 			self.expect(token.RIGHT_PARENTHESIS)
 		}
 		node.Catch = &ast.CatchStatement{
@@ -167,6 +190,7 @@ func (self *_parser) parseFunctionParameterList() *ast.ParameterList {
 	opening := self.expect(token.LEFT_PARENTHESIS)
 	var list []*ast.Binding
 	var rest ast.Expression
+	var trailingComma file.Idx
 	if !self.scope.inFuncParams {
 		self.scope.inFuncParams = true
 		defer func() {
@@ -174,23 +198,43 @@ func (self *_parser) parseFunctionParameterList() *ast.ParameterList {
 		}()
 	}
 	for self.token != token.RIGHT_PARENTHESIS && self.token != token.EOF {
+		if self.mode&TypeScript != 0 {
+			if self.token == token.THIS && len(list) == 0 {
+				// the type of this: function f(this: T, ...)
+				if tkn, _, _ := self.lookahead(); tkn == token.COLON {
+					self.next()
+					self.skipTypeAnnotation()
+					if self.token != token.RIGHT_PARENTHESIS {
+						self.expect(token.COMMA)
+					}
+					continue
+				}
+			}
+			self.checkParameterProperty()
+		}
 		if self.token == token.ELLIPSIS {
+			trailingComma = 0
 			self.next()
 			rest = self.reinterpretAsDestructBindingTarget(self.parseAssignmentExpression())
+			if self.mode&TypeScript != 0 {
+				self.skipTypeAnnotation()
+			}
 			break
 		}
 		self.parseVariableDeclaration(&list)
+		trailingComma = 0
 		if self.token != token.RIGHT_PARENTHESIS {
-			self.expect(token.COMMA)
+			trailingComma = self.expect(token.COMMA)
 		}
 	}
 	closing := self.expect(token.RIGHT_PARENTHESIS)
 
 	return &ast.ParameterList{
-		Opening: opening,
-		List:    list,
-		Rest:    rest,
-		Closing: closing,
+		Opening:       opening,
+		List:          list,
+		Rest:          rest,
+		TrailingComma: trailingComma,
+		Closing:       closing,
 	}
 }
 
@@ -240,6 +284,9 @@ func (self *_parser) parseFunction(declaration, async bool, start file.Idx) *ast
 		self.expect(token.IDENTIFIER)
 	}
 	node.Name = name
+	if self.mode&TypeScript != 0 && self.token == token.LESS {
+		self.skipTypeParameters()
+	}
 
 	if declaration {
 		if async != self.scope.allowAwait {
@@ -257,6 +304,9 @@ func (self *_parser) parseFunction(declaration, async bool, start file.Idx) *ast
 	}
 
 	node.ParameterList = self.parseFunctionParameterList()
+	if self.mode&TypeScript != 0 {
+		self.skipTypeAnnotation()
+	}
 	node.Body, node.DeclarationList = self.parseFunctionBlock(async, async, self.scope.allowYield)
 	node.Source = self.slice(node.Idx0(), node.Idx1())
 
@@ -317,11 +367,17 @@ func (self *_parser) parseClass(declaration bool) *ast.ClassLiteral {
 	}
 
 	node.Name = name
+	if self.mode&TypeScript != 0 && self.token == token.LESS {
+		self.skipTypeParameters()
+	}
 
-	if self.token != token.LEFT_BRACE {
+	if self.token != token.LEFT_BRACE && (self.mode&TypeScript == 0 || self.literal != "implements") {
 		self.expect(token.EXTENDS)
 		node.SuperClass = self.parseLeftHandSideExpressionAllowCall()
 	}
+	if self.mode&TypeScript != 0 {
+		self.skipHeritageTypes()
+	}
 
 	self.expect(token.LEFT_BRACE)
 
@@ -330,6 +386,10 @@ func (self *_parser) parseClass(declaration bool) *ast.ClassLiteral {
 			self.next()
 			continue
 		}
+		drop := false
+		if self.mode&TypeScript != 0 {
+			drop = self.skipClassMemberModifiers()
+		}
 		start := self.idx
 		static := false
 		if self.token == token.STATIC {
@@ -350,6 +410,14 @@ func (self *_parser) parseClass(declaration bool) *ast.ClassLiteral {
 				static = true
 			}
 		}
+		if self.mode&TypeScript != 0 {
+			if self.skipClassMemberModifiers() {
+				drop = true
+			}
+			if self.skipIndexSignature() {
+				continue
+			}
+		}
 
 		var kind ast.PropertyKind
 		var async bool
@@ -388,7 +456,12 @@ func (self *_parser) parseClass(declaration bool) *ast.ClassLiteral {
 			self.error(value.Idx0(), "Classes may not have a static property named 'prototype'")
 		}
 
-		if kind == "" && self.token == token.LEFT_PARENTHESIS {
+		if self.mode&TypeScript != 0 && (self.token == token.QUESTION_MARK || self.token == token.NOT && kind == "") {
+			// an optional member or a definite assignment assertion
+			self.next()
+		}
+
+		if kind == "" && (self.token == token.LEFT_PARENTHESIS || self.token == token.LESS && self.mode&TypeScript != 0) {
 			kind = ast.PropertyKindMethod
 		}
 
@@ -407,11 +480,22 @@ func (self *_parser) parseClass(declaration bool) *ast.ClassLiteral {
 					self.error(value.Idx0(), "Class constructor may not be a private method")
 				}
 			}
+			fn := self.parseMethodParameters(methodBodyStart, kind, generator, async)
+			if self.mode&TypeScript != 0 && self.token != token.LEFT_BRACE {
+				// an overload signature or an abstract method
+				if self.token == token.SEMICOLON {
+					self.next()
+				} else if !self.implicitSemicolon && self.token != token.RIGHT_BRACE {
+					self.errorUnexpectedToken(self.token)
+				}
+				continue
+			}
+			self.parseMethodBody(fn)
 			md := &ast.MethodDefinition{
 				Idx:      start,
 				Key:      value,
 				Kind:     kind,
-				Body:     self.parseMethodDefinition(methodBodyStart, kind, generator, async),
+				Body:     fn,
 				Static:   static,
 				Computed: computed,
 			}
@@ -427,6 +511,9 @@ func (self *_parser) parseClass(declaration bool) *ast.ClassLiteral {
 			if isCtor {
 				self.error(value.Idx0(), "Classes may not have a field named 'constructor'")
 			}
+			if self.mode&TypeScript != 0 {
+				self.skipTypeAnnotation()
+			}
 			var initializer ast.Expression
 			if self.token == token.ASSIGN {
 				self.next()
@@ -437,6 +524,10 @@ func (self *_parser) parseClass(declaration bool) *ast.ClassLiteral {
 				self.errorUnexpectedToken(self.token)
 				break
 			}
+			if drop {
+				// an ambient or an abstract field
+				continue
+			}
 			node.Body = append(node.Body, &ast.FieldDefinition{
 				Idx:         start,
 				Key:         value,
@@ -571,7 +662,7 @@ func (self *_parser) parseCaseStatement() *ast.CaseStatement {
 		self.expect(token.CASE)
 		node.Test = self.parseExpression()
 	}
-	self.expect(token.COLON)
+	node.Colon = self.expect(token.COLON)
 
 	for {
 		if self.token == token.EOF ||
@@ -580,6 +671,9 @@ func (self *_parser) parseCaseStatement() *ast.CaseStatement {
 			self.token == token.DEFAULT {
 			break
 		}
+		if self.mode&TypeScript != 0 && self.skipTypeDeclaration() {
+			continue
+		}
 		self.scope.allowLet = true
 		node.Consequent = append(node.Consequent, self.parseStatement())
 
@@ -851,9 +945,10 @@ func (self *_parser) parseWhileStatement() ast.Statement {
 }
 
 func (self *_parser) parseIfStatement() ast.Statement {
-	self.expect(token.IF)
+	idx := self.expect(token.IF)
 	self.expect(token.LEFT_PARENTHESIS)
 	node := &ast.IfStatement{
+		If:   idx,
 		Test: self.parseExpression(),
 	}
 	self.expect(token.RIGHT_PARENTHESIS)
@@ -876,6 +971,9 @@ func (self *_parser) parseIfStatement() ast.Statement {
 
 func (self *_parser) parseSourceElements() (body []ast.Statement) {
 	for self.token != token.EOF {
+		if self.mode&TypeScript != 0 && self.skipTypeDeclaration() {
+			continue
+		}
 		self.scope.allowLet = true
 		body = append(body, self.parseStatement())
 	}
@@ -890,6 +988,9 @@ func (self *_parser) parseProgram() *ast.Program {
 		File:            self.file,
 	}
 	self.file.SetSourceMap(self.parseSourceMap())
+	if self.mode&ParseComments != 0 {
+		self.attachComments(prg)
+	}
 	return prg
 }
 
@@ -1045,6 +1146,10 @@ illegal:
 
 // Find the next statement after an error (recover)
 func (self *_parser) nextStatement() {
+	if self.mode&ErrorRecovery != 0 {
+		self.synchronize()
+		return
+	}
 	for {
 		switch self.token {
 		case token.BREAK, token.CONTINUE,
@@ -1075,3 +1180,46 @@ func (self *_parser) nextStatement() {
 		self.next()
 	}
 }
+
+// atBoundary reports whether the current token ends a statement or closes a bracket, or starts a new line after
+// a complete statement (i.e. where a semicolon would be inserted automatically).
+func (self *_parser) atBoundary() bool {
+	switch self.token {
+	case token.SEMICOLON, token.RIGHT_BRACE, token.RIGHT_PARENTHESIS, token.RIGHT_BRACKET, token.EOF:
+		return true
+	}
+	return self.implicitSemicolon
+}
+
+// synchronize is the ErrorRecovery mode version of nextStatement. It skips the tokens up to the end of the current
+// statement: up to a semicolon, an unbalanced closing bracket or a new line where a semicolon would be inserted
+// automatically, but never beyond the end of the enclosing block. The terminating token is not consumed.
+func (self *_parser) synchronize() {
+	depth := 0
+	for {
+		if depth == 0 && self.atBoundary() {
+			// Return only if the parser made some progress since the last sync or if it has not reached
+			// 10 calls without progress. Otherwise consume at least one token to avoid an endless loop.
+			if self.idx > self.recover.idx {
+				self.recover.idx = self.idx
+				self.recover.count = 0
+				return
+			}
+			if self.recover.count < 10 {
+				self.recover.count++
+				return
+			}
+		}
+		switch self.token {
+		case token.EOF:
+			return
+		case token.LEFT_PARENTHESIS, token.LEFT_BRACKET, token.LEFT_BRACE:
+			depth++
+		case token.RIGHT_PARENTHESIS, token.RIGHT_BRACKET, token.RIGHT_BRACE:
+			if depth > 0 {
+				depth--
+			}
+		}
+		self.next()
+	}
+}
@@ -0,0 +1,664 @@
+package parser
+
+import (
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/file"
+	"github.com/dop251/goja/token"
+)
+
+// The TypeScript mode accepts the erasable TypeScript syntax. The types are never represented in the AST: they are
+// skipped at the token level, so the resulting program is the same as the one produced from the source with the
+// types replaced by whitespace (the positions of the nodes refer to the original source).
+
+// speculate runs f and keeps its effect if it returns true and there were no errors, otherwise the parser is
+// returned to where it was. The ErrorRecovery mode is off while f runs, so that f fails at the first error.
+func (self *_parser) speculate(f func() bool) bool {
+	var state parserState
+	self.mark(&state)
+	mode := self.mode
+	self.mode &^= ErrorRecovery
+	ok := f() && len(self.errors) == state.errorCount
+	self.mode = mode
+	if !ok {
+		self.restore(&state)
+	}
+	return ok
+}
+
+// lookahead returns the token following the current one, its literal and whether it is on the same line.
+func (self *_parser) lookahead() (tkn token.Token, literal string, sameLine bool) {
+	var state parserState
+	self.mark(&state)
+	self.next()
+	tkn, literal, sameLine = self.token, self.literal, !self.implicitSemicolon
+	self.restore(&state)
+	return
+}
+
+// skipTypeAnnotation skips a type annotation (: Type) if there is one.
+func (self *_parser) skipTypeAnnotation() {
+	if self.token == token.COLON {
+		self.next()
+		self.skipType()
+	}
+}
+
+// skipBindingType skips the type annotation of a variable or a parameter and the definite assignment assertion (!)
+// or the optional parameter mark (?) which may precede it.
+func (self *_parser) skipBindingType(target ast.BindingTarget) {
+	if _, ok := target.(*ast.Identifier); ok && self.token == token.NOT || self.token == token.QUESTION_MARK && self.scope.inFuncParams {
+		self.next()
+	}
+	self.skipTypeAnnotation()
+}
+
+func (self *_parser) skipType() {
+	self.skipUnionType()
+	if self.token == token.EXTENDS && !self.implicitSemicolon {
+		// A conditional type: T extends U ? X : Y
+		self.next()
+		self.skipUnionType()
+		self.expect(token.QUESTION_MARK)
+		self.skipType()
+		self.expect(token.COLON)
+		self.skipType()
+	}
+}
+
+func (self *_parser) skipUnionType() {
+	if self.token == token.OR || self.token == token.AND {
+		self.next()
+	}
+	for {
+		self.skipTypeOperand()
+		if self.token != token.OR && self.token != token.AND {
+			return
+		}
+		self.next()
+	}
+}
+
+func (self *_parser) skipTypeOperand() {
+	if self.token == token.IDENTIFIER {
+		switch self.literal {
+		case "keyof", "unique", "readonly", "asserts":
+			if tkn, _, sameLine := self.lookahead(); sameLine && startsType(tkn) {
+				self.next()
+				self.skipTypeOperand()
+				return
+			}
+		case "infer":
+			if tkn, _, _ := self.lookahead(); token.IsId(tkn) {
+				self.next()
+				self.next()
+				if self.token == token.EXTENDS {
+					// A constraint, unless it's the extends clause of a conditional type
+					self.speculate(func() bool {
+						self.next()
+						self.skipUnionType()
+						return self.token != token.QUESTION_MARK
+					})
+				}
+				return
+			}
+		case "abstract":
+			if tkn, _, _ := self.lookahead(); tkn == token.NEW {
+				self.next()
+			}
+		}
+	}
+	self.skipPrimaryType()
+	for self.token == token.LEFT_BRACKET && !self.implicitSemicolon {
+		// T[] or T[K]
+		self.skipBalanced()
+	}
+	if self.token == token.IDENTIFIER && self.literal == "is" && !self.implicitSemicolon {
+		// A type predicate: x is T
+		self.next()
+		self.skipType()
+	}
+}
+
+func startsType(tkn token.Token) bool {
+	switch tkn {
+	case token.LEFT_PARENTHESIS, token.LEFT_BRACKET, token.LEFT_BRACE, token.LESS, token.STRING, token.NUMBER,
+		token.BOOLEAN, token.NULL, token.MINUS, token.BACKTICK:
+		return true
+	}
+	return token.IsId(tkn)
+}
+
+func (self *_parser) skipPrimaryType() {
+	switch self.token {
+	case token.LEFT_PARENTHESIS:
+		// A parenthesised type or the parameters of a function type
+		self.skipBalanced()
+		if self.token == token.ARROW {
+			self.next()
+			self.skipType()
+		}
+	case token.LESS:
+		self.skipFunctionType()
+	case token.NEW:
+		self.next()
+		self.skipFunctionType()
+	case token.LEFT_BRACE, token.LEFT_BRACKET:
+		// An object type or a tuple type
+		self.skipBalanced()
+	case token.BACKTICK:
+		self.skipTemplateLiteralType()
+	case token.TYPEOF:
+		self.next()
+		self.skipTypeReference()
+	case token.MINUS:
+		self.next()
+		if self.token != token.NUMBER {
+			self.errorUnexpectedToken(self.token)
+			return
+		}
+		self.insertSemicolon = true
+		self.next()
+	case token.STRING, token.NUMBER, token.BOOLEAN, token.NULL, token.THIS:
+		self.next()
+	default:
+		if !token.IsId(self.token) {
+			self.errorUnexpectedToken(self.token)
+			return
+		}
+		self.skipTypeReference()
+	}
+}
+
+// skipTypeReference skips a possibly qualified type name with optional type arguments (or an import type).
+func (self *_parser) skipTypeReference() {
+	if self.token == token.KEYWORD && self.literal == "import" {
+		self.next()
+		if self.token == token.LEFT_PARENTHESIS {
+			self.skipBalanced()
+		}
+	} else {
+		// Unlike the identifiers, the keywords (e.g. void) do not allow a line break to terminate the statement,
+		// but a type does.
+		self.insertSemicolon = true
+		self.next()
+	}
+	for self.token == token.PERIOD {
+		self.next()
+		if !token.IsId(self.token) {
+			self.errorUnexpectedToken(self.token)
+			return
+		}
+		self.insertSemicolon = true
+		self.next()
+	}
+	if self.token == token.LESS && !self.implicitSemicolon {
+		self.skipTypeArguments()
+	}
+}
+
+// skipFunctionType skips the type parameters, the parameters and the return type of a function type.
+func (self *_parser) skipFunctionType() {
+	if self.token == token.LESS {
+		self.skipTypeParameters()
+	}
+	if self.token != token.LEFT_PARENTHESIS {
+		self.errorUnexpectedToken(self.token)
+		return
+	}
+	self.skipBalanced()
+	self.expect(token.ARROW)
+	self.skipType()
+}
+
+// skipBalanced skips the tokens up to and including the bracket matching the current one.
+func (self *_parser) skipBalanced() {
+	depth := 0
+	for {
+		switch self.token {
+		case token.LEFT_PARENTHESIS, token.LEFT_BRACKET, token.LEFT_BRACE:
+			depth++
+		case token.RIGHT_PARENTHESIS, token.RIGHT_BRACKET, token.RIGHT_BRACE:
+			depth--
+		case token.BACKTICK:
+			self.skipTemplateLiteralType()
+			continue
+		case token.EOF:
+			self.errorUnexpectedToken(token.EOF)
+			return
+		}
+		self.next()
+		if depth == 0 {
+			return
+		}
+	}
+}
+
+func (self *_parser) skipTemplateLiteralType() {
+	for {
+		_, _, finished, _, err := self.parseTemplateCharacters()
+		if err != "" {
+			self.error(self.offset, err)
+		}
+		self.next()
+		if finished {
+			return
+		}
+		self.skipType()
+		if self.token != token.RIGHT_BRACE {
+			self.errorUnexpectedToken(self.token)
+			return
+		}
+	}
+}
+
+func (self *_parser) skipTypeArguments() {
+	self.expect(token.LESS)
+	for self.token != token.GREATER && self.token != token.EOF {
+		self.skipType()
+		if self.token != token.COMMA {
+			break
+		}
+		self.next()
+	}
+	self.skipClosingAngle()
+}
+
+func (self *_parser) skipTypeParameters() {
+	self.expect(token.LESS)
+	for self.token != token.GREATER && self.token != token.EOF {
+		for self.token == token.IN || self.token == token.CONST || self.token == token.IDENTIFIER && self.literal == "out" {
+			if tkn, _, _ := self.lookahead(); !token.IsId(tkn) {
+				break
+			}
+			self.next()
+		}
+		if !token.IsId(self.token) {
+			self.errorUnexpectedToken(self.token)
+			return
+		}
+		self.next()
+		if self.token == token.EXTENDS {
+			self.next()
+			self.skipType()
+		}
+		if self.token == token.ASSIGN {
+			self.next()
+			self.skipType()
+		}
+		if self.token != token.COMMA {
+			break
+		}
+		self.next()
+	}
+	self.skipClosingAngle()
+}
+
+// skipClosingAngle skips the > which closes a list of type parameters or arguments. The lexer may have combined it
+// with the following characters (e.g. in Array<Array<T>> or in let x: Array<T>= y), then the rest is rescanned.
+func (self *_parser) skipClosingAngle() {
+	switch self.token {
+	case token.GREATER:
+	case token.SHIFT_RIGHT, token.UNSIGNED_SHIFT_RIGHT, token.GREATER_OR_EQUAL, token.SHIFT_RIGHT_ASSIGN,
+		token.UNSIGNED_SHIFT_RIGHT_ASSIGN:
+		self.offset = int(self.idx) - self.base + 1
+		self.read()
+	default:
+		self.expect(token.GREATER)
+		return
+	}
+	self.insertSemicolon = true
+	self.next()
+}
+
+// skipTypeArgumentsInExpression skips the type arguments of a call (f<T>()), a tagged template or an instantiation
+// expression (f<T>). It returns false and leaves the parser where it was if the < is a relational operator.
+func (self *_parser) skipTypeArgumentsInExpression() bool {
+	return self.speculate(func() bool {
+		self.skipTypeArguments()
+		switch self.token {
+		case token.LEFT_PARENTHESIS, token.BACKTICK:
+			return true
+		case token.LESS, token.GREATER, token.PLUS, token.MINUS:
+			return false
+		}
+		return self.implicitSemicolon || !startsExpression(self.token)
+	})
+}
+
+func startsExpression(tkn token.Token) bool {
+	switch tkn {
+	case token.IDENTIFIER, token.NUMBER, token.STRING, token.BOOLEAN, token.NULL, token.THIS, token.SUPER, token.NEW,
+		token.FUNCTION, token.CLASS, token.TYPEOF, token.VOID, token.DELETE, token.LEFT_PARENTHESIS,
+		token.LEFT_BRACKET, token.LEFT_BRACE, token.NOT, token.BITWISE_NOT, token.INCREMENT, token.DECREMENT,
+		token.SLASH, token.QUOTIENT_ASSIGN, token.PRIVATE_IDENTIFIER:
+		return true
+	}
+	return token.IsUnreservedWord(tkn)
+}
+
+// parseTypedArrowFunction parses an arrow function with type parameters, parameter types or a return type, which
+// cannot be parsed as a parenthesised expression first. It returns nil and leaves the parser where it was if
+// there is no arrow function.
+func (self *_parser) parseTypedArrowFunction(start file.Idx, async bool) ast.Expression {
+	var paramList *ast.ParameterList
+	if !self.speculate(func() bool {
+		if async {
+			self.next()
+			if !self.scope.allowAwait {
+				self.scope.allowAwait = true
+				defer func() {
+					self.scope.allowAwait = false
+				}()
+			}
+		}
+		if self.token == token.LESS {
+			self.skipTypeParameters()
+			if !async {
+				start = self.idx
+			}
+		}
+		if self.token != token.LEFT_PARENTHESIS {
+			return false
+		}
+		paramList = self.parseFunctionParameterList()
+		self.skipTypeAnnotation()
+		return self.token == token.ARROW
+	}) {
+		return nil
+	}
+	if async && !self.scope.allowAwait {
+		self.scope.allowAwait = true
+		defer func() {
+			self.scope.allowAwait = false
+		}()
+	}
+	return self.parseArrowFunction(start, paramList, async)
+}
+
+// reparseAsTypedArrowFunction is called when the expression starting at state (with a parenthesis) could not be
+// parsed or is followed by a colon, to parse it again as an arrow function with types. If that fails as well,
+// the parser returns to where it was after the expression. In the consequent of a conditional expression the
+// arrow function must be followed by the colon, otherwise the colon belongs to the conditional expression, as in
+// a ? (b) : c => d.
+func (self *_parser) reparseAsTypedArrowFunction(state *parserState, start file.Idx, async, consequent bool) ast.Expression {
+	var after parserState
+	self.mark(&after)
+	errors := append(ErrorList(nil), self.errors[state.errorCount:]...)
+	self.restore(state)
+	if node := self.parseTypedArrowFunction(start, async); node != nil && (!consequent || self.token == token.COLON) {
+		return node
+	}
+	after.errorCount = state.errorCount
+	self.restore(&after)
+	self.errors = append(self.errors, errors...)
+	return nil
+}
+
+// skipFunctionSignature skips a function declaration without a body (an overload signature or an ambient
+// declaration). It returns false and leaves the parser where it was if the function has a body.
+func (self *_parser) skipFunctionSignature() bool {
+	return self.speculate(func() bool {
+		if self.token == token.ASYNC {
+			self.next()
+		}
+		self.expect(token.FUNCTION)
+		if self.token == token.MULTIPLY {
+			self.next()
+		}
+		if token.IsId(self.token) {
+			self.next()
+		}
+		if self.token == token.LESS {
+			self.skipTypeParameters()
+		}
+		self.parseFunctionParameterList()
+		self.skipTypeAnnotation()
+		if self.token == token.LEFT_BRACE {
+			return false
+		}
+		self.semicolon()
+		return true
+	})
+}
+
+// skipClassMemberModifiers skips the TypeScript modifiers of a class member. It returns true if the member is to
+// be dropped, i.e. it's declared with declare or abstract.
+func (self *_parser) skipClassMemberModifiers() (drop bool) {
+	for self.token == token.IDENTIFIER {
+		switch self.literal {
+		case "public", "private", "protected", "readonly", "override", "declare", "abstract":
+		default:
+			return
+		}
+		switch tkn, _, sameLine := self.lookahead(); {
+		case !sameLine:
+			return
+		case token.IsId(tkn), tkn == token.STRING, tkn == token.NUMBER, tkn == token.LEFT_BRACKET,
+			tkn == token.PRIVATE_IDENTIFIER, tkn == token.MULTIPLY:
+		default:
+			return
+		}
+		if self.literal == "declare" || self.literal == "abstract" {
+			drop = true
+		}
+		self.next()
+	}
+	return
+}
+
+// skipIndexSignature skips a class index signature ([key: string]: T) if there is one.
+func (self *_parser) skipIndexSignature() bool {
+	if self.token != token.LEFT_BRACKET {
+		return false
+	}
+	var state parserState
+	self.mark(&state)
+	self.next()
+	if token.IsId(self.token) {
+		self.next()
+		if self.token == token.COLON {
+			self.next()
+			self.skipType()
+			self.expect(token.RIGHT_BRACKET)
+			self.skipTypeAnnotation()
+			if self.token == token.SEMICOLON {
+				self.next()
+			}
+			return true
+		}
+	}
+	self.restore(&state)
+	return false
+}
+
+// skipHeritageTypes skips the type arguments of the superclass and the implements clause of a class.
+func (self *_parser) skipHeritageTypes() {
+	if self.token == token.LESS {
+		self.skipTypeArguments()
+	}
+	if self.token == token.IDENTIFIER && self.literal == "implements" {
+		self.next()
+		self.skipType()
+		for self.token == token.COMMA {
+			self.next()
+			self.skipType()
+		}
+	}
+}
+
+// skipTypeDeclaration skips a declaration which only exists in the type system (an interface, a type alias, an
+// ambient declaration or a function overload signature) in a statement list. The declarations which have a runtime
+// effect, but are not supported (an enum or a namespace), are reported and skipped as well. It returns false if the
+// current statement is not one of them.
+func (self *_parser) skipTypeDeclaration() bool {
+	idx := self.idx
+	tkn, literal, sameLine := self.lookahead()
+	switch self.token {
+	case token.IDENTIFIER:
+		switch self.literal {
+		case "interface":
+			if !sameLine || !token.IsId(tkn) {
+				return false
+			}
+			self.next()
+			self.next()
+			if self.token == token.LESS {
+				self.skipTypeParameters()
+			}
+			if self.token == token.EXTENDS {
+				self.next()
+				self.skipType()
+				for self.token == token.COMMA {
+					self.next()
+					self.skipType()
+				}
+			}
+			if self.token != token.LEFT_BRACE {
+				self.expect(token.LEFT_BRACE)
+				return true
+			}
+			self.skipBalanced()
+			return true
+		case "type":
+			if !sameLine || !token.IsId(tkn) {
+				return false
+			}
+			self.next()
+			self.next()
+			if self.token == token.LESS {
+				self.skipTypeParameters()
+			}
+			self.expect(token.ASSIGN)
+			self.skipType()
+			self.semicolon()
+			return true
+		case "declare":
+			if !sameLine || !token.IsId(tkn) {
+				return false
+			}
+			self.next()
+			self.skipAmbientDeclaration()
+			return true
+		case "namespace", "module":
+			if !sameLine || tkn != token.IDENTIFIER && (tkn != token.STRING || self.literal != "module") {
+				return false
+			}
+			self.error(idx, "TypeScript namespaces are not supported, only ambient ones (declare %s) are", self.literal)
+			self.next()
+			self.skipModuleDeclaration()
+			return true
+		}
+	case token.KEYWORD:
+		if self.literal == "enum" && sameLine && token.IsId(tkn) {
+			self.error(idx, "TypeScript enums are not supported")
+			self.skipEnumDeclaration()
+			return true
+		}
+	case token.CONST:
+		if tkn == token.KEYWORD && literal == "enum" {
+			self.error(idx, "TypeScript enums are not supported")
+			self.next()
+			self.skipEnumDeclaration()
+			return true
+		}
+	case token.FUNCTION:
+		return self.skipFunctionSignature()
+	case token.ASYNC:
+		return tkn == token.FUNCTION && self.skipFunctionSignature()
+	}
+	return false
+}
+
+// skipAmbientDeclaration skips the declaration following declare.
+func (self *_parser) skipAmbientDeclaration() {
+	switch self.token {
+	case token.VAR, token.LET, token.CONST:
+		if tkn, literal, _ := self.lookahead(); tkn == token.KEYWORD && literal == "enum" {
+			self.next()
+			self.skipEnumDeclaration()
+			return
+		}
+		self.next()
+		self.parseVariableDeclarationList()
+		self.semicolon()
+	case token.FUNCTION, token.ASYNC:
+		if !self.skipFunctionSignature() {
+			self.parseFunction(true, false, self.idx)
+		}
+	case token.CLASS:
+		self.parseClass(false)
+	case token.KEYWORD:
+		if self.literal == "enum" {
+			self.skipEnumDeclaration()
+			return
+		}
+		self.errorUnexpectedToken(self.token)
+		self.nextStatement()
+	default:
+		switch self.literal {
+		case "abstract":
+			self.next()
+			self.parseClass(false)
+		case "namespace", "module", "global":
+			if self.literal != "global" {
+				self.next()
+			}
+			self.skipModuleDeclaration()
+		default:
+			if !self.skipTypeDeclaration() {
+				self.errorUnexpectedToken(self.token)
+				self.nextStatement()
+			}
+		}
+	}
+}
+
+// skipModuleDeclaration skips the name and the body of a namespace or a module declaration.
+func (self *_parser) skipModuleDeclaration() {
+	if self.token == token.STRING {
+		self.next()
+	} else {
+		self.skipTypeReference()
+	}
+	if self.token == token.LEFT_BRACE {
+		self.skipBalanced()
+	} else {
+		self.semicolon()
+	}
+}
+
+func (self *_parser) skipEnumDeclaration() {
+	self.next()
+	if !token.IsId(self.token) {
+		self.errorUnexpectedToken(self.token)
+		return
+	}
+	self.next()
+	if self.token != token.LEFT_BRACE {
+		self.expect(token.LEFT_BRACE)
+		return
+	}
+	self.skipBalanced()
+}
+
+// checkParameterProperty reports a TypeScript parameter property (constructor(private x: T)), which is not erasable
+// as it declares and assigns a field, and skips its modifiers.
+func (self *_parser) checkParameterProperty() {
+	idx := self.idx
+	found := false
+	for self.token == token.IDENTIFIER {
+		switch self.literal {
+		case "public", "private", "protected", "readonly", "override":
+		default:
+			return
+		}
+		if tkn, _, _ := self.lookahead(); !token.IsId(tkn) && tkn != token.LEFT_BRACE && tkn != token.LEFT_BRACKET {
+			return
+		}
+		if !found {
+			self.error(idx, "TypeScript parameter properties are not supported")
+			found = true
+		}
+		self.next()
+	}
+}
@@ -0,0 +1,171 @@
+package parser
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dop251/goja/ast"
+)
+
+// stripTypes returns the TypeScript source with the «» marks removed and the JavaScript source with the marked
+// parts replaced by spaces.
+func stripTypes(src string) (ts, js string) {
+	var tsb, jsb strings.Builder
+	marked := false
+	for _, chr := range src {
+		switch {
+		case chr == '«':
+			marked = true
+		case chr == '»':
+			marked = false
+		case marked && chr != '\n':
+			tsb.WriteRune(chr)
+			jsb.WriteString(strings.Repeat(" ", len(string(chr))))
+		default:
+			tsb.WriteRune(chr)
+			jsb.WriteRune(chr)
+		}
+	}
+	return tsb.String(), jsb.String()
+}
+
+// compareAST compares the nodes field by field. The source texts of the functions and the classes (which include
+// the types) are not compared, neither are the positions of the parameter lists, which the parser sets differently
+// for the arrow functions depending on whether the parameters are parsed as an expression first.
+func compareAST(a, b reflect.Value, path string) error {
+	if a.Kind() != b.Kind() {
+		return fmt.Errorf("%s: %v != %v", path, a.Kind(), b.Kind())
+	}
+	switch a.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			if a.IsNil() != b.IsNil() {
+				return fmt.Errorf("%s: %v != %v", path, a, b)
+			}
+			return nil
+		}
+		if a.Elem().Type() != b.Elem().Type() {
+			return fmt.Errorf("%s: %v != %v", path, a.Elem().Type(), b.Elem().Type())
+		}
+		return compareAST(a.Elem(), b.Elem(), path)
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			switch name := a.Type().Field(i).Name; name {
+			case "Source", "File", "Opening", "Closing", "CommentMap":
+			default:
+				if err := compareAST(a.Field(i), b.Field(i), path+"."+name); err != nil {
+					return err
+				}
+			}
+		}
+	case reflect.Slice:
+		if a.Len() != b.Len() {
+			return fmt.Errorf("%s: len %d != %d", path, a.Len(), b.Len())
+		}
+		for i := 0; i < a.Len(); i++ {
+			if err := compareAST(a.Index(i), b.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	default:
+		if a.Interface() != b.Interface() {
+			return fmt.Errorf("%s: %v != %v", path, a, b)
+		}
+	}
+	return nil
+}
+
+func TestTypeScript(t *testing.T) {
+	tests := []string{
+		`let x«: number» = 1, y«!: string», z«: Array<Array<number>>»= [];`,
+		`function f«<T extends object = {}>»(«this: Window, »a«: T», b«?: Map<string, T[]>», ...rest«: any[]»)«: asserts a is T» {
+	return a« as any» «as unknown as T»;
+}`,
+		`const g = (a«: number», b«?: string»)«: void» => {};
+const h = «<T,>»(x«: T»)«: T» => x;
+const k = async «<T>»(x«: T») => x;
+const m = (a)«: a is string» => true, n = async (a«: number»)«: Promise<void>» => {};
+let v = (a) => a, w = (a, b) => (a + b)«!»;
+let c = x ? (y) : z;
+let t = a ? (b) : c => d, u = a ? (b, c) : d => 1, s = a ? (b)«: T» => b : c;`,
+		`«interface A<T> extends B, C<T> { x: number; m(): void }»
+«type U<T> = T extends (infer R extends string)[] ? R : never»
+«type V<T> = { readonly [K in keyof T]?: T[K] } | ` + "`a${string}b`" + ` | typeof import("x").y | (new () => T) | -1»
+«declare const z: number;»
+«declare function df(a: number): void»
+«declare abstract class DC { m(): void }»
+«declare module "foo" { export const x: number }»
+«declare global { interface Window { a: number } }»
+foo();`,
+		`«abstract »class C«<T>» extends D«<T>» «implements E, F<T> »{
+	«private readonly »a«: number» = 1;
+	«declare b: string;»
+	«protected »static c«?: number»;
+	d«!: string»;
+	«[key: string]: any;»
+	«abstract e(): void;»
+	«m(a: string): void;»
+	m(a«: any»)«: void» {}
+	«public »get x()«: number» { return 1 }
+	static «readonly »s = 1
+	«override »n«<T>»(x«: T») { return x«!».y«!» }
+	readonly = 1;
+	public() {}
+}`,
+		`«function o(a: string): void»
+function o(a«: any») {}
+let q = f«<number>»(1), r = new Map«<string, number>»(), s = a < b, t = a«<string>», u = «<any>»x;
+x«!».y = z« satisfies Q»;
+let cc = {m«<T>»(x«: T»)«: T» { return x }, get g()«: number» { return 1 }};
+try {} catch (e«: unknown») {}
+for (let i«: number» = 0; i < 10; i++) {}
+for (const [k, v] of m« as Map<string, number>») {}
+let fn«: (a: number) => void» = null, tt = [1]« as const»;
+switch (a) { case 1: «type T = number;» break; }
+let type = 1, declare = 2, module = {};
+«type X = 1;»
+type = declare;
+module.exports = 1;`,
+	}
+	for _, test := range tests {
+		ts, js := stripTypes(test)
+		tsPrg, err := ParseFile(nil, "", ts, TypeScript)
+		if err != nil {
+			t.Errorf("%s: %v", ts, err)
+			continue
+		}
+		jsPrg, err := ParseFile(nil, "", js, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", js, err)
+		}
+		if err := compareAST(reflect.ValueOf(tsPrg), reflect.ValueOf(jsPrg), "Program"); err != nil {
+			t.Errorf("%s: %v", ts, err)
+		}
+		if _, err := ParseFile(nil, "", ts, 0); err == nil {
+			t.Errorf("%s: no error without the TypeScript mode", ts)
+		}
+	}
+
+	tt(t, func() {
+		for _, test := range []struct {
+			src, err string
+		}{
+			{"enum E { A }", "(anonymous): Line 1:1 TypeScript enums are not supported"},
+			{"const enum E { A }", "(anonymous): Line 1:1 TypeScript enums are not supported"},
+			{"namespace N { }", "(anonymous): Line 1:1 TypeScript namespaces are not supported, only ambient ones (declare namespace) are"},
+			{"class C { constructor(private x: number) {} }", "(anonymous): Line 1:23 TypeScript parameter properties are not supported"},
+			{"let x: = 1", "(anonymous): Line 1:8 Unexpected token ="},
+		} {
+			_, err := ParseFile(nil, "", test.src, TypeScript)
+			is(err, test.err)
+		}
+
+		// the statements following the unsupported declarations are parsed
+		prg, _ := ParseFile(nil, "", "enum E { A }\nf()", TypeScript)
+		is(len(prg.Body), 1)
+		_, ok := prg.Body[0].(*ast.ExpressionStatement)
+		is(ok, true)
+	})
+}
@@ -0,0 +1,820 @@
+package printer
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/parser"
+	"github.com/dop251/goja/token"
+	"github.com/dop251/goja/unistring"
+)
+
+// The precedence levels of the expressions, from the lowest to the highest.
+const (
+	levelLowest = iota
+	levelComma
+	levelAssign // assignment, arrow function, yield, spread
+	levelConditional
+	levelCoalesce
+	levelLogicalOr
+	levelLogicalAnd
+	levelBitwiseOr
+	levelBitwiseXor
+	levelBitwiseAnd
+	levelEquals
+	levelCompare
+	levelShift
+	levelAdd
+	levelMultiply
+	levelExponent
+	levelPrefix
+	levelPostfix
+	levelNew
+	levelCall
+	levelMember
+)
+
+type exprFlags uint8
+
+const (
+	// the 'in' operator is not allowed (in the initializer of a for statement)
+	flagNoIn exprFlags = 1 << iota
+	// the call expressions are not allowed (in the callee of a new expression)
+	flagNoCall
+)
+
+func binaryLevel(op token.Token) int {
+	switch op {
+	case token.COALESCE:
+		return levelCoalesce
+	case token.LOGICAL_OR:
+		return levelLogicalOr
+	case token.LOGICAL_AND:
+		return levelLogicalAnd
+	case token.OR:
+		return levelBitwiseOr
+	case token.EXCLUSIVE_OR:
+		return levelBitwiseXor
+	case token.AND:
+		return levelBitwiseAnd
+	case token.EQUAL, token.NOT_EQUAL, token.STRICT_EQUAL, token.STRICT_NOT_EQUAL:
+		return levelEquals
+	case token.LESS, token.GREATER, token.LESS_OR_EQUAL, token.GREATER_OR_EQUAL, token.INSTANCEOF, token.IN:
+		return levelCompare
+	case token.SHIFT_LEFT, token.SHIFT_RIGHT, token.UNSIGNED_SHIFT_RIGHT:
+		return levelShift
+	case token.PLUS, token.MINUS:
+		return levelAdd
+	case token.MULTIPLY, token.SLASH, token.REMAINDER:
+		return levelMultiply
+	case token.EXPONENT:
+		return levelExponent
+	}
+	return -1
+}
+
+func isLogical(e ast.Expression, ops ...token.Token) bool {
+	if b, ok := e.(*ast.BinaryExpression); ok {
+		for _, op := range ops {
+			if b.Operator == op {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// open prints the opening parenthesis if cond is true, and returns cond, so that the result can be passed to close.
+func (p *printer) open(cond bool) bool {
+	if cond {
+		p.op("(")
+	}
+	return cond
+}
+
+func (p *printer) close(cond bool) {
+	if cond {
+		p.op(")")
+	}
+}
+
+func (p *printer) expressionList(list []ast.Expression) {
+	for i, e := range list {
+		if i > 0 {
+			p.op(",")
+			p.space()
+		}
+		if e != nil {
+			p.expression(e, levelAssign, 0)
+		}
+	}
+}
+
+func (p *printer) expression(e ast.Expression, level int, flags exprFlags) {
+	p.mark(e.Idx0())
+	switch e := e.(type) {
+	case *ast.BadExpression:
+		p.source(e, e.From, e.To)
+
+	case *ast.Identifier:
+		p.identifier(e)
+
+	case *ast.PrivateIdentifier:
+		p.markName(e.Idx, e.Name.String())
+		p.op("#")
+		p.print(e.Name.String())
+
+	case *ast.ThisExpression:
+		p.word("this")
+
+	case *ast.SuperExpression:
+		p.word("super")
+
+	case *ast.NullLiteral:
+		p.word("null")
+
+	case *ast.BooleanLiteral:
+		if e.Value {
+			p.word("true")
+		} else {
+			p.word("false")
+		}
+
+	case *ast.NumberLiteral:
+		p.number(e, level)
+
+	case *ast.StringLiteral:
+		if e.Literal != "" {
+			// the literal may be an identifier if it's a property key
+			p.word(e.Literal)
+		} else {
+			p.print(quoteString(e.Value))
+		}
+
+	case *ast.RegExpLiteral:
+		if e.Literal != "" {
+			p.op(e.Literal)
+		} else {
+			p.op("/" + e.Pattern + "/")
+			p.print(e.Flags)
+		}
+
+	case *ast.TemplateLiteral:
+		wrap := false
+		if e.Tag != nil {
+			wrap = p.open(level > levelMember)
+			p.callee(e.Tag, flags)
+		}
+		p.op("`")
+		for i, elt := range e.Elements {
+			if elt.Literal != "" || elt.Parsed == "" {
+				p.print(elt.Literal)
+			} else {
+				p.print(escapeTemplate(elt.Parsed))
+			}
+			if i < len(e.Expressions) {
+				p.print("${")
+				p.expression(e.Expressions[i], levelLowest, 0)
+				p.print("}")
+			}
+		}
+		p.print("`")
+		p.close(wrap)
+
+	case *ast.MetaProperty:
+		p.identifier(e.Meta)
+		p.op(".")
+		p.identifier(e.Property)
+
+	case *ast.ArrayLiteral:
+		p.op("[")
+		p.expressionList(e.Value)
+		if n := len(e.Value); n > 0 && e.Value[n-1] == nil {
+			// a trailing hole requires an extra comma
+			p.op(",")
+		}
+		p.op("]")
+
+	case *ast.ArrayPattern:
+		p.op("[")
+		p.expressionList(e.Elements)
+		if e.Rest != nil {
+			if len(e.Elements) > 0 {
+				p.op(",")
+				p.space()
+			}
+			p.op("...")
+			p.expression(e.Rest, levelAssign, 0)
+		} else if n := len(e.Elements); n > 0 && e.Elements[n-1] == nil {
+			p.op(",")
+		}
+		p.op("]")
+
+	case *ast.ObjectLiteral:
+		wrap := p.open(p.atStatementStart() || p.buf.Len() == p.arrowBodyStart)
+		p.properties(e.Value, nil)
+		p.close(wrap)
+
+	case *ast.ObjectPattern:
+		p.properties(e.Properties, e.Rest)
+
+	case *ast.PropertyShort, *ast.PropertyKeyed, *ast.SpreadElement:
+		p.property(e.(ast.Property))
+
+	case *ast.Binding:
+		p.binding(e, flags)
+
+	case *ast.FunctionLiteral:
+		wrap := p.open(p.atStatementStart())
+		p.function(e)
+		p.close(wrap)
+
+	case *ast.ClassLiteral:
+		wrap := p.open(p.atStatementStart())
+		p.class(e)
+		p.close(wrap)
+
+	case *ast.ArrowFunctionLiteral:
+		wrap := p.open(level > levelAssign)
+		if e.Async {
+			p.word("async")
+			p.space()
+		}
+		p.parameters(e.ParameterList)
+		p.space()
+		p.op("=>")
+		p.space()
+		switch body := e.Body.(type) {
+		case *ast.BlockStatement:
+			p.block(body)
+		case *ast.ExpressionBody:
+			p.arrowBodyStart = p.buf.Len()
+			p.expression(body.Expression, levelAssign, flags&flagNoIn)
+		default:
+			p.fail("unexpected arrow function body %T", body)
+		}
+		p.close(wrap)
+
+	case *ast.SequenceExpression:
+		wrap := p.open(level > levelComma)
+		for i, x := range e.Sequence {
+			if i > 0 {
+				p.op(",")
+				p.space()
+			}
+			p.expression(x, levelAssign, flags)
+		}
+		p.close(wrap)
+
+	case *ast.YieldExpression:
+		wrap := p.open(level > levelAssign)
+		p.word("yield")
+		if e.Delegate {
+			p.op("*")
+		}
+		if e.Argument != nil {
+			p.space()
+			p.expression(e.Argument, levelAssign, flags)
+		}
+		p.close(wrap)
+
+	case *ast.AwaitExpression:
+		wrap := p.open(level > levelPrefix)
+		p.word("await")
+		p.space()
+		p.expression(e.Argument, levelPrefix, 0)
+		p.close(wrap)
+
+	case *ast.AssignExpression:
+		_, isPattern := e.Left.(*ast.ObjectPattern)
+		wrap := p.open(level > levelAssign || isPattern && (p.atStatementStart() || p.buf.Len() == p.arrowBodyStart))
+		p.expression(e.Left, levelNew, 0)
+		p.space()
+		if e.Operator == token.ASSIGN {
+			p.op("=")
+		} else {
+			p.op(e.Operator.String() + "=")
+		}
+		p.space()
+		p.expression(e.Right, levelAssign, flags)
+		p.close(wrap)
+
+	case *ast.ConditionalExpression:
+		wrap := p.open(level > levelConditional)
+		p.expression(e.Test, levelCoalesce, flags)
+		p.space()
+		p.op("?")
+		p.space()
+		p.expression(e.Consequent, levelAssign, 0)
+		p.space()
+		p.op(":")
+		p.space()
+		p.expression(e.Alternate, levelAssign, flags)
+		p.close(wrap)
+
+	case *ast.BinaryExpression:
+		p.binary(e, level, flags)
+
+	case *ast.UnaryExpression:
+		if e.Postfix {
+			wrap := p.open(level > levelPostfix)
+			p.expression(e.Operand, levelNew, 0)
+			p.op(e.Operator.String())
+			p.close(wrap)
+			break
+		}
+		wrap := p.open(level > levelPrefix)
+		switch e.Operator {
+		case token.TYPEOF, token.VOID, token.DELETE:
+			p.word(e.Operator.String())
+			p.space()
+		default:
+			p.op(e.Operator.String())
+		}
+		p.expression(e.Operand, levelPrefix, 0)
+		p.close(wrap)
+
+	case *ast.NewExpression:
+		wrap := p.open(level > levelCall)
+		p.word("new")
+		p.space()
+		p.expression(e.Callee, levelMember, flagNoCall)
+		p.arguments(e.ArgumentList)
+		p.close(wrap)
+
+	case *ast.CallExpression:
+		wrap := p.open(level > levelCall || flags&flagNoCall != 0)
+		if wrap {
+			flags = 0
+		}
+		p.callee(e.Callee, flags)
+		p.arguments(e.ArgumentList)
+		p.close(wrap)
+
+	case *ast.DotExpression:
+		wrap := p.open(level > levelMember)
+		p.callee(e.Left, flags)
+		if _, ok := e.Left.(*ast.Optional); !ok {
+			p.op(".")
+		}
+		p.identifier(&e.Identifier)
+		p.close(wrap)
+
+	case *ast.PrivateDotExpression:
+		wrap := p.open(level > levelMember)
+		p.callee(e.Left, flags)
+		if _, ok := e.Left.(*ast.Optional); !ok {
+			p.op(".")
+		}
+		p.expression(&e.Identifier, levelMember, 0)
+		p.close(wrap)
+
+	case *ast.BracketExpression:
+		wrap := p.open(level > levelMember)
+		p.callee(e.Left, flags)
+		p.op("[")
+		p.expression(e.Member, levelLowest, 0)
+		p.op("]")
+		p.close(wrap)
+
+	case *ast.Optional:
+		p.callee(e.Expression, flags)
+		p.op("?.")
+
+	case *ast.OptionalChain:
+		wrap := p.open(level > levelCall || flags&flagNoCall != 0)
+		p.expression(e.Expression, levelCall, 0)
+		p.close(wrap)
+
+	case *ast.JSXElement:
+		p.jsxElement(e)
+
+	case *ast.JSXFragment:
+		p.jsxFragment(e)
+
+	default:
+		p.fail("unexpected expression type %T", e)
+	}
+}
+
+// callee prints the left-hand side of a member access, a call or a tagged template.
+func (p *printer) callee(e ast.Expression, flags exprFlags) {
+	switch e := e.(type) {
+	case *ast.OptionalChain:
+		// (a?.b).c is not the same as a?.b.c
+		p.op("(")
+		p.expression(e, levelLowest, 0)
+		p.op(")")
+		return
+	case *ast.NumberLiteral:
+		// 1.toString() is a syntax error
+		if lit := e.Literal; lit == "" || strings.IndexFunc(lit, func(r rune) bool { return (r < '0' || r > '9') && r != '_' }) == -1 {
+			p.op("(")
+			p.expression(e, levelLowest, 0)
+			p.op(")")
+			return
+		}
+	}
+	p.expression(e, levelCall, flags&flagNoCall)
+}
+
+func (p *printer) arguments(list []ast.Expression) {
+	p.op("(")
+	p.expressionList(list)
+	p.op(")")
+}
+
+func (p *printer) binary(e *ast.BinaryExpression, level int, flags exprFlags) {
+	op := e.Operator
+	if _, ok := e.Left.(*ast.PrivateIdentifier); ok {
+		// #x in obj
+		op = token.IN
+	}
+	l := binaryLevel(op)
+	if l < 0 {
+		p.fail("unexpected binary operator %s", op)
+	}
+	noIn := op == token.IN && flags&flagNoIn != 0
+	wrap := p.open(level > l || noIn)
+	if wrap {
+		flags = 0
+	}
+
+	leftLevel, rightLevel := l, l+1
+	if op == token.EXPONENT {
+		// -a ** b is a syntax error
+		leftLevel, rightLevel = levelPostfix, l
+	}
+	// ?? cannot be mixed with && and || without parentheses
+	forceLeft, forceRight := false, false
+	switch op {
+	case token.COALESCE:
+		forceLeft = isLogical(e.Left, token.LOGICAL_OR, token.LOGICAL_AND)
+		forceRight = isLogical(e.Right, token.LOGICAL_OR, token.LOGICAL_AND)
+	case token.LOGICAL_OR, token.LOGICAL_AND:
+		forceLeft = isLogical(e.Left, token.COALESCE)
+		forceRight = isLogical(e.Right, token.COALESCE)
+	}
+	if forceLeft {
+		leftLevel = levelPrefix
+	}
+	if forceRight {
+		rightLevel = levelPrefix
+	}
+
+	p.expression(e.Left, leftLevel, flags)
+	p.space()
+	switch op {
+	case token.IN, token.INSTANCEOF:
+		p.word(op.String())
+	default:
+		p.op(op.String())
+	}
+	p.space()
+	p.expression(e.Right, rightLevel, flags)
+	p.close(wrap)
+}
+
+func (p *printer) identifier(id *ast.Identifier) {
+	name := id.Name.String()
+	// 'let' and 'async' are ambiguous at the beginning of a statement or a for-of left-hand side
+	wrap := (name == "let" || name == "async") && (p.atStatementStart() || p.buf.Len() == p.forOfStart)
+	p.open(wrap)
+	p.markName(id.Idx, name)
+	p.word(name)
+	p.close(wrap)
+}
+
+func (p *printer) atStatementStart() bool {
+	return p.buf.Len() == p.stmtStart
+}
+
+func (p *printer) number(e *ast.NumberLiteral, level int) {
+	lit := e.Literal
+	if lit == "" {
+		switch v := e.Value.(type) {
+		case int64:
+			lit = strconv.FormatInt(v, 10)
+		case float64:
+			switch {
+			case math.IsNaN(v):
+				lit = "NaN"
+			case math.IsInf(v, 1):
+				lit = "Infinity"
+			case math.IsInf(v, -1):
+				lit = "-Infinity"
+			default:
+				lit = strconv.FormatFloat(v, 'g', -1, 64)
+			}
+		case *big.Int:
+			lit = v.String() + "n"
+		default:
+			p.fail("unexpected number literal value %T", v)
+		}
+	}
+	if strings.HasPrefix(lit, "-") {
+		wrap := p.open(level > levelPrefix)
+		p.op("-")
+		p.word(lit[1:])
+		p.close(wrap)
+		return
+	}
+	p.word(lit)
+}
+
+func (p *printer) properties(list []ast.Property, rest ast.Expression) {
+	p.op("{")
+	if len(list) == 0 && rest == nil {
+		p.op("}")
+		return
+	}
+	// the objects with methods are printed one property per line
+	multiline := false
+	for _, prop := range list {
+		if prop, ok := prop.(*ast.PropertyKeyed); ok && prop.Kind != ast.PropertyKindValue {
+			multiline = true
+			break
+		}
+	}
+	sep := func() {
+		if multiline {
+			p.newline()
+		} else {
+			p.space()
+		}
+	}
+	if multiline {
+		p.level++
+	}
+	sep()
+	for i, prop := range list {
+		if i > 0 {
+			p.op(",")
+			sep()
+		}
+		p.property(prop)
+	}
+	if rest != nil {
+		if len(list) > 0 {
+			p.op(",")
+			sep()
+		}
+		p.op("...")
+		p.expression(rest, levelAssign, 0)
+	}
+	if multiline {
+		p.level--
+	}
+	sep()
+	p.op("}")
+}
+
+func (p *printer) property(prop ast.Property) {
+	p.mark(prop.Idx0())
+	switch prop := prop.(type) {
+	case *ast.PropertyShort:
+		p.identifier(&prop.Name)
+		if prop.Initializer != nil {
+			p.space()
+			p.op("=")
+			p.space()
+			p.expression(prop.Initializer, levelAssign, 0)
+		}
+	case *ast.PropertyKeyed:
+		if prop.Kind == ast.PropertyKindValue {
+			p.propertyKey(prop.Key, prop.Computed)
+			p.op(":")
+			p.space()
+			p.expression(prop.Value, levelAssign, 0)
+			break
+		}
+		fn, ok := prop.Value.(*ast.FunctionLiteral)
+		if !ok {
+			p.fail("unexpected %s property value %T", prop.Kind, prop.Value)
+		}
+		p.method(prop.Kind, prop.Key, prop.Computed, false, fn)
+	case *ast.SpreadElement:
+		p.op("...")
+		p.expression(prop.Expression, levelAssign, 0)
+	default:
+		p.fail("unexpected property type %T", prop)
+	}
+}
+
+func (p *printer) propertyKey(key ast.Expression, computed bool) {
+	if computed {
+		p.op("[")
+		p.expression(key, levelAssign, 0)
+		p.op("]")
+		return
+	}
+	if s, ok := key.(*ast.StringLiteral); ok && s.Literal == "" {
+		if name := s.Value.String(); parser.IsIdentifier(name) && !strings.Contains(name, "\\") {
+			p.mark(s.Idx)
+			p.word(name)
+			return
+		}
+	}
+	p.expression(key, levelMember, 0)
+}
+
+func (p *printer) method(kind ast.PropertyKind, key ast.Expression, computed, static bool, fn *ast.FunctionLiteral) {
+	if static {
+		p.word("static")
+		p.space()
+	}
+	switch kind {
+	case ast.PropertyKindGet, ast.PropertyKindSet:
+		p.word(string(kind))
+		p.space()
+	}
+	if fn.Async {
+		p.word("async")
+		p.space()
+	}
+	if fn.Generator {
+		p.op("*")
+	}
+	p.propertyKey(key, computed)
+	p.parameters(fn.ParameterList)
+	p.space()
+	p.block(fn.Body)
+}
+
+func (p *printer) binding(b *ast.Binding, flags exprFlags) {
+	p.expression(b.Target, levelAssign, 0)
+	if b.Initializer != nil {
+		p.space()
+		p.op("=")
+		p.space()
+		p.expression(b.Initializer, levelAssign, flags)
+	}
+}
+
+func (p *printer) parameters(params *ast.ParameterList) {
+	p.op("(")
+	for i, b := range params.List {
+		if i > 0 {
+			p.op(",")
+			p.space()
+		}
+		p.binding(b, 0)
+	}
+	if params.Rest != nil {
+		if len(params.List) > 0 {
+			p.op(",")
+			p.space()
+		}
+		p.op("...")
+		p.expression(params.Rest, levelAssign, 0)
+	}
+	p.op(")")
+}
+
+func (p *printer) function(fn *ast.FunctionLiteral) {
+	if fn.Async {
+		p.word("async")
+		p.space()
+	}
+	p.word("function")
+	if fn.Generator {
+		p.op("*")
+	}
+	if fn.Name != nil {
+		p.space()
+		p.identifier(fn.Name)
+	}
+	p.parameters(fn.ParameterList)
+	p.space()
+	p.block(fn.Body)
+}
+
+func (p *printer) class(c *ast.ClassLiteral) {
+	p.word("class")
+	if c.Name != nil {
+		p.space()
+		p.identifier(c.Name)
+	}
+	if c.SuperClass != nil {
+		p.space()
+		p.word("extends")
+		p.space()
+		p.expression(c.SuperClass, levelNew, 0)
+	}
+	p.space()
+	p.op("{")
+	if len(c.Body) > 0 {
+		p.level++
+		for _, elt := range c.Body {
+			p.newline()
+			p.classElement(elt)
+		}
+		p.level--
+		p.newline()
+	}
+	p.op("}")
+}
+
+func (p *printer) classElement(elt ast.ClassElement) {
+	p.leadingComments(elt)
+	p.mark(elt.Idx0())
+	switch elt := elt.(type) {
+	case *ast.FieldDefinition:
+		if elt.Static {
+			p.word("static")
+			p.space()
+		}
+		p.propertyKey(elt.Key, elt.Computed)
+		if elt.Initializer != nil {
+			p.space()
+			p.op("=")
+			p.space()
+			p.expression(elt.Initializer, levelAssign, 0)
+		}
+		p.op(";")
+	case *ast.MethodDefinition:
+		p.method(elt.Kind, elt.Key, elt.Computed, elt.Static, elt.Body)
+	case *ast.ClassStaticBlock:
+		p.word("static")
+		p.space()
+		p.block(elt.Block)
+	default:
+		p.fail("unexpected class element type %T", elt)
+	}
+	p.trailingComments(elt)
+}
+
+// quoteString returns s as a double-quoted JavaScript string literal.
+func quoteString(s unistring.String) string {
+	var units []uint16
+	if u := s.AsUtf16(); u != nil {
+		units = u[1:]
+	} else {
+		units = utf16.Encode([]rune(s.String()))
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	escapeUnits(&b, units, '"')
+	b.WriteByte('"')
+	return b.String()
+}
+
+// escapeTemplate returns s escaped for the use as a part of a template literal.
+func escapeTemplate(s unistring.String) string {
+	var units []uint16
+	if u := s.AsUtf16(); u != nil {
+		units = u[1:]
+	} else {
+		units = utf16.Encode([]rune(s.String()))
+	}
+	var b strings.Builder
+	escapeUnits(&b, units, '`')
+	return b.String()
+}
+
+const hexDigits = "0123456789abcdef"
+
+func escapeUnits(b *strings.Builder, units []uint16, quote byte) {
+	for i := 0; i < len(units); i++ {
+		c := units[i]
+		switch {
+		case c == uint16(quote) || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(byte(c))
+		case c == '$' && quote == '`' && i+1 < len(units) && units[i+1] == '{':
+			b.WriteString("\\$")
+		case c == '\n':
+			b.WriteString("\\n")
+		case c == '\r':
+			b.WriteString("\\r")
+		case c == '\t':
+			b.WriteString("\\t")
+		case c < 0x20 || c == 0x7f:
+			b.WriteString("\\x")
+			b.WriteByte(hexDigits[c>>4])
+			b.WriteByte(hexDigits[c&0xf])
+		case c < 0x80:
+			b.WriteByte(byte(c))
+		case utf16.IsSurrogate(rune(c)):
+			if c < 0xdc00 && i+1 < len(units) && units[i+1] >= 0xdc00 && units[i+1] < 0xe000 {
+				b.WriteRune(utf16.DecodeRune(rune(c), rune(units[i+1])))
+				i++
+				break
+			}
+			// a lone surrogate cannot be represented in UTF-8
+			fallthrough
+		case c == 0x2028 || c == 0x2029:
+			b.WriteString("\\u")
+			b.WriteByte(hexDigits[c>>12])
+			b.WriteByte(hexDigits[c>>8&0xf])
+			b.WriteByte(hexDigits[c>>4&0xf])
+			b.WriteByte(hexDigits[c&0xf])
+		default:
+			b.WriteRune(rune(c))
+		}
+	}
+}
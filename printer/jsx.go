@@ -0,0 +1,124 @@
+package printer
+
+import (
+	"strings"
+
+	"github.com/dop251/goja/ast"
+)
+
+// The JSX is printed as is, without any formatting: the whitespace in the text is significant.
+
+func (p *printer) jsxElement(e *ast.JSXElement) {
+	p.op("<")
+	p.jsxName(e.Name)
+	for _, attr := range e.Attributes {
+		p.print(" ")
+		p.mark(attr.Idx0())
+		switch attr := attr.(type) {
+		case *ast.JSXAttribute:
+			p.jsxName(attr.Name)
+			if attr.Value != nil {
+				p.print("=")
+				p.jsxAttributeValue(attr.Value)
+			}
+		case *ast.JSXSpreadAttribute:
+			p.print("{...")
+			p.expression(attr.Argument, levelAssign, 0)
+			p.print("}")
+		default:
+			p.fail("unexpected JSX attribute type %T", attr)
+		}
+	}
+	if e.SelfClosing {
+		p.print(" />")
+		return
+	}
+	p.print(">")
+	p.jsxChildren(e.Children)
+	p.print("</")
+	p.jsxName(e.Name)
+	p.print(">")
+}
+
+func (p *printer) jsxFragment(e *ast.JSXFragment) {
+	p.op("<>")
+	p.jsxChildren(e.Children)
+	p.print("</>")
+}
+
+func (p *printer) jsxName(n ast.Expression) {
+	switch n := n.(type) {
+	case *ast.Identifier:
+		p.markName(n.Idx, n.Name.String())
+		p.print(n.Name.String())
+	case *ast.ThisExpression:
+		p.mark(n.Idx)
+		p.print("this")
+	case *ast.DotExpression:
+		p.jsxName(n.Left)
+		p.print(".")
+		p.jsxName(&n.Identifier)
+	case *ast.JSXNamespacedName:
+		p.jsxName(n.Namespace)
+		p.print(":")
+		p.jsxName(n.Name)
+	default:
+		p.fail("unexpected JSX name type %T", n)
+	}
+}
+
+func (p *printer) jsxAttributeValue(v ast.Expression) {
+	switch v := v.(type) {
+	case *ast.StringLiteral:
+		p.mark(v.Idx)
+		if v.Literal != "" {
+			p.print(v.Literal)
+		} else {
+			// there are no escape sequences in the JSX strings
+			p.print(`"` + jsxEscaper.Replace(v.Value.String()) + `"`)
+		}
+	case *ast.JSXExpressionContainer:
+		p.mark(v.LeftBrace)
+		p.print("{")
+		if v.Expression != nil {
+			p.expression(v.Expression, levelAssign, 0)
+		}
+		p.print("}")
+	default:
+		p.expression(v, levelAssign, 0)
+	}
+}
+
+func (p *printer) jsxChildren(list []ast.Expression) {
+	for _, child := range list {
+		p.mark(child.Idx0())
+		switch child := child.(type) {
+		case *ast.JSXText:
+			if child.Literal != "" || child.Value == "" {
+				p.print(child.Literal)
+			} else {
+				p.print(jsxEscaper.Replace(child.Value.String()))
+			}
+		case *ast.JSXExpressionContainer:
+			p.print("{")
+			if child.Expression != nil {
+				p.expression(child.Expression, levelAssign, 0)
+			} else {
+				p.innerComments(child, false)
+			}
+			p.print("}")
+		case *ast.JSXSpreadChild:
+			p.print("{...")
+			p.expression(child.Expression, levelAssign, 0)
+			p.print("}")
+		case *ast.JSXElement:
+			p.jsxElement(child)
+		case *ast.JSXFragment:
+			p.jsxFragment(child)
+		default:
+			p.fail("unexpected JSX child type %T", child)
+		}
+	}
+}
+
+var jsxEscaper = strings.NewReplacer("&", "&amp;", `"`, "&quot;", "<", "&lt;", ">", "&gt;", "{", "&#123;", "}", "&#125;")
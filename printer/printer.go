@@ -0,0 +1,362 @@
+/*
+Package printer implements printing of the AST nodes produced by the parser as JavaScript source code.
+
+	program, err := parser.ParseFile(nil, "test.js", src, 0)
+	...
+	var buf bytes.Buffer
+	m, err := (&printer.Config{Mode: printer.Minify}).Fprint(&buf, program)
+
+The output is valid JavaScript which, when parsed, produces an equivalent AST (except for the positions and the
+redundant parentheses): the parentheses are added where the operator precedence requires them and the statements
+are always terminated by semicolons, so the result does not depend on the automatic semicolon insertion. The AST
+may be modified (or built from scratch) before printing, in which case the literals without the original source text
+(i.e. with empty Literal fields) are printed based on their values.
+
+If the positions of the nodes refer to a file, a source map can be generated along with the code.
+*/
+package printer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/file"
+)
+
+// A Mode value is a set of flags (or 0). They control the output.
+type Mode uint
+
+const (
+	Minify         Mode = 1 << iota // Omit all optional whitespace and newlines
+	SourcesContent                  // Include the source code into the source map
+	Comments                        // Print the comments attached to the statements and the class elements (only the legal comments when minifying)
+)
+
+// A Config node controls the output of Fprint.
+type Config struct {
+	Mode Mode
+
+	// The indentation unit used when not minifying. If empty, 4 spaces are used.
+	Indent string
+
+	// The file which the positions of the nodes refer to. It is used to generate the source map and to print
+	// the BadExpression and BadStatement nodes. If nil and the node is an *ast.Program, its File is used.
+	File *file.File
+
+	// The comments to print in the Comments mode. If nil and the node is an *ast.Program, its CommentMap is used.
+	CommentMap ast.CommentMap
+}
+
+// Fprint prints the node (an *ast.Program, a statement, an expression or a class element) to w. If the positions
+// of the nodes refer to a file (see Config.File), the source map of the output is returned, otherwise the returned
+// map is nil. The mappings are recorded for the beginnings of the statements and the expressions and for all
+// identifiers (along with their names).
+func (cfg *Config) Fprint(w io.Writer, node ast.Node) (m *SourceMap, err error) {
+	p := &printer{
+		minify:   cfg.Mode&Minify != 0,
+		indent:   cfg.Indent,
+		file:     cfg.File,
+		comments: cfg.Mode&Comments != 0,
+		cmap:     cfg.CommentMap,
+
+		stmtStart:      -1,
+		arrowBodyStart: -1,
+		forOfStart:     -1,
+	}
+	if p.indent == "" {
+		p.indent = "    "
+	}
+	if prg, ok := node.(*ast.Program); ok {
+		if p.file == nil {
+			p.file = prg.File
+		}
+		if p.cmap == nil {
+			p.cmap = prg.CommentMap
+		}
+	}
+	if p.file != nil {
+		p.sm = newSourceMapBuilder(p.file)
+	}
+	defer func() {
+		if x := recover(); x != nil {
+			if e, ok := x.(printError); ok {
+				err = e
+				return
+			}
+			panic(x)
+		}
+	}()
+	p.node(node)
+	if _, err = w.Write(p.buf.Bytes()); err != nil {
+		return nil, err
+	}
+	if p.sm != nil {
+		m = p.sm.sourceMap(cfg.Mode&SourcesContent != 0)
+	}
+	return
+}
+
+// Fprint pretty-prints the node to w using the default configuration.
+func Fprint(w io.Writer, node ast.Node) error {
+	_, err := (&Config{}).Fprint(w, node)
+	return err
+}
+
+// Sprint pretty-prints the node using the default configuration and returns the result as a string. It returns an
+// empty string if the node cannot be printed.
+func Sprint(node ast.Node) string {
+	var buf bytes.Buffer
+	if Fprint(&buf, node) != nil {
+		return ""
+	}
+	return buf.String()
+}
+
+type printError struct {
+	error
+}
+
+type printer struct {
+	buf    bytes.Buffer
+	minify bool
+	indent string
+	level  int
+	file   *file.File
+	sm     *sourceMapBuilder
+
+	comments bool
+	cmap     ast.CommentMap
+	// set after a //-comment, the next output must start on a new line
+	needNewline bool
+
+	// the current generated position (the line is 0-based, the column is in UTF-16 code units)
+	line, col int
+
+	// the output offsets at which an expression statement, an arrow function body or the left-hand side of a for-of
+	// statement begins, the expressions that would be ambiguous at these positions are wrapped in parentheses
+	stmtStart, arrowBodyStart, forOfStart int
+}
+
+func (p *printer) fail(format string, args ...interface{}) {
+	panic(printError{errors.New("printer: " + fmt.Sprintf(format, args...))})
+}
+
+func (p *printer) print(s string) {
+	if s == "" {
+		return
+	}
+	if p.needNewline {
+		p.needNewline = false
+		if s[0] != '\n' {
+			p.print("\n")
+			if !p.minify {
+				for i := 0; i < p.level; i++ {
+					p.print(p.indent)
+				}
+			}
+		}
+	}
+	p.buf.WriteString(s)
+	last, lines := trimLastLine(s)
+	if lines > 0 {
+		p.line += lines
+		p.col = 0
+	}
+	p.col += utf16Len(last)
+}
+
+func (p *printer) lastByte() byte {
+	if b := p.buf.Bytes(); len(b) > 0 {
+		return b[len(b)-1]
+	}
+	return 0
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || c == '\\' || c >= 0x80 ||
+		'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+// word prints a keyword, an identifier or a number, separating it from the preceding one with a space if required.
+func (p *printer) word(s string) {
+	if len(s) > 0 && isWordByte(p.lastByte()) && isWordByte(s[0]) {
+		p.print(" ")
+	}
+	p.print(s)
+}
+
+// op prints an operator or a punctuator avoiding the sequences that would be tokenized differently (such as "+ +",
+// "/ /" or "<! --").
+func (p *printer) op(s string) {
+	if s == "" {
+		return
+	}
+	last := p.lastByte()
+	switch {
+	case last == '+' && s[0] == '+', last == '-' && s[0] == '-', last == '<' && s[0] == '<',
+		last == '/' && (s[0] == '/' || s[0] == '*'),
+		s[0] == '-' && bytes.HasSuffix(p.buf.Bytes(), []byte("<!")):
+		p.print(" ")
+	}
+	p.print(s)
+}
+
+// space prints a space unless minifying.
+func (p *printer) space() {
+	if !p.minify {
+		p.print(" ")
+	}
+}
+
+// newline starts a new line with the current indentation unless minifying.
+func (p *printer) newline() {
+	if p.minify {
+		return
+	}
+	p.print("\n")
+	for i := 0; i < p.level; i++ {
+		p.print(p.indent)
+	}
+}
+
+// mark records the source map mapping for the node which is about to be printed.
+func (p *printer) mark(idx file.Idx) {
+	if p.sm != nil {
+		p.sm.add(p.line, p.col, idx, "")
+	}
+}
+
+func (p *printer) markName(idx file.Idx, name string) {
+	if p.sm != nil {
+		p.sm.add(p.line, p.col, idx, name)
+	}
+}
+
+// source prints the original source of a bad node.
+func (p *printer) source(n ast.Node, from, to file.Idx) {
+	if p.file == nil {
+		p.fail("cannot print %T without the source file", n)
+	}
+	src := p.file.Source()
+	start, end := int(from)-p.file.Base(), int(to)-p.file.Base()
+	if start < 0 || end > len(src) || start > end {
+		p.fail("%T is outside of the source file", n)
+	}
+	p.mark(from)
+	p.word(src[start:end])
+}
+
+func (p *printer) node(n ast.Node) {
+	switch n := n.(type) {
+	case *ast.Program:
+		p.statementList(n.Body, true)
+		if len(n.Body) == 0 && p.innerComments(n, false) && !p.minify {
+			p.print("\n")
+		}
+	case ast.Statement:
+		p.statement(n)
+	case ast.Expression:
+		p.expression(n, levelLowest, 0)
+	case ast.ClassElement:
+		p.classElement(n)
+	default:
+		p.fail("unexpected node type %T", n)
+	}
+}
+
+// keepComment reports whether the comment should be printed. When minifying, only the legal comments and the
+// hashbang are kept.
+func (p *printer) keepComment(c *ast.Comment) bool {
+	return p.comments && (!p.minify || c.IsLegal() || c.Text[0] == '#')
+}
+
+// sameLine reports whether there are no line terminators in the source between the two indexes. It returns true if
+// the source is not available.
+func (p *printer) sameLine(idx0, idx1 file.Idx) bool {
+	if p.file == nil {
+		return true
+	}
+	src := p.file.Source()
+	start, end := int(idx0)-p.file.Base(), int(idx1)-p.file.Base()
+	if start < 0 || end > len(src) || start > end {
+		return true
+	}
+	return !strings.ContainsAny(src[start:end], "\r\n\u2028\u2029")
+}
+
+func (p *printer) comment(c *ast.Comment) {
+	p.op(c.Text)
+	if c.Text[1] == '/' || c.Text[0] == '#' {
+		p.needNewline = true
+	}
+}
+
+// leadingComments prints the comments preceding the node, each on its own line.
+func (p *printer) leadingComments(n ast.Node) {
+	if !p.comments {
+		return
+	}
+	for _, g := range p.cmap.Leading(n) {
+		for _, c := range g.List {
+			if p.keepComment(c) {
+				p.comment(c)
+				p.newline()
+			}
+		}
+	}
+}
+
+// trailingComments prints the comments following the node, on the same line if they are on the same line in
+// the source.
+func (p *printer) trailingComments(n ast.Node) {
+	if !p.comments {
+		return
+	}
+	prev := n.Idx1()
+	for _, g := range p.cmap.Trailing(n) {
+		for _, c := range g.List {
+			if p.keepComment(c) {
+				if p.sameLine(prev, c.Idx) {
+					p.space()
+				} else {
+					p.newline()
+				}
+				p.comment(c)
+			}
+			prev = c.Idx1()
+		}
+	}
+}
+
+// innerComments prints the comments inside the node which has no children, on separate lines if indent is true.
+// It reports whether anything has been printed.
+func (p *printer) innerComments(n ast.Node, indent bool) bool {
+	if !p.comments {
+		return false
+	}
+	printed := false
+	if c := p.cmap.Get(n); c != nil {
+		if indent {
+			p.level++
+		}
+		for _, g := range c.Inner {
+			for _, c := range g.List {
+				if p.keepComment(c) {
+					if printed || indent {
+						p.newline()
+					}
+					p.comment(c)
+					printed = true
+				}
+			}
+		}
+		if indent {
+			p.level--
+		}
+	}
+	return printed
+}
@@ -0,0 +1,383 @@
+package printer_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/parser"
+	"github.com/dop251/goja/printer"
+	"github.com/dop251/goja/token"
+	"github.com/dop251/goja/unistring"
+	"github.com/go-sourcemap/sourcemap"
+)
+
+const testScript = `"use strict";
+var a = 1, [b, , ...c] = [1, 2, 3], {d, e: f = 2, ...g} = {};
+let h = a?.b?.[c]?.(d).e;
+(a?.b).c;
+for (let j = 0, k = ("x" in a); j < 10; j++) { if (j) continue; else break; }
+for (var k in {}) ;
+for (const [l] of []) {}
+do { a++ } while (!a)
+while (false) debugger
+switch (a) { case 1: a = 2; default: }
+try { throw new Error(a) } catch ({message}) {} finally {}
+function* gen(x = 1, ...rest) { yield* rest; }
+async function af() { await 1; return; }
+const arrow = async (x) => ({x});
+class C extends Object {
+	#priv = 1;
+	static s;
+	static { this.s = 1; }
+	constructor() { super(); this.#priv; #priv in this; }
+	get [Symbol.iterator]() { return super.x; }
+	static async *m() {}
+}
+tag` + "`a${1}b${2}c`" + `;
+a = (1, /re/g, "s", true, 0n, ` + "`${a}`" + `)
+;({a} = b)
+;(function(){})()
+x = a + +b - -c + (a, b) * 2 ** -1 - (-2) ** 2;
+x = (a ?? b) || c;
+new (f())();
+new f().g();
+1..toString(); (1).toString();
+if (a) { if (b) c(); } else d();
+x = { get a() { return 1 }, set a(v) {}, async b() {}, *g() {}, [c]: 1, "d-e": 2, 3: 4 };
+lbl: for (;;) break lbl;
+`
+
+const testScriptPretty = `"use strict";
+var a = 1, [b, , ...c] = [1, 2, 3], { d, e: f = 2, ...g } = {};
+let h = a?.b?.[c]?.(d).e;
+(a?.b).c;
+for (let j = 0, k = ("x" in a); j < 10; j++) {
+    if (j)
+        continue;
+    else
+        break;
+}
+for (var k in {});
+for (const [l] of []) {}
+do {
+    a++;
+} while (!a);
+while (false)
+    debugger;
+switch (a) {
+case 1:
+    a = 2;
+default:
+}
+try {
+    throw new Error(a);
+} catch ({ message }) {} finally {}
+function* gen(x = 1, ...rest) {
+    yield* rest;
+}
+async function af() {
+    await 1;
+    return;
+}
+const arrow = async (x) => ({ x });
+class C extends Object {
+    #priv = 1;
+    static s;
+    static {
+        this.s = 1;
+    }
+    constructor() {
+        super();
+        this.#priv;
+        #priv in this;
+    }
+    get [Symbol.iterator]() {
+        return super.x;
+    }
+    static async *m() {}
+}
+tag` + "`a${1}b${2}c`" + `;
+a = (1, /re/g, "s", true, 0n, ` + "`${a}`" + `);
+({ a } = b);
+(function() {})();
+x = a + +b - -c + (a, b) * 2 ** -1 - (-2) ** 2;
+x = (a ?? b) || c;
+new (f())();
+new f().g();
+1..toString();
+(1).toString();
+if (a) {
+    if (b)
+        c();
+} else
+    d();
+x = {
+    get a() {
+        return 1;
+    },
+    set a(v) {},
+    async b() {},
+    *g() {},
+    [c]: 1,
+    "d-e": 2,
+    3: 4
+};
+lbl: for (;;)
+    break lbl;
+`
+
+func parse(t *testing.T, src string) *ast.Program {
+	t.Helper()
+	prg, err := parser.ParseFile(nil, "test.js", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return prg
+}
+
+func print(t *testing.T, node ast.Node, mode printer.Mode) (string, *printer.SourceMap) {
+	t.Helper()
+	var buf bytes.Buffer
+	m, err := (&printer.Config{Mode: mode}).Fprint(&buf, node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.String(), m
+}
+
+func TestPrint(t *testing.T) {
+	prg := parse(t, testScript)
+	pretty, _ := print(t, prg, 0)
+	if pretty != testScriptPretty {
+		t.Fatalf("unexpected output:\n%s", pretty)
+	}
+	minified, _ := print(t, prg, printer.Minify)
+	if strings.Contains(minified, "\n") {
+		t.Fatalf("newline in minified output:\n%s", minified)
+	}
+
+	// the output produces the same AST
+	for _, src := range []string{pretty, minified} {
+		out, _ := print(t, parse(t, src), 0)
+		if out != pretty {
+			t.Fatalf("the output of\n%s\nis\n%s", src, out)
+		}
+	}
+}
+
+func TestPrintSemantics(t *testing.T) {
+	tests := []string{
+		`var a = 1, b = 2, c = 3; [a - -b, a + +b, a - (-b), -(-a), a+ ++b, a-- - --b]`,
+		`[1 + 2 * 3, (1 + 2) * 3, 2 ** 3 ** 2, (2 ** 3) ** 2, 1 - (2 - 3), 1 - 2 - 3, (-2) ** 2]`,
+		`var x = null, y = 0; [x ?? (y || 5), (x ?? y) || 5, x || (y ?? 5)]`,
+		`var r = []; for (var i = ("a" in {a: 1}) ? 0 : 1; i < 2; i++) r.push(i); r`,
+		`var o = {a: {b: function() { return this.c }, c: 7}}; [o.a.b(), (0, o.a.b)() === undefined, (o?.a).c, o?.x?.y]`,
+		`function F() { return function() { return 42 } }; [new F()(), typeof new (F())(), (1).toFixed(1), 1.5.toFixed(0)]`,
+		`var s = "a\"b\\c\n "; [s, s.length, ` + "`x${s}y`" + `]`,
+		`var {a, b: [c, , d = 5], ...e} = {a: 1, b: [2, 3], f: 6}; [a, c, d, e.f]`,
+		`var x; ({x} = {x: 8}); var f = () => ({x}); [x, f().x]`,
+		`var r = ""; if (true) { if (false) r = "a" } else r = "b"; r`,
+		`class A { #p = 3; static s = 1; get p() { return this.#p } static has(o) { return #p in o } } [new A().p, A.has(new A()), A.s]`,
+		`var g = function*() { yield 1; yield* [2, 3] }; [...g()]`,
+		`var a = [1, , 3, ,]; [a.length, 1 in a]`,
+	}
+	for _, src := range tests {
+		prg := parse(t, src)
+		minified, _ := print(t, prg, printer.Minify)
+		pretty, _ := print(t, prg, 0)
+		expected, err := goja.New().RunString(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, out := range []string{minified, pretty} {
+			res, err := goja.New().RunString(out)
+			if err != nil {
+				t.Fatalf("%s: %v", out, err)
+			}
+			if exp, got := toJSON(t, expected), toJSON(t, res); exp != got {
+				t.Fatalf("%s: %s, expected %s", out, got, exp)
+			}
+		}
+	}
+}
+
+func toJSON(t *testing.T, v goja.Value) string {
+	b, err := json.Marshal(v.Export())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestPrintSynthetic(t *testing.T) {
+	id := func(name string) *ast.Identifier {
+		return &ast.Identifier{Name: unistring.String(name)}
+	}
+	num := func(v interface{}) *ast.NumberLiteral {
+		return &ast.NumberLiteral{Value: v}
+	}
+	bin := func(op token.Token, l, r ast.Expression) *ast.BinaryExpression {
+		return &ast.BinaryExpression{Operator: op, Left: l, Right: r}
+	}
+	tests := []struct {
+		node ast.Node
+		out  string
+	}{
+		{bin(token.MULTIPLY, bin(token.PLUS, id("a"), id("b")), id("c")), "(a+b)*c"},
+		{bin(token.MINUS, id("a"), bin(token.MINUS, id("b"), id("c"))), "a-(b-c)"},
+		{bin(token.COALESCE, id("a"), bin(token.LOGICAL_OR, id("b"), id("c"))), "a??(b||c)"},
+		{bin(token.MINUS, id("a"), num(int64(-1))), "a- -1"},
+		{bin(token.EXPONENT, num(float64(-1.5)), num(int64(2))), "(-1.5)**2"},
+		{&ast.DotExpression{Left: num(int64(1)), Identifier: *id("x")}, "(1).x"},
+		{&ast.StringLiteral{Value: "a\"\n\u2028b"}, `"a\"\n\u2028b"`},
+		{&ast.NewExpression{Callee: &ast.CallExpression{Callee: id("f")}}, "new(f())()"},
+		{&ast.ObjectLiteral{Value: []ast.Property{
+			&ast.PropertyKeyed{Key: &ast.StringLiteral{Value: "a"}, Kind: ast.PropertyKindValue, Value: num(int64(1))},
+			&ast.PropertyKeyed{Key: &ast.StringLiteral{Value: "b-c"}, Kind: ast.PropertyKindValue, Value: num(int64(2))},
+		}}, `{a:1,"b-c":2}`},
+		{&ast.ExpressionStatement{Expression: &ast.AssignExpression{
+			Operator: token.ASSIGN,
+			Left:     &ast.ObjectPattern{Properties: []ast.Property{&ast.PropertyShort{Name: *id("a")}}},
+			Right:    id("b"),
+		}}, "({a}=b);"},
+		{&ast.IfStatement{
+			Test:       id("a"),
+			Consequent: &ast.IfStatement{Test: id("b"), Consequent: &ast.ExpressionStatement{Expression: id("c")}},
+			Alternate:  &ast.ExpressionStatement{Expression: id("d")},
+		}, "if(a){if(b)c;}else d;"},
+		{&ast.TemplateLiteral{Elements: []*ast.TemplateElement{{Parsed: "`${x}"}}}, "`\\`\\${x}`"},
+	}
+	for _, test := range tests {
+		if out, m := print(t, test.node, printer.Minify); out != test.out {
+			t.Errorf("%s, expected %s", out, test.out)
+		} else if m != nil {
+			t.Error("unexpected source map")
+		}
+	}
+
+	if _, err := (&printer.Config{}).Fprint(&bytes.Buffer{}, &ast.BadExpression{From: 1, To: 2}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestPrintSourceMap(t *testing.T) {
+	const src = "function foo(x) {\n  return x + \"ü\" + bar;\n}\n"
+	prg := parse(t, src)
+	out, m := print(t, prg, printer.Minify|printer.SourcesContent)
+	if out != `function foo(x){return x+"ü"+bar;}` {
+		t.Fatal(out)
+	}
+	if m == nil {
+		t.Fatal("no source map")
+	}
+	if len(m.SourcesContent) != 1 || m.SourcesContent[0] != src {
+		t.Fatalf("sourcesContent: %v", m.SourcesContent)
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := sourcemap.Parse("test.js.map", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(genCol int, name string, line, col int) {
+		t.Helper()
+		source, n, l, c, ok := c.Source(1, genCol)
+		if !ok || source != "test.js" || n != name || l != line || c != col {
+			t.Fatalf("%d: %s %q %d:%d %v", genCol, source, n, l, c, ok)
+		}
+	}
+	// the lines are 1-based and the columns are 0-based
+	check(9, "foo", 1, 9)
+	check(16, "", 2, 2) // return
+	check(23, "x", 2, 9)
+	check(29, "bar", 2, 19) // after a non-ASCII string
+}
+
+func TestPrintComments(t *testing.T) {
+	const src = `/*! Copyright (c) Example, MIT license */
+// a
+function f(a) { // b
+	return a; /* c */
+}
+class C {
+	/** d */
+	m() {}
+}
+if (a) {} else { /* e */ }
+// @preserve f
+`
+	prg, err := parser.ParseFile(nil, "test.js", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pretty, _ := print(t, prg, printer.Comments)
+	const expected = `/*! Copyright (c) Example, MIT license */
+// a
+function f(a) {
+    // b
+    return a; /* c */
+}
+class C {
+    /** d */
+    m() {}
+}
+if (a) {} else {
+    /* e */
+}
+// @preserve f
+`
+	if pretty != expected {
+		t.Fatalf("unexpected output:\n%s", pretty)
+	}
+	minified, _ := print(t, prg, printer.Comments|printer.Minify)
+	if minified != "/*! Copyright (c) Example, MIT license */function f(a){return a;}class C{m(){}}if(a){}else{}// @preserve f" {
+		t.Fatalf("unexpected minified output:\n%s", minified)
+	}
+	if out, _ := print(t, prg, 0); strings.Contains(out, "/") {
+		t.Fatalf("comments are printed without the Comments mode:\n%s", out)
+	}
+}
+
+func TestPrintJSX(t *testing.T) {
+	const src = `const el = <div className="a&amp;b" data-x={1} {...props} ns:attr=<b />>
+	text &lt; {value} {/* empty */}<this.Item key={k}>{...children}</this.Item><></>
+</div>;
+x = a < <b /> && <A.B.C />;`
+	prg, err := parser.ParseFile(nil, "test.jsx", src, parser.JSX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pretty, _ := print(t, prg, 0)
+	minified, _ := print(t, prg, printer.Minify)
+	for _, out := range []string{pretty, minified} {
+		prg, err := parser.ParseFile(nil, "test.jsx", out, parser.JSX)
+		if err != nil {
+			t.Fatalf("%s: %v", out, err)
+		}
+		if res, _ := print(t, prg, 0); res != pretty {
+			t.Fatalf("the output of\n%s\nis\n%s", out, res)
+		}
+	}
+	if !strings.Contains(pretty, "\ttext &lt; {value} {}<this.Item key={k}>") {
+		t.Fatalf("the text is not preserved:\n%s", pretty)
+	}
+
+	// the synthetic text and strings are escaped
+	el := &ast.JSXElement{
+		Name: &ast.Identifier{Name: "p"},
+		Attributes: []ast.Expression{&ast.JSXAttribute{
+			Name:  &ast.Identifier{Name: "title"},
+			Value: &ast.StringLiteral{Value: `"a" & b`},
+		}},
+		Children: []ast.Expression{&ast.JSXText{Value: "{1 < 2}"}},
+	}
+	if s := printer.Sprint(el); s != `<p title="&quot;a&quot; &amp; b">&#123;1 &lt; 2&#125;</p>` {
+		t.Fatal(s)
+	}
+}
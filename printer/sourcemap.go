@@ -0,0 +1,218 @@
+package printer
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dop251/goja/file"
+)
+
+// SourceMap is a source map (revision 3) which maps the positions in the generated code to the positions in the
+// source file. It can be serialised using encoding/json.
+type SourceMap struct {
+	Version        int      `json:"version"`
+	File           string   `json:"file,omitempty"`
+	Sources        []string `json:"sources"`
+	SourcesContent []string `json:"sourcesContent,omitempty"`
+	Names          []string `json:"names"`
+	Mappings       string   `json:"mappings"`
+}
+
+// MarshalJSON is only needed to make sure the empty lists are not encoded as null.
+func (m *SourceMap) MarshalJSON() ([]byte, error) {
+	type sourceMap SourceMap
+	res := *m
+	if res.Sources == nil {
+		res.Sources = []string{}
+	}
+	if res.Names == nil {
+		res.Names = []string{}
+	}
+	return json.Marshal((*sourceMap)(&res))
+}
+
+const base64Chars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+func appendVLQ(b []byte, v int) []byte {
+	u := uint(v) << 1
+	if v < 0 {
+		u = uint(-v)<<1 | 1
+	}
+	for {
+		digit := u & 31
+		u >>= 5
+		if u != 0 {
+			digit |= 32
+		}
+		b = append(b, base64Chars[digit])
+		if u == 0 {
+			return b
+		}
+	}
+}
+
+// sourceMapBuilder accumulates the mappings for a single source file.
+type sourceMapBuilder struct {
+	f          *file.File
+	lineStarts []int
+
+	names   map[string]int
+	nameLst []string
+
+	mappings []byte
+	// the previous segment, the values are encoded relative to it
+	prev segment
+	// the last segment which has not been encoded yet
+	pending    segment
+	hasPending bool
+}
+
+type segment struct {
+	genLine, genCol, origLine, origCol int
+	name                               int // -1 if none
+}
+
+func newSourceMapBuilder(f *file.File) *sourceMapBuilder {
+	b := &sourceMapBuilder{
+		f:          f,
+		lineStarts: []int{0},
+	}
+	src := f.Source()
+	for i := 0; i < len(src); i++ {
+		switch src[i] {
+		case '\r':
+			if i+1 < len(src) && src[i+1] == '\n' {
+				i++
+			}
+			fallthrough
+		case '\n':
+			b.lineStarts = append(b.lineStarts, i+1)
+		}
+	}
+	return b
+}
+
+// position returns the 0-based line and UTF-16 column of the given index, or false if it does not belong to the file.
+func (b *sourceMapBuilder) position(idx file.Idx) (line, col int, ok bool) {
+	offset := int(idx) - b.f.Base()
+	src := b.f.Source()
+	if idx <= 0 || offset < 0 || offset > len(src) {
+		return 0, 0, false
+	}
+	lo, hi := 0, len(b.lineStarts)
+	for hi-lo > 1 {
+		m := (lo + hi) / 2
+		if b.lineStarts[m] <= offset {
+			lo = m
+		} else {
+			hi = m
+		}
+	}
+	return lo, utf16Len(src[b.lineStarts[lo]:offset]), true
+}
+
+func (b *sourceMapBuilder) name(name string) int {
+	n, exists := b.names[name]
+	if !exists {
+		if b.names == nil {
+			b.names = make(map[string]int)
+		}
+		n = len(b.nameLst)
+		b.names[name] = n
+		b.nameLst = append(b.nameLst, name)
+	}
+	return n
+}
+
+// add adds a mapping from the given generated position to the original position of idx. If name is not empty,
+// it is recorded as the original name of the symbol.
+func (b *sourceMapBuilder) add(genLine, genCol int, idx file.Idx, name string) {
+	origLine, origCol, ok := b.position(idx)
+	if !ok {
+		return
+	}
+	if b.hasPending && b.pending.genLine == genLine && b.pending.genCol == genCol {
+		// only one mapping per position: the outermost node wins, but the name of an identifier which starts
+		// at the same position is attached to it
+		if name != "" && b.pending.name < 0 && b.pending.origLine == origLine && b.pending.origCol == origCol {
+			b.pending.name = b.name(name)
+		}
+		return
+	}
+	b.flush()
+	b.pending = segment{genLine: genLine, genCol: genCol, origLine: origLine, origCol: origCol, name: -1}
+	if name != "" {
+		b.pending.name = b.name(name)
+	}
+	b.hasPending = true
+}
+
+func (b *sourceMapBuilder) flush() {
+	if !b.hasPending {
+		return
+	}
+	s := &b.pending
+	if s.genLine != b.prev.genLine {
+		for ; b.prev.genLine < s.genLine; b.prev.genLine++ {
+			b.mappings = append(b.mappings, ';')
+		}
+		b.prev.genCol = 0
+	} else if len(b.mappings) > 0 && b.mappings[len(b.mappings)-1] != ';' {
+		b.mappings = append(b.mappings, ',')
+	}
+	b.mappings = appendVLQ(b.mappings, s.genCol-b.prev.genCol)
+	b.mappings = appendVLQ(b.mappings, 0) // there is only one source
+	b.mappings = appendVLQ(b.mappings, s.origLine-b.prev.origLine)
+	b.mappings = appendVLQ(b.mappings, s.origCol-b.prev.origCol)
+	if s.name >= 0 {
+		b.mappings = appendVLQ(b.mappings, s.name-b.prev.name)
+		b.prev.name = s.name
+	}
+	b.prev.genCol, b.prev.origLine, b.prev.origCol = s.genCol, s.origLine, s.origCol
+	b.hasPending = false
+}
+
+func (b *sourceMapBuilder) sourceMap(withContent bool) *SourceMap {
+	b.flush()
+	m := &SourceMap{
+		Version:  3,
+		Sources:  []string{b.f.Name()},
+		Names:    b.nameLst,
+		Mappings: string(b.mappings),
+	}
+	if withContent {
+		m.SourcesContent = []string{b.f.Source()}
+	}
+	return m
+}
+
+// utf16Len returns the length of s in UTF-16 code units, which is what the source map columns are measured in.
+func utf16Len(s string) int {
+	n := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			n++
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+		i += size
+	}
+	return n
+}
+
+// trimLastLine returns the part of s after the last line terminator, and the number of line terminators in s.
+func trimLastLine(s string) (string, int) {
+	lines := strings.Count(s, "\n")
+	if lines > 0 {
+		s = s[strings.LastIndexByte(s, '\n')+1:]
+	}
+	return s, lines
+}
@@ -0,0 +1,354 @@
+package printer
+
+import (
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/token"
+)
+
+// statementList prints the statements each on its own line. If top is true, the first statement is not preceded by
+// a newline.
+func (p *printer) statementList(list []ast.Statement, top bool) {
+	for i, s := range list {
+		if i > 0 || !top {
+			p.newline()
+		}
+		p.statement(s)
+	}
+	if top && len(list) > 0 && !p.minify {
+		p.print("\n")
+	}
+}
+
+func (p *printer) block(b *ast.BlockStatement) {
+	p.mark(b.LeftBrace)
+	p.op("{")
+	if len(b.List) > 0 {
+		p.level++
+		p.statementList(b.List, false)
+		p.level--
+		p.newline()
+	} else if p.innerComments(b, true) {
+		p.newline()
+	}
+	p.op("}")
+}
+
+// body prints the body of an if, a loop, a with or a labelled statement.
+func (p *printer) body(s ast.Statement) {
+	switch s := s.(type) {
+	case *ast.BlockStatement:
+		p.space()
+		p.block(s)
+	case *ast.EmptyStatement:
+		p.mark(s.Semicolon)
+		p.op(";")
+	default:
+		p.level++
+		p.newline()
+		p.statement(s)
+		p.level--
+	}
+}
+
+// endsWithOpenIf reports whether the statement ends with an if statement without the else branch, in which case
+// an else that follows it would be attached to the wrong statement.
+func endsWithOpenIf(s ast.Statement) bool {
+	for {
+		switch st := s.(type) {
+		case *ast.IfStatement:
+			if st.Alternate == nil {
+				return true
+			}
+			s = st.Alternate
+		case *ast.LabelledStatement:
+			s = st.Statement
+		case *ast.ForStatement:
+			s = st.Body
+		case *ast.ForInStatement:
+			s = st.Body
+		case *ast.ForOfStatement:
+			s = st.Body
+		case *ast.WhileStatement:
+			s = st.Body
+		case *ast.WithStatement:
+			s = st.Body
+		default:
+			return false
+		}
+	}
+}
+
+func (p *printer) semicolon() {
+	p.op(";")
+}
+
+func (p *printer) bindingList(list []*ast.Binding, flags exprFlags) {
+	for i, b := range list {
+		if i > 0 {
+			p.op(",")
+			p.space()
+		}
+		p.binding(b, flags)
+	}
+}
+
+func (p *printer) statement(s ast.Statement) {
+	p.leadingComments(s)
+	p.mark(s.Idx0())
+	switch s := s.(type) {
+	case *ast.BadStatement:
+		p.source(s, s.From, s.To)
+
+	case *ast.EmptyStatement:
+		p.op(";")
+
+	case *ast.BlockStatement:
+		p.block(s)
+
+	case *ast.ExpressionStatement:
+		p.stmtStart = p.buf.Len()
+		p.expression(s.Expression, levelLowest, 0)
+		p.semicolon()
+
+	case *ast.VariableStatement:
+		p.word("var")
+		p.space()
+		p.bindingList(s.List, 0)
+		p.semicolon()
+
+	case *ast.LexicalDeclaration:
+		p.word(s.Token.String())
+		p.space()
+		p.bindingList(s.List, 0)
+		p.semicolon()
+
+	case *ast.FunctionDeclaration:
+		p.function(s.Function)
+
+	case *ast.ClassDeclaration:
+		p.class(s.Class)
+
+	case *ast.ReturnStatement:
+		p.word("return")
+		if s.Argument != nil {
+			p.space()
+			p.expression(s.Argument, levelLowest, 0)
+		}
+		p.semicolon()
+
+	case *ast.ThrowStatement:
+		p.word("throw")
+		p.space()
+		p.expression(s.Argument, levelLowest, 0)
+		p.semicolon()
+
+	case *ast.BranchStatement:
+		p.word(s.Token.String())
+		if s.Label != nil {
+			p.space()
+			p.identifier(s.Label)
+		}
+		p.semicolon()
+
+	case *ast.DebuggerStatement:
+		p.word("debugger")
+		p.semicolon()
+
+	case *ast.LabelledStatement:
+		p.identifier(s.Label)
+		p.op(":")
+		p.space()
+		p.statement(s.Statement)
+
+	case *ast.IfStatement:
+		p.word("if")
+		p.space()
+		p.op("(")
+		p.expression(s.Test, levelLowest, 0)
+		p.op(")")
+		if s.Alternate != nil && endsWithOpenIf(s.Consequent) {
+			p.space()
+			p.block(&ast.BlockStatement{List: []ast.Statement{s.Consequent}})
+		} else {
+			p.body(s.Consequent)
+		}
+		if s.Alternate != nil {
+			if _, ok := s.Consequent.(*ast.BlockStatement); ok {
+				p.space()
+			} else {
+				p.newline()
+			}
+			p.word("else")
+			if elseIf, ok := s.Alternate.(*ast.IfStatement); ok {
+				p.space()
+				p.statement(elseIf)
+			} else {
+				p.body(s.Alternate)
+			}
+		}
+
+	case *ast.DoWhileStatement:
+		p.word("do")
+		p.body(s.Body)
+		if _, ok := s.Body.(*ast.BlockStatement); ok {
+			p.space()
+		} else {
+			p.newline()
+		}
+		p.word("while")
+		p.space()
+		p.op("(")
+		p.expression(s.Test, levelLowest, 0)
+		p.op(")")
+		p.semicolon()
+
+	case *ast.WhileStatement:
+		p.word("while")
+		p.space()
+		p.op("(")
+		p.expression(s.Test, levelLowest, 0)
+		p.op(")")
+		p.body(s.Body)
+
+	case *ast.WithStatement:
+		p.word("with")
+		p.space()
+		p.op("(")
+		p.expression(s.Object, levelLowest, 0)
+		p.op(")")
+		p.body(s.Body)
+
+	case *ast.ForStatement:
+		p.word("for")
+		p.space()
+		p.op("(")
+		switch init := s.Initializer.(type) {
+		case nil:
+		case *ast.ForLoopInitializerExpression:
+			p.stmtStart = p.buf.Len()
+			p.expression(init.Expression, levelLowest, flagNoIn)
+		case *ast.ForLoopInitializerVarDeclList:
+			p.word("var")
+			p.space()
+			p.bindingList(init.List, flagNoIn)
+		case *ast.ForLoopInitializerLexicalDecl:
+			p.word(init.LexicalDeclaration.Token.String())
+			p.space()
+			p.bindingList(init.LexicalDeclaration.List, flagNoIn)
+		default:
+			p.fail("unexpected for loop initializer %T", init)
+		}
+		p.op(";")
+		if s.Test != nil {
+			p.space()
+			p.expression(s.Test, levelLowest, 0)
+		}
+		p.op(";")
+		if s.Update != nil {
+			p.space()
+			p.expression(s.Update, levelLowest, 0)
+		}
+		p.op(")")
+		p.body(s.Body)
+
+	case *ast.ForInStatement:
+		p.word("for")
+		p.space()
+		p.op("(")
+		p.forInto(s.Into)
+		p.space()
+		p.word("in")
+		p.space()
+		p.expression(s.Source, levelLowest, 0)
+		p.op(")")
+		p.body(s.Body)
+
+	case *ast.ForOfStatement:
+		p.word("for")
+		p.space()
+		p.op("(")
+		p.forInto(s.Into)
+		p.space()
+		p.word("of")
+		p.space()
+		p.expression(s.Source, levelAssign, 0)
+		p.op(")")
+		p.body(s.Body)
+
+	case *ast.SwitchStatement:
+		p.word("switch")
+		p.space()
+		p.op("(")
+		p.expression(s.Discriminant, levelLowest, 0)
+		p.op(")")
+		p.space()
+		p.op("{")
+		for _, c := range s.Body {
+			p.newline()
+			p.mark(c.Case)
+			if c.Test != nil {
+				p.word("case")
+				p.space()
+				p.expression(c.Test, levelLowest, 0)
+			} else {
+				p.word("default")
+			}
+			p.op(":")
+			p.level++
+			p.statementList(c.Consequent, false)
+			p.level--
+		}
+		p.newline()
+		p.op("}")
+
+	case *ast.TryStatement:
+		p.word("try")
+		p.space()
+		p.block(s.Body)
+		if s.Catch != nil {
+			p.space()
+			p.mark(s.Catch.Catch)
+			p.word("catch")
+			if s.Catch.Parameter != nil {
+				p.space()
+				p.op("(")
+				p.expression(s.Catch.Parameter, levelLowest, 0)
+				p.op(")")
+			}
+			p.space()
+			p.block(s.Catch.Body)
+		}
+		if s.Finally != nil {
+			p.space()
+			p.word("finally")
+			p.space()
+			p.block(s.Finally)
+		}
+
+	default:
+		p.fail("unexpected statement type %T", s)
+	}
+	p.trailingComments(s)
+}
+
+func (p *printer) forInto(into ast.ForInto) {
+	switch into := into.(type) {
+	case *ast.ForIntoVar:
+		p.word("var")
+		p.space()
+		p.binding(into.Binding, flagNoIn)
+	case *ast.ForDeclaration:
+		if into.IsConst {
+			p.word(token.CONST.String())
+		} else {
+			p.word(token.LET.String())
+		}
+		p.space()
+		p.expression(into.Target, levelAssign, 0)
+	case *ast.ForIntoExpression:
+		p.forOfStart = p.buf.Len()
+		p.expression(into.Expression, levelNew, 0)
+	default:
+		p.fail("unexpected for-in/of left-hand side %T", into)
+	}
+}
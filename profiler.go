@@ -3,11 +3,14 @@ package goja
 import (
 	"errors"
 	"io"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/dop251/goja/unistring"
 	"github.com/google/pprof/profile"
 )
 
@@ -35,6 +38,8 @@ type profTracker struct {
 	start, stop   time.Time
 	numFrames     int
 	frames        [profMaxStackDepth]StackFrame
+	labels        *profLabels
+	nativeFrames  bool
 }
 
 type profiler struct {
@@ -42,6 +47,30 @@ type profiler struct {
 	trackers []*profTracker
 	buf      *profBuffer
 	running  bool
+
+	interval     time.Duration
+	nativeFrames bool
+}
+
+// runtimeProfiler is a profiler started by Runtime.StartProfile.
+type runtimeProfiler struct {
+	profiler
+	w io.Writer
+}
+
+// profLabels is an immutable set of labels set by Runtime.SetProfileLabels.
+type profLabels struct {
+	key    string
+	labels map[string][]string
+}
+
+// ProfileOptions configures a profile started by Runtime.StartProfile.
+type ProfileOptions struct {
+	// The sampling period. If zero, 10ms is used.
+	Interval time.Duration
+	// If true, the native (Go) functions, including the built-ins, are included into the stacks. If such a function
+	// is being called when a sample is taken, the time is attributed to it rather than to the caller.
+	NativeFrames bool
 }
 
 type profFunc struct {
@@ -57,33 +86,70 @@ type profSampleNode struct {
 }
 
 type profBuffer struct {
-	funcs map[*Program]*profFunc
-	root  profSampleNode
+	funcs       map[*Program]*profFunc
+	nativeFuncs map[unistring.String]*profFunc
+	// sample trees by the labels key
+	roots map[string]*profSampleNode
+
+	nativeFrames bool
 }
 
-func (pb *profBuffer) addSample(pt *profTracker) {
-	sampleFrames := pt.frames[:pt.numFrames]
-	n := &pb.root
-	for j := len(sampleFrames) - 1; j >= 0; j-- {
-		frame := sampleFrames[j]
-		if frame.prg == nil {
-			continue
-		}
-		var f *profFunc
-		if f = pb.funcs[frame.prg]; f == nil {
+func (pb *profBuffer) location(frame *StackFrame) *profile.Location {
+	var f *profFunc
+	pc := int32(frame.pc)
+	if frame.prg == nil {
+		if f = pb.nativeFuncs[frame.funcName]; f == nil {
 			f = &profFunc{
-				locs: make(map[int32]*profile.Location),
+				locs: make(map[int32]*profile.Location, 1),
 			}
-			if pb.funcs == nil {
-				pb.funcs = make(map[*Program]*profFunc)
+			if pb.nativeFuncs == nil {
+				pb.nativeFuncs = make(map[unistring.String]*profFunc)
 			}
-			pb.funcs[frame.prg] = f
+			pb.nativeFuncs[frame.funcName] = f
+		}
+		pc = 0
+	} else if f = pb.funcs[frame.prg]; f == nil {
+		f = &profFunc{
+			locs: make(map[int32]*profile.Location),
 		}
-		var loc *profile.Location
-		if loc = f.locs[int32(frame.pc)]; loc == nil {
-			loc = &profile.Location{}
-			f.locs[int32(frame.pc)] = loc
+		if pb.funcs == nil {
+			pb.funcs = make(map[*Program]*profFunc)
 		}
+		pb.funcs[frame.prg] = f
+	}
+	loc := f.locs[pc]
+	if loc == nil {
+		loc = &profile.Location{}
+		f.locs[pc] = loc
+	}
+	return loc
+}
+
+func (pb *profBuffer) addTrackerSample(pt *profTracker) {
+	pb.addSample(pt.frames[:pt.numFrames], pt.labels, []int64{1, int64(pt.stop.Sub(pt.start)), 0})
+}
+
+// addSample adds values to the sample with the given stack and labels. The number of values must match
+// the number of the sample types of the profile.
+func (pb *profBuffer) addSample(sampleFrames []StackFrame, labels *profLabels, values []int64) {
+	var key string
+	if labels != nil {
+		key = labels.key
+	}
+	n := pb.roots[key]
+	if n == nil {
+		n = &profSampleNode{}
+		if pb.roots == nil {
+			pb.roots = make(map[string]*profSampleNode)
+		}
+		pb.roots[key] = n
+	}
+	for j := len(sampleFrames) - 1; j >= 0; j-- {
+		frame := &sampleFrames[j]
+		if frame.prg == nil && !pb.nativeFrames {
+			continue
+		}
+		loc := pb.location(frame)
 		if nn := n.children[loc]; nn == nil {
 			if n.children == nil {
 				n.children = make(map[*profile.Location]*profSampleNode, 1)
@@ -106,22 +172,33 @@ func (pb *profBuffer) addSample(pt *profTracker) {
 		}
 		smpl = &profile.Sample{
 			Location: locs,
-			Value:    make([]int64, 2),
+			Value:    make([]int64, len(values)),
+		}
+		if labels != nil {
+			smpl.Label = labels.labels
 		}
 		n.sample = smpl
 	}
-	smpl.Value[0]++
-	smpl.Value[1] += int64(pt.stop.Sub(pt.start))
+	for i, v := range values {
+		smpl.Value[i] += v
+	}
 }
 
-func (pb *profBuffer) profile() *profile.Profile {
-	pr := profile.Profile{}
-	pr.SampleType = []*profile.ValueType{
+func (pb *profBuffer) profile(interval time.Duration) *profile.Profile {
+	pr := pb.build([]*profile.ValueType{
 		{Type: "samples", Unit: "count"},
 		{Type: "cpu", Unit: "nanoseconds"},
-	}
+		{Type: "await", Unit: "nanoseconds"},
+	})
 	pr.PeriodType = pr.SampleType[1]
-	pr.Period = int64(profInterval)
+	pr.Period = int64(interval)
+	return pr
+}
+
+// build creates a profile with the given sample types from the collected samples.
+func (pb *profBuffer) build(sampleTypes []*profile.ValueType) *profile.Profile {
+	pr := profile.Profile{}
+	pr.SampleType = sampleTypes
 	mapping := &profile.Mapping{
 		ID:   1,
 		File: "[ECMAScript code]",
@@ -167,7 +244,32 @@ func (pb *profBuffer) profile() *profile.Profile {
 			pr.Location = append(pr.Location, loc)
 		}
 	}
-	pb.addSamples(&pr, &pb.root)
+	for name, f := range pb.nativeFuncs {
+		funcId++
+		f.f.ID = funcId
+		f.f.Filename = "<native>"
+		f.f.Name = name.String()
+		if _, exists := funcNames[f.f.Name]; exists {
+			f.f.Name += "." + strconv.FormatUint(f.f.ID, 10)
+		} else {
+			funcNames[f.f.Name] = struct{}{}
+		}
+		pr.Function = append(pr.Function, &f.f)
+		for _, loc := range f.locs {
+			locId++
+			loc.ID = locId
+			loc.Line = []profile.Line{
+				{
+					Function: &f.f,
+				},
+			}
+			loc.Mapping = mapping
+			pr.Location = append(pr.Location, loc)
+		}
+	}
+	for _, root := range pb.roots {
+		pb.addSamples(&pr, root)
+	}
 	return &pr
 }
 
@@ -181,7 +283,7 @@ func (pb *profBuffer) addSamples(p *profile.Profile, n *profSampleNode) {
 }
 
 func (p *profiler) run() {
-	ticker := time.NewTicker(profInterval)
+	ticker := time.NewTicker(p.getInterval())
 	counter := 0
 
 	for ts := range ticker.C {
@@ -199,7 +301,7 @@ func (p *profiler) run() {
 			tracker := p.trackers[counter]
 			req := atomic.LoadInt32(&tracker.req)
 			if req == profReqSampleReady {
-				p.buf.addSample(tracker)
+				p.buf.addTrackerSample(tracker)
 			}
 			if atomic.LoadInt32(&tracker.finished) != 0 {
 				p.trackers[counter] = p.trackers[len(p.trackers)-1]
@@ -227,8 +329,17 @@ func (p *profiler) run() {
 	p.mu.Unlock()
 }
 
+func (p *profiler) getInterval() time.Duration {
+	if p.interval > 0 {
+		return p.interval
+	}
+	return profInterval
+}
+
 func (p *profiler) registerVm() *profTracker {
-	pt := new(profTracker)
+	pt := &profTracker{
+		nativeFrames: p.nativeFrames,
+	}
 	p.mu.Lock()
 	if p.buf != nil {
 		p.trackers = append(p.trackers, pt)
@@ -249,7 +360,9 @@ func (p *profiler) start() error {
 		p.mu.Unlock()
 		return errors.New("profiler is already active")
 	}
-	p.buf = new(profBuffer)
+	p.buf = &profBuffer{
+		nativeFrames: p.nativeFrames,
+	}
 	p.mu.Unlock()
 	return nil
 }
@@ -264,7 +377,7 @@ func (p *profiler) stop() *profile.Profile {
 		for i, tracker := range trackers {
 			req := atomic.LoadInt32(&tracker.req)
 			if req == profReqSampleReady {
-				buf.addSample(tracker)
+				buf.addTrackerSample(tracker)
 			} else if req == profReqDoSample {
 				// In case the VM is requested to do a sample, there is a small chance of a race
 				// where we set profReqStop in between the read and the write, so that the req
@@ -304,11 +417,20 @@ func (p *profiler) stop() *profile.Profile {
 				}
 			}()
 		}
-		return buf.profile()
+		return buf.profile(p.getInterval())
 	}
 	return nil
 }
 
+// addAwaitSample records the time an async function has spent awaiting.
+func (p *profiler) addAwaitSample(frames []StackFrame, labels *profLabels, d time.Duration) {
+	p.mu.Lock()
+	if p.buf != nil {
+		p.buf.addSample(frames, labels, []int64{0, 0, int64(d)})
+	}
+	p.mu.Unlock()
+}
+
 /*
 StartProfile enables execution time profiling for all Runtimes within the current process.
 This works similar to pprof.StartCPUProfile and produces the same format which can be consumed by `go tool pprof`.
@@ -323,8 +445,13 @@ If there are multiple functions with the same name, their names get a '.N' suffi
 because otherwise the graph view merges them together (even if they are in different mappings). This includes
 "<anonymous>" functions.
 
+The time async functions spend awaiting is recorded in the 'await' sample, the stack of such samples is the stack
+of the awaiting function. The samples have the labels set by Runtime.SetProfileLabels.
+
 The sampling period is set to 10ms.
 
+The Runtimes which have their own profile active (see Runtime.StartProfile) are not included.
+
 It returns an error if profiling is already active.
 */
 func StartProfile(w io.Writer) error {
@@ -348,3 +475,130 @@ func StopProfile() {
 	}
 	globalProfiler.w = nil
 }
+
+/*
+StartProfile starts profiling this Runtime independently of the other Runtimes and of the process-wide profile (see
+the StartProfile function, the description of the format applies here as well). The profile is written to w when
+StopProfile is called. The profile is shared by all realms (see NewRealm).
+
+This method can be called from any goroutine, including while the Runtime is running. It returns an error if
+the Runtime is already being profiled.
+*/
+func (r *Runtime) StartProfile(w io.Writer, opts ProfileOptions) error {
+	rp := &runtimeProfiler{w: w}
+	rp.interval = opts.Interval
+	rp.nativeFrames = opts.NativeFrames
+	if err := rp.start(); err != nil {
+		return err
+	}
+	if !r.vm.rtProfiler.CompareAndSwap(nil, rp) {
+		rp.stop()
+		return errors.New("profiler is already active")
+	}
+	return nil
+}
+
+/*
+StopProfile stops the profile started by Runtime.StartProfile, if any, and writes it. It can be called from any
+goroutine.
+*/
+func (r *Runtime) StopProfile() error {
+	rp := r.vm.rtProfiler.Swap(nil)
+	if rp == nil {
+		return nil
+	}
+	if pr := rp.stop(); pr != nil {
+		return pr.Write(rp.w)
+	}
+	return nil
+}
+
+/*
+SetProfileLabels sets the pprof labels which are attached to the samples taken from this Runtime from now on (by both
+the Runtime and the process-wide profiles). This can be used, for example, to break down the profile of a
+Runtime pool by tenant. Passing an empty map removes the labels.
+*/
+func (r *Runtime) SetProfileLabels(labels map[string]string) {
+	if len(labels) == 0 {
+		r.vm.profLabels = nil
+		return
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	pl := &profLabels{
+		labels: make(map[string][]string, len(labels)),
+	}
+	for _, k := range keys {
+		v := labels[k]
+		b.WriteString(strconv.Quote(k))
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(v))
+		b.WriteByte(',')
+		pl.labels[k] = []string{v}
+	}
+	pl.key = b.String()
+	r.vm.profLabels = pl
+}
+
+// activeProfiler returns the profiler which the vm should use, or nil if there is none.
+func (vm *vm) activeProfiler() *profiler {
+	if rp := vm.rtProfiler.Load(); rp != nil {
+		return &rp.profiler
+	}
+	if atomic.LoadInt32(&globalProfiler.enabled) == 1 {
+		return &globalProfiler.p
+	}
+	return nil
+}
+
+// nativeCallee returns the native function called by the instruction at pc, if any.
+func (vm *vm) nativeCallee(pc int) *Object {
+	if n, ok := vm.prg.code[pc].(call); ok {
+		if obj, ok := vm.stack[vm.sp-int(n)-1].(*Object); ok {
+			switch obj.self.(type) {
+			case *nativeFuncObject, *wrappedFuncObject:
+				return obj
+			}
+		}
+	}
+	return nil
+}
+
+// addNativeFrame adds the frame of the native function the last sampled instruction has called to the top
+// of the stack. The name is only taken from an own data property, so that no user code is called.
+func (pt *profTracker) addNativeFrame(f *Object) {
+	n := pt.numFrames
+	if n == len(pt.frames) {
+		n--
+	}
+	copy(pt.frames[1:n+1], pt.frames[:n])
+	var name unistring.String
+	if s, ok := dataPropValue(f, "name").(String); ok {
+		name = s.string()
+	}
+	pt.frames[0] = StackFrame{funcName: name}
+	pt.numFrames = n + 1
+}
+
+// profileAwait records the time the async function has spent awaiting, if it was profiled.
+func (vm *vm) profileAwait(ar *asyncRunner) {
+	p := ar.awaitProf
+	if p == nil {
+		return
+	}
+	ar.awaitProf = nil
+	d := time.Since(ar.awaitStart)
+	ctx := &ar.gen.ctx
+	var funcName unistring.String
+	if ctx.prg != nil {
+		funcName = ctx.prg.funcName
+	} else {
+		funcName = getFuncName(ctx.stack, 1)
+	}
+	frames := vm.captureAsyncStack([]StackFrame{{prg: ctx.prg, pc: ctx.pc, funcName: funcName}}, ar)
+	p.addAwaitSample(frames, vm.profLabels, d)
+}
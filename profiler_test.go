@@ -1,9 +1,12 @@
 package goja
 
 import (
+	"bytes"
 	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/google/pprof/profile"
 )
 
 func TestProfiler(t *testing.T) {
@@ -100,3 +103,179 @@ func TestProfiler1(t *testing.T) {
 		t.Fatal("No samples were recorded")
 	}
 }
+
+func TestRuntimeProfile(t *testing.T) {
+	vm := New()
+	vm.Set("spin", func() {
+		time.Sleep(time.Millisecond)
+	})
+	p, resolve, _ := vm.NewPromise()
+	vm.Set("p", p)
+	vm.SetProfileLabels(map[string]string{"tenant": "t1"})
+
+	var buf bytes.Buffer
+	err := vm.StartProfile(&buf, ProfileOptions{Interval: time.Millisecond, NativeFrames: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.StartProfile(&buf, ProfileOptions{}); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	_, err = vm.RunScript("test.js", `
+	async function waiter() {
+		await p;
+	}
+	waiter();
+	for (let i = 0; i < 100; i++) {
+		spin();
+	}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	resolve(nil)
+	if _, err := vm.RunString(""); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.StopProfile(); err != nil {
+		t.Fatal(err)
+	}
+
+	pr, err := profile.Parse(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pr.SampleType) != 3 || pr.SampleType[2].Type != "await" {
+		t.Fatalf("Unexpected sample types: %v", pr.SampleType)
+	}
+	var native bool
+	var await time.Duration
+	for _, s := range pr.Sample {
+		if l := s.Label["tenant"]; len(l) != 1 || l[0] != "t1" {
+			t.Fatalf("Unexpected labels: %v", s.Label)
+		}
+		if s.Value[0] > 0 && len(s.Location) > 0 && s.Location[0].Line[0].Function.Filename == "<native>" {
+			native = true
+		}
+		if s.Value[2] > 0 {
+			if fn := s.Location[0].Line[0].Function; fn.Name != "waiter" {
+				t.Fatalf("Unexpected await sample function: %s", fn.Name)
+			}
+			await += time.Duration(s.Value[2])
+		}
+	}
+	if !native {
+		t.Fatal("No native frames were recorded")
+	}
+	if await < 20*time.Millisecond {
+		t.Fatalf("Unexpected await time: %v", await)
+	}
+}
+
+func TestRuntimeProfileNativeNameAccessor(t *testing.T) {
+	vm := New()
+	vm.Set("spin", func() {
+		time.Sleep(time.Millisecond)
+	})
+	var buf bytes.Buffer
+	if err := vm.StartProfile(&buf, ProfileOptions{Interval: time.Millisecond, NativeFrames: true}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := vm.RunScript("test.js", `
+	var nameCalls = 0;
+	Object.defineProperty(spin, "name", {get() { nameCalls++; return "spin"; }});
+	for (let i = 0; i < 50; i++) {
+		spin();
+	}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.StopProfile(); err != nil {
+		t.Fatal(err)
+	}
+	if n := vm.Get("nameCalls").ToInteger(); n != 0 {
+		t.Fatalf("the name getter has been called %d times", n)
+	}
+}
+
+func TestAllocProfile(t *testing.T) {
+	vm := New()
+	vm.SetProfileLabels(map[string]string{"tenant": "t1"})
+
+	var buf bytes.Buffer
+	err := vm.StartAllocProfile(&buf, AllocProfileOptions{SampleRate: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.StartAllocProfile(&buf, AllocProfileOptions{}); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	_, err = vm.RunScript("test.js", `
+	function makeObjects() {
+		const res = [];
+		for (let i = 0; i < 100; i++) {
+			res.push({i});
+		}
+		return res;
+	}
+	function makeStrings() {
+		let s = "";
+		for (let i = 0; i < 100; i++) {
+			s += "x";
+		}
+		return s;
+	}
+	function makeBuffer() {
+		return new ArrayBuffer(1000);
+	}
+	makeObjects();
+	makeStrings();
+	makeBuffer();
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.StopAllocProfile(); err != nil {
+		t.Fatal(err)
+	}
+
+	pr, err := profile.Parse(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pr.SampleType) != 2 || pr.SampleType[1].Type != "alloc_space" {
+		t.Fatalf("Unexpected sample types: %v", pr.SampleType)
+	}
+	type key struct {
+		fn, kind string
+	}
+	counts := make(map[key]int64)
+	space := make(map[key]int64)
+	for _, s := range pr.Sample {
+		if l := s.Label["tenant"]; len(l) != 1 || l[0] != "t1" {
+			t.Fatalf("Unexpected labels: %v", s.Label)
+		}
+		if len(s.Location) == 0 {
+			continue
+		}
+		k := key{s.Location[0].Line[0].Function.Name, s.Label["kind"][0]}
+		counts[k] += s.Value[0]
+		space[k] += s.Value[1]
+	}
+	if c := counts[key{"makeObjects", "object"}]; c != 100 {
+		t.Fatalf("Unexpected objects count: %d", c)
+	}
+	if c := counts[key{"makeStrings", "string"}]; c != 100 {
+		t.Fatalf("Unexpected strings count: %d", c)
+	}
+	if c := counts[key{"makeObjects", "array"}]; c < 2 {
+		t.Fatalf("Unexpected arrays count: %d", c)
+	}
+	if s := space[key{"makeBuffer", "arraybuffer"}]; s != 1000 {
+		t.Fatalf("Unexpected arraybuffer space: %d", s)
+	}
+}
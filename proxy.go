@@ -81,7 +81,7 @@ func (p Proxy) toValue(r *Runtime) Value {
 		return _null
 	}
 	proxy := p.proxy.val
-	if proxy.runtime != r {
+	if proxy.runtime.agent != r.agent {
 		panic(r.NewTypeError("Illegal runtime transition of a Proxy"))
 	}
 	return proxy
@@ -87,6 +87,8 @@ type global struct {
 	Map     *Object
 	Set     *Object
 
+	ShadowRealm *Object
+
 	Error          *Object
 	AggregateError *Object
 	TypeError      *Object
@@ -116,6 +118,7 @@ type global struct {
 	WeakMapPrototype     *Object
 	MapPrototype         *Object
 	SetPrototype         *Object
+	ShadowRealmPrototype *Object
 	PromisePrototype     *Object
 
 	GeneratorFunctionPrototype *Object
@@ -177,12 +180,59 @@ type RandSource func() float64
 
 type Now func() time.Time
 
+// CodeGenerationKind identifies the source of a dynamic code generation request (see CodeGenerationPolicy).
+type CodeGenerationKind int
+
+const (
+	// CodeGenerationEval is an indirect call to eval(), e.g. (0, eval)(src).
+	CodeGenerationEval CodeGenerationKind = iota
+	// CodeGenerationDirectEval is a direct call to eval(), i.e. eval(src).
+	CodeGenerationDirectEval
+	// CodeGenerationFunction is a call to the Function constructor.
+	CodeGenerationFunction
+	// CodeGenerationGeneratorFunction is a call to the GeneratorFunction constructor.
+	CodeGenerationGeneratorFunction
+	// CodeGenerationAsyncFunction is a call to the AsyncFunction constructor.
+	CodeGenerationAsyncFunction
+	// CodeGenerationShadowRealm is a call to ShadowRealm.prototype.evaluate().
+	CodeGenerationShadowRealm
+)
+
+func (k CodeGenerationKind) String() string {
+	switch k {
+	case CodeGenerationEval:
+		return "eval"
+	case CodeGenerationDirectEval:
+		return "direct eval"
+	case CodeGenerationFunction:
+		return "Function"
+	case CodeGenerationGeneratorFunction:
+		return "GeneratorFunction"
+	case CodeGenerationAsyncFunction:
+		return "AsyncFunction"
+	case CodeGenerationShadowRealm:
+		return "ShadowRealm"
+	}
+	return "unknown"
+}
+
+// CodeGenerationPolicy is called before a string is compiled by eval() or by one of the Function constructors.
+// For the constructors, src is the complete source of the function expression, i.e.
+// "(function anonymous(<parameters>\n) {\n<body>\n})", and a rewritten source must also be a single function
+// expression of the same kind, otherwise a SyntaxError is thrown.
+//
+// If it returns an error, the compilation is rejected and an EvalError with the error message is thrown.
+// Otherwise, the returned string is compiled instead of the original source, so the policy can rewrite the code
+// (return src unchanged to allow it as is). See Runtime.SetCodeGenerationPolicy().
+type CodeGenerationPolicy func(kind CodeGenerationKind, src string) (string, error)
+
 type Runtime struct {
 	global          global
 	globalObject    *Object
 	stringSingleton *stringObject
 	rand            RandSource
 	now             Now
+	location        *time.Location
 	_collator       *collate.Collator
 	parserOptions   []parser.Option
 
@@ -196,20 +246,42 @@ type Runtime struct {
 	vm   *vm
 	hash *maphash.Hash
 
+	// The Runtime that owns the vm and the agent-wide state (such as the job queue). For Runtimes created with
+	// New() it's the Runtime itself, for realms (see NewRealm) it's the parent Runtime.
+	agent *Runtime
+
 	jobQueue []func()
 
+	asyncScheduler AsyncScheduler
+	asyncQueue     *asyncQueue
+
 	promiseRejectionTracker PromiseRejectionTracker
 	asyncContextTracker     AsyncContextTracker
 
 	// Stack for tracking objects currently being converted to string
 	// to detect and handle circular references
 	toStringStack []*Object
+
+	checkpoint *checkpoint
+	lockdown   *lockdownOptions
+
+	codeGenerationPolicy CodeGenerationPolicy
+
+	shadowRealm            bool
+	shadowRealmInitializer ShadowRealmInitializer
+	shadowRealmImporter    ShadowRealmImporter
+
+	deterministic bool
+	recorder      *recorder
+
+	heapIDs *heapIDs
 }
 
 type StackFrame struct {
 	prg      *Program
 	funcName unistring.String
 	pc       int
+	async    bool
 }
 
 func (f *StackFrame) SrcName() string {
@@ -229,6 +301,13 @@ func (f *StackFrame) FuncName() string {
 	return f.funcName.String()
 }
 
+// IsAsync returns true if the frame is an async frame, i.e. it belongs to an async function which awaits
+// the completion of the code in the preceding frames (either directly or through a chain of Promises), or to
+// a Promise combinator such as Promise.all(). Such frames are prefixed with "async" in the stack traces.
+func (f *StackFrame) IsAsync() bool {
+	return f.async
+}
+
 func (f *StackFrame) Position() file.Position {
 	if f.prg == nil || f.prg.src == nil {
 		return file.Position{}
@@ -237,6 +316,9 @@ func (f *StackFrame) Position() file.Position {
 }
 
 func (f *StackFrame) WriteToValueBuilder(b *StringBuilder) {
+	if f.async {
+		b.writeASCII("async ")
+	}
 	if f.prg != nil {
 		if n := f.prg.funcName; n != "" {
 			b.WriteString(stringValueFromRaw(n))
@@ -271,6 +353,9 @@ func (f *StackFrame) WriteToValueBuilder(b *StringBuilder) {
 }
 
 func (f *StackFrame) Write(b *bytes.Buffer) {
+	if f.async {
+		b.WriteString("async ")
+	}
 	if f.prg != nil {
 		if n := f.prg.funcName; n != "" {
 			b.WriteString(n.String())
@@ -445,17 +530,21 @@ func (r *Runtime) getIteratorPrototype() *Object {
 func (r *Runtime) init() {
 	r.rand = rand.Float64
 	r.now = time.Now
+	r.initRealm()
 
+	r.agent = r
+	r.vm = &vm{
+		r: r,
+	}
+	r.vm.init()
+}
+
+func (r *Runtime) initRealm() {
 	r.global.ObjectPrototype = &Object{runtime: r}
 	r.newTemplatedObject(getObjectProtoTemplate(), r.global.ObjectPrototype)
 
 	r.globalObject = &Object{runtime: r}
 	r.newTemplatedObject(getGlobalObjectTemplate(), r.globalObject)
-
-	r.vm = &vm{
-		r: r,
-	}
-	r.vm.init()
 }
 
 func (r *Runtime) typeErrorResult(throw bool, args ...interface{}) {
@@ -758,6 +847,7 @@ func (r *Runtime) newNativeFunc(call func(FunctionCall) Value, name unistring.St
 func (r *Runtime) newWrappedFunc(value reflect.Value) *Object {
 
 	v := &Object{runtime: r}
+	name := unistring.NewFromString(runtime.FuncForPC(value.Pointer()).Name())
 
 	f := &wrappedFuncObject{
 		nativeFuncObject: nativeFuncObject{
@@ -769,12 +859,11 @@ func (r *Runtime) newWrappedFunc(value reflect.Value) *Object {
 					prototype:  r.getFunctionPrototype(),
 				},
 			},
-			f: r.wrapReflectFunc(value),
+			f: r.hostFunc(name, r.wrapReflectFunc(value)),
 		},
 		wrapped: value,
 	}
 	v.self = f
-	name := unistring.NewFromString(runtime.FuncForPC(value.Pointer()).Name())
 	f.init(name, intToValue(int64(value.Type().NumIn())))
 	return v
 }
@@ -916,7 +1005,20 @@ func (r *Runtime) builtin_thrower(call FunctionCall) Value {
 	return nil
 }
 
-func (r *Runtime) eval(srcVal String, direct, strict bool) Value {
+func (r *Runtime) checkCodeGeneration(kind CodeGenerationKind, src String) String {
+	if r.codeGenerationPolicy == nil {
+		return src
+	}
+	newSrc, err := r.codeGenerationPolicy(kind, src.String())
+	if err != nil {
+		panic(r.newError(r.getEvalError(), err.Error()))
+	}
+	return newStringValue(newSrc)
+}
+
+// eval compiles and runs the source which has been allowed by checkCodeGeneration.
+func (r *Runtime) eval(srcVal String, kind CodeGenerationKind, strict bool) Value {
+	direct := kind == CodeGenerationDirectEval
 	src := escapeInvalidUtf16(srcVal)
 	vm := r.vm
 	inGlobal := true
@@ -929,6 +1031,7 @@ func (r *Runtime) eval(srcVal String, direct, strict bool) Value {
 		}
 	}
 	vm.pushCtx()
+	vm.r = r
 	funcObj := _undefined
 	if !direct {
 		vm.stash = &r.global.stash
@@ -942,7 +1045,21 @@ func (r *Runtime) eval(srcVal String, direct, strict bool) Value {
 	if err != nil {
 		panic(err)
 	}
+	return vm.runEval(p, funcObj)
+}
+
+// evalGlobal runs a Program compiled as indirect eval code in the global scope of the realm.
+func (r *Runtime) evalGlobal(p *Program) Value {
+	vm := r.vm
+	vm.pushCtx()
+	vm.r = r
+	vm.stash = &r.global.stash
+	vm.privEnv = nil
+	return vm.runEval(p, _undefined)
+}
 
+// runEval runs the eval code in the context that has been pushed by the caller and pops it.
+func (vm *vm) runEval(p *Program, funcObj Value) Value {
 	vm.prg = p
 	vm.pc = 0
 	vm.args = 0
@@ -965,7 +1082,7 @@ func (r *Runtime) builtin_eval(call FunctionCall) Value {
 		return _undefined
 	}
 	if str, ok := call.Arguments[0].(String); ok {
-		return r.eval(str, false, false)
+		return r.eval(r.checkCodeGeneration(CodeGenerationEval, str), CodeGenerationEval, false)
 	}
 	return call.Arguments[0]
 }
@@ -1300,18 +1417,89 @@ func New() *Runtime {
 	return r
 }
 
+/*
+NewRealm creates a new realm, i.e. a Runtime with its own global object and its own set of built-in objects, which
+shares the VM and the heap with r. The objects can be passed freely between the realms, for example a function
+created in one realm can be called from another one, in which case it runs in the realm where it was created.
+Note that the built-ins are distinct, so, for example, an array from another realm is not an instanceof Array.
+
+The realm inherits the settings of r (such as SetRandSource, SetTimeSource, SetTimeZone, SetDeterministic,
+SetFieldNameMapper, SetParserOptions, SetCodeGenerationPolicy, EnableShadowRealm, SetShadowRealmInitializer and
+SetShadowRealmImporter)
+at the time of creation, they can be changed independently afterwards. The agent-wide state, i.e. the job queue,
+the async scheduler, the trackers set with SetPromiseRejectionTracker and SetAsyncContextTracker, the Symbol registry
+and the recording (see StartRecording), is shared with r. Lockdown and Checkpoint apply to the realm they are
+called on.
+
+The realm can only be used from the goroutine that uses r (and vice versa). Interrupting one of them
+interrupts both.
+*/
+func (r *Runtime) NewRealm() *Runtime {
+	realm := &Runtime{
+		agent:                r.agent,
+		vm:                   r.vm,
+		rand:                 r.rand,
+		now:                  r.now,
+		location:             r.location,
+		deterministic:        r.deterministic,
+		parserOptions:        r.parserOptions,
+		fieldNameMapper:      r.fieldNameMapper,
+		codeGenerationPolicy: r.codeGenerationPolicy,
+
+		shadowRealmInitializer: r.shadowRealmInitializer,
+		shadowRealmImporter:    r.shadowRealmImporter,
+	}
+	realm.initRealm()
+	if r.shadowRealm {
+		realm.EnableShadowRealm()
+	}
+	return realm
+}
+
 // Compile creates an internal representation of the JavaScript code that can be later run using the Runtime.RunProgram()
 // method. This representation is not linked to a runtime in any way and can be run in multiple runtimes (possibly
 // at the same time).
 func Compile(name, src string, strict bool) (*Program, error) {
-	return compile(name, src, strict, true, nil)
+	return compile(name, src, strict, true, nil, false)
 }
 
 // CompileAST creates an internal representation of the JavaScript code that can be later run using the Runtime.RunProgram()
 // method. This representation is not linked to a runtime in any way and can be run in multiple runtimes (possibly
 // at the same time).
 func CompileAST(prg *js_ast.Program, strict bool) (*Program, error) {
-	return compileAST(prg, strict, true, nil)
+	return compileAST(prg, strict, true, nil, false, false)
+}
+
+// CompileForCoverage is like Compile, but the Program also records the beginning of every statement and branch,
+// so that it can be reported when the Program is run with the coverage enabled (see Runtime.SetCoverage).
+// These records make the Program larger, that's why Compile does not produce them.
+func CompileForCoverage(name, src string, strict bool) (*Program, error) {
+	return compile(name, src, strict, true, nil, true)
+}
+
+// CompileLazy is like Compile, but the bodies of the functions are compiled on their first invocation rather than
+// upfront, which reduces the start-up time of large scripts most of which never runs. The compiled bodies are cached
+// in the Program, so they are shared by all the runtimes running it.
+//
+// The source is still parsed entirely and the function bodies are checked for the early errors (such as
+// a redeclaration of a lexical binding or a delete of an unqualified identifier in strict mode), so CompileLazy
+// returns the same errors as Compile.
+//
+// The Program retains the AST and the compiler state needed to compile the remaining functions. The variables
+// of the enclosing functions referred to by a lazily compiled function are always allocated in the heap, so the code
+// may run slightly slower than the one produced by Compile. The functions which could affect the enclosing scopes
+// in other ways (e.g. by calling eval()) are compiled upfront.
+func CompileLazy(name, src string, strict bool) (*Program, error) {
+	prg, err := Parse(name, src)
+	if err != nil {
+		return nil, err
+	}
+	return CompileASTLazy(prg, strict)
+}
+
+// CompileASTLazy is like CompileAST, but compiles the function bodies lazily (see CompileLazy).
+func CompileASTLazy(prg *js_ast.Program, strict bool) (*Program, error) {
+	return compileAST(prg, strict, true, nil, true, false)
 }
 
 // MustCompile is like Compile but panics if the code cannot be compiled.
@@ -1347,17 +1535,19 @@ func Parse(name, src string, options ...parser.Option) (prg *js_ast.Program, err
 	return
 }
 
-func compile(name, src string, strict, inGlobal bool, evalVm *vm, parserOptions ...parser.Option) (p *Program, err error) {
+func compile(name, src string, strict, inGlobal bool, evalVm *vm, coverage bool, parserOptions ...parser.Option) (p *Program, err error) {
 	prg, err := Parse(name, src, parserOptions...)
 	if err != nil {
 		return
 	}
 
-	return compileAST(prg, strict, inGlobal, evalVm)
+	return compileAST(prg, strict, inGlobal, evalVm, false, coverage)
 }
 
-func compileAST(prg *js_ast.Program, strict, inGlobal bool, evalVm *vm) (p *Program, err error) {
+func compileAST(prg *js_ast.Program, strict, inGlobal bool, evalVm *vm, lazy, coverage bool) (p *Program, err error) {
 	c := newCompiler()
+	c.lazy = lazy
+	c.coverage = coverage
 
 	defer func() {
 		if x := recover(); x != nil {
@@ -1377,22 +1567,28 @@ func compileAST(prg *js_ast.Program, strict, inGlobal bool, evalVm *vm) (p *Prog
 }
 
 func (r *Runtime) compile(name, src string, strict, inGlobal bool, evalVm *vm) (p *Program, err error) {
-	p, err = compile(name, src, strict, inGlobal, evalVm, r.parserOptions...)
+	p, err = compile(name, src, strict, inGlobal, evalVm, r.vm.coverage != nil, r.parserOptions...)
 	if err != nil {
-		switch x1 := err.(type) {
-		case *CompilerSyntaxError:
-			err = &Exception{
-				val: r.builtin_new(r.getSyntaxError(), []Value{newStringValue(x1.Error())}),
-			}
-		case *CompilerReferenceError:
-			err = &Exception{
-				val: r.newError(r.getReferenceError(), x1.Message),
-			} // TODO proper message
-		}
+		err = r.compileError(err)
 	}
 	return
 }
 
+// compileError converts a compilation error into an Exception with an error object of the realm.
+func (r *Runtime) compileError(err error) error {
+	switch x1 := err.(type) {
+	case *CompilerSyntaxError:
+		err = &Exception{
+			val: r.builtin_new(r.getSyntaxError(), []Value{newStringValue(x1.Error())}),
+		}
+	case *CompilerReferenceError:
+		err = &Exception{
+			val: r.newError(r.getReferenceError(), x1.Message),
+		} // TODO proper message
+	}
+	return err
+}
+
 // RunString executes the given string in the global context.
 func (r *Runtime) RunString(str string) (Value, error) {
 	return r.RunScript("", str)
@@ -1440,6 +1636,7 @@ func (r *Runtime) RunProgram(p *Program) (result Value, err error) {
 			vm.popCtx()
 		} else {
 			vm.callStack = vm.callStack[:len(vm.callStack)-1]
+			vm.r = r.agent
 		}
 		if x := recover(); x != nil {
 			if ex := asUncatchableException(x); ex != nil {
@@ -1467,6 +1664,7 @@ func (r *Runtime) RunProgram(p *Program) (result Value, err error) {
 	} else {
 		vm.callStack = append(vm.callStack, context{})
 	}
+	vm.r = r
 	vm.prg = p
 	vm.pc = 0
 	vm.result = _undefined
@@ -1698,6 +1896,14 @@ converted into a JS exception. If the error is *Exception, it is thrown as is, o
 Note that if there are exactly two return values and the last is an `error`, the function returns the first value as is,
 not an Array.
 
+If a function returns a *Future or a receive-only channel (<-chan T) as its only value (not counting the trailing
+`error`), the result is a Promise which is settled once the Future completes or the first value is received from
+the channel. See Future and Runtime.SetAsyncScheduler() for more details.
+
+# Futures
+
+A *Future is converted into a Promise, see above.
+
 # Structs
 
 Structs are converted to Object-like values. Fields and methods are available as properties, their values are
@@ -1799,7 +2005,7 @@ func (r *Runtime) toValue(i interface{}, origValue reflect.Value) Value {
 		if i == nil || i.self == nil {
 			return _null
 		}
-		if i.runtime != nil && i.runtime != r {
+		if i.runtime != nil && i.runtime.agent != r.agent {
 			panic(r.NewTypeError("Illegal runtime transition of an Object"))
 		}
 		return i
@@ -1823,12 +2029,12 @@ func (r *Runtime) toValue(i interface{}, origValue reflect.Value) Value {
 		}
 	case func(FunctionCall) Value:
 		name := unistring.NewFromString(runtime.FuncForPC(reflect.ValueOf(i).Pointer()).Name())
-		return r.newNativeFunc(i, name, 0)
+		return r.newNativeFunc(r.hostFunc(name, i), name, 0)
 	case func(FunctionCall, *Runtime) Value:
 		name := unistring.NewFromString(runtime.FuncForPC(reflect.ValueOf(i).Pointer()).Name())
-		return r.newNativeFunc(func(call FunctionCall) Value {
+		return r.newNativeFunc(r.hostFunc(name, func(call FunctionCall) Value {
 			return i(call, r)
-		}, name, 0)
+		}), name, 0)
 	case func(ConstructorCall) *Object:
 		name := unistring.NewFromString(runtime.FuncForPC(reflect.ValueOf(i).Pointer()).Name())
 		return r.newNativeConstructor(i, name, 0)
@@ -2052,6 +2258,9 @@ func (r *Runtime) wrapReflectFunc(value reflect.Value) func(FunctionCall) Value
 		case 0:
 			return _undefined
 		case 1:
+			if isRecvChan(out[0].Type()) && !out[0].IsNil() {
+				return r.futureToPromise(chanToFuture(out[0]))
+			}
 			return r.ToValue(out[0].Interface())
 		default:
 			s := make([]interface{}, len(out))
@@ -2126,7 +2335,7 @@ func (r *Runtime) toReflectValue(v Value, dst reflect.Value, ctx *objectExportCt
 			}
 		}
 		if et.Kind() == reflect.String {
-			tme, ok := dateParse(v.String())
+			tme, ok := dateParse(v.String(), r.getLocation())
 			if !ok {
 				return fmt.Errorf("could not convert string %v to %v", v, typ)
 			}
@@ -2437,11 +2646,60 @@ func (r *Runtime) SetTimeSource(now Now) {
 	r.now = now
 }
 
+// SetTimeZone sets the local time zone used by Date for this Runtime. If not called (or if loc is nil),
+// time.Local is used.
+func (r *Runtime) SetTimeZone(loc *time.Location) {
+	r.location = loc
+}
+
+func (r *Runtime) getLocation() *time.Location {
+	if loc := r.location; loc != nil {
+		return loc
+	}
+	return time.Local
+}
+
 // SetParserOptions sets parser options to be used by RunString, RunScript and eval() within the code.
 func (r *Runtime) SetParserOptions(opts ...parser.Option) {
 	r.parserOptions = opts
 }
 
+// SetCodeGenerationPolicy sets a function that controls dynamic code generation from strings, i.e. eval() and
+// the Function, GeneratorFunction and AsyncFunction constructors (similar to the 'unsafe-eval' directive of the
+// Content Security Policy). The policy can reject the code or rewrite it (see CodeGenerationPolicy).
+// Setting it to nil (the default) allows everything.
+// Note that compiling code with RunString, RunScript, etc. is not affected.
+func (r *Runtime) SetCodeGenerationPolicy(policy CodeGenerationPolicy) {
+	r.codeGenerationPolicy = policy
+}
+
+// EnableShadowRealm adds the ShadowRealm constructor to the global object. ShadowRealm is not a part of the standard
+// yet (it's a TC39 proposal), so it's not available by default. The realms created by NewRealm and by the ShadowRealm
+// constructor inherit this setting.
+func (r *Runtime) EnableShadowRealm() {
+	if r.shadowRealm {
+		return
+	}
+	r.shadowRealm = true
+	ctor := r.getShadowRealm()
+	if r.lockdown != nil {
+		r.deepFreeze([]*Object{ctor}, r.lockdown.intrinsics, map[*Object]struct{}{r.globalObject: {}}, true)
+	}
+	r.globalObject.self._putProp("ShadowRealm", ctor, true, false, true)
+}
+
+// SetShadowRealmInitializer sets a function which is called for every realm created by the ShadowRealm constructor
+// (see ShadowRealmInitializer). Setting it to nil (the default) creates realms with the standard built-ins only.
+func (r *Runtime) SetShadowRealmInitializer(initializer ShadowRealmInitializer) {
+	r.shadowRealmInitializer = initializer
+}
+
+// SetShadowRealmImporter sets a function which loads modules for ShadowRealm.prototype.importValue()
+// (see ShadowRealmImporter). If it's nil (the default), importValue() always returns a rejected Promise.
+func (r *Runtime) SetShadowRealmImporter(importer ShadowRealmImporter) {
+	r.shadowRealmImporter = importer
+}
+
 // SetMaxCallStackSize sets the maximum function call depth. When exceeded, a *StackOverflowError is thrown and
 // returned by RunProgram or by a Callable call. This is useful to prevent memory exhaustion caused by an
 // infinite recursion. The default value is math.MaxInt32.
@@ -2835,19 +3093,19 @@ func (r *Runtime) getHash() *maphash.Hash {
 // called when the top level function returns normally (i.e. control is passed outside the Runtime).
 func (r *Runtime) leave() {
 	var jobs []func()
-	for len(r.jobQueue) > 0 {
-		jobs, r.jobQueue = r.jobQueue, jobs[:0]
+	for len(r.agent.jobQueue) > 0 {
+		jobs, r.agent.jobQueue = r.agent.jobQueue, jobs[:0]
 		for _, job := range jobs {
 			job()
 		}
 	}
-	r.jobQueue = nil
+	r.agent.jobQueue = nil
 	r.vm.stack = nil
 }
 
 // called when the top level function returns (i.e. control is passed outside the Runtime) but it was due to an interrupt
 func (r *Runtime) leaveAbrupt() {
-	r.jobQueue = nil
+	r.agent.jobQueue = nil
 	r.ClearInterrupt()
 }
 
@@ -2946,8 +3204,8 @@ func (r *Runtime) setGlobal(name unistring.String, v Value, strict bool) {
 }
 
 func (r *Runtime) trackPromiseRejection(p *Promise, operation PromiseRejectionOperation) {
-	if r.promiseRejectionTracker != nil {
-		r.promiseRejectionTracker(p, operation)
+	if r.agent.promiseRejectionTracker != nil {
+		r.agent.promiseRejectionTracker(p, operation)
 	}
 }
 
@@ -2507,6 +2507,34 @@ func TestErrorStackRethrow(t *testing.T) {
 	testScriptWithTestLibX(SCRIPT, _undefined, t)
 }
 
+func TestTypeScriptStacktrace(t *testing.T) {
+	const SCRIPT = `interface Point { x: number; y: number }
+function dist<T extends Point>(p: T, q?: T): number {
+	if (!q) {
+		throw new Error("no point") as Error;
+	}
+	return Math.hypot(p.x - q!.x, p.y - q!.y);
+}
+dist<Point>({x: 1, y: 2});
+`
+	prg, err := parser.ParseFile(nil, "test.ts", SCRIPT, parser.TypeScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := CompileAST(prg, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = New().RunProgram(p)
+	ex, ok := err.(*Exception)
+	if !ok {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if s := ex.String(); !strings.Contains(s, "at dist (test.ts:4:9(") || !strings.Contains(s, "at test.ts:8:12(") {
+		t.Fatal(s)
+	}
+}
+
 func TestStacktraceLocationThrowFromGo(t *testing.T) {
 	vm := New()
 	f := func() {
@@ -2998,8 +3026,48 @@ func TestAsyncStacktrace(t *testing.T) {
 	} catch (e) {
 		assertStack(e, [
 			["test.js", "bar", 9, 10],
-			["test.js", "foo", 4, 13],
-			["test.js", "test", 13, 12],
+			["test.js", "async foo", 4, 13],
+			["test.js", "async test", 13, 12],
+		]);
+	}
+	`
+	testAsyncFuncWithTestLibX(SCRIPT, _undefined, t)
+}
+
+func TestAsyncStacktracePromiseChain(t *testing.T) {
+	// Do not reformat, assertions depend on the line and column numbers
+	const SCRIPT = `
+	async function bar() {
+	  await null;
+	  throw new Error("Let's have a look...");
+	}
+
+	async function viaAll() {
+	  await Promise.all([1, bar()]);
+	}
+
+	async function viaReturn() {
+	  return viaAll();
+	}
+
+	try {
+		await viaReturn().then(x => x);
+	} catch (e) {
+		assertStack(e, [
+			["test.js", "bar", 4, 10],
+			["native", "async Promise.all", "", ""],
+			["test.js", "async viaAll", 8, 21],
+		]);
+	}
+
+	try {
+		await Promise.resolve().then(function cb() {
+			throw new Error("In a callback");
+		});
+	} catch (e) {
+		assertStack(e, [
+			["test.js", "cb", 27, 10],
+			["test.js", "async test", 26, 31],
 		]);
 	}
 	`
@@ -3132,6 +3200,123 @@ func TestClassReexport(t *testing.T) {
 	`, valueTrue, t)
 }
 
+func TestCodeGenerationPolicy(t *testing.T) {
+	vm := New()
+	var kinds []CodeGenerationKind
+	vm.SetCodeGenerationPolicy(func(kind CodeGenerationKind, src string) (string, error) {
+		kinds = append(kinds, kind)
+		if strings.Contains(src, "forbidden") {
+			return "", errors.New("code generation from strings disallowed")
+		}
+		return strings.ReplaceAll(src, "REPLACE_ME", "42"), nil
+	})
+	_, err := vm.RunString(TESTLIB + `
+	assert.sameValue(eval("REPLACE_ME"), 42, "direct eval");
+	assert.sameValue((0, eval)("REPLACE_ME"), 42, "indirect eval");
+	assert.sameValue(new Function("a", "return a + REPLACE_ME")(1), 43, "Function");
+	const GeneratorFunction = Object.getPrototypeOf(function*() {}).constructor;
+	assert.sameValue(new GeneratorFunction("yield REPLACE_ME")().next().value, 42, "GeneratorFunction");
+	const AsyncFunction = Object.getPrototypeOf(async function() {}).constructor;
+	assert(new AsyncFunction("await 1") instanceof AsyncFunction, "AsyncFunction");
+	assert.sameValue(eval(1), 1, "non-string");
+	assert.throws(EvalError, () => eval("forbidden"));
+	assert.throws(EvalError, () => Function("forbidden"));
+	try {
+		eval("forbidden");
+	} catch (e) {
+		assert.sameValue(e.message, "code generation from strings disallowed");
+	}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []CodeGenerationKind{CodeGenerationDirectEval, CodeGenerationEval, CodeGenerationFunction,
+		CodeGenerationGeneratorFunction, CodeGenerationAsyncFunction, CodeGenerationDirectEval, CodeGenerationFunction,
+		CodeGenerationDirectEval}
+	if !reflect.DeepEqual(kinds, expected) {
+		t.Fatalf("Unexpected kinds: %v", kinds)
+	}
+}
+
+func TestCodeGenerationPolicyFunctionRewrite(t *testing.T) {
+	vm := New()
+	var rewrite string
+	vm.SetCodeGenerationPolicy(func(kind CodeGenerationKind, src string) (string, error) {
+		if rewrite != "" {
+			return rewrite, nil
+		}
+		return src, nil
+	})
+	for _, src := range []string{
+		"globalThis.pwned = 1, ({})",
+		"42",
+		"(function() {}); globalThis.pwned = 1",
+		"function f() {}",
+		"(function*() {})",
+		"(async function() {})",
+	} {
+		rewrite = src
+		_, err := vm.RunString("Function('return 1')")
+		if ex, ok := err.(*Exception); !ok || !ex.Value().ToObject(vm).Get("constructor").SameAs(vm.Get("SyntaxError")) {
+			t.Fatalf("%s: %v", src, err)
+		}
+	}
+	if vm.Get("pwned") != nil {
+		t.Fatal("the rewritten code has run")
+	}
+	rewrite = "(function anonymous() { return 2 })"
+	if v, err := vm.RunString("Function('return 1')()"); err != nil || v.ToInteger() != 2 {
+		t.Fatal(v, err)
+	}
+	rewrite = "(async function*() {})"
+	if _, err := vm.RunString("Object.getPrototypeOf(async function() {}).constructor('')"); err == nil {
+		t.Fatal("expected an error")
+	}
+	rewrite = "1 + 1"
+	if v, err := vm.RunString("eval('1')"); err != nil || v.ToInteger() != 2 {
+		t.Fatal(v, err)
+	}
+}
+
+func TestNewRealm(t *testing.T) {
+	vm := New()
+	realm := vm.NewRealm()
+	if realm.GlobalObject() == vm.GlobalObject() {
+		t.Fatal("the global object is shared")
+	}
+	_, err := realm.RunString(`
+	var realmValue = 1;
+	Array.prototype.extra = true;
+	function makeArray() { return [1, 2]; }
+	Promise.resolve().then(() => { globalThis.jobRun = true; });
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if realm.Get("jobRun") != valueTrue {
+		t.Fatal("the job has not run")
+	}
+	vm.Set("makeArray", realm.Get("makeArray"))
+	_, err = vm.RunString(TESTLIB + `
+	assert.sameValue(typeof realmValue, "undefined");
+	assert.sameValue([].extra, undefined);
+	const a = makeArray();
+	assert.sameValue(a.extra, true, "the function runs in its realm");
+	assert.sameValue(a instanceof Array, false);
+	assert(Array.isArray(a));
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := realm.RunString(`globalThis.sym = Symbol.for("shared")`); err != nil {
+		t.Fatal(err)
+	}
+	vm.Set("sym", realm.Get("sym"))
+	if _, err := vm.RunString(`if (Symbol.for("shared") !== sym) throw new Error("Symbol registry is not shared")`); err != nil {
+		t.Fatal(err)
+	}
+}
+
 /*
 func TestArrayConcatSparse(t *testing.T) {
 function foo(a,b,c)
@@ -0,0 +1,521 @@
+package goja
+
+import (
+	"errors"
+	"math/big"
+	"sync/atomic"
+	"time"
+
+	"github.com/dop251/goja/unistring"
+)
+
+type serialKind int
+
+const (
+	serialPrimitive serialKind = iota
+	serialObject
+	serialArray
+	serialDate
+	serialRegExp
+	serialPrimitiveWrapper
+	serialMap
+	serialSet
+	serialArrayBuffer
+	serialTypedArray
+	serialDataView
+	serialError
+)
+
+type serialProp struct {
+	name  unistring.String
+	value *serialRecord
+}
+
+// serialRecord is a Runtime-independent representation of a single value. Records representing objects
+// are shared so that the identity of objects (including cycles) is preserved.
+type serialRecord struct {
+	kind serialKind
+
+	// primitive value for serialPrimitive and serialPrimitiveWrapper, source for serialRegExp,
+	// error name for serialError
+	prim Value
+
+	props []serialProp
+
+	// serialArray: length, serialDate: time value, views: byte offset and length (in elements for typed arrays)
+	length       int64
+	msec         int64
+	offset, size int
+
+	flags string
+
+	// serialMap: pairs of key and value, serialSet: keys
+	entries []*serialRecord
+
+	data        []byte
+	transferred bool
+
+	// views: the underlying ArrayBuffer and the name of the constructor
+	buffer   *serialRecord
+	ctorName unistring.String
+}
+
+// SerializedValue is a Runtime-independent representation of a value produced by the HTML structured clone
+// algorithm (see Runtime.StructuredSerialize()). Unlike Value it is safe to pass it between goroutines and
+// it can be deserialized in any Runtime.
+//
+// A SerializedValue can be deserialized multiple times unless it contains transferred ArrayBuffers, in which
+// case it can only be deserialized once.
+type SerializedValue struct {
+	root         *serialRecord
+	hasTransfers bool
+	consumed     uint32
+}
+
+var errSerializedValueConsumed = errors.New("SerializedValue with transferred ArrayBuffers has already been deserialized")
+
+type structuredSerializer struct {
+	r      *Runtime
+	memory map[*Object]*serialRecord
+}
+
+func (r *Runtime) throwDataCloneError(v Value) {
+	panic(r.NewTypeError("%s could not be cloned", r.objDescription(v)))
+}
+
+func (r *Runtime) objDescription(v Value) string {
+	if o, ok := v.(*Object); ok {
+		if _, ok := o.self.assertCallable(); ok {
+			if name := nilSafe(o.self.getStr("name", nil)).String(); name != "" {
+				return "function " + name
+			}
+			return "function"
+		}
+		return "#<" + o.self.className() + ">"
+	}
+	return v.String()
+}
+
+func cloneablePrimitive(v Value) Value {
+	switch v := v.(type) {
+	case asciiString, unicodeString:
+		return v
+	case String:
+		return stringValueFromRaw(v.string())
+	case *valueBigInt:
+		return (*valueBigInt)(new(big.Int).Set((*big.Int)(v)))
+	}
+	return v
+}
+
+func typedArrayCtorName(ta *typedArrayObject) unistring.String {
+	switch ta.typedArray.(type) {
+	case *uint8Array:
+		return "Uint8Array"
+	case *uint8ClampedArray:
+		return "Uint8ClampedArray"
+	case *int8Array:
+		return "Int8Array"
+	case *uint16Array:
+		return "Uint16Array"
+	case *int16Array:
+		return "Int16Array"
+	case *uint32Array:
+		return "Uint32Array"
+	case *int32Array:
+		return "Int32Array"
+	case *float32Array:
+		return "Float32Array"
+	case *float64Array:
+		return "Float64Array"
+	case *bigInt64Array:
+		return "BigInt64Array"
+	case *bigUint64Array:
+		return "BigUint64Array"
+	}
+	panic("unknown typed array type")
+}
+
+func regexpFlags(p *regexpPattern) string {
+	var flags []byte
+	if p.global {
+		flags = append(flags, 'g')
+	}
+	if p.ignoreCase {
+		flags = append(flags, 'i')
+	}
+	if p.multiline {
+		flags = append(flags, 'm')
+	}
+	if p.dotAll {
+		flags = append(flags, 's')
+	}
+	if p.unicode {
+		flags = append(flags, 'u')
+	}
+	if p.sticky {
+		flags = append(flags, 'y')
+	}
+	return string(flags)
+}
+
+func isStandardErrorName(name string) bool {
+	switch name {
+	case "Error", "EvalError", "RangeError", "ReferenceError", "SyntaxError", "TypeError", "URIError":
+		return true
+	}
+	return false
+}
+
+func (s *structuredSerializer) serialize(v Value) *serialRecord {
+	obj, ok := v.(*Object)
+	if !ok {
+		if _, ok := v.(*Symbol); ok {
+			s.r.throwDataCloneError(v)
+		}
+		return &serialRecord{kind: serialPrimitive, prim: cloneablePrimitive(v)}
+	}
+	if rec := s.memory[obj]; rec != nil {
+		return rec
+	}
+	rec := &serialRecord{}
+	s.memory[obj] = rec
+	switch o := obj.self.(type) {
+	case *primitiveValueObject:
+		rec.kind = serialPrimitiveWrapper
+		rec.prim = cloneablePrimitive(o.pValue)
+	case *stringObject:
+		rec.kind = serialPrimitiveWrapper
+		rec.prim = cloneablePrimitive(o.value)
+	case *dateObject:
+		rec.kind = serialDate
+		rec.msec = o.msec
+	case *regexpObject:
+		rec.kind = serialRegExp
+		rec.prim = cloneablePrimitive(o.source)
+		rec.flags = regexpFlags(o.pattern)
+	case *arrayBufferObject:
+		if o.detached {
+			s.r.throwDataCloneError(obj)
+		}
+		rec.kind = serialArrayBuffer
+		rec.data = append([]byte(nil), o.data...)
+	case *typedArrayObject:
+		if o.viewedArrayBuf.detached {
+			s.r.throwDataCloneError(obj)
+		}
+		rec.kind = serialTypedArray
+		rec.buffer = s.serialize(o.viewedArrayBuf.val)
+		rec.offset, rec.size = o.offset*o.elemSize, o.length
+		rec.ctorName = typedArrayCtorName(o)
+	case *dataViewObject:
+		if o.viewedArrayBuf.detached {
+			s.r.throwDataCloneError(obj)
+		}
+		rec.kind = serialDataView
+		rec.buffer = s.serialize(o.viewedArrayBuf.val)
+		rec.offset, rec.size = o.byteOffset, o.byteLen
+	case *mapObject:
+		rec.kind = serialMap
+		// copy the entries first so that side effects of serializing them do not affect the iteration
+		var entries []Value
+		iter := o.m.newIter()
+		for entry := iter.next(); entry != nil; entry = iter.next() {
+			entries = append(entries, entry.key, entry.value)
+		}
+		for _, e := range entries {
+			rec.entries = append(rec.entries, s.serialize(e))
+		}
+	case *setObject:
+		rec.kind = serialSet
+		var entries []Value
+		iter := o.m.newIter()
+		for entry := iter.next(); entry != nil; entry = iter.next() {
+			entries = append(entries, entry.key)
+		}
+		for _, e := range entries {
+			rec.entries = append(rec.entries, s.serialize(e))
+		}
+	case *errorObject:
+		rec.kind = serialError
+		name := nilSafe(o.getStr("name", nil)).String()
+		if !isStandardErrorName(name) {
+			name = "Error"
+		}
+		rec.prim = asciiString(name)
+		for _, p := range []unistring.String{"message", propNameStack} {
+			if o.getOwnPropStr(p) != nil {
+				rec.props = append(rec.props, serialProp{name: p, value: &serialRecord{
+					kind: serialPrimitive,
+					prim: cloneablePrimitive(nilSafe(o.getStr(p, nil)).toString()),
+				}})
+			}
+		}
+		if o.getOwnPropStr("cause") != nil {
+			rec.props = append(rec.props, serialProp{name: "cause", value: s.serialize(o.getStr("cause", nil))})
+		}
+	case *proxyObject, *Promise, *weakMapObject, *weakSetObject:
+		s.r.throwDataCloneError(obj)
+	default:
+		if _, ok := o.assertCallable(); ok {
+			s.r.throwDataCloneError(obj)
+		}
+		if isArray(obj) {
+			rec.kind = serialArray
+			rec.length = toLength(o.getStr("length", nil))
+		} else {
+			rec.kind = serialObject
+		}
+		for item, next := iterateEnumerableStringProperties(obj)(); next != nil; item, next = next() {
+			rec.props = append(rec.props, serialProp{
+				name:  item.name.string(),
+				value: s.serialize(item.value),
+			})
+		}
+	}
+	return rec
+}
+
+type structuredDeserializer struct {
+	r      *Runtime
+	memory map[*serialRecord]Value
+}
+
+func (d *structuredDeserializer) deserialize(rec *serialRecord) Value {
+	if rec.kind == serialPrimitive {
+		return rec.prim
+	}
+	if v := d.memory[rec]; v != nil {
+		return v
+	}
+	r := d.r
+	var obj *Object
+	switch rec.kind {
+	case serialObject:
+		obj = r.NewObject()
+	case serialArray:
+		obj = r.newArrayLength(rec.length)
+	case serialDate:
+		obj = r.newDateObject(time.Time{}, false, r.getDatePrototype())
+		obj.self.(*dateObject).msec = rec.msec
+	case serialRegExp:
+		obj = r._newRegExp(rec.prim.(String), rec.flags, r.getRegExpPrototype()).val
+	case serialPrimitiveWrapper:
+		obj = rec.prim.ToObject(r)
+	case serialMap:
+		obj = r.builtin_new(r.getMap(), nil)
+	case serialSet:
+		obj = r.builtin_new(r.getSet(), nil)
+	case serialArrayBuffer:
+		buf := r._newArrayBuffer(r.getArrayBufferPrototype(), nil)
+		buf.data = rec.data
+		if !rec.transferred {
+			buf.data = append([]byte(nil), rec.data...)
+		}
+		obj = buf.val
+	case serialTypedArray:
+		buffer := d.deserialize(rec.buffer)
+		obj = r.builtin_new(r.globalCtorByName(rec.ctorName), []Value{buffer, intToValue(int64(rec.offset)), intToValue(int64(rec.size))})
+	case serialDataView:
+		buffer := d.deserialize(rec.buffer)
+		obj = r.builtin_new(r.getDataView(), []Value{buffer, intToValue(int64(rec.offset)), intToValue(int64(rec.size))})
+	case serialError:
+		ctor := r.globalCtorByName(rec.prim.string())
+		obj = r.newErrorObject(r.toObject(ctor.self.getStr("prototype", nil)), classError).val
+	}
+	d.memory[rec] = obj
+	switch rec.kind {
+	case serialMap:
+		m := obj.self.(*mapObject).m
+		for i := 0; i+1 < len(rec.entries); i += 2 {
+			m.set(d.deserialize(rec.entries[i]), d.deserialize(rec.entries[i+1]))
+		}
+	case serialSet:
+		m := obj.self.(*setObject).m
+		for _, e := range rec.entries {
+			m.set(d.deserialize(e), _undefined)
+		}
+	case serialError:
+		e := obj.self.(*errorObject)
+		for _, p := range rec.props {
+			e._putProp(p.name, d.deserialize(p.value), true, false, true)
+			if p.name == propNameStack {
+				e.stackPropAdded = true
+			}
+		}
+	default:
+		for _, p := range rec.props {
+			createDataProperty(obj, stringValueFromRaw(p.name), d.deserialize(p.value))
+		}
+	}
+	return obj
+}
+
+func (r *Runtime) globalCtorByName(name unistring.String) *Object {
+	switch name {
+	case "Error":
+		return r.getError()
+	case "EvalError":
+		return r.getEvalError()
+	case "RangeError":
+		return r.getRangeError()
+	case "ReferenceError":
+		return r.getReferenceError()
+	case "SyntaxError":
+		return r.getSyntaxError()
+	case "TypeError":
+		return r.getTypeError()
+	case "URIError":
+		return r.getURIError()
+	case "Uint8Array":
+		return r.getUint8Array()
+	case "Uint8ClampedArray":
+		return r.getUint8ClampedArray()
+	case "Int8Array":
+		return r.getInt8Array()
+	case "Uint16Array":
+		return r.getUint16Array()
+	case "Int16Array":
+		return r.getInt16Array()
+	case "Uint32Array":
+		return r.getUint32Array()
+	case "Int32Array":
+		return r.getInt32Array()
+	case "Float32Array":
+		return r.getFloat32Array()
+	case "Float64Array":
+		return r.getFloat64Array()
+	case "BigInt64Array":
+		return r.getBigInt64Array()
+	case "BigUint64Array":
+		return r.getBigUint64Array()
+	}
+	panic("unknown constructor: " + name.String())
+}
+
+func (r *Runtime) structuredSerialize(v Value, transfer []*arrayBufferObject) *SerializedValue {
+	s := &structuredSerializer{
+		r:      r,
+		memory: make(map[*Object]*serialRecord),
+	}
+	res := &SerializedValue{}
+	for _, buf := range transfer {
+		if buf.val.runtime.agent != r.agent || buf.detached || s.memory[buf.val] != nil {
+			r.throwDataCloneError(buf.val)
+		}
+		s.memory[buf.val] = &serialRecord{
+			kind:        serialArrayBuffer,
+			transferred: true,
+		}
+		res.hasTransfers = true
+	}
+	res.root = s.serialize(v)
+	for _, buf := range transfer {
+		s.memory[buf.val].data = buf.data
+		buf.detach()
+	}
+	return res
+}
+
+func (r *Runtime) structuredDeserialize(s *SerializedValue) Value {
+	if s.hasTransfers && !atomic.CompareAndSwapUint32(&s.consumed, 0, 1) {
+		panic(r.NewTypeError(errSerializedValueConsumed.Error()))
+	}
+	d := &structuredDeserializer{
+		r:      r,
+		memory: make(map[*serialRecord]Value),
+	}
+	return d.deserialize(s.root)
+}
+
+func (r *Runtime) builtin_structuredClone(call FunctionCall) Value {
+	if len(call.Arguments) == 0 {
+		panic(r.NewTypeError("The \"value\" argument must be specified"))
+	}
+	var transfer []*arrayBufferObject
+	if options := call.Argument(1); options != _undefined {
+		if list := r.toObject(options).self.getStr("transfer", nil); list != nil && list != _undefined {
+			for _, item := range r.iterableToList(list, nil) {
+				if o, ok := item.(*Object); ok {
+					if buf, ok := o.self.(*arrayBufferObject); ok {
+						transfer = append(transfer, buf)
+						continue
+					}
+				}
+				r.throwDataCloneError(item)
+			}
+		}
+	}
+	return r.structuredDeserialize(r.structuredSerialize(call.Argument(0), transfer))
+}
+
+func arrayBuffersToTransfer(transfer []ArrayBuffer) []*arrayBufferObject {
+	if len(transfer) == 0 {
+		return nil
+	}
+	res := make([]*arrayBufferObject, len(transfer))
+	for i, buf := range transfer {
+		res[i] = buf.buf
+	}
+	return res
+}
+
+// StructuredSerialize serializes the value using the HTML structured clone algorithm
+// (https://html.spec.whatwg.org/multipage/structured-data.html#safe-passing-of-structured-data).
+// The value must belong to this Runtime (or be a primitive). The result can be passed to another goroutine and
+// deserialized in any Runtime using StructuredDeserialize().
+//
+// The ArrayBuffers in the transfer list are detached and their contents are moved into the result instead of being
+// copied.
+//
+// Primitives (except Symbols), plain Objects, Arrays, Dates, RegExps, primitive wrappers, Maps, Sets, ArrayBuffers,
+// typed arrays, DataViews and Errors are supported, including cycles and shared references. Wrapped Go values are
+// treated as plain Objects (or Arrays) containing their enumerable properties. Any other value (such as a function,
+// a Symbol, a Proxy or a Promise) causes a TypeError.
+//
+// If a JavaScript exception is thrown (e.g. by a getter) the returned error is an *Exception.
+func (r *Runtime) StructuredSerialize(v Value, transfer ...ArrayBuffer) (res *SerializedValue, err error) {
+	err = r.runWrapped(func() {
+		res = r.structuredSerialize(v, arrayBuffersToTransfer(transfer))
+	})
+	return
+}
+
+// StructuredDeserialize creates a value in this Runtime from the result of StructuredSerialize().
+func (r *Runtime) StructuredDeserialize(s *SerializedValue) (res Value, err error) {
+	if s.hasTransfers && atomic.LoadUint32(&s.consumed) != 0 {
+		return nil, errSerializedValueConsumed
+	}
+	err = r.runWrapped(func() {
+		res = r.structuredDeserialize(s)
+	})
+	return
+}
+
+// StructuredClone copies the value into this Runtime using the HTML structured clone algorithm (see
+// StructuredSerialize() for details). The value may belong to a different Runtime in which case it is serialized
+// in that Runtime. This is the Go equivalent of the global structuredClone() function.
+//
+// Neither Runtime may be used concurrently while this method is running. To pass values between Runtimes running
+// in different goroutines use StructuredSerialize() and StructuredDeserialize() instead.
+func (r *Runtime) StructuredClone(v Value, transfer ...ArrayBuffer) (Value, error) {
+	src := r
+	if o, ok := v.(*Object); ok && o.runtime != nil {
+		src = o.runtime
+	}
+	s, err := src.StructuredSerialize(v, transfer...)
+	if err != nil {
+		return nil, err
+	}
+	return r.StructuredDeserialize(s)
+}
+
+// Export deserializes the value into a temporary Runtime and returns the result of Value.Export() called on it.
+// This is a convenient way of obtaining a Go representation of the value without having a Runtime at hand.
+func (s *SerializedValue) Export() (interface{}, error) {
+	v, err := New().StructuredDeserialize(s)
+	if err != nil {
+		return nil, err
+	}
+	return v.Export(), nil
+}
@@ -0,0 +1,288 @@
+package goja
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strconv"
+	"unicode/utf16"
+
+	"github.com/dop251/goja/unistring"
+)
+
+var errSerializedValueHasTransfers = errors.New("SerializedValue with transferred ArrayBuffers cannot be marshalled")
+
+// jsonString is a string that is marshalled as a JSON string if it's valid UTF-16, or as an array of code units
+// otherwise (i.e. if it contains unpaired surrogates).
+type jsonString unistring.String
+
+func (s jsonString) MarshalJSON() ([]byte, error) {
+	u := unistring.String(s)
+	if b := u.AsUtf16(); b != nil && !slices.Equal(utf16.Encode([]rune(u.String())), b[1:]) {
+		return json.Marshal(b[1:])
+	}
+	return json.Marshal(u.String())
+}
+
+func (s *jsonString) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		*s = jsonString(unistring.NewFromString(str))
+		return nil
+	}
+	var b []uint16
+	if err := json.Unmarshal(data, &b); err != nil {
+		return err
+	}
+	*s = jsonString(unistring.FromUtf16(append([]uint16{unistring.BOM}, b...)))
+	return nil
+}
+
+type serialPrimJSON struct {
+	Type string     `json:"t"`
+	Num  string     `json:"n,omitempty"`
+	Str  jsonString `json:"s,omitempty"`
+	Bool bool       `json:"b,omitempty"`
+}
+
+type serialPropJSON struct {
+	Name  jsonString `json:"n"`
+	Value int        `json:"v"`
+}
+
+type serialRecordJSON struct {
+	Kind     serialKind       `json:"k"`
+	Prim     *serialPrimJSON  `json:"p,omitempty"`
+	Props    []serialPropJSON `json:"props,omitempty"`
+	Length   int64            `json:"len,omitempty"`
+	Msec     int64            `json:"msec,omitempty"`
+	Offset   int              `json:"off,omitempty"`
+	Size     int              `json:"size,omitempty"`
+	Flags    string           `json:"flags,omitempty"`
+	Entries  []int            `json:"entries,omitempty"`
+	Data     []byte           `json:"data,omitempty"`
+	Buffer   *int             `json:"buf,omitempty"`
+	CtorName string           `json:"ctor,omitempty"`
+}
+
+type serializedValueJSON struct {
+	Records []*serialRecordJSON `json:"records"`
+}
+
+func marshalSerialPrim(v Value) *serialPrimJSON {
+	switch v := v.(type) {
+	case valueUndefined:
+		return &serialPrimJSON{Type: "undefined"}
+	case valueNull:
+		return &serialPrimJSON{Type: "null"}
+	case valueBool:
+		return &serialPrimJSON{Type: "boolean", Bool: bool(v)}
+	case valueInt:
+		return &serialPrimJSON{Type: "int", Num: strconv.FormatInt(int64(v), 10)}
+	case valueFloat:
+		return &serialPrimJSON{Type: "number", Num: strconv.FormatFloat(float64(v), 'g', -1, 64)}
+	case String:
+		return &serialPrimJSON{Type: "string", Str: jsonString(v.string())}
+	case *valueBigInt:
+		return &serialPrimJSON{Type: "bigint", Num: (*big.Int)(v).String()}
+	}
+	panic(fmt.Errorf("unexpected primitive %T", v))
+}
+
+func unmarshalSerialPrim(p *serialPrimJSON) (Value, error) {
+	switch p.Type {
+	case "undefined":
+		return _undefined, nil
+	case "null":
+		return _null, nil
+	case "boolean":
+		if p.Bool {
+			return valueTrue, nil
+		}
+		return valueFalse, nil
+	case "int":
+		i, err := strconv.ParseInt(p.Num, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return valueInt(i), nil
+	case "number":
+		f, err := strconv.ParseFloat(p.Num, 64)
+		if err != nil {
+			return nil, err
+		}
+		return valueFloat(f), nil
+	case "string":
+		return stringValueFromRaw(unistring.String(p.Str)), nil
+	case "bigint":
+		b, ok := new(big.Int).SetString(p.Num, 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid bigint: %q", p.Num)
+		}
+		return (*valueBigInt)(b), nil
+	}
+	return nil, fmt.Errorf("invalid primitive type: %q", p.Type)
+}
+
+// MarshalJSON encodes the value as JSON, so that it can be stored or sent over the network. Values containing
+// transferred ArrayBuffers cannot be marshalled.
+func (s *SerializedValue) MarshalJSON() ([]byte, error) {
+	if s.hasTransfers {
+		return nil, errSerializedValueHasTransfers
+	}
+	var res serializedValueJSON
+	index := make(map[*serialRecord]int)
+	var add func(rec *serialRecord) int
+	add = func(rec *serialRecord) int {
+		if idx, exists := index[rec]; exists {
+			return idx
+		}
+		idx := len(res.Records)
+		index[rec] = idx
+		j := &serialRecordJSON{
+			Kind:     rec.kind,
+			Length:   rec.length,
+			Msec:     rec.msec,
+			Offset:   rec.offset,
+			Size:     rec.size,
+			Flags:    rec.flags,
+			Data:     rec.data,
+			CtorName: rec.ctorName.String(),
+		}
+		res.Records = append(res.Records, j)
+		if rec.prim != nil {
+			j.Prim = marshalSerialPrim(rec.prim)
+		}
+		for _, p := range rec.props {
+			j.Props = append(j.Props, serialPropJSON{Name: jsonString(p.name), Value: add(p.value)})
+		}
+		for _, e := range rec.entries {
+			j.Entries = append(j.Entries, add(e))
+		}
+		if rec.buffer != nil {
+			buf := add(rec.buffer)
+			j.Buffer = &buf
+		}
+		return idx
+	}
+	add(s.root)
+	return json.Marshal(&res)
+}
+
+// UnmarshalJSON decodes the value encoded by MarshalJSON.
+func (s *SerializedValue) UnmarshalJSON(data []byte) error {
+	var src serializedValueJSON
+	if err := json.Unmarshal(data, &src); err != nil {
+		return err
+	}
+	if len(src.Records) == 0 {
+		return errors.New("no records")
+	}
+	records := make([]*serialRecord, len(src.Records))
+	for i := range records {
+		records[i] = &serialRecord{}
+	}
+	ref := func(idx int) (*serialRecord, error) {
+		if idx < 0 || idx >= len(records) {
+			return nil, fmt.Errorf("invalid record reference: %d", idx)
+		}
+		return records[idx], nil
+	}
+	for i, j := range src.Records {
+		if j == nil {
+			return fmt.Errorf("record %d is null", i)
+		}
+		rec := records[i]
+		rec.kind = j.Kind
+		rec.length = j.Length
+		rec.msec = j.Msec
+		rec.offset, rec.size = j.Offset, j.Size
+		rec.flags = j.Flags
+		rec.data = j.Data
+		rec.ctorName = unistring.NewFromString(j.CtorName)
+		if j.Prim != nil {
+			v, err := unmarshalSerialPrim(j.Prim)
+			if err != nil {
+				return fmt.Errorf("record %d: %w", i, err)
+			}
+			rec.prim = v
+		}
+		for _, p := range j.Props {
+			v, err := ref(p.Value)
+			if err != nil {
+				return err
+			}
+			rec.props = append(rec.props, serialProp{name: unistring.String(p.Name), value: v})
+		}
+		for _, e := range j.Entries {
+			v, err := ref(e)
+			if err != nil {
+				return err
+			}
+			rec.entries = append(rec.entries, v)
+		}
+		if j.Buffer != nil {
+			v, err := ref(*j.Buffer)
+			if err != nil {
+				return err
+			}
+			rec.buffer = v
+		}
+	}
+	for i, rec := range records {
+		if err := validateSerialRecord(rec); err != nil {
+			return fmt.Errorf("record %d: %w", i, err)
+		}
+	}
+	s.root = records[0]
+	s.hasTransfers = false
+	s.consumed = 0
+	return nil
+}
+
+// validateSerialRecord checks the invariants the deserializer relies on.
+func validateSerialRecord(rec *serialRecord) error {
+	switch rec.kind {
+	case serialPrimitive, serialPrimitiveWrapper:
+		if rec.prim == nil {
+			return errors.New("missing primitive value")
+		}
+		if rec.kind == serialPrimitiveWrapper && (rec.prim == _undefined || rec.prim == _null) {
+			return errors.New("invalid primitive wrapper")
+		}
+	case serialRegExp:
+		if _, ok := rec.prim.(String); !ok {
+			return errors.New("missing RegExp source")
+		}
+	case serialError:
+		if rec.prim == nil || !isStandardErrorName(rec.prim.String()) {
+			return errors.New("invalid error name")
+		}
+	case serialTypedArray, serialDataView:
+		if rec.buffer == nil || rec.buffer.kind != serialArrayBuffer {
+			return errors.New("missing ArrayBuffer")
+		}
+		if rec.kind == serialTypedArray && !isTypedArrayCtorName(rec.ctorName) {
+			return fmt.Errorf("invalid typed array constructor: %q", rec.ctorName)
+		}
+	case serialMap:
+		if len(rec.entries)%2 != 0 {
+			return errors.New("odd number of Map entries")
+		}
+	case serialObject, serialArray, serialDate, serialSet, serialArrayBuffer:
+	default:
+		return fmt.Errorf("invalid kind: %d", rec.kind)
+	}
+	return nil
+}
+
+func isTypedArrayCtorName(name unistring.String) bool {
+	switch name {
+	case "Uint8Array", "Uint8ClampedArray", "Int8Array", "Uint16Array", "Int16Array", "Uint32Array", "Int32Array",
+		"Float32Array", "Float64Array", "BigInt64Array", "BigUint64Array":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,247 @@
+package goja
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestStructuredCloneBasic(t *testing.T) {
+	const SCRIPT = `
+	const d = new Date(2020, 1, 1);
+	const shared = {x: 1};
+	const src = {
+		n: 1, s: "str", b: true, u: undefined, nul: null, big: 123n,
+		d: d, re: /ab+c/gi, arr: [1, , 3], shared1: shared, shared2: shared,
+		m: new Map([[1, "one"], ["two", shared]]),
+		set: new Set([1, "a", shared]),
+		num: new Number(5), str: new String("abc"),
+	};
+	src.self = src;
+	const c = structuredClone(src);
+
+	assert(c !== src, "copy");
+	assert.sameValue(c.self, c, "cycle");
+	assert.sameValue(c.n, 1, "n");
+	assert.sameValue(c.s, "str", "s");
+	assert.sameValue(c.b, true, "b");
+	assert("u" in c && c.u === undefined, "u");
+	assert.sameValue(c.nul, null, "nul");
+	assert.sameValue(c.big, 123n, "big");
+	assert(c.d instanceof Date && c.d !== d && c.d.getTime() === d.getTime(), "date");
+	assert(c.re instanceof RegExp && c.re.source === "ab+c" && c.re.flags === "gi", "regexp");
+	assert.sameValue(c.arr.length, 3, "arr.length");
+	assert(!(1 in c.arr), "hole");
+	assert(c.shared1 !== shared && c.shared1 === c.shared2, "shared");
+	assert(c.m instanceof Map && c.m.get(1) === "one" && c.m.get("two") === c.shared1, "map");
+	assert(c.set instanceof Set && c.set.has("a") && c.set.has(c.shared1), "set");
+	assert(c.num instanceof Number && c.num.valueOf() === 5, "Number");
+	assert(c.str instanceof String && c.str.valueOf() === "abc", "String");
+	`
+	testScriptWithTestLib(SCRIPT, _undefined, t)
+}
+
+func TestStructuredCloneTypedArrays(t *testing.T) {
+	const SCRIPT = `
+	const buf = new ArrayBuffer(8);
+	const u8 = new Uint8Array(buf, 2, 4);
+	const dv = new DataView(buf);
+	u8[0] = 42;
+	const c = structuredClone({u8, dv, buf});
+	assert(c.buf !== buf, "buf copy");
+	assert(c.u8 instanceof Uint8Array && c.u8.buffer === c.buf, "shared buffer");
+	assert.sameValue(c.u8.byteOffset, 2, "byteOffset");
+	assert.sameValue(c.u8.length, 4, "length");
+	assert.sameValue(c.u8[0], 42, "value");
+	assert(c.dv instanceof DataView && c.dv.buffer === c.buf, "DataView");
+	u8[0] = 1;
+	assert.sameValue(c.u8[0], 42, "independent");
+
+	const f64 = new Float64Array(new ArrayBuffer(32), 8, 2);
+	f64[0] = 1.5; f64[1] = -2.25;
+	const cf = structuredClone(f64);
+	assert.sameValue(cf.byteOffset, 8, "Float64Array byteOffset");
+	assert.sameValue(cf.length, 2, "Float64Array length");
+	assert.sameValue(cf[0], 1.5, "Float64Array[0]");
+	assert.sameValue(cf[1], -2.25, "Float64Array[1]");
+	const i32 = new Int32Array(new ArrayBuffer(16), 4);
+	i32[2] = 7;
+	const ci = structuredClone(i32);
+	assert.sameValue(ci.byteOffset, 4, "Int32Array byteOffset");
+	assert.sameValue(ci.length, 3, "Int32Array length");
+	assert.sameValue(ci[2], 7, "Int32Array[2]");
+
+	const c1 = structuredClone(u8, {transfer: [buf]});
+	assert.sameValue(buf.byteLength, 0, "detached");
+	assert.sameValue(c1[0], 1, "transferred");
+	`
+	testScriptWithTestLib(SCRIPT, _undefined, t)
+}
+
+func TestStructuredCloneErrors(t *testing.T) {
+	const SCRIPT = `
+	const e = new RangeError("bad", {cause: {x: 1}});
+	const c = structuredClone(e);
+	assert(c instanceof RangeError, "type");
+	assert.sameValue(c.message, "bad", "message");
+	assert.sameValue(c.cause.x, 1, "cause");
+	assert.sameValue(c.stack, e.stack, "stack");
+
+	assert.throws(TypeError, () => structuredClone(function() {}));
+	assert.throws(TypeError, () => structuredClone({s: Symbol()}));
+	assert.throws(TypeError, () => structuredClone(new Proxy({}, {})));
+	assert.throws(TypeError, () => structuredClone(Promise.resolve()));
+	assert.throws(TypeError, () => structuredClone());
+	`
+	testScriptWithTestLib(SCRIPT, _undefined, t)
+}
+
+func TestStructuredCloneBetweenRuntimes(t *testing.T) {
+	vm1 := New()
+	v, err := vm1.RunString(`
+	const buf = new Uint8Array([1, 2, 3]).buffer;
+	var obj = {m: new Map([["k", new Set([1n])]]), d: new Date(0), buf: buf};
+	obj.self = obj;
+	obj;
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := v.(*Object).Get("buf").Export().(ArrayBuffer)
+
+	s, err := vm1.StructuredSerialize(v, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !buf.Detached() {
+		t.Fatal("not detached")
+	}
+
+	done := make(chan Value)
+	vm2 := New()
+	go func() {
+		res, err := vm2.StructuredDeserialize(s)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- res
+	}()
+	res := <-done
+	if res.(*Object).runtime != vm2 {
+		t.Fatal("wrong runtime")
+	}
+	vm2.Set("obj", res)
+	_, err = vm2.RunString(`
+	if (obj.self !== obj) throw new Error("cycle");
+	if (!obj.m.get("k").has(1n)) throw new Error("map");
+	if (obj.d.getTime() !== 0) throw new Error("date");
+	if (new Uint8Array(obj.buf)[2] !== 3) throw new Error("buf");
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New().StructuredDeserialize(s); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestStructuredCloneGoAPI(t *testing.T) {
+	vm1 := New()
+	vm2 := New()
+	v, err := vm1.RunString(`({a: [1, "x"]})`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := vm2.StructuredClone(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.(*Object).runtime != vm2 {
+		t.Fatal("wrong runtime")
+	}
+	if s := res.(*Object).Get("a").String(); s != "1,x" {
+		t.Fatal(s)
+	}
+
+	fn, err := vm1.RunString(`(function() {})`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = vm2.StructuredClone(fn)
+	if ex, ok := err.(*Exception); !ok || !ex.Value().(*Object).runtime.InstanceOf(ex.Value(), vm1.getTypeError()) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestSerializedValueJSON(t *testing.T) {
+	vm := New()
+	v, err := vm.RunString(`
+	const o = {s: "xé\ud800", n: -0, nan: NaN, i: 42, big: 12345678901234567890n, u: undefined, nil: null,
+		d: new Date(1000), re: /a+/gi, w: Object(true), m: new Map([[1, "one"]]), set: new Set(["a"]),
+		err: new RangeError("boom"), ta: new Int16Array([1, -2])};
+	o.self = o;
+	o.view = new DataView(o.ta.buffer, 2);
+	o.f64 = new Float64Array(new ArrayBuffer(24), 8, 1);
+	o.f64[0] = 0.5;
+	o;
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := vm.StructuredSerialize(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s1 SerializedValue
+	if err := json.Unmarshal(data, &s1); err != nil {
+		t.Fatal(err)
+	}
+	vm1 := New()
+	res, err := vm1.StructuredDeserialize(&s1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm1.Set("o", res)
+	_, err = vm1.RunString(TESTLIB + `
+	assert.sameValue(o.s, "xé\ud800");
+	assert.sameValue(1 / o.n, -Infinity);
+	assert.sameValue(o.nan, NaN);
+	assert.sameValue(o.i, 42);
+	assert.sameValue(o.big, 12345678901234567890n);
+	assert(o.hasOwnProperty("u") && o.u === undefined);
+	assert.sameValue(o.nil, null);
+	assert.sameValue(o.d.getTime(), 1000);
+	assert.sameValue(o.re.source + o.re.flags, "a+gi");
+	assert.sameValue(typeof o.w, "object");
+	assert.sameValue(o.m.get(1), "one");
+	assert(o.set.has("a"));
+	assert(o.err instanceof RangeError);
+	assert.sameValue(o.err.message, "boom");
+	assert.sameValue(o.ta[1], -2);
+	assert.sameValue(o.view.getInt16(0, true), -2);
+	assert.sameValue(o.view.buffer, o.ta.buffer);
+	assert.sameValue(o.f64.byteOffset, 8);
+	assert.sameValue(o.f64[0], 0.5);
+	assert.sameValue(o.self, o);
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, bad := range []string{
+		`{"records":[]}`,
+		`{"records":[{"k":0}]}`,
+		`{"records":[{"k":1,"props":[{"n":"a","v":5}]}]}`,
+		`{"records":[{"k":9,"buf":0,"ctor":"Object"}]}`,
+		`{"records":[{"k":11,"p":{"t":"string","s":"NotAnError"}}]}`,
+		`{"records":[{"k":100}]}`,
+	} {
+		if err := json.Unmarshal([]byte(bad), &s1); err == nil {
+			t.Fatalf("%s: expected error", bad)
+		}
+	}
+}
@@ -83,7 +83,7 @@ func (a ArrayBuffer) toValue(r *Runtime) Value {
 		return _null
 	}
 	v := a.buf.val
-	if v.runtime != r {
+	if v.runtime.agent != r.agent {
 		panic(r.NewTypeError("Illegal runtime transition of an ArrayBuffer"))
 	}
 	return v
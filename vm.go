@@ -17,6 +17,8 @@ const (
 	maxInt = 1 << 53
 
 	tryPanicMarker = -2
+
+	maxAsyncStackDepth = 64
 )
 
 type valueStack []Value
@@ -35,6 +37,7 @@ type stash struct {
 }
 
 type context struct {
+	r         *Runtime // the current realm
 	prg       *Program
 	stash     *stash
 	privEnv   *privateEnv
@@ -381,8 +384,17 @@ type vm struct {
 	interruptLock sync.Mutex
 
 	curAsyncRunner *asyncRunner
+	curReaction    *promiseReaction
 
 	profTracker *profTracker
+	rtProfiler  atomic.Pointer[runtimeProfiler]
+	profLabels  *profLabels
+	allocProf   *allocProfiler
+	coverage    *Coverage
+
+	hooks      ExecutionHooks
+	hookFrames []hookFrame
+	hookEx     *Exception
 }
 
 type instruction interface {
@@ -611,6 +623,10 @@ func (vm *vm) halted() bool {
 }
 
 func (vm *vm) run() {
+	if vm.coverage != nil || vm.hooks != nil {
+		vm.runInstrumented()
+		return
+	}
 	if vm.profTracker != nil && !vm.runWithProfiler() {
 		return
 	}
@@ -618,7 +634,7 @@ func (vm *vm) run() {
 	interrupted := false
 	for {
 		if count == 0 {
-			if atomic.LoadInt32(&globalProfiler.enabled) == 1 && !vm.runWithProfiler() {
+			if vm.profilingEnabled() && !vm.runWithProfiler() {
 				return
 			}
 			count = 100
@@ -636,52 +652,142 @@ func (vm *vm) run() {
 	}
 
 	if interrupted {
-		vm.interruptLock.Lock()
-		v := &InterruptedError{
-			iface: vm.interruptVal,
+		vm.throwInterrupted()
+	}
+}
+
+func (vm *vm) throwInterrupted() {
+	vm.interruptLock.Lock()
+	v := &InterruptedError{
+		iface: vm.interruptVal,
+	}
+	v.stack = vm.captureStack(nil, 0)
+	vm.interruptLock.Unlock()
+	panic(v)
+}
+
+// runInstrumented is the same as run() but it also collects the coverage (see Runtime.SetCoverage) and calls
+// the execution hooks (see Runtime.SetExecutionHooks), whichever are enabled. The profiler samples are taken as well.
+func (vm *vm) runInstrumented() {
+	cov, hooks := vm.coverage, vm.hooks
+	var prg *Program
+	var hits []uint32
+	var pt *profTracker
+	registered := false
+	defer func() {
+		if registered {
+			vm.unregisterProfTracker()
+		}
+	}()
+	count := 0
+	for {
+		if pt == nil {
+			if count == 0 {
+				if pt = vm.profTracker; pt == nil && vm.profilingEnabled() {
+					pt = vm.registerProfTracker()
+					registered = true
+				}
+				count = 100
+			} else {
+				count--
+			}
+		}
+		if hooks != nil {
+			vm.syncHooks()
+		}
+		if atomic.LoadUint32(&vm.interrupted) != 0 {
+			vm.throwInterrupted()
+		}
+		pc := vm.pc
+		if pc < 0 || pc >= len(vm.prg.code) {
+			break
+		}
+		if cov != nil {
+			if vm.prg != prg {
+				prg = vm.prg
+				hits = cov.programHits(prg)
+			}
+			atomic.AddUint32(&hits[pc], 1)
+		}
+		if pt == nil {
+			vm.prg.code[pc].exec(vm)
+		} else if !vm.execProfiled(pt, pc) {
+			if registered {
+				vm.unregisterProfTracker()
+				registered = false
+			}
+			pt = nil
 		}
-		v.stack = vm.captureStack(nil, 0)
-		vm.interruptLock.Unlock()
-		panic(v)
 	}
 }
 
+func (vm *vm) profilingEnabled() bool {
+	return atomic.LoadInt32(&globalProfiler.enabled) == 1 || vm.rtProfiler.Load() != nil
+}
+
+func (vm *vm) registerProfTracker() *profTracker {
+	p := vm.activeProfiler()
+	if p == nil {
+		p = &globalProfiler.p
+	}
+	pt := p.registerVm()
+	vm.profTracker = pt
+	return pt
+}
+
+func (vm *vm) unregisterProfTracker() {
+	atomic.StoreInt32(&vm.profTracker.finished, 1)
+	vm.profTracker = nil
+}
+
 func (vm *vm) runWithProfiler() bool {
 	pt := vm.profTracker
 	if pt == nil {
-		pt = globalProfiler.p.registerVm()
-		vm.profTracker = pt
-		defer func() {
-			atomic.StoreInt32(&vm.profTracker.finished, 1)
-			vm.profTracker = nil
-		}()
+		pt = vm.registerProfTracker()
+		defer vm.unregisterProfTracker()
 	}
-	interrupted := false
 	for {
-		if interrupted = atomic.LoadUint32(&vm.interrupted) != 0; interrupted {
+		if atomic.LoadUint32(&vm.interrupted) != 0 {
 			return true
 		}
 		pc := vm.pc
 		if pc < 0 || pc >= len(vm.prg.code) {
 			break
 		}
-		vm.prg.code[pc].exec(vm)
-		req := atomic.LoadInt32(&pt.req)
-		if req == profReqStop {
+		if !vm.execProfiled(pt, pc) {
 			return true
 		}
-		if req == profReqDoSample {
-			pt.stop = time.Now()
-
-			pt.numFrames = len(vm.r.CaptureCallStack(len(pt.frames), pt.frames[:0]))
-			pt.frames[0].pc = pc
-			atomic.StoreInt32(&pt.req, profReqSampleReady)
-		}
 	}
 
 	return false
 }
 
+// execProfiled executes the instruction at pc and takes the profiler sample if it has been requested.
+// It returns false if the profiling has been stopped.
+func (vm *vm) execProfiled(pt *profTracker, pc int) bool {
+	var nativeCallee *Object
+	if pt.nativeFrames {
+		nativeCallee = vm.nativeCallee(pc)
+	}
+	vm.prg.code[pc].exec(vm)
+	req := atomic.LoadInt32(&pt.req)
+	if req == profReqStop {
+		return false
+	}
+	if req == profReqDoSample {
+		pt.stop = time.Now()
+
+		pt.numFrames = len(vm.r.CaptureCallStack(len(pt.frames), pt.frames[:0]))
+		pt.frames[0].pc = pc
+		if nativeCallee != nil {
+			pt.addNativeFrame(nativeCallee)
+		}
+		pt.labels = vm.profLabels
+		atomic.StoreInt32(&pt.req, profReqSampleReady)
+	}
+	return true
+}
+
 func (vm *vm) Interrupt(v interface{}) {
 	vm.interruptLock.Lock()
 	vm.interruptVal = v
@@ -728,16 +834,35 @@ func (vm *vm) captureStack(stack []StackFrame, ctxOffset int) []StackFrame {
 			stack = append(stack, StackFrame{prg: vm.callStack[i].prg, pc: frame.pc, funcName: funcName})
 		}
 	}
-	if ctxOffset == 0 && vm.curAsyncRunner != nil {
-		stack = vm.captureAsyncStack(stack, vm.curAsyncRunner)
+	if ctxOffset == 0 {
+		if vm.curAsyncRunner != nil {
+			stack = vm.captureAsyncStack(stack, vm.curAsyncRunner)
+		} else if reaction := vm.curReaction; reaction != nil && reaction.capability != nil {
+			stack = vm.capturePromiseStack(stack, reaction.capability.promise)
+		}
 	}
 	return stack
 }
 
+// captureAsyncStack appends the async frames of the functions awaiting the completion of the async function
+// run by the runner.
 func (vm *vm) captureAsyncStack(stack []StackFrame, runner *asyncRunner) []StackFrame {
-	if promise, _ := runner.promiseCap.promise.self.(*Promise); promise != nil {
-		if len(promise.fulfillReactions) == 1 {
-			if r := promise.fulfillReactions[0].asyncRunner; r != nil {
+	return vm.capturePromiseStack(stack, runner.promiseCap.promise)
+}
+
+// capturePromiseStack follows the chain of the promises which depend on p (i.e. the ones which are resolved with p,
+// the ones returned by p.then() and the ones returned by Promise.all() and the other combinators which p
+// is passed to) and appends an async frame for every async function awaiting them and for every combinator.
+// If there are multiple dependent promises, only the first one is followed.
+func (vm *vm) capturePromiseStack(stack []StackFrame, p *Object) []StackFrame {
+	for i := 0; p != nil && i < maxAsyncStackDepth; i++ {
+		promise, _ := p.self.(*Promise)
+		if promise == nil {
+			break
+		}
+		p = nil
+		for j, reaction := range promise.fulfillReactions {
+			if r := reaction.asyncRunner; r != nil {
 				ctx := &r.gen.ctx
 				if ctx.prg != nil || ctx.sb > 0 {
 					var funcName unistring.String
@@ -746,9 +871,27 @@ func (vm *vm) captureAsyncStack(stack []StackFrame, runner *asyncRunner) []Stack
 					} else {
 						funcName = getFuncName(ctx.stack, 1)
 					}
-					stack = append(stack, StackFrame{prg: ctx.prg, pc: ctx.pc, funcName: funcName})
+					stack = append(stack, StackFrame{prg: ctx.prg, pc: ctx.pc, funcName: funcName, async: true})
+				}
+				p = r.promiseCap.promise
+				break
+			}
+			if f := reaction.promiseFunc(); f != nil {
+				if f.combinator != "" {
+					stack = append(stack, StackFrame{funcName: f.combinator, async: true})
+				}
+				p = f.promise
+				break
+			}
+			if j < len(promise.rejectReactions) {
+				if f := promise.rejectReactions[j].promiseFunc(); f != nil {
+					p = f.promise
+					break
 				}
-				stack = vm.captureAsyncStack(stack, r)
+			}
+			if c := reaction.capability; c != nil {
+				p = c.promise
+				break
 			}
 		}
 	}
@@ -799,6 +942,10 @@ func (vm *vm) restoreStacks(iterLen, refLen uint32) (ex *Exception) {
 
 func (vm *vm) handleThrow(arg interface{}) *Exception {
 	ex := vm.exceptionFromValue(arg)
+	if vm.hooks != nil && ex != nil {
+		vm.hookException(ex)
+		defer vm.syncHooks()
+	}
 	for len(vm.tryStack) > 0 {
 		tf := &vm.tryStack[len(vm.tryStack)-1]
 		if tf.catchPos == -1 && tf.finallyPos == -1 || ex == nil && tf.catchPos != tryPanicMarker {
@@ -808,8 +955,8 @@ func (vm *vm) handleThrow(arg interface{}) *Exception {
 		}
 		if int(tf.callStackLen) < len(vm.callStack) {
 			ctx := &vm.callStack[tf.callStackLen]
-			vm.prg, vm.newTarget, vm.result, vm.pc, vm.sb, vm.args =
-				ctx.prg, ctx.newTarget, ctx.result, ctx.pc, ctx.sb, ctx.args
+			vm.r, vm.prg, vm.newTarget, vm.result, vm.pc, vm.sb, vm.args =
+				ctx.r, ctx.prg, ctx.newTarget, ctx.result, ctx.pc, ctx.sb, ctx.args
 			vm.callStack = vm.callStack[:tf.callStackLen]
 		}
 		vm.sp = int(tf.sp)
@@ -904,8 +1051,8 @@ func (vm *vm) peek() Value {
 }
 
 func (vm *vm) saveCtx(ctx *context) {
-	ctx.prg, ctx.stash, ctx.privEnv, ctx.newTarget, ctx.result, ctx.pc, ctx.sb, ctx.args =
-		vm.prg, vm.stash, vm.privEnv, vm.newTarget, vm.result, vm.pc, vm.sb, vm.args
+	ctx.r, ctx.prg, ctx.stash, ctx.privEnv, ctx.newTarget, ctx.result, ctx.pc, ctx.sb, ctx.args =
+		vm.r, vm.prg, vm.stash, vm.privEnv, vm.newTarget, vm.result, vm.pc, vm.sb, vm.args
 }
 
 func (vm *vm) pushCtx() {
@@ -920,8 +1067,8 @@ func (vm *vm) pushCtx() {
 }
 
 func (vm *vm) restoreCtx(ctx *context) {
-	vm.prg, vm.stash, vm.privEnv, vm.newTarget, vm.result, vm.pc, vm.sb, vm.args =
-		ctx.prg, ctx.stash, ctx.privEnv, ctx.newTarget, ctx.result, ctx.pc, ctx.sb, ctx.args
+	vm.r, vm.prg, vm.stash, vm.privEnv, vm.newTarget, vm.result, vm.pc, vm.sb, vm.args =
+		ctx.r, ctx.prg, ctx.stash, ctx.privEnv, ctx.newTarget, ctx.result, ctx.pc, ctx.sb, ctx.args
 }
 
 func (vm *vm) popCtx() {
@@ -1279,7 +1426,7 @@ func (_add) exec(vm *vm) {
 		if !isRightString {
 			rightString = right.toString()
 		}
-		ret = leftString.Concat(rightString)
+		ret = vm.r.stringAllocated(leftString.Concat(rightString))
 	} else {
 		switch left := left.(type) {
 		case valueInt:
@@ -2773,7 +2920,11 @@ func (_pushArraySpread) exec(vm *vm) {
 			vm.throw(vm.r.newError(vm.r.getRangeError(), "Invalid array length"))
 			return
 		}
+		c := cap(arr.values)
 		arr.values = append(arr.values, val)
+		if cap(arr.values) != c {
+			vm.allocated(allocArray, cap(arr.values)*allocValueSize)
+		}
 		arr.objCount++
 	})
 	vm.sp--
@@ -3530,7 +3681,7 @@ func (vm *vm) callEval(n int, strict bool) {
 		if n > 0 {
 			srcVal := vm.stack[vm.sp-n]
 			if src, ok := srcVal.(String); ok {
-				ret := vm.r.eval(src, true, strict)
+				ret := vm.r.eval(vm.r.checkCodeGeneration(CodeGenerationDirectEval, src), CodeGenerationDirectEval, strict)
 				vm.stack[vm.sp-n-2] = ret
 			} else {
 				vm.stack[vm.sp-n-2] = srcVal
@@ -5292,14 +5443,14 @@ func (n concatStrings) exec(vm *vm) {
 		for _, s := range strs {
 			buf.WriteString(string(s.(asciiString)))
 		}
-		vm.stack[vm.sp-1] = asciiString(buf.String())
+		vm.stack[vm.sp-1] = vm.r.stringAllocated(asciiString(buf.String()))
 	} else {
 		var buf unicodeStringBuilder
 		buf.Grow(length)
 		for _, s := range strs {
 			buf.writeString(s.(String))
 		}
-		vm.stack[vm.sp-1] = buf.String()
+		vm.stack[vm.sp-1] = vm.r.stringAllocated(buf.String())
 	}
 	vm.pc++
 }
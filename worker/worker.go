@@ -0,0 +1,351 @@
+/*
+Package worker runs goja Runtimes on dedicated goroutines and provides a Worker-like message passing API
+between them and Go code.
+
+Inside the worker script the following globals are available:
+
+	postMessage(value[, transfer]) // sends a copy of value to the Go side (see Worker.Receive)
+	onmessage                      // if set to a function, it's called with {data: value} for every incoming message
+	close()                        // terminates the worker after the current task
+	self                           // the global object
+
+The messages are copied using the structured clone algorithm (see goja.Runtime.StructuredSerialize), so Maps, Sets,
+Dates, typed arrays, cycles, etc. are preserved. ArrayBuffers listed in the transfer array are moved rather than
+copied.
+
+Every worker has its own event loop which is used to deliver messages, to run functions submitted with
+Worker.Submit and to settle Promises returned by asynchronous Go functions (see goja.Future).
+*/
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/dop251/goja"
+)
+
+// ErrTerminated is returned when the worker has been terminated either by calling Terminate() or by close() in
+// the script.
+var ErrTerminated = errors.New("worker terminated")
+
+// Option represents one of the options for the worker.
+type Option func(*options)
+
+type options struct {
+	setup        func(vm *goja.Runtime) error
+	errorHandler func(err error)
+}
+
+// WithSetup sets a function that is called on the worker goroutine before the script is run. It can be used to
+// add host functions to the Runtime. If it returns an error, the worker is terminated with that error.
+func WithSetup(setup func(vm *goja.Runtime) error) Option {
+	return func(opts *options) {
+		opts.setup = setup
+	}
+}
+
+// WithErrorHandler sets a function which is called (on the worker goroutine) when an exception is not handled
+// by onmessage or a submitted function. If not set, such an exception terminates the worker and is returned by Err().
+func WithErrorHandler(handler func(err error)) Option {
+	return func(opts *options) {
+		opts.errorHandler = handler
+	}
+}
+
+// Worker is a Runtime running on its own goroutine. All methods of Worker are goroutine-safe.
+type Worker struct {
+	opts options
+
+	jobs   queue // func()
+	outbox queue // *goja.SerializedValue posted by the script
+
+	vm *goja.Runtime
+
+	// serializer is used to copy the Go values passed to Send() on the caller's goroutine.
+	serializerMu sync.Mutex
+	serializer   *goja.Runtime
+
+	closeOnce  sync.Once
+	terminated chan struct{}
+	done       chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+// queue is an unbounded goroutine-safe FIFO queue.
+type queue struct {
+	mu     sync.Mutex
+	items  []interface{}
+	notify chan struct{}
+}
+
+func (q *queue) init() {
+	q.notify = make(chan struct{}, 1)
+}
+
+func (q *queue) push(item interface{}) {
+	q.mu.Lock()
+	q.items = append(q.items, item)
+	q.mu.Unlock()
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (q *queue) pop() (item interface{}, ok bool) {
+	q.mu.Lock()
+	if len(q.items) > 0 {
+		item, ok = q.items[0], true
+		q.items[0] = nil
+		q.items = q.items[1:]
+	}
+	q.mu.Unlock()
+	return
+}
+
+func (q *queue) clear() {
+	q.mu.Lock()
+	q.items = nil
+	q.mu.Unlock()
+}
+
+// New starts a new worker which runs the program and then processes incoming messages until terminated.
+func New(prg *goja.Program, opts ...Option) *Worker {
+	w := &Worker{
+		terminated: make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(&w.opts)
+	}
+	w.jobs.init()
+	w.outbox.init()
+	w.vm = goja.New()
+	go w.run(prg)
+	return w
+}
+
+func (w *Worker) setErr(err error) {
+	w.mu.Lock()
+	if w.err == nil {
+		w.err = err
+	}
+	w.mu.Unlock()
+}
+
+// Err returns the error which caused the worker to terminate, or nil if it's still running or has been terminated
+// with Terminate() or close().
+func (w *Worker) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// Done returns a channel which is closed when the worker goroutine exits.
+func (w *Worker) Done() <-chan struct{} {
+	return w.done
+}
+
+// Wait blocks until the worker goroutine exits and returns Err().
+func (w *Worker) Wait() error {
+	<-w.done
+	return w.Err()
+}
+
+// Terminate stops the worker. If the script is currently running, it is interrupted. Any pending messages and
+// submitted functions are discarded.
+func (w *Worker) Terminate() {
+	w.close()
+	w.vm.Interrupt(ErrTerminated)
+}
+
+// close stops the event loop after the current task.
+func (w *Worker) close() {
+	w.closeOnce.Do(func() {
+		close(w.terminated)
+	})
+}
+
+// Submit schedules fn to be run on the worker goroutine. Returns ErrTerminated if the worker is no longer running.
+// If fn panics with an error (such as a JavaScript *goja.Exception) it is handled in the same way as an exception
+// thrown by onmessage.
+func (w *Worker) Submit(fn func(vm *goja.Runtime)) error {
+	select {
+	case <-w.terminated:
+		return ErrTerminated
+	default:
+	}
+	w.jobs.push(func() {
+		fn(w.vm)
+	})
+	return nil
+}
+
+// Send posts a message to the worker. The message can be a *goja.SerializedValue (for example, one obtained from
+// Receive() of another worker) or any Go value. Go values are converted using goja.Runtime.ToValue() and serialized
+// using the structured clone algorithm before Send returns, so the worker never shares memory with the caller.
+// If the value cannot be cloned, the error is returned and nothing is sent.
+func (w *Worker) Send(v interface{}) error {
+	s, ok := v.(*goja.SerializedValue)
+	if !ok {
+		var err error
+		if s, err = w.serialize(v); err != nil {
+			return err
+		}
+	}
+	return w.Submit(func(vm *goja.Runtime) {
+		msg, err := vm.StructuredDeserialize(s)
+		if err != nil {
+			panic(err)
+		}
+		w.dispatchMessage(msg)
+	})
+}
+
+func (w *Worker) serialize(v interface{}) (*goja.SerializedValue, error) {
+	w.serializerMu.Lock()
+	defer w.serializerMu.Unlock()
+	if w.serializer == nil {
+		w.serializer = goja.New()
+	}
+	return w.serializer.StructuredSerialize(w.serializer.ToValue(v))
+}
+
+// Receive waits for the next message posted by the worker script with postMessage(). The result can be
+// deserialized into another Runtime, passed to another Worker using Send() or converted to a Go value using
+// Export(). Once the worker has exited and all messages have been received, Receive returns ErrTerminated
+// (or the error returned by Err()).
+func (w *Worker) Receive(ctx context.Context) (*goja.SerializedValue, error) {
+	for {
+		if msg, ok := w.outbox.pop(); ok {
+			return msg.(*goja.SerializedValue), nil
+		}
+		select {
+		case <-w.outbox.notify:
+		case <-w.done:
+			if msg, ok := w.outbox.pop(); ok {
+				return msg.(*goja.SerializedValue), nil
+			}
+			if err := w.Err(); err != nil {
+				return nil, err
+			}
+			return nil, ErrTerminated
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (w *Worker) handleError(err error) {
+	if errors.Is(err, ErrTerminated) {
+		w.close()
+		return
+	}
+	var interrupted *goja.InterruptedError
+	if w.opts.errorHandler != nil && !errors.As(err, &interrupted) {
+		w.opts.errorHandler(err)
+		return
+	}
+	w.setErr(err)
+	w.close()
+}
+
+func (w *Worker) runJob(job func()) {
+	defer func() {
+		if x := recover(); x != nil {
+			if err, ok := x.(error); ok {
+				w.handleError(err)
+				return
+			}
+			panic(x)
+		}
+	}()
+	job()
+}
+
+func (w *Worker) dispatchMessage(msg goja.Value) {
+	vm := w.vm
+	handler, ok := goja.AssertFunction(vm.Get("onmessage"))
+	if !ok {
+		return
+	}
+	event := vm.NewObject()
+	_ = event.Set("data", msg)
+	if _, err := handler(vm.GlobalObject(), event); err != nil {
+		panic(err)
+	}
+}
+
+func (w *Worker) postMessage(call goja.FunctionCall) goja.Value {
+	vm := w.vm
+	var transfer []goja.ArrayBuffer
+	if arg := call.Argument(1); !goja.IsUndefined(arg) && !goja.IsNull(arg) {
+		if err := vm.ExportTo(arg, &transfer); err != nil {
+			panic(vm.NewTypeError("Invalid transfer list: %v", err))
+		}
+	}
+	s, err := vm.StructuredSerialize(call.Argument(0), transfer...)
+	if err != nil {
+		panic(err)
+	}
+	w.outbox.push(s)
+	return goja.Undefined()
+}
+
+func (w *Worker) init() error {
+	vm := w.vm
+	vm.SetAsyncScheduler(func(job func()) {
+		w.jobs.push(job)
+	})
+	global := vm.GlobalObject()
+	if err := global.Set("self", global); err != nil {
+		return err
+	}
+	if err := global.Set("postMessage", w.postMessage); err != nil {
+		return err
+	}
+	if err := global.Set("onmessage", goja.Null()); err != nil {
+		return err
+	}
+	if err := global.Set("close", func() {
+		w.close()
+	}); err != nil {
+		return err
+	}
+	if w.opts.setup != nil {
+		return w.opts.setup(vm)
+	}
+	return nil
+}
+
+func (w *Worker) run(prg *goja.Program) {
+	defer close(w.done)
+	defer w.close()
+	if err := w.init(); err != nil {
+		w.setErr(err)
+		return
+	}
+	if _, err := w.vm.RunProgram(prg); err != nil {
+		w.handleError(err)
+	}
+	for {
+		select {
+		case <-w.terminated:
+			w.jobs.clear()
+			return
+		default:
+		}
+		if job, ok := w.jobs.pop(); ok {
+			w.runJob(job.(func()))
+			continue
+		}
+		select {
+		case <-w.jobs.notify:
+		case <-w.terminated:
+		}
+	}
+}
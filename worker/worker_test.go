@@ -0,0 +1,184 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+func receive(t *testing.T, w *Worker) interface{} {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	msg, err := w.Receive(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := msg.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestEcho(t *testing.T) {
+	w := New(goja.MustCompile("worker.js", `
+	onmessage = function(e) {
+		const m = e.data;
+		postMessage({sum: m.a + m.b, set: new Set(m.list), d: new Date(0)});
+	};
+	`, false))
+	defer w.Terminate()
+
+	if err := w.Send(map[string]interface{}{"a": 1, "b": 2, "list": []interface{}{1, 1, 2}}); err != nil {
+		t.Fatal(err)
+	}
+	res := receive(t, w).(map[string]interface{})
+	if res["sum"] != int64(3) {
+		t.Fatalf("sum: %v", res["sum"])
+	}
+	if set := res["set"].([]interface{}); len(set) != 2 {
+		t.Fatalf("set: %v", set)
+	}
+	if d := res["d"].(time.Time); d.UnixMilli() != 0 {
+		t.Fatalf("date: %v", d)
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	w1 := New(goja.MustCompile("w1.js", `
+	const buf = new Float64Array([1.5, 2.5]).buffer;
+	postMessage(buf, [buf]);
+	if (buf.byteLength !== 0) throw new Error("not detached");
+	`, false))
+	defer w1.Terminate()
+	w2 := New(goja.MustCompile("w2.js", `
+	onmessage = e => postMessage(new Float64Array(e.data).reduce((a, b) => a + b));
+	`, false))
+	defer w2.Terminate()
+
+	msg, err := w1.Receive(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w2.Send(msg); err != nil {
+		t.Fatal(err)
+	}
+	if res := receive(t, w2); res != int64(4) {
+		t.Fatalf("%v (%T)", res, res)
+	}
+}
+
+func TestFutureInWorker(t *testing.T) {
+	w := New(goja.MustCompile("worker.js", `
+	onmessage = async e => postMessage(await double(e.data));
+	`, false), WithSetup(func(vm *goja.Runtime) error {
+		return vm.Set("double", func(n int) *goja.Future {
+			return goja.Async(func() (interface{}, error) {
+				time.Sleep(5 * time.Millisecond)
+				return n * 2, nil
+			})
+		})
+	}))
+	defer w.Terminate()
+	if err := w.Send(21); err != nil {
+		t.Fatal(err)
+	}
+	if res := receive(t, w); res != int64(42) {
+		t.Fatal(res)
+	}
+}
+
+func TestTerminate(t *testing.T) {
+	w := New(goja.MustCompile("worker.js", `
+	onmessage = () => { for (;;) {} };
+	`, false))
+	if err := w.Send(nil); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	w.Terminate()
+	if err := w.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Receive(context.Background()); !errors.Is(err, ErrTerminated) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := w.Send(nil); !errors.Is(err, ErrTerminated) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	w := New(goja.MustCompile("worker.js", `
+	onmessage = e => { postMessage(e.data); close(); postMessage("after close"); };
+	`, false))
+	if err := w.Send("last"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if res := receive(t, w); res != "last" {
+		t.Fatal(res)
+	}
+	if res := receive(t, w); res != "after close" {
+		t.Fatal(res)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	w := New(goja.MustCompile("worker.js", `
+	onmessage = e => { throw new Error(e.data); };
+	`, false))
+	if err := w.Send("boom"); err != nil {
+		t.Fatal(err)
+	}
+	var ex *goja.Exception
+	if err := w.Wait(); !errors.As(err, &ex) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	errs := make(chan error, 1)
+	w = New(goja.MustCompile("worker.js", `
+	onmessage = e => { if (e.data === "fail") throw new Error("fail"); postMessage(e.data); };
+	`, false), WithErrorHandler(func(err error) {
+		errs <- err
+	}))
+	defer w.Terminate()
+	if err := w.Send("fail"); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errs; !errors.As(err, &ex) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := w.Send("ok"); err != nil {
+		t.Fatal(err)
+	}
+	if res := receive(t, w); res != "ok" {
+		t.Fatal(res)
+	}
+}
+
+func TestSendSerializesSynchronously(t *testing.T) {
+	w := New(goja.MustCompile("worker.js", `
+	onmessage = e => postMessage(e.data.a);
+	`, false))
+	defer w.Terminate()
+
+	var ex *goja.Exception
+	if err := w.Send(func() {}); !errors.As(err, &ex) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	m := map[string]interface{}{"a": 1}
+	if err := w.Send(m); err != nil {
+		t.Fatal(err)
+	}
+	m["a"] = 2
+	if res := receive(t, w); res != int64(1) {
+		t.Fatal(res)
+	}
+}